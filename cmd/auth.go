@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/keyring"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var authFile bool
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage stored API credentials",
+	Long: `Manage API credentials kept out of the config file.
+
+'auth login' stores the API key in the desktop keyring through the Secret
+Service (GNOME Keyring, KWallet, KeePassXC), or, where none is running, in
+$XDG_CONFIG_HOME/vic-ptv-cli/credentials.age (~/.config by default),
+encrypted with a passphrase. Only the developer ID is written to the config
+file.
+
+The encrypted file's passphrase is asked for on the terminal, or read from
+$` + keyring.PassphraseEnv + ` when there is none. The file is a standard
+age file and can also be read with 'age -d'.
+
+Keys given by --api-key, $PTV_API_KEY or apiKey in the config file take
+priority over a stored key.
+
+Each profile has its own developer ID, so keys for several IDs can be
+stored side by side: 'vic-ptv --profile work auth login'.`,
+	PersistentPreRunE: configPreRun,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Check and store a developer ID and API key",
+	Long: `Prompt for a developer ID and API key, check them against the PTV API and
+store the key in the keyring. Any plaintext apiKey in the config file is
+removed.
+
+The prompts are skipped for values given with --dev-id and --api-key.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in := bufio.NewReader(os.Stdin)
+		devID := flagDevID
+		if devID == "" {
+			current := config.DevID()
+			prompt := "Developer ID: "
+			if current != "" {
+				prompt = fmt.Sprintf("Developer ID [%s]: ", current)
+			}
+			line, err := readLine(in, prompt)
+			if err != nil {
+				return err
+			}
+			if devID = line; devID == "" {
+				devID = current
+			}
+		}
+		if devID == "" {
+			return fmt.Errorf("no developer ID given")
+		}
+
+		apiKey := flagAPIKey
+		if apiKey == "" {
+			var err error
+			if apiKey, err = readSecret(in, "API key: "); err != nil {
+				return err
+			}
+		}
+		if apiKey == "" {
+			return fmt.Errorf("no API key given")
+		}
+
+		if err := checkCredentials(devID, apiKey); err != nil {
+			return err
+		}
+
+		store, err := storeKey(devID, apiKey, authFile)
+		if err != nil {
+			return err
+		}
+
+		if err := config.SaveDevID(devID); err != nil {
+			return err
+		}
+		removed, err := config.RemoveAPIKey()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Logged in as developer ID %s; API key stored in the %s.\n", devID, store.Name())
+		if removed {
+			fmt.Printf("Removed the plaintext apiKey from %s.\n", config.ConfigFilePath())
+		}
+		return nil
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the stored API key",
+	Long: `Remove the API key for the configured developer ID from the keyring and
+the encrypted file, and any plaintext apiKey from the config file. The
+developer ID is kept.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		devID := flagDevID
+		if devID == "" {
+			devID = config.DevID()
+		}
+		if devID == "" {
+			return fmt.Errorf("no developer ID configured")
+		}
+
+		backends := config.KeyringBackends()
+		defer keyring.Close(backends)
+		var from []string
+		for _, b := range backends {
+			err := b.Delete(devID)
+			if errors.Is(err, keyring.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", b.Name(), err)
+			}
+			from = append(from, "the "+b.Name())
+		}
+		removed, err := config.RemoveAPIKey()
+		if err != nil {
+			return err
+		}
+		if removed {
+			from = append(from, config.ConfigFilePath())
+		}
+
+		if len(from) == 0 {
+			fmt.Printf("No API key was stored for developer ID %s.\n", devID)
+			return nil
+		}
+		fmt.Printf("Removed the API key for developer ID %s from %s.\n", devID, strings.Join(from, " and "))
+		return nil
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show where credentials come from and check them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(flagDevID, flagAPIKey)
+		if errors.Is(err, config.ErrNoCredentials) {
+			fmt.Println("Not logged in. Run 'vic-ptv auth login'.")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Developer ID: %s\n", cfg.DevID)
+		fmt.Printf("API key:      %s (from %s)\n", maskKey(cfg.APIKey), cfg.KeySource)
+		if err := checkCredentials(cfg.DevID, cfg.APIKey); err != nil {
+			fmt.Println("Status:       invalid")
+			return err
+		}
+		fmt.Println("Status:       valid")
+		return nil
+	},
+}
+
+// storeKey stores apiKey in the first keyring backend, or in the encrypted
+// file if toFile is set, returning where it went.
+func storeKey(devID, apiKey string, toFile bool) (keyring.Backend, error) {
+	backends := config.KeyringBackends()
+	defer keyring.Close(backends)
+	store := backends[0]
+	if toFile {
+		store = backends[len(backends)-1]
+	}
+	if err := store.Set(devID, apiKey); err != nil {
+		if _, ok := store.(*keyring.File); !ok {
+			return nil, fmt.Errorf("storing the key in the %s: %w (use --file to store it in an encrypted file instead)", store.Name(), err)
+		}
+		return nil, fmt.Errorf("storing the key in the %s: %w", store.Name(), err)
+	}
+	// A key left in a backend consulted earlier would shadow this one.
+	for _, b := range backends {
+		if b == store {
+			break
+		}
+		if err := b.Delete(devID); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return nil, fmt.Errorf("removing the old key from the %s: %w", b.Name(), err)
+		}
+	}
+	return store, nil
+}
+
+// checkCredentials makes a signed request to check that the API accepts
+// devID and apiKey.
+func checkCredentials(devID, apiKey string) error {
+	_, err := apiClient(devID, apiKey).RouteTypes()
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("the PTV API rejected developer ID %s with this API key; check both were copied correctly", devID)
+	}
+	if err != nil {
+		return fmt.Errorf("checking credentials: %w", err)
+	}
+	return nil
+}
+
+// maskKey hides all but the last four characters of an API key.
+func maskKey(key string) string {
+	return "****" + key[max(0, len(key)-4):]
+}
+
+// readLine prompts on stderr and reads a line from in.
+func readLine(in *bufio.Reader, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no input")
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readSecret prompts for a value without echoing it, or reads it as a line
+// when stdin is not a terminal.
+func readSecret(in *bufio.Reader, prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine(in, prompt)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func init() {
+	authLoginCmd.Flags().BoolVar(&authFile, "file", false, "Store the key in the encrypted file even if a Secret Service is running")
+
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd)
+	rootCmd.AddCommand(authCmd)
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/source"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boardRouteType int
+	boardRefresh   time.Duration
+	boardCycle     time.Duration
+)
+
+var boardCmd = &cobra.Command{
+	Use:   "board <stop>",
+	Short: "Show a full-screen departure board for a stop",
+	Long: `Show a full-screen, auto-refreshing departure board for a stop, styled like a
+station passenger information display. Disruption messages for the stop and
+the listed services are cycled along the bottom. Press Ctrl-C to exit.
+
+The stop is a stop ID or a stop name. --route-type is optional; when omitted,
+all modes serving the stop are shown.
+
+Route types: 0=Train, 1=Tram, 2=Bus, 3=V/Line Train, 4=V/Line Coach`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newSource()
+		if err != nil {
+			return err
+		}
+
+		routeType := -1
+		if cmd.Flags().Changed("route-type") {
+			routeType = boardRouteType
+		}
+		target, err := resolveStopTarget(client, args[0], routeType)
+		if err != nil {
+			return err
+		}
+		stopID := target.StopID
+		routeTypes, err := targetRouteTypes(client, target)
+		if err != nil {
+			return err
+		}
+		if boardRefresh < 5*time.Second {
+			return fmt.Errorf("--refresh must be at least 5s")
+		}
+		// The board redraws once a second, so shorter cycles would skip
+		// messages.
+		if boardCycle < time.Second {
+			return fmt.Errorf("--cycle must be at least 1s")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		board := &display.Board{StopName: fmt.Sprintf("Stop %d", stopID)}
+		// fetch queries the API and returns a function that updates the
+		// board, so the slow part runs off the loop that watches for Ctrl-C.
+		fetch := func() func() {
+			resp, err := departuresForStop(client, target, routeTypes, 10)
+			if err != nil {
+				return func() { board.Err = err }
+			}
+			var stopDisruptions []api.Disruption
+			if ds, ok := client.(source.DisruptionSource); ok {
+				if d, err := ds.DisruptionsByStop(stopID); err == nil {
+					stopDisruptions = d.Disruptions.AllDisruptions()
+				}
+			}
+			messages := boardMessages(resp, stopDisruptions)
+			return func() {
+				board.Err = nil
+				board.Departures = resp
+				board.Updated = time.Now()
+				if s, ok := resp.Stops[strconv.Itoa(stopID)]; ok {
+					board.StopName = s.StopName
+				}
+				board.Messages = messages
+			}
+		}
+		// Only one fetch runs at a time, so a buffer of one never blocks it,
+		// even after the board has been closed.
+		updates := make(chan func(), 1)
+		refreshing := false
+		refresh := func() {
+			refreshing = true
+			go func() { updates <- fetch() }()
+		}
+
+		screen := display.NewScreen()
+		screen.Enter()
+		defer screen.Exit()
+
+		refresh()
+		loaded := false
+		lastRefresh := time.Now()
+		start := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			now := time.Now()
+			if !refreshing && now.Sub(lastRefresh) >= boardRefresh {
+				refresh()
+				lastRefresh = now
+			}
+			if loaded {
+				width, height := display.TerminalSize()
+				page := int(now.Sub(start) / boardCycle)
+				screen.Draw(board.Render(now, width, height, page))
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case apply := <-updates:
+				apply()
+				refreshing = false
+				loaded = true
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// boardMessages returns the titles of the current disruptions at the stop
+// and those expanded in a departures response, listing those that affect
+// the soonest departures first.
+func boardMessages(resp *api.DeparturesResponse, stopDisruptions []api.Disruption) []string {
+	order := make(map[int]int)
+	for _, d := range resp.Departures {
+		for _, id := range d.DisruptionIDs {
+			if _, ok := order[id]; !ok {
+				order[id] = len(order)
+			}
+		}
+	}
+
+	all := make(map[int]api.Disruption)
+	for _, d := range resp.Disruptions {
+		all[d.DisruptionID] = d
+	}
+	for _, d := range stopDisruptions {
+		all[d.DisruptionID] = d
+	}
+	var current []api.Disruption
+	for _, d := range all {
+		if d.DisruptionStatus == "" || d.DisruptionStatus == "Current" {
+			current = append(current, d)
+		}
+	}
+	sort.Slice(current, func(i, j int) bool {
+		oi, iok := order[current[i].DisruptionID]
+		oj, jok := order[current[j].DisruptionID]
+		if iok != jok {
+			return iok
+		}
+		if iok {
+			return oi < oj
+		}
+		return current[i].DisruptionID < current[j].DisruptionID
+	})
+
+	msgs := make([]string, len(current))
+	for i, d := range current {
+		msgs[i] = display.PlainText(d.Title)
+	}
+	return msgs
+}
+
+func init() {
+	boardCmd.Flags().IntVar(&boardRouteType, "route-type", -1, "Route type (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach); inferred if omitted")
+	boardCmd.Flags().DurationVar(&boardRefresh, "refresh", 30*time.Second, "How often to re-query departures")
+	boardCmd.Flags().DurationVar(&boardCycle, "cycle", 8*time.Second, "How long each disruption message is shown")
+	rootCmd.AddCommand(boardCmd)
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/commute"
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/source"
+	"github.com/spf13/cobra"
+)
+
+// commuteDepartures is how many departures are fetched for each leg. Later
+// legs need enough to cover the whole span of the first leg's departures.
+const commuteDepartures = 10
+
+var (
+	commuteLimit int
+	commuteWatch time.Duration
+)
+
+var commuteCmd = &cobra.Command{
+	Use:   "commute [name]",
+	Short: "Show connections for a multi-leg commute",
+	Long: `Show the next connections for a commute defined in the config file, such as
+a tram then a train. Departures for each leg are fetched concurrently, and
+each run's stopping pattern gives its arrival time at the transfer stop, so
+only connections that leave enough time to change are shown.
+
+With no name, the configured commutes are listed.
+
+Commutes are configured under "commutes" in the config file:
+
+  commutes:
+    work:
+      - stop: 2504        # board the tram here
+        route: 722
+        direction: 5
+        alight: 2171      # optional; defaults to the next leg's stop
+      - stop: 1071        # then the train
+        route: 6
+        direction: 1
+        transfer: 5m      # minimum time to change onto this leg
+
+A leg may use "favourite: home-tram" in place of stop, route and direction.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			names, err := config.Commutes()
+			if err != nil {
+				return err
+			}
+			if flagJSON {
+				return display.JSON(names)
+			}
+			if len(names) == 0 {
+				fmt.Println("No commutes configured. See 'vic-ptv commute --help'.")
+				return nil
+			}
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return nil
+		}
+
+		name := args[0]
+		legs, err := config.LoadCommute(name)
+		if err != nil {
+			return err
+		}
+		client, err := newSource()
+		if err != nil {
+			return err
+		}
+
+		return runOrWatch(commuteWatch, func() error {
+			conns, err := commuteConnections(client, legs)
+			if err != nil {
+				return err
+			}
+			if len(conns) > commuteLimit {
+				conns = conns[:commuteLimit]
+			}
+
+			if flagJSON {
+				return display.JSON(conns)
+			}
+			display.CommuteConnections(name, conns)
+			return nil
+		})
+	},
+}
+
+// commuteConnections fetches departures for every leg concurrently, looks
+// up arrival times from run patterns, and joins them into connections.
+func commuteConnections(client source.Source, legs []config.Leg) ([]commute.Connection, error) {
+	joined := make([]commute.Leg, len(legs))
+	errs := make([]error, len(legs))
+	var wg sync.WaitGroup
+	for i, l := range legs {
+		wg.Add(1)
+		go func(i int, l config.Leg) {
+			defer wg.Done()
+			trips, err := legTrips(client, l)
+			joined[i] = commute.Leg{Transfer: l.Transfer, Trips: trips}
+			errs[i] = err
+		}(i, l)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %w", i+1, err)
+		}
+	}
+	return commute.Connections(joined), nil
+}
+
+// legTrips returns the trips available on a leg, with arrival times at the
+// leg's alighting stop when it has one.
+func legTrips(client source.Source, l config.Leg) ([]commute.Trip, error) {
+	target := stopTarget{StopID: l.StopID, RouteType: -1, RouteID: l.RouteID, DirectionID: l.DirectionID}
+	if l.RouteType != nil {
+		target.RouteType = *l.RouteType
+	}
+	routeTypes, err := targetRouteTypes(client, target)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := departuresForStop(client, target, routeTypes, commuteDepartures)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := make([]commute.Trip, len(resp.Departures))
+	errs := make([]error, len(resp.Departures))
+	var wg sync.WaitGroup
+	for i, d := range resp.Departures {
+		route, ok := resp.Routes[strconv.Itoa(d.RouteID)]
+		label := fmt.Sprintf("route %d", d.RouteID)
+		if ok {
+			label = tripLabel(route)
+		}
+		trips[i] = commute.Trip{Label: label, Depart: d.DepartureTime()}
+		if l.AlightID == 0 || d.RunRef == "" {
+			continue
+		}
+		routeType := route.RouteType
+		if run, ok := resp.Runs[d.RunRef]; ok {
+			routeType = run.RouteType
+		}
+		wg.Add(1)
+		go func(i int, d api.Departure, routeType int) {
+			defer wg.Done()
+			trips[i].Arrive, trips[i].Alight, errs[i] = arrivalAt(client, d, routeType, l.AlightID)
+		}(i, d, routeType)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return trips, nil
+}
+
+// arrivalAt returns when the run of departure d reaches stop alightID, and
+// the stop's name, from the run's stopping pattern. It returns the zero
+// time if the run does not call there after d's stop.
+func arrivalAt(client source.Source, d api.Departure, routeType, alightID int) (time.Time, string, error) {
+	pattern, err := client.Pattern(d.RunRef, routeType)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	boarded := false
+	for _, p := range pattern.Departures {
+		if p.StopID == d.StopID {
+			boarded = true
+			continue
+		}
+		if boarded && p.StopID == alightID {
+			return p.DepartureTime(), pattern.Stops[strconv.Itoa(alightID)].StopName, nil
+		}
+	}
+	return time.Time{}, "", nil
+}
+
+// tripLabel describes a route for a connection, such as "tram 96" or
+// "train Lilydale".
+func tripLabel(r api.RouteInfo) string {
+	mode := strings.ToLower(display.RouteTypeName(r.RouteType))
+	if r.RouteNumber != "" {
+		return mode + " " + r.RouteNumber
+	}
+	return mode + " " + r.RouteName
+}
+
+func init() {
+	commuteCmd.Flags().IntVar(&commuteLimit, "limit", 5, "Maximum number of connections to show")
+	addWatchFlag(commuteCmd, &commuteWatch)
+	rootCmd.AddCommand(commuteCmd)
+}
@@ -1,40 +1,394 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/bls/vic-ptv-cli/internal/api"
 	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
 	"github.com/spf13/cobra"
 )
 
+// maxClockSkew is how far the local clock may drift from the API server's
+// before 'config validate' warns about it.
+const maxClockSkew = time.Minute
+
 var configCmd = &cobra.Command{
 	Use:   "config",
-	Short: "Show current configuration",
-	Long:  `Display the current configuration including credential status and config file location.`,
+	Short: "Show and manage configuration",
+	Long: `Display the current configuration including credential status, config file
+location and profiles.
+
+Subcommands create, edit and check the config file. They act on the active
+profile, chosen with --profile or $PTV_PROFILE.`,
+	PersistentPreRunE: configPreRun,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfgPath := config.ConfigFilePath()
+		if flagJSON {
+			return display.JSON(config.ProfileSummaries())
+		}
 		fmt.Printf("Config file: %s\n", cfgPath)
+		fmt.Printf("Profile: %s\n", config.Profile())
 
+		defer func() {
+			fmt.Println()
+			var list []display.Profile
+			for _, p := range config.ProfileSummaries() {
+				list = append(list, display.Profile{Name: p.Name, DevID: p.DevID, BaseURL: p.BaseURL, Active: p.Active})
+			}
+			display.ProfilesList(list)
+		}()
+		if err := config.CheckProfile(); err != nil {
+			fmt.Printf("\nStatus: %v\n", err)
+			return nil
+		}
 		cfg, err := config.Load(flagDevID, flagAPIKey)
 		if err != nil {
 			fmt.Println("Developer ID: not set")
 			fmt.Println("API Key: not set")
 			fmt.Println("\nStatus: not configured")
-			fmt.Println("\nRun 'ptv' with no arguments for setup instructions.")
+			fmt.Println("\nRun 'vic-ptv config init' or 'vic-ptv auth login' to set up credentials.")
 			return nil
 		}
 
-		// Mask the credentials for display
-		maskedDevID := cfg.DevID
-		maskedKey := "****" + cfg.APIKey[max(0, len(cfg.APIKey)-4):]
-
-		fmt.Printf("Developer ID: %s\n", maskedDevID)
-		fmt.Printf("API Key: %s\n", maskedKey)
+		fmt.Printf("Developer ID: %s\n", cfg.DevID)
+		fmt.Printf("API Key: %s (from %s)\n", maskKey(cfg.APIKey), cfg.KeySource)
+		if cfg.BaseURL != "" {
+			fmt.Printf("Base URL: %s\n", cfg.BaseURL)
+		}
 		fmt.Println("\nStatus: configured")
 		return nil
 	},
 }
 
+// configPreRun replaces the root command's setup for the commands that
+// write the config file. A broken config file must not stop the commands
+// that fix it, so display settings fall back to their defaults, and the
+// active profile need not exist yet, as writing to it creates it.
+func configPreRun(cmd *cobra.Command, args []string) error {
+	display.SetWide(flagWide)
+	config.SetConfigFile(flagConfig)
+	if err := config.UseProfile(flagProfile); err != nil {
+		return err
+	}
+	d, _ := config.LoadDisplay(flagTimezone, flagTimeFormat, flagDateFormat)
+	if display.ConfigureTime(d.Timezone, d.TimeFormat, d.DateFormat) != nil {
+		return display.ConfigureTime(config.DefaultTimezone, config.DefaultTimeFormat, config.DefaultDateFormat)
+	}
+	return nil
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create or update the config file interactively",
+	Long: `Ask for each setting in turn and write the answers to the config file.
+Press Enter to keep the value shown in brackets.
+
+The API key is checked against the PTV API and, unless you choose
+otherwise, stored in the keyring as by 'vic-ptv auth login' rather than in
+the config file.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in := bufio.NewReader(os.Stdin)
+		fmt.Fprintf(os.Stderr, "Writing %s. Press Enter to keep the value in brackets.\n\n", config.ConfigFilePath())
+
+		var devID, apiKey string
+		for _, v := range config.SettingValues() {
+			current := v.Value
+			if v.Secret && v.IsSet {
+				current = maskKey(current)
+			}
+			prompt := v.Description
+			if current != "" {
+				prompt += fmt.Sprintf(" [%s]", current)
+			}
+			prompt += ": "
+
+			var answer string
+			for {
+				var err error
+				if v.Secret {
+					answer, err = readSecret(in, prompt)
+				} else {
+					answer, err = readLine(in, prompt)
+				}
+				if err != nil {
+					return err
+				}
+				if answer == "" {
+					break
+				}
+				if err := v.Check(answer); err != nil {
+					fmt.Fprintf(os.Stderr, "  %v\n", err)
+					continue
+				}
+				break
+			}
+
+			switch {
+			case v.Key == "devId":
+				devID = answer
+				if devID == "" {
+					devID = v.Value
+				}
+			case v.Key == "apiKey":
+				apiKey = answer
+			case answer != "" && (v.IsSet || answer != v.Default):
+				if err := config.Set(v.Key, answer); err != nil {
+					return err
+				}
+			}
+		}
+
+		if devID != "" {
+			if err := config.SaveDevID(devID); err != nil {
+				return err
+			}
+		}
+		if apiKey != "" {
+			if devID == "" {
+				return fmt.Errorf("an API key needs a developer ID")
+			}
+			if err := checkCredentials(devID, apiKey); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			answer, err := readLine(in, "Store the API key in the keyring rather than the config file? [Y/n]: ")
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(strings.ToLower(answer), "n") {
+				if err := config.Set("apiKey", apiKey); err != nil {
+					return err
+				}
+			} else {
+				store, err := storeKey(devID, apiKey, false)
+				if err != nil {
+					return err
+				}
+				if _, err := config.RemoveAPIKey(); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "API key stored in the %s.\n", store.Name())
+			}
+		}
+		fmt.Printf("Wrote %s\n", config.ConfigFilePath())
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Show settings",
+	Long: `Print the value of a setting, or list every setting with its value when no
+key is given. Settings that are not in the config file show their default.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			value, _, err := config.Get(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(value)
+			return nil
+		}
+		values := config.SettingValues()
+		if flagJSON {
+			m := make(map[string]string, len(values))
+			for _, v := range values {
+				if v.IsSet && !v.Secret {
+					m[v.Key] = v.Value
+				}
+			}
+			return display.JSON(m)
+		}
+		list := make([]display.Setting, len(values))
+		for i, v := range values {
+			list[i] = display.Setting{Key: v.Key, Value: v.Value, Description: v.Description, IsSet: v.IsSet, Secret: v.Secret}
+		}
+		display.SettingsList(list)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a setting",
+	Long: `Check a value and write it to the config file, keeping the file's comments
+and layout. 'vic-ptv config get' lists the settings.
+
+Example:
+  vic-ptv config set timeFormat 12h
+  vic-ptv config set defaults.routeType 1`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return config.Set(args[0], args[1])
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a setting, restoring its default",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		removed, err := config.Unset(args[0])
+		if err != nil {
+			return err
+		}
+		if !removed {
+			fmt.Printf("%s was not set\n", args[0])
+		}
+		return nil
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the config file location",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(config.ConfigFilePath())
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open the config file in an editor",
+	Long: `Open the config file in $VISUAL or $EDITOR (vi if neither is set), creating
+it if need be, and check it once the editor exits.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgPath := config.ConfigFilePath()
+		if _, err := os.Stat(cfgPath); errors.Is(err, os.ErrNotExist) {
+			if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+				return err
+			}
+			// An empty file is not valid JSON.
+			var empty []byte
+			if strings.EqualFold(filepath.Ext(cfgPath), ".json") {
+				empty = []byte("{}\n")
+			}
+			if err := os.WriteFile(cfgPath, empty, 0o600); err != nil {
+				return err
+			}
+		}
+
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		// The editor may carry arguments, as in EDITOR="code --wait".
+		fields := strings.Fields(editor)
+		ed := exec.Command(fields[0], append(fields[1:], cfgPath)...)
+		ed.Stdin, ed.Stdout, ed.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := ed.Run(); err != nil {
+			return fmt.Errorf("running %s: %w", editor, err)
+		}
+
+		if problems := config.Validate(); len(problems) > 0 {
+			printProblems(problems)
+			return fmt.Errorf("%s has problems; run 'vic-ptv config edit' again to fix them", cfgPath)
+		}
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file and credentials",
+	Long: `Check every setting in the config file, then make a signed request to the
+PTV API with the configured credentials.
+
+A refused request is explained: either the developer ID and key do not
+match, or this computer's clock is wrong.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgPath := config.ConfigFilePath()
+		problems := config.Validate()
+		if err := config.CheckProfile(); err != nil {
+			problems = append(problems, err)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("Config file: %s OK\n", cfgPath)
+		} else {
+			fmt.Printf("Config file: %s\n", cfgPath)
+			printProblems(problems)
+		}
+
+		cfg, err := config.Load(flagDevID, flagAPIKey)
+		if errors.Is(err, config.ErrNoCredentials) {
+			fmt.Println("Credentials: not configured; run 'vic-ptv auth login'")
+			return fmt.Errorf("no credentials to check")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Credentials: developer ID %s, API key from %s\n", cfg.DevID, cfg.KeySource)
+
+		client := api.NewClient(cfg.DevID, cfg.APIKey)
+		if cfg.BaseURL != "" {
+			client.BaseURL = cfg.BaseURL
+		}
+		sent := time.Now()
+		serverTime, err := client.ServerTime()
+		skew := time.Duration(0)
+		if !serverTime.IsZero() {
+			// The Date header is truncated to the second and stamped while
+			// the request was in flight.
+			skew = sent.Add(time.Since(sent) / 2).Sub(serverTime).Round(time.Second)
+		}
+		badClock := skew > maxClockSkew || skew < -maxClockSkew
+
+		var apiErr *api.APIError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden && badClock:
+			fmt.Printf("API: request refused (HTTP 403), and this computer's clock is %s.\n", describeSkew(skew))
+			fmt.Println("  Correct the clock, for example by turning on network time (NTP), and try again.")
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden:
+			fmt.Printf("API: request refused (HTTP 403): the signature made with this API key was not accepted for developer ID %s.\n", cfg.DevID)
+			fmt.Println("  Check that devId is the number and apiKey the UUID from PTV's email, with no extra")
+			fmt.Println("  spaces or quotes, and that they were issued together. A new key can take a few hours")
+			fmt.Println("  to start working.")
+		case err != nil:
+			fmt.Printf("API: %v\n", err)
+		case badClock:
+			fmt.Printf("API: OK, but this computer's clock is %s; correct it to avoid refused requests.\n", describeSkew(skew))
+		default:
+			fmt.Println("API: OK")
+		}
+
+		if err != nil || len(problems) > 0 {
+			return fmt.Errorf("configuration is not valid")
+		}
+		return nil
+	},
+}
+
+// describeSkew says how far the local clock is from the server's.
+func describeSkew(skew time.Duration) string {
+	if skew < 0 {
+		return fmt.Sprintf("%s behind the server's", -skew)
+	}
+	return fmt.Sprintf("%s ahead of the server's", skew)
+}
+
+func printProblems(problems []error) {
+	for _, p := range problems {
+		fmt.Printf("  %v\n", p)
+	}
+}
+
 func init() {
+	configCmd.AddCommand(configInitCmd, configGetCmd, configSetCmd, configUnsetCmd, configPathCmd, configEditCmd, configValidateCmd)
 	rootCmd.AddCommand(configCmd)
 }
@@ -1,55 +1,102 @@
 package cmd
 
 import (
-	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/ical"
 	"github.com/spf13/cobra"
 )
 
 var (
 	departuresRouteType int
 	departuresLimit     int
+	departuresRoute     string
+	departuresDirection int
+	departuresWatch     time.Duration
+	departuresFormat    string
 )
 
 var departuresCmd = &cobra.Command{
-	Use:   "departures <stop_id>",
+	Use:   "departures <stop>",
 	Short: "Show upcoming departures from a stop",
-	Long: `Show upcoming departures from a stop. Requires a stop ID and route type.
+	Long: `Show upcoming departures from a stop. The stop is a stop ID or a stop name
+such as "Flinders Street".
+
+--route-type is optional. Without it, the route type is taken from the
+matched stop, or for a stop ID looked up (and cached) from the modes serving
+it. At interchanges served by several modes, departures for all of them are
+merged into one table with a MODE column.
+
+The stop may also be a saved favourite such as @home-tram (see 'vic-ptv fav'),
+in which case its route and direction filters are applied too. --route and
+--direction override the favourite's.
+
+--format ics writes the departures as an iCalendar file, each a short event
+with the stop and platform as its location.
 
 Route types: 0=Train, 1=Tram, 2=Bus, 3=V/Line Train, 4=V/Line Coach`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := newClient()
+		format, err := outputFormat(departuresFormat, departuresWatch)
 		if err != nil {
 			return err
 		}
-
-		stopID, err := strconv.Atoi(args[0])
+		client, err := newSource()
 		if err != nil {
-			return fmt.Errorf("invalid stop_id %q: must be a number", args[0])
+			return err
 		}
 
-		if !cmd.Flags().Changed("route-type") {
-			return fmt.Errorf("--route-type is required (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach)")
+		routeType := -1
+		if cmd.Flags().Changed("route-type") {
+			routeType = departuresRouteType
 		}
-
-		resp, err := client.Departures(departuresRouteType, stopID, departuresLimit)
+		target, err := resolveStopTarget(client, args[0], routeType)
 		if err != nil {
 			return err
 		}
-
-		if flagJSON {
-			return display.JSON(resp)
+		if departuresRoute != "" {
+			if target.RouteID, err = resolveRoute(client, departuresRoute); err != nil {
+				return err
+			}
 		}
-		display.DeparturesList(resp)
-		return nil
+		if cmd.Flags().Changed("direction") {
+			target.DirectionID = departuresDirection
+		}
+		routeTypes, err := targetRouteTypes(client, target)
+		if err != nil {
+			return err
+		}
+
+		return runOrWatch(departuresWatch, func() error {
+			resp, err := departuresForStop(client, target, routeTypes, departuresLimit)
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case formatJSON:
+				return display.JSON(resp)
+			case formatICS:
+				name := "Departures"
+				if s, ok := resp.Stops[strconv.Itoa(target.StopID)]; ok && s.StopName != "" {
+					name += " from " + s.StopName
+				}
+				return writeICS(name, ical.DepartureEvents(resp))
+			}
+			display.DeparturesList(resp)
+			return nil
+		})
 	},
 }
 
 func init() {
-	departuresCmd.Flags().IntVar(&departuresRouteType, "route-type", -1, "Route type (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach)")
+	departuresCmd.Flags().IntVar(&departuresRouteType, "route-type", -1, "Route type (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach); inferred if omitted")
 	departuresCmd.Flags().IntVar(&departuresLimit, "limit", 5, "Maximum number of departures to show")
+	departuresCmd.Flags().StringVar(&departuresRoute, "route", "", "Only show departures on this route (ID or name)")
+	departuresCmd.Flags().IntVar(&departuresDirection, "direction", 0, "Only show departures in this direction ID")
+	addWatchFlag(departuresCmd, &departuresWatch)
+	addFormatFlag(departuresCmd, &departuresFormat)
 	rootCmd.AddCommand(departuresCmd)
 }
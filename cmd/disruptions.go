@@ -2,21 +2,43 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/cache"
 	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/disruption"
+	"github.com/bls/vic-ptv-cli/internal/ical"
 	"github.com/spf13/cobra"
 )
 
 var (
-	disruptionsRoute int
-	disruptionsStop  int
+	disruptionsRoute     string
+	disruptionsStop      string
+	disruptionsWatch     time.Duration
+	disruptionsSinceLast bool
+	disruptionsFormat    string
 )
 
+// disruptionsSeenCacheFile holds the disruptions last reported by
+// --since-last, keyed by the route or stop filter used.
+const disruptionsSeenCacheFile = "disruptions-seen.json"
+
 var disruptionsCmd = &cobra.Command{
 	Use:   "disruptions",
 	Short: "Show current disruptions",
-	Long:  `Show current service disruptions across the PTV network. Optionally filter by route or stop.`,
+	Long: `Show current service disruptions across the PTV network. Optionally filter by
+route or stop, given as an ID or a name.
+
+With --since-last, show only what has changed since the previous
+--since-last run with the same filter: new disruptions, disruptions updated
+since, and disruptions no longer listed (resolved). The first run reports
+every disruption as new.
+
+--format ics writes the disruptions as an iCalendar file, each an event
+spanning the dates it is in effect, for importing planned works into a
+calendar. 'vic-ptv serve' offers the same as a live feed to subscribe to.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		client, err := newClient()
 		if err != nil {
@@ -29,53 +51,127 @@ var disruptionsCmd = &cobra.Command{
 		if routeChanged && stopChanged {
 			return fmt.Errorf("specify either --route or --stop, not both")
 		}
+		if disruptionsSinceLast && disruptionsWatch > 0 {
+			return fmt.Errorf("--since-last cannot be combined with --watch; run it periodically instead")
+		}
+		format, err := outputFormat(disruptionsFormat, disruptionsWatch)
+		if err != nil {
+			return err
+		}
+		if disruptionsSinceLast && format == formatICS {
+			return fmt.Errorf("--since-last cannot be combined with --format ics")
+		}
 
-		var disruptions []Disruption
+		var routeID, stopID int
 		if routeChanged {
-			resp, err := client.DisruptionsByRoute(disruptionsRoute)
-			if err != nil {
+			if routeID, err = resolveRoute(client, disruptionsRoute); err != nil {
 				return err
 			}
-			if flagJSON {
-				return display.JSON(resp)
+		}
+		if stopChanged {
+			if stopID, _, err = resolveStop(client, disruptionsStop, -1); err != nil {
+				return err
+			}
+		}
+
+		fetch := func() (*api.DisruptionsResponse, error) {
+			switch {
+			case routeChanged:
+				return client.DisruptionsByRoute(routeID)
+			case stopChanged:
+				return client.DisruptionsByStop(stopID)
 			}
-			disruptions = resp.Disruptions.AllDisruptions()
-		} else if stopChanged {
-			resp, err := client.DisruptionsByStop(disruptionsStop)
+			return client.Disruptions()
+		}
+
+		if disruptionsSinceLast {
+			resp, err := fetch()
 			if err != nil {
 				return err
 			}
-			if flagJSON {
-				return display.JSON(resp)
-			}
-			disruptions = resp.Disruptions.AllDisruptions()
-		} else {
-			resp, err := client.Disruptions()
+			return showDisruptionsSinceLast(fmt.Sprintf("route:%d/stop:%d", routeID, stopID), resp.Disruptions.AllDisruptions(), format == formatJSON)
+		}
+
+		return runOrWatch(disruptionsWatch, func() error {
+			resp, err := fetch()
 			if err != nil {
 				return err
 			}
-			if flagJSON {
+			switch format {
+			case formatJSON:
 				return display.JSON(resp)
+			case formatICS:
+				return writeICS("PTV disruptions", ical.DisruptionEvents(resp.Disruptions.AllDisruptions()))
 			}
-			disruptions = resp.Disruptions.AllDisruptions()
+			display.DisruptionsList(resp.Disruptions.AllDisruptions())
+			return nil
+		})
+	},
+}
+
+// showDisruptionsSinceLast reports the changes since the disruptions last
+// seen under key, as JSON if asJSON, then remembers the current ones.
+func showDisruptionsSinceLast(key string, current []api.Disruption, asJSON bool) error {
+	seen := make(map[string]*disruption.Seen)
+	if _, err := cache.Load(disruptionsSeenCacheFile, &seen); err != nil {
+		return err
+	}
+	var before []api.Disruption
+	var since time.Time
+	if prev, ok := seen[key]; ok {
+		before, since = prev.Disruptions, prev.Checked
+	}
+	changes := disruption.Compare(before, current)
+
+	if asJSON {
+		if err := display.JSON(changes); err != nil {
+			return err
 		}
+	} else {
+		display.DisruptionChanges(changes, since)
+	}
+
+	seen[key] = disruption.NewSeen(current, time.Now())
+	return cache.Save(disruptionsSeenCacheFile, seen)
+}
 
-		display.DisruptionsList(disruptions)
+var disruptionsDiffCmd = &cobra.Command{
+	Use:   "diff <snapshot-a> <snapshot-b>",
+	Short: "Compare two saved disruption snapshots",
+	Long: `Show the disruptions that are new, updated or resolved in snapshot-b compared
+with snapshot-a. Snapshots are JSON files saved from 'vic-ptv disruptions
+--json' (or the flat lists served by 'vic-ptv serve').`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		before, err := disruption.LoadSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		after, err := disruption.LoadSnapshot(args[1])
+		if err != nil {
+			return err
+		}
+		changes := disruption.Compare(before, after)
+		if flagJSON {
+			return display.JSON(changes)
+		}
+		display.DisruptionChanges(changes, time.Time{})
 		return nil
 	},
 }
 
 func init() {
-	disruptionsCmd.Flags().IntVar(&disruptionsRoute, "route", 0, "Filter by route ID")
-	disruptionsCmd.Flags().IntVar(&disruptionsStop, "stop", 0, "Filter by stop ID")
+	disruptionsCmd.Flags().StringVar(&disruptionsRoute, "route", "", "Filter by route ID or name")
+	disruptionsCmd.Flags().StringVar(&disruptionsStop, "stop", "", "Filter by stop ID or name")
 	_ = disruptionsCmd.RegisterFlagCompletionFunc("route", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	})
 	_ = disruptionsCmd.RegisterFlagCompletionFunc("stop", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	})
+	disruptionsCmd.Flags().BoolVar(&disruptionsSinceLast, "since-last", false, "Only show disruptions new, updated or resolved since the last --since-last run")
+	addWatchFlag(disruptionsCmd, &disruptionsWatch)
+	addFormatFlag(disruptionsCmd, &disruptionsFormat)
+	disruptionsCmd.AddCommand(disruptionsDiffCmd)
 	rootCmd.AddCommand(disruptionsCmd)
 }
-
-// Disruption is re-exported for use in this file to avoid fully qualifying.
-type Disruption = api.Disruption
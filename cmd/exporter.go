@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/exporter"
+	"github.com/spf13/cobra"
+)
+
+// minExporterInterval keeps the exporter from polling the API too hard.
+const minExporterInterval = 15 * time.Second
+
+var (
+	exporterStops    []string
+	exporterRoutes   []string
+	exporterListen   string
+	exporterInterval time.Duration
+	exporterLimit    int
+)
+
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Export service health as Prometheus metrics",
+	Long: `Poll departures and disruptions every --interval and serve Prometheus metrics
+on /metrics:
+
+  ptv_departure_delay_seconds        histogram of departure delays by stop and
+                                     route, observed once per run as it leaves
+  ptv_departures_total               departures seen leaving
+  ptv_disruptions_active             current disruptions by mode and type
+  ptv_api_health                     health in the last API response status
+  ptv_api_request_duration_seconds   API latency by endpoint
+  ptv_api_requests_total             API requests by endpoint and HTTP status
+
+Departures are watched at the --stops given (IDs or names), optionally only
+for the --routes given. Without --stops, only the disruption and API metrics
+are exported.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exporterInterval < minExporterInterval {
+			return fmt.Errorf("--interval must be at least %s", minExporterInterval)
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		opts := exporter.Options{Limit: exporterLimit}
+		for _, arg := range exporterStops {
+			id, rt, err := resolveStop(client, arg, -1)
+			if err != nil {
+				return err
+			}
+			routeTypes, err := stopRouteTypesOrFlag(client, id, rt)
+			if err != nil {
+				return err
+			}
+			opts.Stops = append(opts.Stops, exporter.Stop{ID: id, RouteTypes: routeTypes})
+		}
+		for _, arg := range exporterRoutes {
+			id, err := resolveRoute(client, arg)
+			if err != nil {
+				return err
+			}
+			opts.Routes = append(opts.Routes, id)
+		}
+
+		exp := exporter.New(client, opts)
+		if err := exp.Poll(time.Now()); err != nil {
+			log.Printf("poll failed: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			ticker := time.NewTicker(exporterInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := exp.Poll(time.Now()); err != nil {
+						log.Printf("poll failed: %v", err)
+					}
+				}
+			}
+		}()
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", exp)
+		srv := &http.Server{Addr: exporterListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+		}()
+
+		log.Printf("serving metrics for %d stops on http://%s/metrics", len(opts.Stops), exporterListen)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	exporterCmd.Flags().StringSliceVar(&exporterStops, "stops", nil, "Stops to watch departures at (IDs or names, comma-separated)")
+	exporterCmd.Flags().StringSliceVar(&exporterRoutes, "routes", nil, "Only watch departures on these routes (IDs or names, comma-separated)")
+	exporterCmd.Flags().StringVar(&exporterListen, "listen", "localhost:9464", "Address to serve /metrics on")
+	exporterCmd.Flags().DurationVar(&exporterInterval, "interval", time.Minute, "How often to poll the API")
+	exporterCmd.Flags().IntVar(&exporterLimit, "limit", 10, "Departures to fetch per stop and mode")
+	rootCmd.AddCommand(exporterCmd)
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/source"
+	"github.com/spf13/cobra"
+)
+
+var (
+	favStop      string
+	favRouteType int
+	favRoute     string
+	favDirection int
+)
+
+var favCmd = &cobra.Command{
+	Use:   "fav",
+	Short: "Manage saved favourites",
+	Long: `Manage favourites: named stops with optional route and direction filters,
+saved in the config file.
+
+Any stop or route argument accepts a favourite as @name, for example:
+  vic-ptv departures @home-tram`,
+}
+
+var favAddCmd = &cobra.Command{
+	Use:   "add <name> --stop <stop>",
+	Short: "Save a favourite",
+	Long: `Save a favourite, replacing any existing one with the same name. Names use
+lowercase letters, digits, '-' and '_'.
+
+--stop and --route accept IDs or names, which are resolved to IDs when the
+favourite is saved. --route-type is optional; with --route it defaults to the
+route's type, and otherwise the stop's modes are inferred when it is used.
+
+Example:
+  vic-ptv fav add home-tram --stop 2504 --route-type 1 --route 96 --direction 5`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateFavouriteName(name); err != nil {
+			return err
+		}
+
+		// Only talk to the API when something has to be looked up, so
+		// favourites can be saved from IDs without credentials.
+		var client source.Source
+		if !isID(favStop) || (favRoute != "" && (!isID(favRoute) || !cmd.Flags().Changed("route-type"))) {
+			var err error
+			if client, err = newSource(); err != nil {
+				return err
+			}
+		}
+
+		routeType := -1
+		if cmd.Flags().Changed("route-type") {
+			routeType = favRouteType
+		}
+		target, err := resolveStopTarget(client, favStop, routeType)
+		if err != nil {
+			return err
+		}
+		if favRoute != "" {
+			if target.RouteID, err = resolveRoute(client, favRoute); err != nil {
+				return err
+			}
+			if target.RouteType < 0 {
+				if target.RouteType, err = routeTypeOf(client, target.RouteID); err != nil {
+					return err
+				}
+			}
+		}
+		if cmd.Flags().Changed("direction") {
+			target.DirectionID = favDirection
+		}
+
+		f := config.Favourite{StopID: target.StopID, RouteID: target.RouteID, DirectionID: target.DirectionID}
+		// A stop found by name carries the route type it was matched
+		// under, but only pin it when it was asked for or implied by a
+		// route, so multi-mode stops keep showing every mode.
+		if target.RouteType >= 0 && (routeType >= 0 || target.RouteID > 0) {
+			rt := target.RouteType
+			f.RouteType = &rt
+		}
+		if err := config.SaveFavourite(name, f); err != nil {
+			return err
+		}
+		fmt.Printf("Saved @%s (stop %d)\n", name, f.StopID)
+		return nil
+	},
+}
+
+var favListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved favourites",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		favs, err := config.Favourites()
+		if err != nil {
+			return err
+		}
+		if flagJSON {
+			return display.JSON(favs)
+		}
+		list := make([]display.Favourite, 0, len(favs))
+		for _, name := range config.FavouriteNames(favs) {
+			f := favs[name]
+			list = append(list, display.Favourite{Name: name, StopID: f.StopID, RouteType: f.RouteType, RouteID: f.RouteID, DirectionID: f.DirectionID})
+		}
+		display.FavouritesList(list)
+		return nil
+	},
+}
+
+var favRmCmd = &cobra.Command{
+	Use:     "rm <name>",
+	Aliases: []string{"remove"},
+	Short:   "Remove a saved favourite",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.TrimPrefix(args[0], "@")
+		if err := config.RemoveFavourite(name); err != nil {
+			return err
+		}
+		fmt.Printf("Removed @%s\n", name)
+		return nil
+	},
+}
+
+// isID reports whether a stop or route argument is a numeric ID.
+func isID(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil
+}
+
+func init() {
+	favAddCmd.Flags().StringVar(&favStop, "stop", "", "Stop ID or name")
+	favAddCmd.Flags().IntVar(&favRouteType, "route-type", -1, "Route type (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach)")
+	favAddCmd.Flags().StringVar(&favRoute, "route", "", "Only show departures on this route (ID or name)")
+	favAddCmd.Flags().IntVar(&favDirection, "direction", 0, "Only show departures in this direction ID")
+	favAddCmd.MarkFlagRequired("stop")
+
+	favCmd.AddCommand(favAddCmd, favListCmd, favRmCmd)
+	rootCmd.AddCommand(favCmd)
+}
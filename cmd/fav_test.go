@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bls/vic-ptv-cli/internal/config"
+)
+
+func TestFavAddFromIDs(t *testing.T) {
+	// With no credentials, any attempt to reach the API fails the command.
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("PTV_DEV_ID", "")
+	t.Setenv("PTV_API_KEY", "")
+	cfg := filepath.Join(dir, "config.yaml")
+
+	rootCmd.SetArgs([]string{"--config", cfg, "fav", "add", "home-tram", "--stop", "2504", "--route-type", "1", "--route", "96", "--direction", "5"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("fav add: %v", err)
+	}
+
+	config.SetConfigFile(cfg)
+	f, err := config.LookupFavourite("home-tram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.StopID != 2504 || f.RouteID != 96 || f.DirectionID != 5 || f.RouteType == nil || *f.RouteType != 1 {
+		t.Errorf("saved %+v, want stop 2504, route type 1, route 96, direction 5", f)
+	}
+}
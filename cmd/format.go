@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/ical"
+	"github.com/spf13/cobra"
+)
+
+// Output formats for commands with a --format flag.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatICS   = "ics"
+)
+
+// addFormatFlag registers the --format flag on cmd.
+func addFormatFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVar(format, "format", formatTable, "Output format: table, json or ics (iCalendar)")
+}
+
+// outputFormat checks format, treating --json as --format json. An
+// iCalendar file cannot be redrawn in place, so ics excludes --watch.
+func outputFormat(format string, watch time.Duration) (string, error) {
+	switch format {
+	case formatTable, formatJSON, formatICS:
+	default:
+		return "", fmt.Errorf("unknown --format %q (use table, json or ics)", format)
+	}
+	if format == formatICS && flagJSON {
+		return "", fmt.Errorf("use either --json or --format ics, not both")
+	}
+	if format == formatICS && watch > 0 {
+		return "", fmt.Errorf("--format ics cannot be combined with --watch")
+	}
+	if flagJSON && format == formatTable {
+		format = formatJSON
+	}
+	return format, nil
+}
+
+// writeICS writes events to stdout as a calendar named name.
+func writeICS(name string, events []ical.Event) error {
+	return ical.Write(os.Stdout, name, events, time.Now())
+}
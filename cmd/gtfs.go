@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/gtfs"
+	"github.com/spf13/cobra"
+)
+
+var gtfsCmd = &cobra.Command{
+	Use:   "gtfs",
+	Short: "Manage the offline GTFS timetable",
+	Long: `Manage a local copy of PTV's GTFS timetable, used to answer routes, route,
+stop, search, departures and plan without the API when --offline is given.
+
+Departures answered offline are scheduled times only; there is no realtime
+information. Stop IDs match the API's, but route and direction IDs are
+numbered by the import (routes from 1000001), so route IDs from the API,
+including those saved in favourites, are refused offline; use route names
+instead.
+
+The timetable is published by PTV on the Victorian open data portal
+(https://discover.data.vic.gov.au, "Timetable and geographic information -
+GTFS").`,
+}
+
+var gtfsImportCmd = &cobra.Command{
+	Use:   "import <zip>",
+	Short: "Import a GTFS zip, replacing any earlier import",
+	Long: `Import a GTFS zip into the local timetable, replacing any earlier import.
+Either a single feed or PTV's combined zip of numbered per-mode feeds is
+accepted. Importing the full PTV timetable takes a few minutes.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := gtfs.DefaultPath()
+		if path == "" {
+			return fmt.Errorf("could not determine the cache directory")
+		}
+		stats, err := gtfs.Import(args[0], path, func(msg string) {
+			fmt.Fprintf(os.Stderr, "%s...\n", msg)
+		})
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			return display.JSON(stats)
+		}
+		fmt.Printf("Imported %d stops, %d routes, %d trips and %d stop times from %d feeds.\n",
+			stats.Stops, stats.Routes, stats.Trips, stats.StopTimes, stats.Feeds)
+		return nil
+	},
+}
+
+var gtfsInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show details of the imported timetable",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := gtfs.Open(gtfs.DefaultPath())
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		info, err := store.Info()
+		if err != nil {
+			return err
+		}
+
+		if flagJSON {
+			return display.JSON(info)
+		}
+		display.GTFSInfo(info)
+		return nil
+	},
+}
+
+func init() {
+	gtfsCmd.AddCommand(gtfsImportCmd, gtfsInfoCmd)
+	rootCmd.AddCommand(gtfsCmd)
+}
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/gtfs"
+	"github.com/bls/vic-ptv-cli/internal/gtfsrt"
+	"github.com/spf13/cobra"
+)
+
+// GTFS-Realtime feed names, used as dump arguments and serve paths.
+const (
+	feedTripUpdates      = "trip-updates"
+	feedVehiclePositions = "vehicle-positions"
+	feedAlerts           = "alerts"
+)
+
+var feedNames = []string{feedTripUpdates, feedVehiclePositions, feedAlerts}
+
+// minGTFSRTInterval keeps the server from polling the API too hard.
+const minGTFSRTInterval = 15 * time.Second
+
+var (
+	gtfsrtStops    []string
+	gtfsrtLimit    int
+	gtfsrtListen   string
+	gtfsrtInterval time.Duration
+	gtfsrtOutput   string
+)
+
+var gtfsrtCmd = &cobra.Command{
+	Use:   "gtfsrt",
+	Short: "Publish PTV realtime data as GTFS-Realtime feeds",
+	Long: `Convert PTV realtime departures, vehicle positions and disruptions into
+GTFS-Realtime TripUpdates, VehiclePositions and ServiceAlerts feeds.
+
+PTV's API reports realtime data per stop, so feeds cover the departures from
+the stops given with --stop (IDs, names or @favourites), or from every
+favourite's stop if none are given. Alerts cover the whole network.
+
+Route IDs are the GTFS route IDs PTV reports. Trip IDs are matched to the
+imported GTFS timetable when there is one (see 'vic-ptv gtfs'); otherwise
+they are PTV run refs.`,
+}
+
+var gtfsrtDumpCmd = &cobra.Command{
+	Use:   "dump <trip-updates|vehicle-positions|alerts>",
+	Short: "Write one GTFS-Realtime feed",
+	Long: `Write one GTFS-Realtime feed as a protocol buffer, or as JSON with --json,
+to stdout or to the file given with -o. The output setting in the config
+file does not apply, as the feed is binary.`,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: feedNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The feed is binary, so "output: json" in the config file does not
+		// apply; only an explicit --json does.
+		asJSON := cmd.Flags().Changed("json") && flagJSON
+		if !asJSON && gtfsrtOutput == "" && term.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("not writing a binary feed to the terminal; use -o <file> or --json")
+		}
+
+		b, err := newGTFSRTBuilder([]string{args[0]})
+		if err != nil {
+			return err
+		}
+		defer b.close()
+		feeds, err := b.build(time.Now())
+		if err != nil {
+			return err
+		}
+		feed := feeds[args[0]]
+
+		if gtfsrtOutput != "" {
+			data := feed.Marshal()
+			if asJSON {
+				if data, err = json.MarshalIndent(feed, "", "  "); err != nil {
+					return err
+				}
+				data = append(data, '\n')
+			}
+			return os.WriteFile(gtfsrtOutput, data, 0o644)
+		}
+		if asJSON {
+			return display.JSON(feed)
+		}
+		_, err = os.Stdout.Write(feed.Marshal())
+		return err
+	},
+}
+
+var gtfsrtServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve GTFS-Realtime feeds over HTTP",
+	Long: `Serve GTFS-Realtime feeds over HTTP, refreshed from the API every --interval:
+
+  /trip-updates       TripUpdates
+  /vehicle-positions  VehiclePositions
+  /alerts             ServiceAlerts
+
+Feeds are protocol buffers; add ?format=json for JSON. If a refresh fails
+the previous feeds are served until the next one succeeds.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if gtfsrtInterval < minGTFSRTInterval {
+			return fmt.Errorf("--interval must be at least %s", minGTFSRTInterval)
+		}
+		b, err := newGTFSRTBuilder(feedNames)
+		if err != nil {
+			return err
+		}
+		defer b.close()
+
+		srv := &gtfsrtServer{}
+		if err := srv.refresh(b); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			ticker := time.NewTicker(gtfsrtInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := srv.refresh(b); err != nil {
+						log.Printf("refresh failed, serving previous feeds: %v", err)
+					}
+				}
+			}
+		}()
+
+		mux := http.NewServeMux()
+		for _, name := range feedNames {
+			mux.HandleFunc("GET /"+name, srv.handler(name))
+		}
+		httpSrv := &http.Server{Addr: gtfsrtListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpSrv.Shutdown(shutdown)
+		}()
+
+		log.Printf("serving GTFS-Realtime feeds for %d stops on http://%s/", len(b.stops), gtfsrtListen)
+		if err := httpSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+// gtfsrtBuilder fetches what the requested feeds need and converts it.
+type gtfsrtBuilder struct {
+	client *api.Client
+	store  *gtfs.Store
+	conv   *gtfsrt.Converter
+	stops  []int
+	feeds  map[string]bool
+	// routeTypes are the modes serving each stop, looked up once up front.
+	routeTypes map[int][]int
+}
+
+// newGTFSRTBuilder resolves the stops to cover and opens the timetable for
+// trip matching, if one has been imported.
+func newGTFSRTBuilder(feeds []string) (*gtfsrtBuilder, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	b := &gtfsrtBuilder{
+		client:     client,
+		conv:       &gtfsrt.Converter{Location: display.Location()},
+		feeds:      make(map[string]bool),
+		routeTypes: make(map[int][]int),
+	}
+	for _, f := range feeds {
+		b.feeds[f] = true
+	}
+
+	if b.feeds[feedTripUpdates] || b.feeds[feedVehiclePositions] {
+		if b.stops, err = gtfsrtStopIDs(client); err != nil {
+			return nil, err
+		}
+		for _, id := range b.stops {
+			if b.routeTypes[id], err = stopRouteTypes(client, id); err != nil {
+				return nil, err
+			}
+		}
+		if store, err := gtfs.Open(gtfs.DefaultPath()); err == nil {
+			b.store = store
+			b.conv.Matcher = store
+		}
+	}
+	return b, nil
+}
+
+func (b *gtfsrtBuilder) close() {
+	if b.store != nil {
+		b.store.Close()
+	}
+}
+
+// gtfsrtStopIDs resolves the --stop arguments, or the favourites' stops.
+func gtfsrtStopIDs(client *api.Client) ([]int, error) {
+	args := gtfsrtStops
+	if len(args) == 0 {
+		favs, err := config.Favourites()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range config.FavouriteNames(favs) {
+			args = append(args, "@"+name)
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("no stops to cover; pass --stop or save favourites with 'vic-ptv fav add'")
+		}
+	}
+
+	seen := make(map[int]bool)
+	var ids []int
+	for _, arg := range args {
+		id, _, err := resolveStop(client, arg, -1)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// build fetches and converts the feeds, keyed by feed name.
+func (b *gtfsrtBuilder) build(now time.Time) (map[string]*gtfsrt.FeedMessage, error) {
+	feeds := make(map[string]*gtfsrt.FeedMessage)
+	if b.feeds[feedTripUpdates] || b.feeds[feedVehiclePositions] {
+		resp, err := b.departures()
+		if err != nil {
+			return nil, err
+		}
+		if b.feeds[feedTripUpdates] {
+			feeds[feedTripUpdates] = gtfsrt.NewFeed(now, b.conv.TripUpdates(resp))
+		}
+		if b.feeds[feedVehiclePositions] {
+			feeds[feedVehiclePositions] = gtfsrt.NewFeed(now, b.conv.VehiclePositions(resp, now))
+		}
+	}
+	if b.feeds[feedAlerts] {
+		resp, err := b.client.Disruptions()
+		if err != nil {
+			return nil, err
+		}
+		feeds[feedAlerts] = gtfsrt.NewFeed(now, gtfsrt.Alerts(resp.Disruptions.AllDisruptions()))
+	}
+	return feeds, nil
+}
+
+// departures fetches realtime departures for every mode at every stop and
+// merges them into one response.
+func (b *gtfsrtBuilder) departures() (*api.DeparturesResponse, error) {
+	var resps []*api.DeparturesResponse
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, stopID := range b.stops {
+		for _, rt := range b.routeTypes[stopID] {
+			wg.Add(1)
+			go func(stopID, rt int) {
+				defer wg.Done()
+				resp, err := b.client.RealtimeDepartures(rt, stopID, gtfsrtLimit)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+				resps = append(resps, resp)
+			}(stopID, rt)
+		}
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return api.MergeDepartures(resps...), nil
+}
+
+// gtfsrtServer holds the latest feeds for serving.
+type gtfsrtServer struct {
+	mu    sync.RWMutex
+	feeds map[string]*gtfsrt.FeedMessage
+	raw   map[string][]byte
+}
+
+// refresh rebuilds the feeds, keeping the previous ones on failure.
+func (s *gtfsrtServer) refresh(b *gtfsrtBuilder) error {
+	feeds, err := b.build(time.Now())
+	if err != nil {
+		return err
+	}
+	raw := make(map[string][]byte, len(feeds))
+	for name, f := range feeds {
+		raw[name] = f.Marshal()
+	}
+	s.mu.Lock()
+	s.feeds, s.raw = feeds, raw
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *gtfsrtServer) handler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		feed, raw := s.feeds[name], s.raw[name]
+		s.mu.RUnlock()
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(feed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(raw)
+	}
+}
+
+func init() {
+	gtfsrtCmd.PersistentFlags().StringArrayVar(&gtfsrtStops, "stop", nil, "Stop to cover (ID, name or @favourite); repeatable (default: every favourite's stop)")
+	gtfsrtCmd.PersistentFlags().IntVar(&gtfsrtLimit, "limit", 10, "Departures to fetch per stop and mode")
+	gtfsrtDumpCmd.Flags().StringVarP(&gtfsrtOutput, "output", "o", "", "Write the feed to this file instead of stdout")
+	gtfsrtServeCmd.Flags().StringVar(&gtfsrtListen, "listen", "localhost:8080", "Address to listen on")
+	gtfsrtServeCmd.Flags().DurationVar(&gtfsrtInterval, "interval", 30*time.Second, "How often to refresh the feeds from the API")
+
+	gtfsrtCmd.AddCommand(gtfsrtDumpCmd, gtfsrtServeCmd)
+	rootCmd.AddCommand(gtfsrtCmd)
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/mcp"
+	"github.com/bls/vic-ptv-cli/internal/source"
+	"github.com/spf13/cobra"
+)
+
+// maxMCPDepartures caps the departures an assistant may ask for.
+const maxMCPDepartures = 50
+
+const mcpInstructions = `Tools for Public Transport Victoria (Melbourne and regional Victoria): trains, trams, buses and V/Line.
+Stops and routes can be given by ID or by name, such as "Richmond" or "tram 96". If a name matches several, the error lists the candidates with their IDs; pick one and call again with its ID.
+Route types: 0=Train, 1=Tram, 2=Bus, 3=V/Line Train, 4=V/Line Coach. Pass route_type to narrow a stop name to one mode, e.g. route_type 0 for "the next train from Richmond".
+Times are Melbourne local time.`
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve PTV tools to AI assistants over MCP",
+	Long: `Serve PTV data to AI assistants as Model Context Protocol tools over stdio.
+Configure your assistant to run 'vic-ptv mcp' as an MCP server.
+
+Tools: search, departures, stop, route, disruptions and fare. Their input and
+output schemas are advertised to the assistant, and results are compact JSON
+rather than raw API responses.
+
+With --offline, the tools answer from the imported GTFS timetable, and
+disruptions and fare are not offered.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, err := newSource()
+		if err != nil {
+			return err
+		}
+		// Stdin carries the protocol, so ambiguous names are reported to
+		// the assistant rather than prompted for.
+		noPrompt = true
+
+		s := mcp.NewServer("vic-ptv", rootCmd.Version, mcpInstructions)
+		addMCPTools(s, src)
+		if !flagOffline {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			addMCPAPITools(s, client)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return s.Serve(ctx, os.Stdin, os.Stdout)
+	},
+}
+
+type mcpSearchArgs struct {
+	Query     string `json:"query" jsonschema:"Stop, station or route name to search for"`
+	RouteType *int   `json:"route_type,omitempty" jsonschema:"Only return results of this route type"`
+}
+
+type mcpDeparturesArgs struct {
+	Stop      string `json:"stop" jsonschema:"Stop ID or name"`
+	RouteType *int   `json:"route_type,omitempty" jsonschema:"Only departures of this route type; all modes at the stop if omitted"`
+	Route     string `json:"route,omitempty" jsonschema:"Only departures on this route (ID or name, such as \"tram 96\" or \"Lilydale line\")"`
+	Direction int    `json:"direction,omitempty" jsonschema:"Only departures in this direction ID"`
+	Limit     int    `json:"limit,omitempty" jsonschema:"Maximum departures per mode, 1 to 50 (default 5)"`
+}
+
+type mcpStopArgs struct {
+	Stop      string `json:"stop" jsonschema:"Stop ID or name"`
+	RouteType *int   `json:"route_type,omitempty" jsonschema:"Route type of the stop; every mode serving it if omitted"`
+}
+
+type mcpRouteArgs struct {
+	Route string `json:"route" jsonschema:"Route ID or name, such as \"tram 96\" or \"Lilydale line\""`
+}
+
+type mcpDisruptionsArgs struct {
+	Route string `json:"route,omitempty" jsonschema:"Only disruptions on this route (ID or name)"`
+	Stop  string `json:"stop,omitempty" jsonschema:"Only disruptions at this stop (ID or name)"`
+	ID    int    `json:"id,omitempty" jsonschema:"Fetch this one disruption"`
+}
+
+type mcpFareArgs struct {
+	MinZone int `json:"min_zone" jsonschema:"Lowest myki zone travelled in"`
+	MaxZone int `json:"max_zone" jsonschema:"Highest myki zone travelled in"`
+}
+
+// optionalRouteType returns the route type argument, or -1 if absent.
+func optionalRouteType(rt *int) int {
+	if rt == nil {
+		return -1
+	}
+	return *rt
+}
+
+// addMCPTools adds the tools that work from any source.
+func addMCPTools(s *mcp.Server, src source.Source) {
+	mcp.AddTool(s, "search", "Search for stops and routes by name.",
+		func(ctx context.Context, args mcpSearchArgs) (*mcp.SearchResult, error) {
+			var routeTypes []int
+			if args.RouteType != nil {
+				routeTypes = []int{*args.RouteType}
+			}
+			resp, err := src.Search(args.Query, routeTypes)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewSearchResult(resp), nil
+		})
+
+	mcp.AddTool(s, "departures", "Upcoming departures from a stop, with realtime estimates where available.",
+		func(ctx context.Context, args mcpDeparturesArgs) (*mcp.DeparturesResult, error) {
+			if args.Limit == 0 {
+				args.Limit = 5
+			}
+			if args.Limit < 1 || args.Limit > maxMCPDepartures {
+				return nil, fmt.Errorf("limit must be between 1 and %d", maxMCPDepartures)
+			}
+			target, err := resolveStopTarget(src, args.Stop, optionalRouteType(args.RouteType))
+			if err != nil {
+				return nil, err
+			}
+			if args.Route != "" {
+				if target.RouteID, err = resolveRoute(src, args.Route); err != nil {
+					return nil, err
+				}
+			}
+			target.DirectionID = args.Direction
+			routeTypes, err := targetRouteTypes(src, target)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := departuresForStop(src, target, routeTypes, args.Limit)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewDeparturesResult(target.StopID, resp, display.Location(), time.Now()), nil
+		})
+
+	mcp.AddTool(s, "stop", "Details of a stop: location, station type, amenities and accessibility.",
+		func(ctx context.Context, args mcpStopArgs) (*mcp.StopResult, error) {
+			stopID, routeType, err := resolveStop(src, args.Stop, optionalRouteType(args.RouteType))
+			if err != nil {
+				return nil, err
+			}
+			routeTypes, err := stopRouteTypesOrFlag(src, stopID, routeType)
+			if err != nil {
+				return nil, err
+			}
+			r := &mcp.StopResult{Stops: []mcp.StopDetails{}}
+			for _, rt := range routeTypes {
+				resp, err := src.Stop(stopID, rt)
+				if err != nil {
+					return nil, err
+				}
+				r.Stops = append(r.Stops, mcp.NewStopDetails(resp.Stop))
+			}
+			return r, nil
+		})
+
+	mcp.AddTool(s, "route", "Details and current service status of a route.",
+		func(ctx context.Context, args mcpRouteArgs) (*mcp.Route, error) {
+			routeID, err := resolveRoute(src, args.Route)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := src.Route(routeID)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewRoute(resp.Route), nil
+		})
+}
+
+// addMCPAPITools adds the tools that need the live API.
+func addMCPAPITools(s *mcp.Server, client *api.Client) {
+	mcp.AddTool(s, "disruptions", "Current and planned service disruptions, across the network or for one route or stop.",
+		func(ctx context.Context, args mcpDisruptionsArgs) (*mcp.DisruptionsResult, error) {
+			loc := display.Location()
+			var resp *api.DisruptionsResponse
+			var err error
+			switch {
+			case args.ID > 0:
+				if resp, err = client.Disruptions(); err != nil {
+					return nil, err
+				}
+				for _, d := range resp.Disruptions.AllDisruptions() {
+					if d.DisruptionID == args.ID {
+						return mcp.NewDisruptionsResult([]api.Disruption{d}, loc), nil
+					}
+				}
+				return nil, fmt.Errorf("no current or planned disruption %d", args.ID)
+			case args.Route != "" && args.Stop != "":
+				return nil, fmt.Errorf("give either route or stop, not both")
+			case args.Route != "":
+				var routeID int
+				if routeID, err = resolveRoute(client, args.Route); err != nil {
+					return nil, err
+				}
+				resp, err = client.DisruptionsByRoute(routeID)
+			case args.Stop != "":
+				var stopID int
+				if stopID, _, err = resolveStop(client, args.Stop, -1); err != nil {
+					return nil, err
+				}
+				resp, err = client.DisruptionsByStop(stopID)
+			default:
+				resp, err = client.Disruptions()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewDisruptionsResult(resp.Disruptions.AllDisruptions(), loc), nil
+		})
+
+	mcp.AddTool(s, "fare", "Estimated myki fares for travel between two zones.",
+		func(ctx context.Context, args mcpFareArgs) (*mcp.FareResult, error) {
+			resp, err := client.FareEstimate(args.MinZone, args.MaxZone)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewFareResult(resp), nil
+		})
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/cache"
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/notify"
+	"github.com/spf13/cobra"
+)
+
+// minNotifyInterval keeps the notifier from polling the API too hard.
+const minNotifyInterval = 15 * time.Second
+
+// notifyMemory is how long a sent alert is remembered after it last
+// matched, so that it is not sent again.
+const notifyMemory = 48 * time.Hour
+
+// notifySentCache is the cache file recording which alerts have been sent.
+const notifySentCache = "notify-sent.json"
+
+var (
+	notifyInterval time.Duration
+	notifyOnce     bool
+	notifyDryRun   bool
+	notifyLimit    int
+)
+
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Send alerts for disruptions, delays and cancellations",
+	Long: `Watch for what the rules in the notify section of the config file describe
+and send alerts to its sinks: a JSON webhook, a Slack-compatible incoming
+webhook, an ntfy topic or the desktop (notify-send).
+
+  notify:
+    sinks:
+      phone:  {type: ntfy, url: https://ntfy.sh/my-commute}
+      laptop: {type: desktop}
+    rules:
+      - name: tram-96            # a disruption affects route 96
+        when: disruption
+        route: tram 96
+      - name: morning-train      # the 08:02 is more than 5 minutes late
+        when: delay
+        stop: "@home-train"
+        departure: "08:02"
+        delay: 5m
+        sinks: [phone]
+      - name: flinders           # a departure from stop 1071 is cancelled
+        when: cancelled
+        stop: 1071
+
+Each alert is sent once to each sink; see 'vic-ptv notify run'.`,
+}
+
+var notifyRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Evaluate the notify rules every --interval and send alerts",
+	Long: `Evaluate the notify rules every --interval, fetching disruptions and realtime
+departures as they need, and send each new alert to the rule's sinks.
+
+Sent alerts are remembered in the cache directory, so an alert is not sent
+again while it keeps matching, including across restarts. A sink that fails
+is retried on the next poll.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if notifyInterval < minNotifyInterval {
+			return fmt.Errorf("--interval must be at least %s", minNotifyInterval)
+		}
+		cfg, err := config.LoadNotify()
+		if err != nil {
+			return err
+		}
+		if len(cfg.Rules) == 0 {
+			return fmt.Errorf("no notify rules in the config file; see 'vic-ptv notify --help'")
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		rules, err := resolveNotifyRules(client, cfg)
+		if err != nil {
+			return err
+		}
+		sinks, err := notifySinks(cfg, nil)
+		if err != nil {
+			return err
+		}
+		sent := notify.Sent{}
+		if _, err := cache.Load(notifySentCache, &sent); err != nil {
+			log.Printf("forgetting sent alerts: %v", err)
+		}
+		n := notify.New(client, rules, sinks, sent, notifyLimit)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		poll := func() {
+			now := time.Now()
+			alerts, err := n.Evaluate(display.Location(), now)
+			if err != nil {
+				log.Print(err)
+			}
+			if notifyDryRun {
+				for _, a := range alerts {
+					for _, s := range a.Sinks {
+						if !sent.Has(a.Key, s) {
+							log.Printf("would send to %s: %s: %s", s, a.Title, a.Message)
+						}
+					}
+				}
+				return
+			}
+			count, err := n.Send(ctx, alerts)
+			if err != nil {
+				log.Print(err)
+			}
+			if count > 0 {
+				log.Printf("sent %d notifications", count)
+			}
+			sent.Prune(now.Add(-notifyMemory))
+			if err := cache.Save(notifySentCache, sent); err != nil {
+				log.Printf("saving sent alerts: %v", err)
+			}
+		}
+
+		if !notifyOnce {
+			log.Printf("evaluating %d notify rules every %s", len(rules), notifyInterval)
+		}
+		poll()
+		if notifyOnce {
+			return nil
+		}
+		ticker := time.NewTicker(notifyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				poll()
+			}
+		}
+	},
+}
+
+var notifyTestCmd = &cobra.Command{
+	Use:   "test [sink...]",
+	Short: "Send a test alert to the sinks given, or all of them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadNotify()
+		if err != nil {
+			return err
+		}
+		sinks, err := notifySinks(cfg, args)
+		if err != nil {
+			return err
+		}
+		if len(sinks) == 0 {
+			return fmt.Errorf("no notify sinks in the config file; see 'vic-ptv notify --help'")
+		}
+		names := make([]string, 0, len(sinks))
+		for name := range sinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		a := notify.Alert{
+			Key:     "test",
+			Rule:    "test",
+			Title:   "vic-ptv test notification",
+			Message: "Notifications from vic-ptv will arrive like this.",
+			Time:    time.Now(),
+		}
+		failed := 0
+		for _, name := range names {
+			if err := sinks[name].Send(cmd.Context(), a); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: sent\n", name)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d sinks failed", failed, len(names))
+		}
+		return nil
+	},
+}
+
+// notifySinks builds the configured sinks named, or all of them.
+func notifySinks(cfg *config.Notify, names []string) (map[string]notify.Sink, error) {
+	if len(names) == 0 {
+		for name := range cfg.Sinks {
+			names = append(names, name)
+		}
+	}
+	sinks := make(map[string]notify.Sink, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		s, ok := cfg.Sinks[name]
+		if !ok {
+			return nil, fmt.Errorf("no notify sink named %q", name)
+		}
+		sink, err := notify.NewSink(s)
+		if err != nil {
+			return nil, fmt.Errorf("notify sink %q: %w", name, err)
+		}
+		sinks[name] = sink
+	}
+	return sinks, nil
+}
+
+// resolveNotifyRules resolves the stops and routes of the configured rules
+// and fills in their sinks.
+func resolveNotifyRules(client *api.Client, cfg *config.Notify) ([]notify.Rule, error) {
+	all := make([]string, 0, len(cfg.Sinks))
+	for name := range cfg.Sinks {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+
+	var rules []notify.Rule
+	for _, c := range cfg.Rules {
+		r := notify.Rule{Name: c.Name, When: c.When, Departure: c.Departure, Delay: c.Delay, Sinks: c.Sinks}
+		if len(r.Sinks) == 0 {
+			r.Sinks = all
+		}
+		routeType := -1
+		if c.RouteType != nil {
+			routeType = *c.RouteType
+		}
+
+		var target stopTarget
+		var err error
+		if c.Stop != "" {
+			if target, err = resolveStopTarget(client, c.Stop, routeType); err != nil {
+				return nil, fmt.Errorf("notify rule %q: %w", c.Name, err)
+			}
+		}
+		if c.Route != "" {
+			if target.RouteID, err = resolveRoute(client, c.Route); err != nil {
+				return nil, fmt.Errorf("notify rule %q: %w", c.Name, err)
+			}
+		}
+		if c.Direction > 0 {
+			target.DirectionID = c.Direction
+		}
+		r.StopID, r.RouteID, r.DirectionID = target.StopID, target.RouteID, target.DirectionID
+
+		if c.When == config.NotifyDisruption {
+			if c.Route == "" {
+				// Disruptions of the stop itself, not of a favourite's route.
+				r.RouteID = 0
+			}
+		} else if r.RouteTypes, err = targetRouteTypes(client, target); err != nil {
+			return nil, fmt.Errorf("notify rule %q: %w", c.Name, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func init() {
+	notifyRunCmd.Flags().DurationVar(&notifyInterval, "interval", time.Minute, "How often to evaluate the rules")
+	notifyRunCmd.Flags().BoolVar(&notifyOnce, "once", false, "Evaluate the rules once and exit, e.g. from cron")
+	notifyRunCmd.Flags().BoolVar(&notifyDryRun, "dry-run", false, "Log the alerts that would be sent instead of sending them")
+	notifyRunCmd.Flags().IntVar(&notifyLimit, "limit", 20, "Departures to fetch per stop and mode")
+
+	notifyCmd.AddCommand(notifyRunCmd, notifyTestCmd)
+	rootCmd.AddCommand(notifyCmd)
+}
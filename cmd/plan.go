@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/cache"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/gtfs"
+	"github.com/bls/vic-ptv-cli/internal/planner"
+	"github.com/bls/vic-ptv-cli/internal/source"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// planCacheFile holds the network built by previous searches.
+	planCacheFile = "planner-network.json"
+	// planKeep is how long past connections are kept in the cache.
+	planKeep = 24 * time.Hour
+	// planDepartures is how many departures are fetched per stop and mode.
+	planDepartures = 20
+	// planWorkers limits concurrent pattern requests.
+	planWorkers = 8
+)
+
+var (
+	planDepartAt  string
+	planArriveBy  string
+	planPenalty   time.Duration
+	planMaxWalk   float64
+	planWalkSpeed float64
+	planCount     int
+	planWindow    time.Duration
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan <from> <to>",
+	Short: "Plan a journey between two stops",
+	Long: `Plan a journey between two stops. PTV's API has no journey planner, so a
+local timetable is built from departures at both stops and the stopping
+patterns of those runs, and searched for the fastest itineraries, including
+changes between services and short walks between nearby stops.
+
+Online, journeys are found through stops served both by services from the
+origin and by services to the destination. Everything fetched is cached
+and merged with earlier searches, so the local network grows with use.
+With --offline, no API requests are made: the imported GTFS timetable is
+searched if there is one (see 'vic-ptv gtfs'), and otherwise only the cached
+network. A network can be shared with 'plan export' and 'plan import'.
+
+Stops are IDs, names or @favourites. Times are like 08:30, 8:30am or
+"2024-01-15 08:30" in the display timezone.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if planDepartAt != "" && planArriveBy != "" {
+			return fmt.Errorf("use only one of --depart-at and --arrive-by")
+		}
+		at := time.Now()
+		arriveBy := planArriveBy != ""
+		if s := planDepartAt + planArriveBy; s != "" {
+			var err error
+			if at, err = parsePlanTime(s, at); err != nil {
+				return err
+			}
+		}
+
+		net := loadPlanNetwork()
+		// Offline without an imported timetable, only the cached
+		// network is searched.
+		var src source.Source
+		if flagOffline {
+			if store, err := gtfs.Open(gtfs.DefaultPath()); err == nil {
+				defer store.Close()
+				src = store
+			}
+		} else {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			src = client
+		}
+
+		from, err := resolvePlanStop(src, net, args[0])
+		if err != nil {
+			return err
+		}
+		to, err := resolvePlanStop(src, net, args[1])
+		if err != nil {
+			return err
+		}
+		if from == to {
+			return fmt.Errorf("origin and destination are the same stop")
+		}
+
+		if src != nil {
+			start := at
+			if arriveBy {
+				start = at.Add(-planWindow)
+			}
+			fetched, err := fetchPlanNetwork(src, []int{from, to}, start)
+			if err != nil {
+				return err
+			}
+			net.Merge(fetched)
+			// Timetable-derived connections are cheap to rebuild, so
+			// only those fetched from the API are cached.
+			if !flagOffline {
+				net.Prune(time.Now().Add(-planKeep))
+				if err := cache.Save(planCacheFile, net); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: could not cache the network: %v\n", err)
+				}
+			}
+		}
+
+		opts := planner.Options{
+			TransferPenalty: planPenalty,
+			MaxWalk:         planMaxWalk,
+			WalkSpeed:       planWalkSpeed,
+			Count:           planCount,
+		}
+		var its []planner.Itinerary
+		if arriveBy {
+			its = planner.ArriveBy(net, []int{from}, []int{to}, at, opts)
+		} else {
+			its = planner.DepartAt(net, []int{from}, []int{to}, at, opts)
+		}
+
+		if flagJSON {
+			return display.JSON(its)
+		}
+		display.Itineraries(net, its)
+		if len(its) == 0 && src == nil {
+			if first, last := net.Span(); !first.IsZero() {
+				fmt.Printf("The cached network covers %s to %s.\n", display.FormatDateTime(first), display.FormatDateTime(last))
+			}
+		}
+		return nil
+	},
+}
+
+var planImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Merge a network file into the cached network",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		imported := planner.NewNetwork()
+		if err := json.Unmarshal(data, imported); err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+		net := loadPlanNetwork()
+		before := len(net.Connections)
+		net.Merge(imported)
+		if err := cache.Save(planCacheFile, net); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d new connections (%d stops in the network).\n", len(net.Connections)-before, len(net.Stops))
+		return nil
+	},
+}
+
+var planExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Write the cached network to a file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := json.Marshal(loadPlanNetwork())
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(args[0], data, 0o644)
+	},
+}
+
+// loadPlanNetwork returns the cached network, or an empty one.
+func loadPlanNetwork() *planner.Network {
+	net := planner.NewNetwork()
+	if _, err := cache.Load(planCacheFile, net); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring the cached network: %v\n", err)
+		return planner.NewNetwork()
+	}
+	return net
+}
+
+// resolvePlanStop resolves a stop argument. Without a source, names are
+// matched against the stops in the cached network.
+func resolvePlanStop(src source.Source, net *planner.Network, arg string) (int, error) {
+	if src != nil || isID(arg) || strings.HasPrefix(arg, "@") {
+		id, _, err := resolveStop(src, arg, -1)
+		return id, err
+	}
+
+	name := strings.ToLower(arg)
+	var matches []planner.Stop
+	for _, s := range net.Stops {
+		if strings.Contains(strings.ToLower(s.Name), name) {
+			matches = append(matches, s)
+		}
+	}
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("no stop matching %q in the cached network", arg)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	labels := make([]string, len(matches))
+	for i, s := range matches {
+		labels[i] = fmt.Sprintf("%-6d %s — %s", s.ID, s.Name, display.RouteTypeName(s.RouteType))
+	}
+	i, err := choose("stop", arg, labels)
+	if err != nil {
+		return 0, err
+	}
+	return matches[i].ID, nil
+}
+
+// planRun identifies a run whose stopping pattern is needed.
+type planRun struct {
+	ref       string
+	routeType int
+}
+
+// fetchPlanNetwork builds a network from the departures at each stop from
+// start onwards and the full stopping patterns of those runs.
+func fetchPlanNetwork(src source.Source, stops []int, start time.Time) (*planner.Network, error) {
+	net := planner.NewNetwork()
+	runs := make(map[planRun]bool)
+	for _, stopID := range stops {
+		routeTypes, err := stopRouteTypes(src, stopID)
+		if err != nil {
+			return nil, err
+		}
+		for _, rt := range routeTypes {
+			resp, err := src.DeparturesAt(rt, stopID, start, planDepartures)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range resp.Routes {
+				net.AddRoute(planner.Route{ID: r.RouteID, Type: r.RouteType, Number: r.RouteNumber, Name: r.RouteName})
+			}
+			for _, d := range resp.Departures {
+				if d.RunRef != "" {
+					runs[planRun{ref: d.RunRef, routeType: rt}] = true
+				}
+			}
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, planWorkers)
+	)
+	for run := range runs {
+		wg.Add(1)
+		go func(run planRun) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			pattern, err := src.Pattern(run.ref, run.routeType)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			addPattern(net, run, pattern)
+		}(run)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return net, nil
+}
+
+// addPattern adds a run's stops and the connections between them to net.
+func addPattern(net *planner.Network, run planRun, pattern *api.PatternResponse) {
+	for _, s := range pattern.Stops {
+		net.AddStop(planner.Stop{ID: s.StopID, Name: s.StopName, Lat: s.StopLatitude, Lon: s.StopLongitude, RouteType: run.routeType})
+	}
+	for _, r := range pattern.Routes {
+		net.AddRoute(planner.Route{ID: r.RouteID, Type: r.RouteType, Number: r.RouteNumber, Name: r.RouteName})
+	}
+
+	deps := make([]api.Departure, 0, len(pattern.Departures))
+	for _, d := range pattern.Departures {
+		if !d.DepartureTime().IsZero() {
+			deps = append(deps, d)
+		}
+	}
+	sort.SliceStable(deps, func(i, j int) bool { return deps[i].DepartureTime().Before(deps[j].DepartureTime()) })
+	for i := 0; i+1 < len(deps); i++ {
+		a, b := deps[i], deps[i+1]
+		net.AddConnection(planner.Connection{
+			From:     a.StopID,
+			To:       b.StopID,
+			Depart:   a.DepartureTime(),
+			Arrive:   b.DepartureTime(),
+			Run:      run.ref,
+			RouteID:  a.RouteID,
+			Platform: a.PlatformNumber,
+		})
+	}
+}
+
+// parsePlanTime parses a --depart-at or --arrive-by time in the display
+// timezone. A time of day alone means the next occurrence of that time,
+// or today if it is within the last hour.
+func parsePlanTime(s string, now time.Time) (time.Time, error) {
+	loc := display.Location()
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04", "3:04pm", "3:04PM", "3pm", "3PM"} {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err != nil {
+			continue
+		}
+		local := now.In(loc)
+		t = time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		if t.Before(now.Add(-time.Hour)) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a form like 08:30, 8:30am or \"2024-01-15 08:30\"", s)
+}
+
+func init() {
+	defaults := planner.DefaultOptions()
+	planCmd.Flags().StringVar(&planDepartAt, "depart-at", "", "Leave at or after this time (default now)")
+	planCmd.Flags().StringVar(&planArriveBy, "arrive-by", "", "Arrive at or before this time")
+	planCmd.Flags().DurationVar(&planPenalty, "transfer-penalty", defaults.TransferPenalty, "Minimum time to change between services")
+	planCmd.Flags().Float64Var(&planMaxWalk, "max-walk", defaults.MaxWalk, "Longest walk between nearby stops, in metres (0 to disable)")
+	planCmd.Flags().Float64Var(&planWalkSpeed, "walk-speed", defaults.WalkSpeed, "Walking speed in metres per second")
+	planCmd.Flags().IntVar(&planCount, "count", defaults.Count, "Number of itineraries to show")
+	planCmd.Flags().DurationVar(&planWindow, "window", 90*time.Minute, "With --arrive-by, how long before the arrival time to look for departures")
+
+	planCmd.AddCommand(planImportCmd, planExportCmd)
+	rootCmd.AddCommand(planCmd)
+}
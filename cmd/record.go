@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/punctuality"
+	"github.com/bls/vic-ptv-cli/internal/source"
+	"github.com/spf13/cobra"
+)
+
+// minRecordInterval keeps the recorder from polling the API too hard.
+const minRecordInterval = 15 * time.Second
+
+var (
+	recordStops    []string
+	recordInterval time.Duration
+	recordDB       string
+	recordLimit    int
+
+	statsDB    string
+	statsStop  string
+	statsRoute string
+	statsDays  int
+	statsLate  time.Duration
+)
+
+var recordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Record departures for punctuality statistics",
+	Long: `Poll departures from the --stop given (repeatable; IDs, names or @favourites)
+every --interval and record them in a SQLite database, for 'vic-ptv stats'.
+
+Each run is stored once per stop with its scheduled departure, the first
+realtime estimate seen and the last estimate seen before it left, which is
+taken as its actual departure. Cancellations are recorded too. Leave it
+running to build up a history; runs seen while it was stopped are missed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(recordStops) == 0 {
+			return fmt.Errorf("give at least one --stop to record")
+		}
+		if recordInterval < minRecordInterval {
+			return fmt.Errorf("--interval must be at least %s", minRecordInterval)
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		type recordStop struct {
+			id         int
+			routeTypes []int
+		}
+		var stops []recordStop
+		for _, arg := range recordStops {
+			id, rt, err := resolveStop(client, arg, -1)
+			if err != nil {
+				return err
+			}
+			routeTypes, err := stopRouteTypesOrFlag(client, id, rt)
+			if err != nil {
+				return err
+			}
+			stops = append(stops, recordStop{id, routeTypes})
+		}
+
+		db, err := punctuality.Open(recordDB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		poll := func() {
+			n := 0
+			for _, s := range stops {
+				for _, rt := range s.routeTypes {
+					resp, err := client.RealtimeDepartures(rt, s.id, recordLimit)
+					if err != nil {
+						log.Printf("stop %d: %v", s.id, err)
+						continue
+					}
+					recorded, err := db.Record(s.id, resp, time.Now())
+					if err != nil {
+						log.Printf("stop %d: %v", s.id, err)
+					}
+					n += recorded
+				}
+			}
+			log.Printf("recorded %d departures", n)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		log.Printf("recording departures from %d stops to %s every %s", len(stops), recordDB, recordInterval)
+		poll()
+		ticker := time.NewTicker(recordInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				poll()
+			}
+		}
+	},
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report punctuality from recorded departures",
+	Long: `Report the on-time percentage, mean delay and cancellations of the departures
+recorded by 'vic-ptv record', overall and by route, hour of day and weekday.
+
+A departure is on time if it left less than --late late and no more than a
+minute early, judged by its last realtime estimate. Departures never given an
+estimate are counted but not measured.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(statsDB); err != nil {
+			return fmt.Errorf("no recorded departures at %s; run 'vic-ptv record' first", statsDB)
+		}
+		// Only talk to the API when a name has to be looked up, so stats
+		// can be filtered by ID without credentials.
+		var client source.Source
+		if (statsStop != "" && !isID(statsStop)) || (statsRoute != "" && !isID(statsRoute)) {
+			var err error
+			if client, err = newClient(); err != nil {
+				return err
+			}
+		}
+		var f punctuality.Filter
+		var err error
+		if f.StopID, f.RouteID, err = resolveStatsFilter(client); err != nil {
+			return err
+		}
+		if statsDays > 0 {
+			f.Since = time.Now().AddDate(0, 0, -statsDays)
+		}
+
+		db, err := punctuality.Open(statsDB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		report, err := db.Stats(f, statsLate, display.Location(), time.Now())
+		if err != nil {
+			return err
+		}
+		if flagJSON {
+			return display.JSON(report)
+		}
+		display.PunctualityReport(report)
+		return nil
+	},
+}
+
+// resolveStatsFilter resolves the --stop and --route of stats.
+func resolveStatsFilter(src source.Source) (stopID, routeID int, err error) {
+	if statsStop != "" {
+		if stopID, _, err = resolveStop(src, statsStop, -1); err != nil {
+			return 0, 0, err
+		}
+	}
+	if statsRoute != "" {
+		if routeID, err = resolveRoute(src, statsRoute); err != nil {
+			return 0, 0, err
+		}
+	}
+	return stopID, routeID, nil
+}
+
+func init() {
+	recordCmd.Flags().StringArrayVar(&recordStops, "stop", nil, "Stop to record (ID, name or @favourite); repeatable")
+	recordCmd.Flags().DurationVar(&recordInterval, "interval", time.Minute, "How often to poll departures")
+	recordCmd.Flags().StringVar(&recordDB, "db", "punctuality.db", "SQLite database to record to")
+	recordCmd.Flags().IntVar(&recordLimit, "limit", 10, "Departures to fetch per stop and mode")
+
+	statsCmd.Flags().StringVar(&statsDB, "db", "punctuality.db", "SQLite database recorded by 'vic-ptv record'")
+	statsCmd.Flags().StringVar(&statsStop, "stop", "", "Only report on this stop (ID or name)")
+	statsCmd.Flags().StringVar(&statsRoute, "route", "", "Only report on this route (ID or name)")
+	statsCmd.Flags().IntVar(&statsDays, "days", 0, "Only report on the last N days (default: everything recorded)")
+	statsCmd.Flags().DurationVar(&statsLate, "late", 5*time.Minute, "Delay from which a departure counts as late")
+
+	rootCmd.AddCommand(recordCmd, statsCmd)
+}
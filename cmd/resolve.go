@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/cache"
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/resolve"
+	"github.com/bls/vic-ptv-cli/internal/source"
+)
+
+const (
+	// maxCandidates is how many matches are offered when a name is ambiguous.
+	maxCandidates = 15
+
+	// stopModesCacheFile caches the route types served at each stop.
+	stopModesCacheFile = "stop-route-types.json"
+	// stopModesTTL is how long a cached stop lookup is trusted.
+	stopModesTTL = 30 * 24 * time.Hour
+)
+
+// allRouteTypes are the route types probed when inferring a stop's modes.
+var allRouteTypes = []int{0, 1, 2, 3, 4}
+
+// noPrompt makes choose fail with the candidates instead of prompting, for
+// commands whose stdin is not the user's.
+var noPrompt bool
+
+// stopModes is a cached record of the route types served at a stop.
+type stopModes struct {
+	RouteTypes []int     `json:"route_types"`
+	Checked    time.Time `json:"checked"`
+}
+
+// stopTarget is a resolved stop argument, along with any route and
+// direction filters saved in a favourite. RouteType is -1 when unknown, and
+// RouteID and DirectionID are 0 when unfiltered.
+type stopTarget struct {
+	StopID      int
+	RouteType   int
+	RouteID     int
+	DirectionID int
+}
+
+// resolveStop turns a stop argument into a stop ID and route type. A
+// numeric argument is a stop ID and routeType is returned unchanged;
+// anything else is looked up by name, restricted to routeType if it is not
+// -1, and the route type of the matched stop is returned.
+func resolveStop(src source.Source, arg string, routeType int) (int, int, error) {
+	t, err := resolveStopTarget(src, arg, routeType)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t.StopID, t.RouteType, nil
+}
+
+// resolveStopTarget is resolveStop for commands that can use a favourite's
+// filters. An @name argument is looked up in the saved favourites; a
+// routeType other than -1 overrides the favourite's.
+func resolveStopTarget(src source.Source, arg string, routeType int) (stopTarget, error) {
+	if name, ok := strings.CutPrefix(arg, "@"); ok {
+		f, err := config.LookupFavourite(name)
+		if err != nil {
+			return stopTarget{}, err
+		}
+		t := stopTarget{StopID: f.StopID, RouteType: routeType, RouteID: f.RouteID, DirectionID: f.DirectionID}
+		if routeType < 0 && f.RouteType != nil {
+			t.RouteType = *f.RouteType
+		}
+		return t, nil
+	}
+
+	if id, err := strconv.Atoi(arg); err == nil {
+		return stopTarget{StopID: id, RouteType: routeType}, nil
+	}
+
+	var routeTypes []int
+	if routeType >= 0 {
+		routeTypes = []int{routeType}
+	}
+	resp, err := src.Search(arg, routeTypes)
+	if err != nil {
+		return stopTarget{}, err
+	}
+	matches := resolve.Stops(resp.Stops, arg)
+	if len(matches) == 0 {
+		return stopTarget{}, fmt.Errorf("no stop found matching %q", arg)
+	}
+
+	labels := make([]string, len(matches))
+	for i, s := range matches {
+		labels[i] = fmt.Sprintf("%-6d %s — %s", s.StopID, display.StopLabel(s.StopName, s.StopSuburb), display.RouteTypeName(s.RouteType))
+	}
+	i, err := choose("stop", arg, labels)
+	if err != nil {
+		return stopTarget{}, err
+	}
+	return stopTarget{StopID: matches[i].StopID, RouteType: matches[i].RouteType}, nil
+}
+
+// resolveRoute turns a route argument into a route ID. A numeric argument
+// is always a route ID, so scripts are never asked to choose; anything else
+// is looked up by route number or name, such as "tram 96", "route 96" (any
+// mode) or "Lilydale line". An @name argument is the route saved in that
+// favourite.
+func resolveRoute(src source.Source, arg string) (int, error) {
+	if name, ok := strings.CutPrefix(arg, "@"); ok {
+		f, err := config.LookupFavourite(name)
+		if err != nil {
+			return 0, err
+		}
+		if f.RouteID == 0 {
+			return 0, fmt.Errorf("favourite %q has no route", name)
+		}
+		return f.RouteID, nil
+	}
+	if id, err := strconv.Atoi(arg); err == nil {
+		return id, nil
+	}
+
+	q := resolve.ParseRouteQuery(arg)
+	resp, err := src.Search(q.Term, q.RouteTypes)
+	if err != nil {
+		return 0, err
+	}
+	matches := resolve.Routes(resp.Routes, q)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("no route found matching %q", arg)
+	}
+
+	labels := make([]string, len(matches))
+	for i, r := range matches {
+		name := r.RouteName
+		if r.RouteNumber != "" {
+			name = r.RouteNumber + " " + name
+		}
+		labels[i] = fmt.Sprintf("%-6d %s — %s", r.RouteID, name, display.RouteTypeName(r.RouteType))
+	}
+	i, err := choose("route", arg, labels)
+	if err != nil {
+		return 0, err
+	}
+	return matches[i].RouteID, nil
+}
+
+// choose picks one of several matches for a name. A single match is picked
+// automatically. With several, the user is prompted when running
+// interactively; otherwise an error lists the candidates.
+func choose(kind, name string, labels []string) (int, error) {
+	if len(labels) == 1 {
+		return 0, nil
+	}
+	if len(labels) > maxCandidates {
+		labels = labels[:maxCandidates]
+	}
+
+	if noPrompt || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "several %ss match %q; use an ID or a more specific name:", kind, name)
+		for _, l := range labels {
+			b.WriteString("\n  " + l)
+		}
+		return 0, fmt.Errorf("%s", b.String())
+	}
+
+	fmt.Fprintf(os.Stderr, "Several %ss match %q:\n", kind, name)
+	for i, l := range labels {
+		fmt.Fprintf(os.Stderr, "  %2d) %s\n", i+1, l)
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "Choose a %s [1-%d]: ", kind, len(labels))
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return 0, fmt.Errorf("no %s chosen", kind)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && n >= 1 && n <= len(labels) {
+			return n - 1, nil
+		}
+	}
+}
+
+// stopRouteTypes determines which route types serve a stop by looking the
+// stop up under each route type. Results are cached between runs. A source
+// that knows a stop's route types is asked directly.
+func stopRouteTypes(src source.Source, stopID int) ([]int, error) {
+	if st, ok := src.(source.StopRouteTyper); ok {
+		return st.StopRouteTypes(stopID)
+	}
+
+	cached := make(map[string]stopModes)
+	if _, err := cache.Load(stopModesCacheFile, &cached); err != nil {
+		cached = make(map[string]stopModes)
+	}
+	key := strconv.Itoa(stopID)
+	if m, ok := cached[key]; ok && time.Since(m.Checked) < stopModesTTL && len(m.RouteTypes) > 0 {
+		return m.RouteTypes, nil
+	}
+
+	served := make([]bool, len(allRouteTypes))
+	errs := make([]error, len(allRouteTypes))
+	var wg sync.WaitGroup
+	for i, rt := range allRouteTypes {
+		wg.Add(1)
+		go func(i, rt int) {
+			defer wg.Done()
+			resp, err := src.Stop(stopID, rt)
+			var apiErr *api.APIError
+			switch {
+			case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusNotFound):
+				// Not a stop for this route type.
+			case err != nil:
+				errs[i] = err
+			default:
+				served[i] = resp.Stop.StopID == stopID && resp.Stop.StopName != ""
+			}
+		}(i, rt)
+	}
+	wg.Wait()
+
+	var routeTypes []int
+	for i, rt := range allRouteTypes {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if served[i] {
+			routeTypes = append(routeTypes, rt)
+		}
+	}
+	if len(routeTypes) == 0 {
+		return nil, fmt.Errorf("could not determine the route type for stop %d; pass --route-type", stopID)
+	}
+
+	cached[key] = stopModes{RouteTypes: routeTypes, Checked: time.Now()}
+	_ = cache.Save(stopModesCacheFile, cached)
+	return routeTypes, nil
+}
+
+// stopRouteTypesOrFlag returns routeType if it was given, or the route
+// types inferred for the stop.
+func stopRouteTypesOrFlag(src source.Source, stopID, routeType int) ([]int, error) {
+	if routeType >= 0 {
+		return []int{routeType}, nil
+	}
+	return stopRouteTypes(src, stopID)
+}
+
+// targetRouteTypes returns the route types to fetch departures for. A route
+// filter without a route type is looked up, since a route has one type.
+func targetRouteTypes(src source.Source, target stopTarget) ([]int, error) {
+	if target.RouteType < 0 && target.RouteID > 0 {
+		rt, err := routeTypeOf(src, target.RouteID)
+		if err != nil {
+			return nil, err
+		}
+		return []int{rt}, nil
+	}
+	return stopRouteTypesOrFlag(src, target.StopID, target.RouteType)
+}
+
+// routeTypeOf looks up the route type of a route.
+func routeTypeOf(src source.Source, routeID int) (int, error) {
+	resp, err := src.Route(routeID)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Route.RouteType, nil
+}
+
+// departuresForStop fetches departures for each route type concurrently and
+// merges them into one time-ordered response, applying the target's route
+// and direction filters.
+func departuresForStop(src source.Source, target stopTarget, routeTypes []int, limit int) (*api.DeparturesResponse, error) {
+	fetch := func(rt int) (*api.DeparturesResponse, error) {
+		return src.RouteDepartures(rt, target.StopID, target.RouteID, target.DirectionID, limit)
+	}
+	if len(routeTypes) == 1 {
+		return fetch(routeTypes[0])
+	}
+
+	resps := make([]*api.DeparturesResponse, len(routeTypes))
+	errs := make([]error, len(routeTypes))
+	var wg sync.WaitGroup
+	for i, rt := range routeTypes {
+		wg.Add(1)
+		go func(i, rt int) {
+			defer wg.Done()
+			resps[i], errs[i] = fetch(rt)
+		}(i, rt)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return api.MergeDepartures(resps...), nil
+}
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/bls/vic-ptv-cli/internal/api"
 	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/bls/vic-ptv-cli/internal/gtfs"
+	"github.com/bls/vic-ptv-cli/internal/source"
 	"github.com/spf13/cobra"
 )
 
@@ -13,6 +18,15 @@ var (
 	flagDevID  string
 	flagAPIKey string
 	flagJSON   bool
+	flagWide   bool
+
+	flagOffline bool
+	flagProfile string
+	flagConfig  string
+
+	flagTimezone   string
+	flagTimeFormat string
+	flagDateFormat string
 )
 
 var rootCmd = &cobra.Command{
@@ -24,6 +38,24 @@ Query stops, routes, departures, disruptions, and fares from the PTV network
 covering trains, trams, buses, V/Line, and more.
 
 Data licensed from Public Transport Victoria under Creative Commons Attribution 3.0 Australia Licence.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		display.SetWide(flagWide)
+		config.SetConfigFile(flagConfig)
+		if err := config.UseProfile(flagProfile); err != nil {
+			return err
+		}
+		if err := config.CheckProfile(); err != nil {
+			return err
+		}
+		if err := applyDefaults(cmd); err != nil {
+			return err
+		}
+		d, err := config.LoadDisplay(flagTimezone, flagTimeFormat, flagDateFormat)
+		if err != nil {
+			return err
+		}
+		return display.ConfigureTime(d.Timezone, d.TimeFormat, d.DateFormat)
+	},
 }
 
 // SetVersion sets the version info from ldflags.
@@ -41,15 +73,79 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().StringVar(&flagDevID, "dev-id", "", "PTV Developer ID")
 	rootCmd.PersistentFlags().StringVar(&flagAPIKey, "api-key", "", "PTV API Key")
+	rootCmd.PersistentFlags().StringVar(&flagConfig, "config", "", "Config file to use (default $PTV_CONFIG, or config.yaml in $XDG_CONFIG_HOME/vic-ptv-cli)")
+	rootCmd.PersistentFlags().StringVar(&flagProfile, "profile", "", "Config profile to use (default $PTV_PROFILE, or default)")
 	rootCmd.PersistentFlags().BoolVar(&flagJSON, "json", false, "Output raw JSON")
+	rootCmd.PersistentFlags().BoolVar(&flagWide, "wide", false, "Never truncate table columns to fit the terminal")
+	rootCmd.PersistentFlags().StringVar(&flagTimezone, "tz", "", "Timezone for displayed times (default Australia/Melbourne)")
+	rootCmd.PersistentFlags().StringVar(&flagTimeFormat, "time-format", "", "Clock style for displayed times: 12h or 24h (default 24h)")
+	rootCmd.PersistentFlags().StringVar(&flagDateFormat, "date-format", "", "Date style for displayed dates: iso, au, us, long or a Go time layout (default iso)")
+	rootCmd.PersistentFlags().BoolVar(&flagOffline, "offline", false, "Answer from the imported GTFS timetable instead of the API (see 'vic-ptv gtfs')")
+}
+
+// applyDefaults sets the flags of cmd that were not given from the defaults
+// in the config file.
+func applyDefaults(cmd *cobra.Command) error {
+	d, err := config.LoadDefaults()
+	if err != nil {
+		return err
+	}
+	flags := cmd.Flags()
+	if d.Output == config.OutputJSON {
+		if f := flags.Lookup("format"); f != nil {
+			if !f.Changed {
+				flags.Set("format", formatJSON)
+			}
+		} else if !flags.Changed("json") {
+			flagJSON = true
+		}
+	}
+	if d.RouteType != nil {
+		for _, name := range []string{"route-type", "route-types"} {
+			if f := flags.Lookup(name); f != nil && !f.Changed {
+				flags.Set(name, strconv.Itoa(*d.RouteType))
+			}
+		}
+	}
+	return nil
 }
 
 // newClient creates a new API client from the current config.
 func newClient() (*api.Client, error) {
+	if flagOffline {
+		return nil, fmt.Errorf("this command needs the PTV API and cannot be used with --offline")
+	}
 	cfg, err := config.Load(flagDevID, flagAPIKey)
-	if err != nil {
+	if errors.Is(err, config.ErrNoCredentials) {
 		config.PrintAuthHelp()
 		return nil, fmt.Errorf("authentication required")
 	}
-	return api.NewClient(cfg.DevID, cfg.APIKey), nil
+	if err != nil {
+		return nil, err
+	}
+	client := api.NewClient(cfg.DevID, cfg.APIKey)
+	if cfg.BaseURL != "" {
+		client.BaseURL = cfg.BaseURL
+	}
+	return client, nil
+}
+
+// apiClient returns a client for devID and apiKey that uses the active
+// profile's base URL, for checking credentials that are not yet saved.
+func apiClient(devID, apiKey string) *api.Client {
+	client := api.NewClient(devID, apiKey)
+	if baseURL, _, _ := config.Get("baseUrl"); baseURL != "" {
+		client.BaseURL = baseURL
+	}
+	return client
+}
+
+// newSource returns where stop, route and scheduled departure queries are
+// answered from: the imported GTFS timetable with --offline, otherwise the
+// API.
+func newSource() (source.Source, error) {
+	if flagOffline {
+		return gtfs.Open(gtfs.DefaultPath())
+	}
+	return newClient()
 }
@@ -1,42 +1,47 @@
 package cmd
 
 import (
-	"fmt"
-	"strconv"
+	"time"
 
 	"github.com/bls/vic-ptv-cli/internal/display"
 	"github.com/spf13/cobra"
 )
 
+var routeWatch time.Duration
+
 var routeCmd = &cobra.Command{
-	Use:   "route <route_id>",
+	Use:   "route <route>",
 	Short: "Show route details",
-	Long:  `Show detailed information about a specific route.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Show detailed information about a specific route. The route is a route ID,
+or a route number or name such as "tram 96" or "Lilydale line".`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := newClient()
+		client, err := newSource()
 		if err != nil {
 			return err
 		}
 
-		routeID, err := strconv.Atoi(args[0])
-		if err != nil {
-			return fmt.Errorf("invalid route_id %q: must be a number", args[0])
-		}
-
-		resp, err := client.Route(routeID)
+		routeID, err := resolveRoute(client, args[0])
 		if err != nil {
 			return err
 		}
 
-		if flagJSON {
-			return display.JSON(resp)
-		}
-		display.RouteDetail(resp)
-		return nil
+		return runOrWatch(routeWatch, func() error {
+			resp, err := client.Route(routeID)
+			if err != nil {
+				return err
+			}
+
+			if flagJSON {
+				return display.JSON(resp)
+			}
+			display.RouteDetail(resp)
+			return nil
+		})
 	},
 }
 
 func init() {
+	addWatchFlag(routeCmd, &routeWatch)
 	rootCmd.AddCommand(routeCmd)
 }
@@ -16,7 +16,7 @@ var routesCmd = &cobra.Command{
 	Short: "List routes",
 	Long:  `List all PTV routes, optionally filtered by route type.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := newClient()
+		client, err := newSource()
 		if err != nil {
 			return err
 		}
@@ -17,7 +17,7 @@ var searchCmd = &cobra.Command{
 	Long:  `Search the PTV network for stops, routes, and outlets matching a search term.`,
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := newClient()
+		client, err := newSource()
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/config"
+	"github.com/bls/vic-ptv-cli/internal/proxy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen  string
+	serveOrigins []string
+	serveRate    float64
+	serveBurst   int
+	serveNoAuth  bool
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve PTV data over a local JSON API",
+	Long: `Serve PTV data over an unsigned JSON API, so other applications can use it
+without being given your Developer ID and API key. Upstream requests are
+signed, cached and rate limited by the server.
+
+Endpoints (all GET):
+  /search?q=<term>[&route_types=0,1]
+  /departures/<stop_id>[?route_type=&route=&direction=&limit=]
+  /stops/<stop_id>[?route_type=]
+  /routes[?route_types=0,1]
+  /routes/<route_id>
+  /disruptions[?route=<route_id>|stop=<stop_id>]
+  /disruptions/<disruption_id>
+  /fare?min_zone=&max_zone=
+  /route-types
+  /healthz
+
+Without route_type, departures and stops cover every mode at the stop.
+Errors are returned as {"error": "...", "status": N}.
+
+Add format=ics to departures or disruptions for an iCalendar feed that
+calendar applications can subscribe to.
+
+Clients authenticate with "Authorization: Bearer <token>" or ?token=, using
+tokens listed in the config file under serve.tokens (name: token). Generate
+one with 'vic-ptv serve token'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		tokens, err := config.ServeTokens()
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 && !serveNoAuth {
+			return fmt.Errorf("no client tokens configured under serve.tokens; add some (see 'vic-ptv serve token') or pass --no-auth")
+		}
+		if serveRate <= 0 || serveBurst < 1 {
+			return fmt.Errorf("--rate must be positive and --burst at least 1")
+		}
+
+		logger := log.New(os.Stderr, "", log.LstdFlags)
+		handler := proxy.New(client, proxy.Options{
+			Tokens:       tokens,
+			AllowOrigins: serveOrigins,
+			Rate:         serveRate,
+			Burst:        serveBurst,
+			MaxWait:      5 * time.Second,
+			Logger:       logger,
+		})
+		srv := &http.Server{Addr: serveListen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+		}()
+
+		if len(tokens) == 0 {
+			logger.Printf("warning: authentication disabled; anyone who can reach %s can use your API quota", serveListen)
+		}
+		logger.Printf("serving on http://%s/ for %d clients", serveListen, len(tokens))
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+var serveTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Generate a random client token",
+	Long: `Generate a random client token to add to the config file:
+
+  serve:
+    tokens:
+      dashboard: <token>`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		fmt.Println(hex.EncodeToString(b))
+		return nil
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "localhost:8080", "Address to listen on")
+	serveCmd.Flags().StringArrayVar(&serveOrigins, "cors-origin", nil, "Origin browsers may call from, or * for any; repeatable")
+	serveCmd.Flags().Float64Var(&serveRate, "rate", 5, "Upstream API requests allowed per second")
+	serveCmd.Flags().IntVar(&serveBurst, "burst", 10, "Upstream API requests allowed in a burst")
+	serveCmd.Flags().BoolVar(&serveNoAuth, "no-auth", false, "Allow requests without a client token")
+
+	serveCmd.AddCommand(serveTokenCmd)
+	rootCmd.AddCommand(serveCmd)
+}
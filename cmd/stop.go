@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"strconv"
 
+	"github.com/bls/vic-ptv-cli/internal/api"
 	"github.com/bls/vic-ptv-cli/internal/display"
 	"github.com/spf13/cobra"
 )
@@ -11,41 +11,59 @@ import (
 var stopRouteType int
 
 var stopCmd = &cobra.Command{
-	Use:   "stop <stop_id>",
+	Use:   "stop <stop>",
 	Short: "Show stop details and facilities",
 	Long: `Show detailed information about a stop including amenities and accessibility.
+The stop is a stop ID or a stop name. Without --route-type, details are shown
+for every mode serving the stop.
 
 Route types: 0=Train, 1=Tram, 2=Bus, 3=V/Line Train, 4=V/Line Coach`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := newClient()
+		client, err := newSource()
 		if err != nil {
 			return err
 		}
 
-		stopID, err := strconv.Atoi(args[0])
-		if err != nil {
-			return fmt.Errorf("invalid stop_id %q: must be a number", args[0])
+		routeType := -1
+		if cmd.Flags().Changed("route-type") {
+			routeType = stopRouteType
 		}
-
-		if !cmd.Flags().Changed("route-type") {
-			return fmt.Errorf("--route-type is required (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach)")
+		stopID, routeType, err := resolveStop(client, args[0], routeType)
+		if err != nil {
+			return err
 		}
-
-		resp, err := client.Stop(stopID, stopRouteType)
+		routeTypes, err := stopRouteTypesOrFlag(client, stopID, routeType)
 		if err != nil {
 			return err
 		}
 
+		var resps []*api.StopResponse
+		for _, rt := range routeTypes {
+			resp, err := client.Stop(stopID, rt)
+			if err != nil {
+				return err
+			}
+			resps = append(resps, resp)
+		}
+
 		if flagJSON {
-			return display.JSON(resp)
+			if len(resps) == 1 {
+				return display.JSON(resps[0])
+			}
+			return display.JSON(resps)
+		}
+		for i, resp := range resps {
+			if i > 0 {
+				fmt.Println()
+			}
+			display.StopDetail(resp)
 		}
-		display.StopDetail(resp)
 		return nil
 	},
 }
 
 func init() {
-	stopCmd.Flags().IntVar(&stopRouteType, "route-type", -1, "Route type (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach)")
+	stopCmd.Flags().IntVar(&stopRouteType, "route-type", -1, "Route type (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach); inferred if omitted")
 	rootCmd.AddCommand(stopCmd)
 }
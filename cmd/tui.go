@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bls/vic-ptv-cli/internal/tui"
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Interactive full-screen interface",
+	Long: `Open an interactive full-screen interface. Search for a stop or route, then
+drill down into stop details with live departures, route details, and
+disruptions without copying IDs between commands.
+
+Keys: type to search, Enter to open, arrows to move or scroll, d for
+disruptions, r to refresh, Esc to go back, Ctrl-C to quit.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return tui.New(client).Run(ctx)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
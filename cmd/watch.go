@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultWatchInterval is used when --watch is given without a value.
+	defaultWatchInterval = 30 * time.Second
+	minWatchInterval     = 5 * time.Second
+	maxWatchBackoff      = 10 * time.Minute
+)
+
+// addWatchFlag registers the --watch flag on cmd. Given without a value it
+// watches every 30s; a value must be attached with "=", e.g. --watch=1m.
+func addWatchFlag(cmd *cobra.Command, interval *time.Duration) {
+	cmd.Flags().DurationVar(interval, "watch", 0, "Re-query on an interval and redraw in place (e.g. --watch or --watch=1m)")
+	cmd.Flags().Lookup("watch").NoOptDefVal = defaultWatchInterval.String()
+}
+
+// runOrWatch calls show once, or repeatedly every interval when watching.
+func runOrWatch(interval time.Duration, show func() error) error {
+	if interval == 0 {
+		return show()
+	}
+	if interval < minWatchInterval {
+		return fmt.Errorf("--watch interval must be at least %s", minWatchInterval)
+	}
+	return watch(interval, show)
+}
+
+// watch redraws the output of show on the alternate screen every interval,
+// with a status line showing when it was last updated and a countdown to the
+// next refresh. Failures the API reports as temporary (rate limiting, server
+// errors) and network errors are retried with exponential backoff; anything
+// else, such as bad credentials, stops watching. Ctrl-C exits cleanly.
+func watch(interval time.Duration, show func() error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var buf bytes.Buffer
+	display.SetOutput(&buf)
+	defer display.SetOutput(os.Stdout)
+
+	screen := display.NewScreen()
+	screen.Enter()
+	defer screen.Exit()
+
+	var (
+		frame    []string
+		updated  time.Time
+		lastErr  error
+		failures int
+		next     time.Time
+	)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if !now.Before(next) {
+			buf.Reset()
+			if err := show(); err != nil {
+				if !retryable(err) {
+					return err
+				}
+				lastErr = err
+				failures++
+				next = now.Add(watchBackoff(interval, failures, err))
+			} else {
+				frame = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+				updated = now
+				lastErr = nil
+				failures = 0
+				next = now.Add(interval)
+			}
+		}
+
+		wait := max(next.Sub(now).Round(time.Second), 0)
+		status := fmt.Sprintf("Updated %s · refreshing in %s · Ctrl-C to exit", display.FormatTime(updated), wait)
+		if updated.IsZero() {
+			status = fmt.Sprintf("Waiting for data · retrying in %s · Ctrl-C to exit", wait)
+		}
+		if lastErr != nil {
+			status = fmt.Sprintf("%s (retrying in %s) · %s", lastErr, wait, status)
+		}
+
+		width, height := display.TerminalSize()
+		lines := frame
+		if len(lines) > height-2 {
+			lines = lines[:max(height-2, 0)]
+		}
+		screen.Draw(append(append([]string{}, lines...), "", display.Truncate(status, width)))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// retryable reports whether a failed query is worth retrying: the API was
+// rate limiting or having server-side issues, or the request never reached
+// it. Anything else, such as a response that cannot be decoded, would fail
+// the same way again.
+func retryable(err error) bool {
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// watchBackoff returns how long to wait after the given number of
+// consecutive failures. Rate limiting backs off from at least a minute.
+func watchBackoff(interval time.Duration, failures int, err error) time.Duration {
+	base := interval
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 429 {
+		base = max(base, time.Minute)
+	}
+	d := base
+	for i := 1; i < failures && d < maxWatchBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxWatchBackoff)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func TestRetryable(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://localhost/v3/route_types", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limited", err: &api.APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "server error", err: &api.APIError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "forbidden", err: &api.APIError{StatusCode: http.StatusForbidden}, want: false},
+		{name: "not found", err: fmt.Errorf("stop 5: %w", &api.APIError{StatusCode: http.StatusNotFound}), want: false},
+		{name: "connection refused", err: fmt.Errorf("HTTP request failed: %w", refused), want: true},
+		{name: "dns failure", err: &net.DNSError{Err: "no such host", Name: "timetableapi.ptv.vic.gov.au"}, want: true},
+		{name: "bad response", err: fmt.Errorf("decoding response: %w", &json.SyntaxError{Offset: 1}), want: false},
+		{name: "other", err: errors.New("no stop found matching \"nowhere\""), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchBackoff(t *testing.T) {
+	rateLimited := &api.APIError{StatusCode: http.StatusTooManyRequests}
+	serverError := &api.APIError{StatusCode: http.StatusInternalServerError}
+	tests := []struct {
+		name     string
+		interval time.Duration
+		failures int
+		err      error
+		want     time.Duration
+	}{
+		{name: "first failure", interval: 30 * time.Second, failures: 1, err: serverError, want: 30 * time.Second},
+		{name: "doubles", interval: 30 * time.Second, failures: 3, err: serverError, want: 2 * time.Minute},
+		{name: "capped", interval: 30 * time.Second, failures: 10, err: serverError, want: maxWatchBackoff},
+		{name: "rate limited starts at a minute", interval: 10 * time.Second, failures: 1, err: rateLimited, want: time.Minute},
+		{name: "rate limited doubles", interval: 10 * time.Second, failures: 2, err: rateLimited, want: 2 * time.Minute},
+		{name: "long interval kept", interval: 5 * time.Minute, failures: 1, err: rateLimited, want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := watchBackoff(tt.interval, tt.failures, tt.err); got != tt.want {
+				t.Errorf("watchBackoff(%s, %d, %v) = %s, want %s", tt.interval, tt.failures, tt.err, got, tt.want)
+			}
+		})
+	}
+}
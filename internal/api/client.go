@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -45,13 +46,13 @@ func (c *Client) get(path string, result interface{}) error {
 
 	resp, err := c.HTTPClient.Get(signedURL)
 	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
+		return fmt.Errorf("HTTP request failed: %w", redactURL(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (HTTP %d): %s", resp.StatusCode, httpErrorMessage(resp.StatusCode, string(body)))
+		return &APIError{StatusCode: resp.StatusCode, Message: httpErrorMessage(resp.StatusCode, string(body))}
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
@@ -60,6 +61,36 @@ func (c *Client) get(path string, result interface{}) error {
 	return nil
 }
 
+// redactURL removes the query string, which holds the developer ID and
+// signature, from the URL in a transport error, so the error can be shown
+// or passed on without leaking them.
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if u, perr := url.Parse(urlErr.URL); perr == nil {
+			u.RawQuery = ""
+			urlErr.URL = u.String()
+		}
+	}
+	return err
+}
+
+// APIError is returned when the PTV API responds with a non-200 status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (HTTP %d): %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried later: the
+// API was rate limiting or having server-side issues.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
 func httpErrorMessage(code int, body string) string {
 	switch code {
 	case 400:
@@ -101,8 +132,45 @@ func (c *Client) Search(term string, routeTypes []int) (*SearchResponse, error)
 
 // Departures gets upcoming departures from a stop.
 func (c *Client) Departures(routeType, stopID, maxResults int) (*DeparturesResponse, error) {
-	path := fmt.Sprintf("/v3/departures/route_type/%d/stop/%d?max_results=%d&expand=route&expand=direction&expand=stop",
-		routeType, stopID, maxResults)
+	return c.RouteDepartures(routeType, stopID, 0, 0, maxResults)
+}
+
+// RouteDepartures gets upcoming departures from a stop for one route and
+// direction. A routeID or directionID of 0 matches any.
+func (c *Client) RouteDepartures(routeType, stopID, routeID, directionID, maxResults int) (*DeparturesResponse, error) {
+	path := fmt.Sprintf("/v3/departures/route_type/%d/stop/%d", routeType, stopID)
+	if routeID > 0 {
+		path += fmt.Sprintf("/route/%d", routeID)
+	}
+	path += fmt.Sprintf("?max_results=%d&expand=route&expand=direction&expand=stop&expand=run&expand=disruption", maxResults)
+	if directionID > 0 {
+		path += fmt.Sprintf("&direction_id=%d", directionID)
+	}
+	var resp DeparturesResponse
+	if err := c.get(path, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RealtimeDepartures gets upcoming departures from a stop with the
+// positions and descriptions of the vehicles on each run, including
+// cancelled services. Routes, runs and the stop are expanded.
+func (c *Client) RealtimeDepartures(routeType, stopID, maxResults int) (*DeparturesResponse, error) {
+	path := fmt.Sprintf("/v3/departures/route_type/%d/stop/%d?max_results=%d&include_cancelled=true"+
+		"&expand=route&expand=run&expand=stop&expand=VehiclePosition&expand=VehicleDescriptor", routeType, stopID, maxResults)
+	var resp DeparturesResponse
+	if err := c.get(path, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeparturesAt gets departures from a stop starting at a given time rather
+// than now.
+func (c *Client) DeparturesAt(routeType, stopID int, at time.Time, maxResults int) (*DeparturesResponse, error) {
+	path := fmt.Sprintf("/v3/departures/route_type/%d/stop/%d?date_utc=%s&max_results=%d&expand=route&expand=stop&expand=run",
+		routeType, stopID, url.QueryEscape(at.UTC().Format(time.RFC3339)), maxResults)
 	var resp DeparturesResponse
 	if err := c.get(path, &resp); err != nil {
 		return nil, err
@@ -110,6 +178,17 @@ func (c *Client) Departures(routeType, stopID, maxResults int) (*DeparturesRespo
 	return &resp, nil
 }
 
+// Pattern gets the stopping pattern of a run, with the departure time at
+// each stop.
+func (c *Client) Pattern(runRef string, routeType int) (*PatternResponse, error) {
+	path := fmt.Sprintf("/v3/pattern/run/%s/route_type/%d?expand=stop", url.PathEscape(runRef), routeType)
+	var resp PatternResponse
+	if err := c.get(path, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Stop gets details for a specific stop.
 func (c *Client) Stop(stopID, routeType int) (*StopResponse, error) {
 	path := fmt.Sprintf("/v3/stops/%d/route_type/%d?stop_location=true&stop_amenities=true&stop_accessibility=true",
@@ -197,3 +276,26 @@ func (c *Client) RouteTypes() (*RouteTypesResponse, error) {
 	}
 	return &resp, nil
 }
+
+// ServerTime makes a signed request for the route types and returns the
+// time in the response's Date header, for checking credentials and the
+// local clock together. The time is returned even when the API refuses the
+// request, and is zero if the response had no Date.
+func (c *Client) ServerTime() (time.Time, error) {
+	signedURL, err := SignURL(c.BaseURL, "/v3/route_types", c.DevID, c.APIKey)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("signing URL: %w", err)
+	}
+	resp, err := c.HTTPClient.Get(signedURL)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("HTTP request failed: %w", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	date, _ := http.ParseTime(resp.Header.Get("Date"))
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return date, &APIError{StatusCode: resp.StatusCode, Message: httpErrorMessage(resp.StatusCode, string(body))}
+	}
+	return date, nil
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientAPIError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantTemporary bool
+	}{
+		{name: "bad request", status: http.StatusBadRequest, wantTemporary: false},
+		{name: "forbidden", status: http.StatusForbidden, wantTemporary: false},
+		{name: "not found", status: http.StatusNotFound, wantTemporary: false},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantTemporary: true},
+		{name: "server error", status: http.StatusInternalServerError, wantTemporary: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantTemporary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			c := NewClient("1000001", "test-key")
+			c.BaseURL = srv.URL
+			_, err := c.RouteTypes()
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("RouteTypes() error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			if got := apiErr.Temporary(); got != tt.wantTemporary {
+				t.Errorf("Temporary() = %v, want %v", got, tt.wantTemporary)
+			}
+		})
+	}
+}
+
+func TestClientRedactsSignedURL(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	c := NewClient("3001234", "test-key")
+	c.BaseURL = srv.URL
+	if _, err := c.RouteTypes(); err == nil || strings.Contains(err.Error(), "devid") || strings.Contains(err.Error(), "signature") {
+		t.Errorf("RouteTypes() error = %v, want one without the query string", err)
+	}
+	if _, err := c.ServerTime(); err == nil || strings.Contains(err.Error(), "devid") {
+		t.Errorf("ServerTime() error = %v, want one without the query string", err)
+	}
+}
+
+func TestClientRouteDeparturesPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		routeID     int
+		directionID int
+		wantPath    string
+		wantDir     string
+	}{
+		{name: "unfiltered", wantPath: "/v3/departures/route_type/1/stop/2504"},
+		{name: "route", routeID: 722, wantPath: "/v3/departures/route_type/1/stop/2504/route/722"},
+		{name: "route and direction", routeID: 722, directionID: 5, wantPath: "/v3/departures/route_type/1/stop/2504/route/722", wantDir: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotDir string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotDir = r.URL.Query().Get("direction_id")
+				w.Write([]byte(`{"departures":[]}`))
+			}))
+			defer srv.Close()
+
+			c := NewClient("1000001", "test-key")
+			c.BaseURL = srv.URL
+			if _, err := c.RouteDepartures(1, 2504, tt.routeID, tt.directionID, 5); err != nil {
+				t.Fatalf("RouteDepartures() error = %v", err)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("path = %q, want %q", gotPath, tt.wantPath)
+			}
+			if gotDir != tt.wantDir {
+				t.Errorf("direction_id = %q, want %q", gotDir, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestClientServerTime(t *testing.T) {
+	date := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	for _, status := range []int{http.StatusOK, http.StatusForbidden} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v3/route_types" || r.URL.Query().Get("signature") == "" {
+				t.Errorf("request for %s, want a signed /v3/route_types", r.URL)
+			}
+			w.Header().Set("Date", date.Format(http.TimeFormat))
+			w.WriteHeader(status)
+			w.Write([]byte("{}"))
+		}))
+		c := NewClient("1000001", "test-key")
+		c.BaseURL = srv.URL
+		got, err := c.ServerTime()
+		srv.Close()
+
+		if !got.Equal(date) {
+			t.Errorf("HTTP %d: ServerTime() = %s, want %s", status, got, date)
+		}
+		var apiErr *APIError
+		if (status == http.StatusOK) != (err == nil) || (err != nil && !errors.As(err, &apiErr)) {
+			t.Errorf("HTTP %d: ServerTime() error = %v", status, err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package api
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
 
 // Status is the common status field in API responses.
 type Status struct {
@@ -46,12 +50,60 @@ type ResultOutlet struct {
 
 // DeparturesResponse is the response from GET /v3/departures/...
 type DeparturesResponse struct {
-	Departures []Departure          `json:"departures"`
-	Stops      map[string]StopInfo  `json:"stops"`
-	Routes     map[string]RouteInfo `json:"routes"`
-	Runs       map[string]RunInfo   `json:"runs"`
-	Directions map[string]Direction `json:"directions"`
-	Status     Status               `json:"status"`
+	Departures  []Departure           `json:"departures"`
+	Stops       map[string]StopInfo   `json:"stops"`
+	Routes      map[string]RouteInfo  `json:"routes"`
+	Runs        map[string]RunInfo    `json:"runs"`
+	Directions  map[string]Direction  `json:"directions"`
+	Disruptions map[string]Disruption `json:"disruptions"`
+	Status      Status                `json:"status"`
+}
+
+// PatternResponse is the response from GET /v3/pattern/run/{run_ref}/route_type/{route_type}:
+// the stopping pattern of a run, with one departure per stop.
+type PatternResponse struct {
+	Departures  []Departure           `json:"departures"`
+	Stops       map[string]StopInfo   `json:"stops"`
+	Routes      map[string]RouteInfo  `json:"routes"`
+	Runs        map[string]RunInfo    `json:"runs"`
+	Directions  map[string]Direction  `json:"directions"`
+	Disruptions map[string]Disruption `json:"disruptions"`
+	Status      Status                `json:"status"`
+}
+
+// MergeDepartures combines departures responses, such as those for each
+// route type served at a stop, into one response ordered by departure time.
+func MergeDepartures(resps ...*DeparturesResponse) *DeparturesResponse {
+	merged := &DeparturesResponse{
+		Stops:       make(map[string]StopInfo),
+		Routes:      make(map[string]RouteInfo),
+		Runs:        make(map[string]RunInfo),
+		Directions:  make(map[string]Direction),
+		Disruptions: make(map[string]Disruption),
+	}
+	for _, r := range resps {
+		merged.Departures = append(merged.Departures, r.Departures...)
+		for k, v := range r.Stops {
+			merged.Stops[k] = v
+		}
+		for k, v := range r.Routes {
+			merged.Routes[k] = v
+		}
+		for k, v := range r.Runs {
+			merged.Runs[k] = v
+		}
+		for k, v := range r.Directions {
+			merged.Directions[k] = v
+		}
+		for k, v := range r.Disruptions {
+			merged.Disruptions[k] = v
+		}
+		merged.Status = r.Status
+	}
+	sort.SliceStable(merged.Departures, func(i, j int) bool {
+		return merged.Departures[i].DepartureTime().Before(merged.Departures[j].DepartureTime())
+	})
+	return merged
 }
 
 // Departure is a single departure.
@@ -70,12 +122,26 @@ type Departure struct {
 	DepartureSequence     int        `json:"departure_sequence"`
 }
 
+// DepartureTime returns the estimated departure time if known, else the
+// scheduled time, or the zero time if neither is set.
+func (d Departure) DepartureTime() time.Time {
+	if d.EstimatedDepartureUTC != nil {
+		return *d.EstimatedDepartureUTC
+	}
+	if d.ScheduledDepartureUTC != nil {
+		return *d.ScheduledDepartureUTC
+	}
+	return time.Time{}
+}
+
 // StopInfo is expanded stop info in departures response.
 type StopInfo struct {
-	StopID       int    `json:"stop_id"`
-	StopName     string `json:"stop_name"`
-	StopSuburb   string `json:"stop_suburb"`
-	RouteType    int    `json:"route_type"`
+	StopID        int     `json:"stop_id"`
+	StopName      string  `json:"stop_name"`
+	StopSuburb    string  `json:"stop_suburb"`
+	RouteType     int     `json:"route_type"`
+	StopLatitude  float64 `json:"stop_latitude"`
+	StopLongitude float64 `json:"stop_longitude"`
 }
 
 // RouteInfo is expanded route info in departures response.
@@ -84,15 +150,49 @@ type RouteInfo struct {
 	RouteName   string `json:"route_name"`
 	RouteNumber string `json:"route_number"`
 	RouteType   int    `json:"route_type"`
+	RouteGTFSID string `json:"route_gtfs_id"`
 }
 
 // RunInfo is expanded run info in departures response.
 type RunInfo struct {
-	RunID       int    `json:"run_id"`
-	RunRef      string `json:"run_ref"`
-	RouteID     int    `json:"route_id"`
-	RouteType   int    `json:"route_type"`
-	DirectionID int    `json:"direction_id"`
+	RunID            int    `json:"run_id"`
+	RunRef           string `json:"run_ref"`
+	RouteID          int    `json:"route_id"`
+	RouteType        int    `json:"route_type"`
+	DirectionID      int    `json:"direction_id"`
+	FinalStopID      int    `json:"final_stop_id"`
+	DestinationName  string `json:"destination_name"`
+	Status           string `json:"status"`
+	ExpressStopCount int    `json:"express_stop_count"`
+
+	VehiclePosition   *VehiclePosition   `json:"vehicle_position"`
+	VehicleDescriptor *VehicleDescriptor `json:"vehicle_descriptor"`
+}
+
+// Cancelled reports whether the run is cancelled. The status is compared
+// case-insensitively, as the API does not document its case.
+func (r RunInfo) Cancelled() bool {
+	return strings.EqualFold(r.Status, "cancelled")
+}
+
+// VehiclePosition is the last reported position of the vehicle on a run.
+// It is only returned when requested with expand=VehiclePosition.
+type VehiclePosition struct {
+	Latitude    float64    `json:"latitude"`
+	Longitude   float64    `json:"longitude"`
+	Bearing     float64    `json:"bearing"`
+	DatetimeUTC *time.Time `json:"datetime_utc"`
+	ExpiryTime  *time.Time `json:"expiry_time"`
+}
+
+// VehicleDescriptor describes the vehicle on a run. It is only returned
+// when requested with expand=VehicleDescriptor.
+type VehicleDescriptor struct {
+	Operator       string `json:"operator"`
+	ID             string `json:"id"`
+	Description    string `json:"description"`
+	LowFloor       bool   `json:"low_floor"`
+	AirConditioned bool   `json:"air_conditioned"`
 }
 
 // Direction is a direction entry.
@@ -219,15 +319,33 @@ func (dc DisruptionCategories) AllDisruptions() []Disruption {
 
 // Disruption is a single disruption.
 type Disruption struct {
-	DisruptionID     int        `json:"disruption_id"`
-	Title            string     `json:"title"`
-	Description      string     `json:"description"`
-	DisruptionStatus string     `json:"disruption_status"`
-	DisruptionType   string     `json:"disruption_type"`
-	FromDate         *time.Time `json:"from_date"`
-	ToDate           *time.Time `json:"to_date"`
-	PublishedOn      *time.Time `json:"published_on"`
-	LastUpdated      *time.Time `json:"last_updated"`
+	DisruptionID     int               `json:"disruption_id"`
+	Title            string            `json:"title"`
+	URL              string            `json:"url"`
+	Description      string            `json:"description"`
+	DisruptionStatus string            `json:"disruption_status"`
+	DisruptionType   string            `json:"disruption_type"`
+	FromDate         *time.Time        `json:"from_date"`
+	ToDate           *time.Time        `json:"to_date"`
+	PublishedOn      *time.Time        `json:"published_on"`
+	LastUpdated      *time.Time        `json:"last_updated"`
+	Routes           []DisruptionRoute `json:"routes"`
+	Stops            []DisruptionStop  `json:"stops"`
+}
+
+// DisruptionRoute is a route affected by a disruption.
+type DisruptionRoute struct {
+	RouteID     int    `json:"route_id"`
+	RouteName   string `json:"route_name"`
+	RouteNumber string `json:"route_number"`
+	RouteType   int    `json:"route_type"`
+	RouteGTFSID string `json:"route_gtfs_id"`
+}
+
+// DisruptionStop is a stop affected by a disruption.
+type DisruptionStop struct {
+	StopID   int    `json:"stop_id"`
+	StopName string `json:"stop_name"`
 }
 
 // RouteDisruptionsResponse is the response from GET /v3/disruptions/route/{route_id}.
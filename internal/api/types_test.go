@@ -0,0 +1,67 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeDepartures(t *testing.T) {
+	base := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	at := func(m int) *time.Time {
+		t := base.Add(time.Duration(m) * time.Minute)
+		return &t
+	}
+
+	train := &DeparturesResponse{
+		Departures: []Departure{
+			{RouteID: 6, ScheduledDepartureUTC: at(5)},
+			{RouteID: 6, ScheduledDepartureUTC: at(20)},
+		},
+		Routes: map[string]RouteInfo{"6": {RouteID: 6, RouteType: 0}},
+	}
+	tram := &DeparturesResponse{
+		Departures: []Departure{
+			// Scheduled later than the first train but running early.
+			{RouteID: 722, ScheduledDepartureUTC: at(12), EstimatedDepartureUTC: at(3)},
+			{RouteID: 722, ScheduledDepartureUTC: at(15)},
+		},
+		Routes:      map[string]RouteInfo{"722": {RouteID: 722, RouteType: 1}},
+		Disruptions: map[string]Disruption{"9": {DisruptionID: 9}},
+	}
+
+	got := MergeDepartures(train, tram)
+
+	wantOrder := []int{722, 6, 722, 6}
+	if len(got.Departures) != len(wantOrder) {
+		t.Fatalf("got %d departures, want %d", len(got.Departures), len(wantOrder))
+	}
+	for i, d := range got.Departures {
+		if d.RouteID != wantOrder[i] {
+			t.Errorf("departure %d route = %d, want %d", i, d.RouteID, wantOrder[i])
+		}
+	}
+	if len(got.Routes) != 2 {
+		t.Errorf("got %d routes, want 2", len(got.Routes))
+	}
+	if _, ok := got.Disruptions["9"]; !ok {
+		t.Error("merged response is missing disruption 9")
+	}
+}
+
+func TestRunInfoCancelled(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{"cancelled", true},
+		{"Cancelled", true},
+		{"CANCELLED", true},
+		{"scheduled", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := (RunInfo{Status: tt.status}).Cancelled(); got != tt.want {
+			t.Errorf("RunInfo{Status: %q}.Cancelled() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package cache stores small JSON documents in the user's cache directory
+// (~/.cache/vic-ptv-cli on Linux) so lookups can be reused between runs.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns the cache directory, or "" if it cannot be determined.
+func Dir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(base, "vic-ptv-cli")
+}
+
+// Load decodes the cached document name into v. It reports false, with no
+// error, if nothing has been cached yet.
+func Load(name string, v interface{}) (bool, error) {
+	dir := Dir()
+	if dir == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("reading cache %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// Save writes v as the cached document name, replacing it atomically.
+func Save(name string, v interface{}) error {
+	dir := Dir()
+	if dir == "" {
+		return fmt.Errorf("no cache directory available")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, name+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
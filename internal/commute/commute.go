@@ -0,0 +1,121 @@
+// Package commute joins departures on consecutive legs of a journey into
+// connections that can actually be made, allowing time to change between
+// services.
+package commute
+
+import (
+	"sort"
+	"time"
+)
+
+// Trip is one service that can be taken on a leg.
+type Trip struct {
+	// Label describes the service, such as "tram 96".
+	Label string `json:"label"`
+	// Depart is when the service leaves the leg's boarding stop.
+	Depart time.Time `json:"depart"`
+	// Arrive is when it reaches the leg's alighting stop, or the zero
+	// time if that is not known.
+	Arrive time.Time `json:"arrive"`
+	// Alight is the name of the alighting stop, if known.
+	Alight string `json:"alight,omitempty"`
+}
+
+// Leg is one stage of a commute: the trips available from its boarding stop
+// and the minimum time needed to change onto it from the previous leg.
+type Leg struct {
+	Transfer time.Duration
+	Trips    []Trip
+}
+
+// Connection is a sequence of trips, one per leg, each of which can be
+// caught after arriving on the one before.
+type Connection struct {
+	Trips []Trip `json:"trips"`
+}
+
+// Depart returns when the connection leaves.
+func (c Connection) Depart() time.Time {
+	return c.Trips[0].Depart
+}
+
+// Arrive returns when the connection reaches its final stop, or when its
+// last trip departs if the final arrival time is not known.
+func (c Connection) Arrive() time.Time {
+	last := c.Trips[len(c.Trips)-1]
+	if last.Arrive.IsZero() {
+		return last.Depart
+	}
+	return last.Arrive
+}
+
+// Connections returns the connections that can be made across legs, in
+// departure order. A connection starts from each trip on the first leg and
+// takes the first trip on each later leg that leaves at least Transfer after
+// arriving. Connections that leave earlier but arrive no sooner than another
+// are dropped, since there is no reason to take them.
+func Connections(legs []Leg) []Connection {
+	if len(legs) == 0 {
+		return nil
+	}
+
+	var conns []Connection
+	for _, first := range legs[0].Trips {
+		if c, ok := connect(first, legs[1:]); ok {
+			conns = append(conns, c)
+		}
+	}
+	sort.SliceStable(conns, func(i, j int) bool {
+		return conns[i].Depart().Before(conns[j].Depart())
+	})
+
+	// Walk from the latest departure back, keeping a connection only if it
+	// arrives strictly before every later-leaving one.
+	var kept []Connection
+	var best time.Time
+	for i := len(conns) - 1; i >= 0; i-- {
+		arrive := conns[i].Arrive()
+		if best.IsZero() || arrive.Before(best) {
+			kept = append(kept, conns[i])
+			best = arrive
+		}
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return kept
+}
+
+// connect extends a journey starting with first across the remaining legs.
+func connect(first Trip, rest []Leg) (Connection, bool) {
+	c := Connection{Trips: []Trip{first}}
+	prev := first
+	for _, leg := range rest {
+		if prev.Arrive.IsZero() {
+			return Connection{}, false
+		}
+		earliest := prev.Arrive.Add(leg.Transfer)
+		next, ok := firstFrom(leg.Trips, earliest)
+		if !ok {
+			return Connection{}, false
+		}
+		c.Trips = append(c.Trips, next)
+		prev = next
+	}
+	return c, true
+}
+
+// firstFrom returns the earliest trip departing at or after t.
+func firstFrom(trips []Trip, t time.Time) (Trip, bool) {
+	var best Trip
+	found := false
+	for _, trip := range trips {
+		if trip.Depart.Before(t) {
+			continue
+		}
+		if !found || trip.Depart.Before(best.Depart) {
+			best, found = trip, true
+		}
+	}
+	return best, found
+}
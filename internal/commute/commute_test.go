@@ -0,0 +1,85 @@
+package commute
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnections(t *testing.T) {
+	base := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	tram := func(dep, arr int) Trip { return Trip{Label: "tram", Depart: at(dep), Arrive: at(arr)} }
+	train := func(dep, arr int) Trip { return Trip{Label: "train", Depart: at(dep), Arrive: at(arr)} }
+
+	tests := []struct {
+		name string
+		legs []Leg
+		// want lists the departure minute of each trip in each connection.
+		want [][]int
+	}{
+		{
+			name: "single leg",
+			legs: []Leg{{Trips: []Trip{tram(2, 19), tram(10, 27)}}},
+			want: [][]int{{2}, {10}},
+		},
+		{
+			name: "transfer time respected",
+			legs: []Leg{
+				{Trips: []Trip{tram(2, 19)}},
+				{Transfer: 5 * time.Minute, Trips: []Trip{train(22, 40), train(24, 42), train(35, 53)}},
+			},
+			want: [][]int{{2, 24}},
+		},
+		{
+			name: "earlier tram catching the same train is dropped",
+			legs: []Leg{
+				{Trips: []Trip{tram(2, 15), tram(6, 19), tram(14, 27)}},
+				{Transfer: 3 * time.Minute, Trips: []Trip{train(24, 42), train(34, 52)}},
+			},
+			want: [][]int{{6, 24}, {14, 34}},
+		},
+		{
+			name: "no onward service",
+			legs: []Leg{
+				{Trips: []Trip{tram(2, 19), tram(30, 47)}},
+				{Transfer: 3 * time.Minute, Trips: []Trip{train(24, 42)}},
+			},
+			want: [][]int{{2, 24}},
+		},
+		{
+			name: "unknown arrival cannot connect",
+			legs: []Leg{
+				{Trips: []Trip{{Label: "tram", Depart: at(2)}}},
+				{Trips: []Trip{train(24, 42)}},
+			},
+			want: nil,
+		},
+		{
+			name: "trips out of order",
+			legs: []Leg{
+				{Trips: []Trip{tram(2, 19)}},
+				{Transfer: 2 * time.Minute, Trips: []Trip{train(34, 52), train(24, 42)}},
+			},
+			want: [][]int{{2, 24}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Connections(tt.legs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d connections, want %d", len(got), len(tt.want))
+			}
+			for i, c := range got {
+				if len(c.Trips) != len(tt.want[i]) {
+					t.Fatalf("connection %d has %d trips, want %d", i, len(c.Trips), len(tt.want[i]))
+				}
+				for j, trip := range c.Trips {
+					if !trip.Depart.Equal(at(tt.want[i][j])) {
+						t.Errorf("connection %d trip %d departs %s, want %s", i, j, trip.Depart.Format("15:04"), at(tt.want[i][j]).Format("15:04"))
+					}
+				}
+			}
+		})
+	}
+}
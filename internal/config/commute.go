@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Leg is one stage of a commute as written in the config file. A leg
+// boards at a stop and alights where the next leg boards, unless Alight
+// says otherwise. Favourite fills in any of the stop, route type, route and
+// direction that are not given.
+type Leg struct {
+	Favourite   string `mapstructure:"favourite" json:"favourite,omitempty"`
+	StopID      int    `mapstructure:"stop" json:"stop,omitempty"`
+	RouteType   *int   `mapstructure:"routeType" json:"routeType,omitempty"`
+	RouteID     int    `mapstructure:"route" json:"route,omitempty"`
+	DirectionID int    `mapstructure:"direction" json:"direction,omitempty"`
+	AlightID    int    `mapstructure:"alight" json:"alight,omitempty"`
+	// Transfer is the minimum time needed to change onto this leg.
+	Transfer time.Duration `mapstructure:"transfer" json:"transfer,omitempty"`
+}
+
+// Commutes returns the names of all commutes in the config file, sorted.
+func Commutes() ([]string, error) {
+	commutes := make(map[string][]Leg)
+	read, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if read {
+		if err := fileConfig.UnmarshalKey("commutes", &commutes); err != nil {
+			return nil, fmt.Errorf("reading commutes: %w", err)
+		}
+	}
+	names := make([]string, 0, len(commutes))
+	for name := range commutes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadCommute returns the legs of the commute called name, with favourites
+// applied and alighting stops filled in from the following leg.
+func LoadCommute(name string) ([]Leg, error) {
+	var legs []Leg
+	read, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if read {
+		if err := fileConfig.UnmarshalKey("commutes."+name, &legs); err != nil {
+			return nil, fmt.Errorf("reading commute %q: %w", name, err)
+		}
+	}
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("no commute named %q in %s", name, ConfigFilePath())
+	}
+
+	var favs map[string]Favourite
+	for i := range legs {
+		l := &legs[i]
+		if l.Favourite != "" {
+			if favs == nil {
+				var err error
+				if favs, err = Favourites(); err != nil {
+					return nil, err
+				}
+			}
+			f, ok := favs[l.Favourite]
+			if !ok {
+				return nil, fmt.Errorf("commute %q leg %d: no favourite named %q", name, i+1, l.Favourite)
+			}
+			if l.StopID == 0 {
+				l.StopID = f.StopID
+			}
+			if l.RouteType == nil {
+				l.RouteType = f.RouteType
+			}
+			if l.RouteID == 0 {
+				l.RouteID = f.RouteID
+			}
+			if l.DirectionID == 0 {
+				l.DirectionID = f.DirectionID
+			}
+		}
+		if l.StopID == 0 {
+			return nil, fmt.Errorf("commute %q leg %d: no stop given", name, i+1)
+		}
+		if l.Transfer < 0 {
+			return nil, fmt.Errorf("commute %q leg %d: transfer must not be negative", name, i+1)
+		}
+	}
+	for i := 0; i+1 < len(legs); i++ {
+		if legs[i].AlightID == 0 {
+			legs[i].AlightID = legs[i+1].StopID
+		}
+	}
+	return legs, nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadCommute(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfgPath := ConfigFilePath()
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := `favourites:
+  home-tram:
+    stop: 2504
+    routeType: 1
+    route: 722
+    direction: 5
+commutes:
+  work:
+    - favourite: home-tram
+    - stop: 1071
+      route: 6
+      direction: 1
+      transfer: 5m
+  broken:
+    - favourite: nowhere
+`
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	legs, err := LoadCommute("work")
+	if err != nil {
+		t.Fatalf("LoadCommute() error = %v", err)
+	}
+	if len(legs) != 2 {
+		t.Fatalf("got %d legs, want 2", len(legs))
+	}
+	tram, train := legs[0], legs[1]
+	if tram.StopID != 2504 || tram.RouteID != 722 || tram.DirectionID != 5 || tram.RouteType == nil || *tram.RouteType != 1 {
+		t.Errorf("tram leg = %+v, want the home-tram favourite", tram)
+	}
+	if tram.AlightID != 1071 {
+		t.Errorf("tram leg alights at %d, want the next leg's stop 1071", tram.AlightID)
+	}
+	if train.Transfer != 5*time.Minute {
+		t.Errorf("train leg transfer = %s, want 5m", train.Transfer)
+	}
+	if train.AlightID != 0 {
+		t.Errorf("last leg alights at %d, want 0", train.AlightID)
+	}
+
+	if _, err := LoadCommute("broken"); err == nil {
+		t.Error("LoadCommute(broken) succeeded, want unknown favourite error")
+	}
+	if _, err := LoadCommute("missing"); err == nil {
+		t.Error("LoadCommute(missing) succeeded, want error")
+	}
+
+	names, err := Commutes()
+	if err != nil {
+		t.Fatalf("Commutes() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "broken" || names[1] != "work" {
+		t.Errorf("Commutes() = %v, want [broken work]", names)
+	}
+}
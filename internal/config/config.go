@@ -1,41 +1,162 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/bls/vic-ptv-cli/internal/keyring"
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 )
 
+// Display defaults. PTV is a Melbourne network, so times are shown in
+// Melbourne time regardless of the machine's local zone.
+const (
+	DefaultTimezone   = "Australia/Melbourne"
+	DefaultTimeFormat = "24h"
+	DefaultDateFormat = "2006-01-02"
+)
+
+// Where an API key was found, for Config.KeySource. A key from a keyring
+// has the backend's name as its source.
+const (
+	SourceFlags       = "command-line flags"
+	SourceEnvironment = "environment"
+	SourceConfigFile  = "config file"
+)
+
+// ErrNoCredentials is returned by Load when no developer ID or API key is
+// configured.
+var ErrNoCredentials = errors.New("API credentials not configured")
+
 // Config holds the application configuration.
 type Config struct {
-	DevID  string
-	APIKey string
+	DevID     string
+	APIKey    string
+	KeySource string
+	// BaseURL is the API endpoint, or "" for the public PTV API.
+	BaseURL string
+	Profile string
 }
 
-// ConfigFilePath returns the path to the config file.
-func ConfigFilePath() string {
+// ConfigFileEnv is the environment variable that names the config file
+// when --config is not given.
+const ConfigFileEnv = "PTV_CONFIG"
+
+// configExts are the config file extensions viper can read, in the order
+// ConfigFilePath looks for them.
+var configExts = []string{"yaml", "yml", "toml", "json"}
+
+// configFile is the config file chosen by SetConfigFile.
+var configFile string
+
+// fileConfig holds the settings read from the config file. It is separate
+// from viper's global instance so that nothing else can leak into it.
+var fileConfig = viper.New()
+
+// SetConfigFile makes path the config file, overriding $PTV_CONFIG and the
+// default location. An empty path restores them.
+func SetConfigFile(path string) {
+	configFile = path
+}
+
+// ConfigDir returns the directory holding the config and credentials files:
+// $XDG_CONFIG_HOME/vic-ptv-cli, or ~/.config/vic-ptv-cli.
+func ConfigDir() string {
+	// The XDG spec says relative paths are invalid and should be ignored.
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "vic-ptv-cli")
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return ""
 	}
-	return filepath.Join(home, ".config", "vic-ptv-cli", "config.yaml")
+	return filepath.Join(home, ".config", "vic-ptv-cli")
+}
+
+// ConfigFilePath returns the path to the config file: the one chosen with
+// --config or $PTV_CONFIG, or else config.yaml, .yml, .toml or .json in
+// ConfigDir, whichever exists first. It returns the path of config.yaml
+// when none exists.
+func ConfigFilePath() string {
+	if configFile != "" {
+		return configFile
+	}
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		return path
+	}
+	dir := ConfigDir()
+	if dir == "" {
+		return ""
+	}
+	for _, ext := range configExts {
+		path := filepath.Join(dir, "config."+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// CredentialsFilePath returns the path to the encrypted credentials file
+// used when no Secret Service is available.
+func CredentialsFilePath() string {
+	dir := ConfigDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "credentials.age")
+}
+
+// fileFormat returns the format of the config file at path, from its
+// extension.
+func fileFormat(path string) (string, error) {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case "yaml", "yml":
+		return "yaml", nil
+	case "toml", "json":
+		return ext, nil
+	default:
+		return "", fmt.Errorf("%s: unsupported config file type %q; use .yaml, .yml, .toml or .json", path, ext)
+	}
 }
 
-// Load loads configuration from flags, environment, and config file.
-// Priority: flags > env > config file.
+// KeyringBackends returns where 'auth login' stores API keys, in the order
+// Load consults them. It is a variable so tests can substitute their own.
+var KeyringBackends = func() []keyring.Backend {
+	return keyring.Backends(CredentialsFilePath(), keyring.TerminalPassphrase)
+}
+
+// Load loads the active profile's configuration from flags, environment,
+// config file and keyring. Priority: flags > env > config file > keyring.
+// The keyring is only consulted for the key of a developer ID found earlier
+// in the chain.
 func Load(flagDevID, flagAPIKey string) (*Config, error) {
+	cfg := &Config{Profile: profile}
+	read, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if read {
+		cfg.BaseURL, _ = lookup("baseUrl")
+	}
+
 	// 1. CLI flags (highest priority)
 	if flagDevID != "" && flagAPIKey != "" {
-		return &Config{DevID: flagDevID, APIKey: flagAPIKey}, nil
+		cfg.DevID, cfg.APIKey, cfg.KeySource = flagDevID, flagAPIKey, SourceFlags
+		return cfg, nil
 	}
 
 	// 2. Environment variables
 	envDevID := os.Getenv("PTV_DEV_ID")
 	envAPIKey := os.Getenv("PTV_API_KEY")
 	if envDevID != "" && envAPIKey != "" {
-		return &Config{DevID: envDevID, APIKey: envAPIKey}, nil
+		cfg.DevID, cfg.APIKey, cfg.KeySource = envDevID, envAPIKey, SourceEnvironment
+		return cfg, nil
 	}
 
 	// Mix flags and env if partially set
@@ -43,30 +164,153 @@ func Load(flagDevID, flagAPIKey string) (*Config, error) {
 	if devID == "" {
 		devID = envDevID
 	}
-	apiKey := flagAPIKey
+	apiKey, keySource := flagAPIKey, SourceFlags
 	if apiKey == "" {
-		apiKey = envAPIKey
+		apiKey, keySource = envAPIKey, SourceEnvironment
 	}
 
 	// 3. Config file
-	cfgPath := ConfigFilePath()
-	if cfgPath != "" {
-		viper.SetConfigFile(cfgPath)
-		if err := viper.ReadInConfig(); err == nil {
-			if devID == "" {
-				devID = viper.GetString("devId")
-			}
-			if apiKey == "" {
-				apiKey = viper.GetString("apiKey")
-			}
+	if read {
+		fileDevID, fileAPIKey := credentials()
+		if devID == "" {
+			devID = fileDevID
+		}
+		if apiKey == "" {
+			apiKey, keySource = fileAPIKey, SourceConfigFile
+		}
+	}
+
+	// 4. Keyring
+	if devID != "" && apiKey == "" {
+		backends := KeyringBackends()
+		defer keyring.Close(backends)
+		key, b, err := keyring.Lookup(backends, devID)
+		switch {
+		case err == nil:
+			apiKey, keySource = key, b.Name()
+		case !errors.Is(err, keyring.ErrNotFound):
+			return nil, fmt.Errorf("reading API key: %w", err)
 		}
 	}
 
 	if devID != "" && apiKey != "" {
-		return &Config{DevID: devID, APIKey: apiKey}, nil
+		cfg.DevID, cfg.APIKey, cfg.KeySource = devID, apiKey, keySource
+		return cfg, nil
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// DevID returns the developer ID set in the environment or in the active
+// profile in the config file, or "" if there is none.
+func DevID() string {
+	if id := os.Getenv("PTV_DEV_ID"); id != "" {
+		return id
+	}
+	if ok, _ := readConfigFile(); ok {
+		devID, _ := credentials()
+		return devID
 	}
+	return ""
+}
+
+// SaveDevID sets the developer ID of the active profile in the config file.
+func SaveDevID(devID string) error {
+	path := writePath("devId")
+	return updateFile(func(root *yaml.Node) error {
+		return setPathValue(root, path, devID)
+	})
+}
 
-	return nil, fmt.Errorf("API credentials not configured")
+// RemoveAPIKey removes the active profile's plaintext API key from the
+// config file, reporting whether there was one.
+func RemoveAPIKey() (bool, error) {
+	if ok, err := readConfigFile(); !ok || err != nil {
+		return false, err
+	}
+	var path []string
+	switch {
+	case fileConfig.IsSet(profileKey(profile, "apiKey")):
+		path = []string{"profiles", profile, "apiKey"}
+	case fileConfig.IsSet("apiKey") && !fileConfig.IsSet(profileKey(profile, "devId")):
+		path = []string{"apiKey"}
+	default:
+		return false, nil
+	}
+	var removed bool
+	err := updateFile(func(root *yaml.Node) error {
+		removed = deletePathValue(root, path)
+		return nil
+	})
+	return removed, err
+}
+
+// Display holds settings that control how output is formatted.
+type Display struct {
+	Timezone   string
+	TimeFormat string
+	DateFormat string
+}
+
+// LoadDisplay loads display settings from flags and the active profile in
+// the config file. Priority: flags > config file > defaults. If the config
+// file cannot be read, it returns the error along with the settings from
+// flags and defaults.
+func LoadDisplay(flagTimezone, flagTimeFormat, flagDateFormat string) (*Display, error) {
+	d := &Display{
+		Timezone:   DefaultTimezone,
+		TimeFormat: DefaultTimeFormat,
+		DateFormat: DefaultDateFormat,
+	}
+	read, err := readConfigFile()
+	if read {
+		if tz, _ := lookup("timezone"); tz != "" {
+			d.Timezone = tz
+		}
+		if tf, _ := lookup("timeFormat"); tf != "" {
+			d.TimeFormat = tf
+		}
+		if df, _ := lookup("dateFormat"); df != "" {
+			d.DateFormat = df
+		}
+	}
+	if flagTimezone != "" {
+		d.Timezone = flagTimezone
+	}
+	if flagTimeFormat != "" {
+		d.TimeFormat = flagTimeFormat
+	}
+	if flagDateFormat != "" {
+		d.DateFormat = flagDateFormat
+	}
+	return d, err
+}
+
+// readConfigFile reads the config file into fileConfig, reporting whether
+// there is one. A missing file is not an error, but one that cannot be
+// parsed is.
+func readConfigFile() (bool, error) {
+	cfgPath := ConfigFilePath()
+	if cfgPath == "" {
+		fileConfig = viper.New()
+		return false, nil
+	}
+	if _, err := os.Stat(cfgPath); errors.Is(err, fs.ErrNotExist) {
+		fileConfig = viper.New()
+		return false, nil
+	}
+	format, err := fileFormat(cfgPath)
+	if err != nil {
+		return false, err
+	}
+	v := viper.New()
+	v.SetConfigFile(cfgPath)
+	v.SetConfigType(format)
+	if err := v.ReadInConfig(); err != nil {
+		return false, fmt.Errorf("reading %s: %w", cfgPath, err)
+	}
+	fileConfig = v
+	return true, nil
 }
 
 // PrintAuthHelp prints instructions on how to configure API credentials.
@@ -82,14 +326,17 @@ How to get credentials:
 
 Configure credentials (pick one method):
 
-  Option 1: Environment variables
+  Option 1: Log in, storing the key in your keyring
+    ptv auth login
+
+  Option 2: Environment variables
     export PTV_DEV_ID=your_dev_id
     export PTV_API_KEY=your_api_key
 
-  Option 2: Config file (~/.config/vic-ptv-cli/config.yaml)
+  Option 3: Config file (`+ConfigFilePath()+`)
     devId: your_dev_id
     apiKey: your_api_key
 
-  Option 3: CLI flags
+  Option 4: CLI flags
     ptv --dev-id your_dev_id --api-key your_api_key <command>`)
 }
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bls/vic-ptv-cli/internal/keyring"
+)
+
+// TestMain clears the variables that move the config file, so that tests
+// setting HOME never touch the real one.
+func TestMain(m *testing.M) {
+	os.Unsetenv("XDG_CONFIG_HOME")
+	os.Unsetenv(ConfigFileEnv)
+	os.Exit(m.Run())
+}
+
+// memKeyring is a keyring backend holding keys in a map.
+type memKeyring map[string]string
+
+func (m memKeyring) Name() string { return "test keyring" }
+func (m memKeyring) Get(devID string) (string, error) {
+	if k, ok := m[devID]; ok {
+		return k, nil
+	}
+	return "", keyring.ErrNotFound
+}
+func (m memKeyring) Set(devID, apiKey string) error { m[devID] = apiKey; return nil }
+func (m memKeyring) Delete(devID string) error      { delete(m, devID); return nil }
+
+func TestLoad(t *testing.T) {
+	orig := KeyringBackends
+	t.Cleanup(func() { KeyringBackends = orig })
+	KeyringBackends = func() []keyring.Backend {
+		return []keyring.Backend{memKeyring{"1000001": "from-keyring"}}
+	}
+
+	tests := []struct {
+		name          string
+		config        string
+		env           map[string]string
+		flagID        string
+		flagKey       string
+		wantID        string
+		wantKey       string
+		wantKeySource string
+		wantErr       error
+	}{
+		{name: "flags", flagID: "2", flagKey: "k", config: "devId: \"1000001\"\napiKey: file\n",
+			wantID: "2", wantKey: "k", wantKeySource: SourceFlags},
+		{name: "environment", env: map[string]string{"PTV_DEV_ID": "3", "PTV_API_KEY": "e"},
+			wantID: "3", wantKey: "e", wantKeySource: SourceEnvironment},
+		{name: "config file", config: "devId: \"1000001\"\napiKey: file\n",
+			wantID: "1000001", wantKey: "file", wantKeySource: SourceConfigFile},
+		{name: "keyring", config: "devId: \"1000001\"\n",
+			wantID: "1000001", wantKey: "from-keyring", wantKeySource: "test keyring"},
+		{name: "keyring for flag dev id", flagID: "1000001",
+			wantID: "1000001", wantKey: "from-keyring", wantKeySource: "test keyring"},
+		{name: "env key over keyring", config: "devId: \"1000001\"\n", env: map[string]string{"PTV_API_KEY": "e"},
+			wantID: "1000001", wantKey: "e", wantKeySource: SourceEnvironment},
+		{name: "not in keyring", config: "devId: \"1000002\"\n", wantErr: ErrNoCredentials},
+		{name: "nothing", wantErr: ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("PTV_DEV_ID", tt.env["PTV_DEV_ID"])
+			t.Setenv("PTV_API_KEY", tt.env["PTV_API_KEY"])
+			if tt.config != "" {
+				writeConfig(t, tt.config)
+			}
+			cfg, err := Load(tt.flagID, tt.flagKey)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.DevID != tt.wantID || cfg.APIKey != tt.wantKey || cfg.KeySource != tt.wantKeySource {
+				t.Errorf("Load() = %+v, want %s/%s from %s", cfg, tt.wantID, tt.wantKey, tt.wantKeySource)
+			}
+		})
+	}
+}
+
+func TestSaveDevIDAndRemoveAPIKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("PTV_DEV_ID", "")
+	writeConfig(t, "# credentials\ndevId: \"1\"\napiKey: secret\ntimezone: UTC\n")
+
+	if err := SaveDevID("1000001"); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := RemoveAPIKey(); err != nil || !removed {
+		t.Errorf("RemoveAPIKey() = %v, %v; want the key removed", removed, err)
+	}
+	data, err := os.ReadFile(ConfigFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if strings.Contains(got, "secret") || !strings.Contains(got, `devId: "1000001"`) || !strings.Contains(got, "timezone: UTC") {
+		t.Errorf("config file after SaveDevID:\n%s", got)
+	}
+	if DevID() != "1000001" {
+		t.Errorf("DevID() = %q, want 1000001", DevID())
+	}
+	if removed, err := RemoveAPIKey(); err != nil || removed {
+		t.Errorf("second RemoveAPIKey() = %v, %v; want nothing to remove", removed, err)
+	}
+}
+
+func TestConfigFilePath(t *testing.T) {
+	home := t.TempDir()
+	xdg := t.TempDir()
+	t.Cleanup(func() { SetConfigFile("") })
+
+	tests := []struct {
+		name   string
+		xdg    string
+		env    string
+		flag   string
+		create string
+		want   string
+	}{
+		{name: "default", want: filepath.Join(home, ".config", "vic-ptv-cli", "config.yaml")},
+		{name: "xdg", xdg: xdg, want: filepath.Join(xdg, "vic-ptv-cli", "config.yaml")},
+		{name: "relative xdg", xdg: "relative", want: filepath.Join(home, ".config", "vic-ptv-cli", "config.yaml")},
+		{name: "toml", xdg: xdg, create: "config.toml", want: filepath.Join(xdg, "vic-ptv-cli", "config.toml")},
+		{name: "env", xdg: xdg, env: "/etc/ptv.json", want: "/etc/ptv.json"},
+		{name: "flag", env: "/etc/ptv.json", flag: "ptv.yml", want: "ptv.yml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CONFIG_HOME", tt.xdg)
+			t.Setenv(ConfigFileEnv, tt.env)
+			SetConfigFile(tt.flag)
+			if tt.create != "" {
+				dir := filepath.Join(tt.xdg, "vic-ptv-cli")
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, tt.create), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { os.Remove(filepath.Join(dir, tt.create)) })
+			}
+			if got := ConfigFilePath(); got != tt.want {
+				t.Errorf("ConfigFilePath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	if got, want := CredentialsFilePath(), filepath.Join(xdg, "vic-ptv-cli", "credentials.age"); got != want {
+		t.Errorf("CredentialsFilePath() = %s, want %s", got, want)
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	t.Setenv("PTV_DEV_ID", "")
+	t.Setenv("PTV_API_KEY", "")
+	t.Cleanup(func() { SetConfigFile("") })
+
+	tests := []struct {
+		file   string
+		config string
+		want   string
+	}{
+		{file: "config.yaml", config: "devId: \"1000001\"\napiKey: file\n",
+			want: "devId: \"1000001\"\napiKey: file\ntimezone: UTC\n"},
+		{file: "config.toml", config: "devId = \"1000001\"\napiKey = \"file\"\n",
+			want: "apiKey = 'file'\ndevId = '1000001'\ntimezone = 'UTC'\n"},
+		{file: "config.json", config: `{"devId": "1000001", "apiKey": "file"}`,
+			want: "{\n  \"apiKey\": \"file\",\n  \"devId\": \"1000001\",\n  \"timezone\": \"UTC\"\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			cfgPath := filepath.Join(t.TempDir(), tt.file)
+			SetConfigFile(cfgPath)
+			writeConfig(t, tt.config)
+
+			cfg, err := Load("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.DevID != "1000001" || cfg.APIKey != "file" {
+				t.Errorf("Load() = %+v, want 1000001/file", cfg)
+			}
+			if err := Set("timezone", "UTC"); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(cfgPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("after Set, config file =\n%s\nwant\n%s", data, tt.want)
+			}
+			if d, err := LoadDisplay("", "", ""); err != nil || d.Timezone != "UTC" {
+				t.Errorf("LoadDisplay() = %+v, %v; want timezone UTC", d, err)
+			}
+		})
+	}
+
+	SetConfigFile(filepath.Join(t.TempDir(), "config.ini"))
+	writeConfig(t, "devId=1\n")
+	if _, err := Load("", ""); err == nil || !strings.Contains(err.Error(), "unsupported config file type") {
+		t.Errorf("Load() of an .ini file = %v, want unsupported type error", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeConfig(t, "devId: \"1000001\"\napiKey: [unclosed\n")
+
+	if _, err := Load("", ""); err == nil || !strings.Contains(err.Error(), ConfigFilePath()) {
+		t.Errorf("Load() = %v, want an error naming the config file", err)
+	}
+	d, err := LoadDisplay("", "12h", "au")
+	if err == nil {
+		t.Error("LoadDisplay() returned no error")
+	}
+	if d.Timezone != DefaultTimezone || d.TimeFormat != "12h" || d.DateFormat != "au" {
+		t.Errorf("LoadDisplay() = %+v, want defaults and flags", d)
+	}
+	if _, err := Favourites(); err == nil {
+		t.Error("Favourites() returned no error")
+	}
+	if problems := Validate(); len(problems) != 1 {
+		t.Errorf("Validate() = %v, want one problem", problems)
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// favouriteName restricts favourite names to characters that survive
+// viper's case-insensitive keys and read well after "@".
+var favouriteName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Favourite is a saved stop with optional route and direction filters,
+// referred to on the command line as @name.
+type Favourite struct {
+	StopID int `yaml:"stop" mapstructure:"stop" json:"stop"`
+	// RouteType is nil when the stop's modes should be inferred.
+	RouteType   *int `yaml:"routeType,omitempty" mapstructure:"routeType" json:"routeType,omitempty"`
+	RouteID     int  `yaml:"route,omitempty" mapstructure:"route" json:"route,omitempty"`
+	DirectionID int  `yaml:"direction,omitempty" mapstructure:"direction" json:"direction,omitempty"`
+}
+
+// ValidateFavouriteName checks that name can be used as a favourite.
+func ValidateFavouriteName(name string) error {
+	if !favouriteName.MatchString(name) {
+		return fmt.Errorf("invalid favourite name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// Favourites returns all saved favourites from the config file.
+func Favourites() (map[string]Favourite, error) {
+	favs := make(map[string]Favourite)
+	if read, err := readConfigFile(); !read || err != nil {
+		return favs, err
+	}
+	if err := fileConfig.UnmarshalKey("favourites", &favs); err != nil {
+		return nil, fmt.Errorf("reading favourites: %w", err)
+	}
+	return favs, nil
+}
+
+// FavouriteNames returns the names of all saved favourites, sorted.
+func FavouriteNames(favs map[string]Favourite) []string {
+	names := make([]string, 0, len(favs))
+	for name := range favs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupFavourite returns the favourite called name.
+func LookupFavourite(name string) (Favourite, error) {
+	favs, err := Favourites()
+	if err != nil {
+		return Favourite{}, err
+	}
+	f, ok := favs[name]
+	if !ok {
+		return Favourite{}, fmt.Errorf("no favourite named %q (see 'vic-ptv fav list')", name)
+	}
+	return f, nil
+}
+
+// SaveFavourite adds or replaces the favourite called name in the config file.
+func SaveFavourite(name string, f Favourite) error {
+	if err := ValidateFavouriteName(name); err != nil {
+		return err
+	}
+	return updateFile(func(root *yaml.Node) error {
+		favs := mappingValue(root, "favourites")
+		if favs == nil || favs.Kind != yaml.MappingNode {
+			favs = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingNode(root, "favourites", favs)
+		}
+		return setMappingValue(favs, name, f)
+	})
+}
+
+// RemoveFavourite deletes the favourite called name from the config file.
+func RemoveFavourite(name string) error {
+	return updateFile(func(root *yaml.Node) error {
+		favs := mappingValue(root, "favourites")
+		if favs == nil || !deleteMappingValue(favs, name) {
+			return fmt.Errorf("no favourite named %q", name)
+		}
+		return nil
+	})
+}
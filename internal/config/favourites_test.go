@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFavouritesRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfgPath := ConfigFilePath()
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	original := "# my credentials\ndevId: \"1000001\"\napiKey: secret\n"
+	if err := os.WriteFile(cfgPath, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tram := 1
+	if err := SaveFavourite("home-tram", Favourite{StopID: 2504, RouteType: &tram, RouteID: 722, DirectionID: 5}); err != nil {
+		t.Fatalf("SaveFavourite() error = %v", err)
+	}
+	if err := SaveFavourite("work", Favourite{StopID: 1071}); err != nil {
+		t.Fatalf("SaveFavourite() error = %v", err)
+	}
+
+	favs, err := Favourites()
+	if err != nil {
+		t.Fatalf("Favourites() error = %v", err)
+	}
+	got := favs["home-tram"]
+	if got.StopID != 2504 || got.RouteType == nil || *got.RouteType != 1 || got.RouteID != 722 || got.DirectionID != 5 {
+		t.Errorf("home-tram = %+v, want stop 2504, type 1, route 722, direction 5", got)
+	}
+	if work := favs["work"]; work.StopID != 1071 || work.RouteType != nil {
+		t.Errorf("work = %+v, want stop 1071 with no route type", work)
+	}
+
+	if err := RemoveFavourite("work"); err != nil {
+		t.Fatalf("RemoveFavourite() error = %v", err)
+	}
+	if err := RemoveFavourite("work"); err == nil {
+		t.Error("removing a missing favourite succeeded, want error")
+	}
+
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# my credentials", "devId: \"1000001\"", "apiKey: secret", "home-tram:"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config file is missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "work:") {
+		t.Errorf("config file still contains removed favourite:\n%s", data)
+	}
+}
+
+func TestValidateFavouriteName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "home-tram"},
+		{name: "work_2"},
+		{name: "", wantErr: true},
+		{name: "Home", wantErr: true},
+		{name: "-home", wantErr: true},
+		{name: "home tram", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFavouriteName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFavouriteName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// updateFile applies fn to the top-level mapping of the config file and
+// writes the result back. Editing the YAML node tree rather than
+// re-marshalling the settings keeps the user's comments, key order and key
+// spelling intact. TOML and JSON files are edited through the same tree, but
+// lose their comments and key order. A missing config file is created.
+func updateFile(fn func(root *yaml.Node) error) error {
+	cfgPath := ConfigFilePath()
+	if cfgPath == "" {
+		return fmt.Errorf("cannot determine config file location")
+	}
+	format, err := fileFormat(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(cfgPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := decodeFile(format, data, &doc); err != nil {
+			return fmt.Errorf("parsing %s: %w", cfgPath, err)
+		}
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level must be a mapping", cfgPath)
+	}
+
+	if err := fn(root); err != nil {
+		return err
+	}
+
+	data, err = encodeFile(format, &doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		return err
+	}
+	// The file holds the API key, so keep it private.
+	return os.WriteFile(cfgPath, data, 0o600)
+}
+
+// decodeFile parses data, a config file in format, into doc.
+func decodeFile(format string, data []byte, doc *yaml.Node) error {
+	var v interface{}
+	var err error
+	switch format {
+	case "yaml":
+		return yaml.Unmarshal(data, doc)
+	case "json":
+		err = json.Unmarshal(data, &v)
+	case "toml":
+		err = toml.Unmarshal(data, &v)
+	}
+	if err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := root.Encode(v); err != nil {
+		return err
+	}
+	*doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&root}}
+	return nil
+}
+
+// encodeFile formats doc as a config file in format.
+func encodeFile(format string, doc *yaml.Node) ([]byte, error) {
+	if format == "yaml" {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	var v interface{}
+	if err := doc.Decode(&v); err != nil {
+		return nil, err
+	}
+	if format == "json" {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return append(data, '\n'), err
+	}
+	return toml.Marshal(v)
+}
+
+// mappingValue returns the value node for key in mapping m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets key in mapping m to the YAML encoding of v, keeping
+// the key's position if it already exists.
+func setMappingValue(m *yaml.Node, key string, v interface{}) error {
+	var val yaml.Node
+	if err := val.Encode(v); err != nil {
+		return err
+	}
+	setMappingNode(m, key, &val)
+	return nil
+}
+
+// setMappingNode sets key in mapping m to val, keeping the key's position
+// and comments if it already exists.
+func setMappingNode(m *yaml.Node, key string, val *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			val.HeadComment = m.Content[i+1].HeadComment
+			val.LineComment = m.Content[i+1].LineComment
+			m.Content[i+1] = val
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, val)
+}
+
+// deleteMappingValue removes key from mapping m, reporting whether it was present.
+func deleteMappingValue(m *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// setPathValue sets the value at the key path below mapping m to the YAML
+// encoding of v, creating intermediate mappings as needed.
+func setPathValue(m *yaml.Node, path []string, v interface{}) error {
+	for _, p := range path[:len(path)-1] {
+		child := mappingValue(m, p)
+		if child == nil || child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingNode(m, p, child)
+		}
+		m = child
+	}
+	return setMappingValue(m, path[len(path)-1], v)
+}
+
+// deletePathValue removes the value at the key path below mapping m,
+// reporting whether it was present.
+func deletePathValue(m *yaml.Node, path []string) bool {
+	for _, p := range path[:len(path)-1] {
+		if m = mappingValue(m, p); m == nil || m.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return deleteMappingValue(m, path[len(path)-1])
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notification rule triggers.
+const (
+	NotifyDisruption = "disruption"
+	NotifyDelay      = "delay"
+	NotifyCancelled  = "cancelled"
+)
+
+// Notification sink types.
+const (
+	SinkWebhook = "webhook"
+	SinkSlack   = "slack"
+	SinkNtfy    = "ntfy"
+	SinkDesktop = "desktop"
+)
+
+// DefaultNotifyDelay is how late a departure must be for a delay rule
+// without its own threshold.
+const DefaultNotifyDelay = 5 * time.Minute
+
+// NotifyRule is a condition to be notified about, as written in the config
+// file. Stop and Route are IDs or names as on the command line; Stop may be
+// an @favourite, whose route and direction filters then apply.
+type NotifyRule struct {
+	Name string `mapstructure:"name" json:"name"`
+	// When is what to watch for: NotifyDisruption, NotifyDelay or
+	// NotifyCancelled.
+	When      string `mapstructure:"when" json:"when"`
+	Stop      string `mapstructure:"stop" json:"stop,omitempty"`
+	Route     string `mapstructure:"route" json:"route,omitempty"`
+	RouteType *int   `mapstructure:"routeType" json:"routeType,omitempty"`
+	Direction int    `mapstructure:"direction" json:"direction,omitempty"`
+	// Departure restricts delay and cancellation rules to the departure
+	// scheduled at this time of day, as HH:MM.
+	Departure string `mapstructure:"departure" json:"departure,omitempty"`
+	// Delay is the threshold for delay rules.
+	Delay time.Duration `mapstructure:"delay" json:"delay,omitempty"`
+	// Sinks are the names of the sinks to notify; all of them if empty.
+	Sinks []string `mapstructure:"sinks" json:"sinks,omitempty"`
+}
+
+// NotifySink is somewhere to send notifications.
+type NotifySink struct {
+	// Type is SinkWebhook, SinkSlack, SinkNtfy or SinkDesktop.
+	Type string `mapstructure:"type" json:"type"`
+	URL  string `mapstructure:"url" json:"url,omitempty"`
+	// Headers are added to HTTP requests, for example for authentication.
+	Headers map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+}
+
+// Notify is the notify section of the config file:
+//
+//	notify:
+//	  sinks:
+//	    phone: {type: ntfy, url: https://ntfy.sh/my-topic}
+//	  rules:
+//	    - name: tram-96
+//	      when: disruption
+//	      route: tram 96
+type Notify struct {
+	Sinks map[string]NotifySink `mapstructure:"sinks" json:"sinks"`
+	Rules []NotifyRule          `mapstructure:"rules" json:"rules"`
+}
+
+// LoadNotify returns the notification rules and sinks from the config file,
+// checking that they are complete and consistent.
+func LoadNotify() (*Notify, error) {
+	n := &Notify{Sinks: make(map[string]NotifySink)}
+	read, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if read {
+		if err := fileConfig.UnmarshalKey("notify", n); err != nil {
+			return nil, fmt.Errorf("reading notify: %w", err)
+		}
+	}
+
+	for name, s := range n.Sinks {
+		switch s.Type {
+		case SinkWebhook, SinkSlack, SinkNtfy:
+			if s.URL == "" {
+				return nil, fmt.Errorf("notify sink %q: no url given", name)
+			}
+		case SinkDesktop:
+		default:
+			return nil, fmt.Errorf("notify sink %q: unknown type %q (use webhook, slack, ntfy or desktop)", name, s.Type)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range n.Rules {
+		r := &n.Rules[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("notify rule %d: no name given", i+1)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("notify rule %q: name used twice", r.Name)
+		}
+		seen[r.Name] = true
+
+		switch r.When {
+		case NotifyDisruption:
+			if r.Stop == "" && r.Route == "" {
+				return nil, fmt.Errorf("notify rule %q: give the route or stop to watch for disruptions", r.Name)
+			}
+			if r.Stop != "" && r.Route != "" {
+				return nil, fmt.Errorf("notify rule %q: give either route or stop for disruptions, not both", r.Name)
+			}
+		case NotifyDelay, NotifyCancelled:
+			if r.Stop == "" {
+				return nil, fmt.Errorf("notify rule %q: give the stop to watch departures from", r.Name)
+			}
+		default:
+			return nil, fmt.Errorf("notify rule %q: unknown trigger %q (use disruption, delay or cancelled)", r.Name, r.When)
+		}
+		if r.Departure != "" {
+			t, err := time.Parse("15:04", r.Departure)
+			if err != nil {
+				return nil, fmt.Errorf("notify rule %q: departure %q is not a time like 08:02", r.Name, r.Departure)
+			}
+			r.Departure = t.Format("15:04")
+		}
+		if r.When == NotifyDelay && r.Delay == 0 {
+			r.Delay = DefaultNotifyDelay
+		}
+		if r.Delay < 0 {
+			return nil, fmt.Errorf("notify rule %q: delay must not be negative", r.Name)
+		}
+		for j, s := range r.Sinks {
+			// Viper lowercases map keys, so sink names are case-insensitive.
+			r.Sinks[j] = strings.ToLower(s)
+			if _, ok := n.Sinks[r.Sinks[j]]; !ok {
+				return nil, fmt.Errorf("notify rule %q: no sink named %q", r.Name, s)
+			}
+		}
+		if len(r.Sinks) == 0 && len(n.Sinks) == 0 {
+			return nil, fmt.Errorf("notify rule %q: no sinks configured to notify", r.Name)
+		}
+		slices.Sort(r.Sinks)
+	}
+	return n, nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, cfg string) {
+	t.Helper()
+	cfgPath := ConfigFilePath()
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadNotify(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeConfig(t, `notify:
+  sinks:
+    phone:
+      type: ntfy
+      url: https://ntfy.sh/commute
+      headers:
+        Authorization: Bearer tk_x
+    laptop:
+      type: desktop
+  rules:
+    - name: tram-96
+      when: disruption
+      route: 96
+    - name: morning-train
+      when: delay
+      stop: "@home-train"
+      departure: "8:02"
+      sinks: [phone]
+    - name: cancellations
+      when: cancelled
+      stop: 1071
+`)
+
+	n, err := LoadNotify()
+	if err != nil {
+		t.Fatalf("LoadNotify() error = %v", err)
+	}
+	if len(n.Sinks) != 2 || n.Sinks["phone"].URL != "https://ntfy.sh/commute" || n.Sinks["phone"].Headers["authorization"] != "Bearer tk_x" {
+		t.Errorf("sinks = %+v", n.Sinks)
+	}
+	if len(n.Rules) != 3 {
+		t.Fatalf("got %d rules, want 3", len(n.Rules))
+	}
+	if r := n.Rules[0]; r.Route != "96" || r.When != NotifyDisruption {
+		t.Errorf("tram-96 = %+v, want route 96 disruptions", r)
+	}
+	if r := n.Rules[1]; r.Delay != DefaultNotifyDelay || r.Departure != "08:02" || len(r.Sinks) != 1 {
+		t.Errorf("morning-train = %+v, want the 08:02 delayed by %s to phone", r, DefaultNotifyDelay)
+	}
+
+	const desktop = "sinks: {laptop: {type: desktop}}\n  "
+	bad := map[string]string{
+		"unknown trigger":   desktop + "rules: [{name: a, when: late, stop: 1}]",
+		"no stop":           desktop + "rules: [{name: a, when: cancelled}]",
+		"route and stop":    desktop + "rules: [{name: a, when: disruption, stop: 1, route: 2}]",
+		"bad time":          desktop + "rules: [{name: a, when: delay, stop: 1, departure: 8am}]",
+		"unknown sink":      desktop + "rules: [{name: a, when: delay, stop: 1, sinks: [pager]}]",
+		"duplicate name":    desktop + "rules: [{name: a, when: delay, stop: 1}, {name: a, when: cancelled, stop: 1}]",
+		"sink without url":  "sinks: {hook: {type: webhook}}",
+		"unknown sink type": "sinks: {pager: {type: pager}}",
+		"no sinks":          "rules: [{name: a, when: delay, stop: 1}]",
+	}
+	for name, cfg := range bad {
+		t.Run(name, func(t *testing.T) {
+			writeConfig(t, "notify:\n  "+cfg+"\n")
+			if _, err := LoadNotify(); err == nil {
+				t.Error("LoadNotify() succeeded, want an error")
+			}
+		})
+	}
+
+	writeConfig(t, "notify:\n  sinks: {laptop: {type: desktop}}\n  rules: [{name: a, when: delay, stop: 1, delay: 10m}]\n")
+	if n, err := LoadNotify(); err != nil || n.Rules[0].Delay != 10*time.Minute {
+		t.Errorf("LoadNotify() = %+v, %v; want a 10m delay", n, err)
+	}
+}
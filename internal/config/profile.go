@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the profile used when none is chosen. Settings at the
+// top level of the config file belong to it, and are inherited by the other
+// profiles.
+const DefaultProfile = "default"
+
+// ProfileEnv is the environment variable that chooses a profile when
+// --profile is not given.
+const ProfileEnv = "PTV_PROFILE"
+
+// profile is the active profile, chosen by UseProfile.
+var profile = DefaultProfile
+
+// UseProfile makes name the active profile, or $PTV_PROFILE when name is
+// empty, or else the default profile.
+func UseProfile(name string) error {
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	if !favouriteName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	profile = name
+	return nil
+}
+
+// Profile returns the name of the active profile.
+func Profile() string {
+	return profile
+}
+
+// CheckProfile reports an error if the active profile is not in the config
+// file. The default profile always exists.
+func CheckProfile() error {
+	if profile == DefaultProfile {
+		return nil
+	}
+	read, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	if read && fileConfig.IsSet("profiles."+profile) {
+		return nil
+	}
+	return fmt.Errorf("no profile named %q in %s (see 'vic-ptv config')", profile, ConfigFilePath())
+}
+
+// Profiles returns the names of the profiles in the config file, sorted,
+// always including the default profile.
+func Profiles() []string {
+	names := []string{DefaultProfile}
+	if read, _ := readConfigFile(); read {
+		for name := range fileConfig.GetStringMap("profiles") {
+			if name != DefaultProfile {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// ProfileSummary describes a profile for listing.
+type ProfileSummary struct {
+	Name    string `json:"name"`
+	DevID   string `json:"devId,omitempty"`
+	BaseURL string `json:"baseUrl,omitempty"`
+	Active  bool   `json:"active"`
+}
+
+// ProfileSummaries describes every profile in the config file.
+func ProfileSummaries() []ProfileSummary {
+	names := Profiles()
+	summaries := make([]ProfileSummary, len(names))
+	for i, name := range names {
+		summaries[i] = ProfileSummary{Name: name, Active: name == profile}
+		summaries[i].DevID, _ = credentialsOf(name)
+		summaries[i].BaseURL, _ = lookupIn(name, "baseUrl")
+	}
+	return summaries
+}
+
+// profileKey returns the viper key of setting key in profile name.
+func profileKey(name, key string) string {
+	return "profiles." + name + "." + key
+}
+
+// lookup returns setting key of the active profile, falling back to the top
+// level of the config file, which must already have been read.
+func lookup(key string) (string, bool) {
+	return lookupIn(profile, key)
+}
+
+func lookupIn(name, key string) (string, bool) {
+	if fileConfig.IsSet(profileKey(name, key)) {
+		return fileConfig.GetString(profileKey(name, key)), true
+	}
+	if fileConfig.IsSet(key) {
+		return fileConfig.GetString(key), true
+	}
+	return "", false
+}
+
+// credentials returns the developer ID and API key of the active profile
+// from the config file, which must already have been read.
+func credentials() (devID, apiKey string) {
+	return credentialsOf(profile)
+}
+
+// credentialsOf returns the developer ID and API key of profile name. A
+// profile that sets its own developer ID does not inherit the top-level API
+// key, which belongs to a different ID.
+func credentialsOf(name string) (devID, apiKey string) {
+	if fileConfig.IsSet(profileKey(name, "devId")) {
+		return fileConfig.GetString(profileKey(name, "devId")), fileConfig.GetString(profileKey(name, "apiKey"))
+	}
+	devID, _ = lookupIn(name, "devId")
+	apiKey, _ = lookupIn(name, "apiKey")
+	return devID, apiKey
+}
+
+// writePath returns the path that setting key of the active profile is
+// written to: inside the profile's entry under profiles, or at the top level
+// for the default profile when it has no entry.
+func writePath(key string) []string {
+	path := strings.Split(key, ".")
+	read, _ := readConfigFile()
+	if profile == DefaultProfile && !(read && fileConfig.IsSet("profiles."+DefaultProfile)) {
+		return path
+	}
+	return append([]string{"profiles", profile}, path...)
+}
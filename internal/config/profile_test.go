@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bls/vic-ptv-cli/internal/keyring"
+)
+
+const profilesConfig = `devId: "1000001"
+apiKey: top-level-key
+timezone: Australia/Melbourne
+output: json
+profiles:
+  work:
+    devId: "2000002"
+    baseUrl: https://ptv-proxy.example.com
+    timeFormat: 12h
+  shared-key:
+    timezone: UTC
+`
+
+func TestProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("PTV_DEV_ID", "")
+	t.Setenv("PTV_API_KEY", "")
+	t.Cleanup(func() { profile = DefaultProfile })
+	orig := KeyringBackends
+	t.Cleanup(func() { KeyringBackends = orig })
+	KeyringBackends = func() []keyring.Backend {
+		return []keyring.Backend{memKeyring{"2000002": "work-key"}}
+	}
+	writeConfig(t, profilesConfig)
+
+	if got, want := Profiles(), []string{"default", "shared-key", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Profiles() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		profile    string
+		env        string
+		wantID     string
+		wantKey    string
+		wantBase   string
+		wantTZ     string
+		wantClock  string
+		wantOutput string
+	}{
+		{wantID: "1000001", wantKey: "top-level-key", wantTZ: "Australia/Melbourne", wantClock: "24h", wantOutput: OutputJSON},
+		{profile: "work", wantID: "2000002", wantKey: "work-key", wantBase: "https://ptv-proxy.example.com",
+			wantTZ: "Australia/Melbourne", wantClock: "12h", wantOutput: OutputJSON},
+		{env: "work", wantID: "2000002", wantKey: "work-key", wantBase: "https://ptv-proxy.example.com",
+			wantTZ: "Australia/Melbourne", wantClock: "12h", wantOutput: OutputJSON},
+		{profile: "shared-key", env: "work", wantID: "1000001", wantKey: "top-level-key", wantTZ: "UTC", wantClock: "24h", wantOutput: OutputJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile+"/"+tt.env, func(t *testing.T) {
+			t.Setenv(ProfileEnv, tt.env)
+			if err := UseProfile(tt.profile); err != nil {
+				t.Fatal(err)
+			}
+			if err := CheckProfile(); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.DevID != tt.wantID || cfg.APIKey != tt.wantKey || cfg.BaseURL != tt.wantBase {
+				t.Errorf("Load() = %+v, want %s/%s at %q", cfg, tt.wantID, tt.wantKey, tt.wantBase)
+			}
+			if d, err := LoadDisplay("", "", ""); err != nil || d.Timezone != tt.wantTZ || d.TimeFormat != tt.wantClock {
+				t.Errorf("LoadDisplay() = %+v, %v; want %s, %s", d, err, tt.wantTZ, tt.wantClock)
+			}
+			if d, err := LoadDefaults(); err != nil || d.Output != tt.wantOutput {
+				t.Errorf("LoadDefaults() = %+v, %v; want output %s", d, err, tt.wantOutput)
+			}
+		})
+	}
+
+	if err := UseProfile("personal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckProfile(); err == nil {
+		t.Error("CheckProfile() accepted a profile that is not in the config file")
+	}
+	if err := UseProfile("Bad Name"); err == nil {
+		t.Error("UseProfile() accepted an invalid name")
+	}
+}
+
+func TestProfileWrites(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { profile = DefaultProfile })
+	writeConfig(t, profilesConfig)
+
+	profile = "personal"
+	if err := Set("timeFormat", "12h"); err != nil {
+		t.Fatal(err)
+	}
+	profile = "work"
+	if err := SaveDevID("3000003"); err != nil {
+		t.Fatal(err)
+	}
+	// The top-level key belongs to the default profile's developer ID.
+	if removed, err := RemoveAPIKey(); err != nil || removed {
+		t.Errorf("RemoveAPIKey() for work = %v, %v; want nothing removed", removed, err)
+	}
+	profile = DefaultProfile
+	if err := Set("timezone", "UTC"); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := RemoveAPIKey(); err != nil || !removed {
+		t.Errorf("RemoveAPIKey() for default = %v, %v; want the top-level key removed", removed, err)
+	}
+
+	data, err := os.ReadFile(ConfigFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.NewReplacer(
+		"apiKey: top-level-key\n", "",
+		"timezone: Australia/Melbourne", "timezone: UTC",
+		`devId: "2000002"`, `devId: "3000003"`,
+	).Replace(profilesConfig) + "  personal:\n    timeFormat: 12h\n"
+	if string(data) != want {
+		t.Errorf("config file =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeConfig(t, profilesConfig+"  broken:\n    timeFormat: 13h\n    favourites:\n      home: {stop: 1071}\n")
+	problems := Validate()
+	want := []string{"apiKey:", "profiles.broken.timeFormat:", "profiles.broken.favourites: unknown setting"}
+	if len(problems) != len(want) {
+		t.Fatalf("Validate() = %v, want %d problems", problems, len(want))
+	}
+	for i, p := range problems {
+		if !strings.HasPrefix(p.Error(), want[i]) {
+			t.Errorf("problem %d = %q, want %q", i, p, want[i])
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+)
+
+// ServeTokens returns the API tokens of the clients allowed to use the
+// proxy server, keyed by client name, from the serve.tokens section of the
+// config file:
+//
+//	serve:
+//	  tokens:
+//	    dashboard: 6f1c0a...
+func ServeTokens() (map[string]string, error) {
+	tokens := make(map[string]string)
+	if read, err := readConfigFile(); !read || err != nil {
+		return tokens, err
+	}
+	if err := fileConfig.UnmarshalKey("serve.tokens", &tokens); err != nil {
+		return nil, fmt.Errorf("reading serve.tokens: %w", err)
+	}
+	for name, t := range tokens {
+		if len(t) < 16 {
+			return nil, fmt.Errorf("serve token for %q is too short; use at least 16 characters", name)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Output formats for the output setting.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// apiKeyPattern matches the UUIDs PTV issues as API keys.
+var apiKeyPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Setting is a single-valued config file setting that 'config get' and
+// 'config set' manage. Keys of nested settings are dotted paths. Every
+// setting can be given per profile.
+type Setting struct {
+	Key         string
+	Description string
+	// Default is the value used when the setting is absent, or "" for none.
+	Default string
+	// Secret settings are masked when listed.
+	Secret bool
+	// Int settings are written to the file as numbers.
+	Int   bool
+	Check func(value string) error
+}
+
+// Settings lists the settings 'config set' accepts, in the order they are
+// listed and asked for by 'config init'.
+var Settings = []Setting{
+	{Key: "devId", Description: "PTV developer ID", Check: checkDevID},
+	{Key: "apiKey", Description: "PTV API key (prefer 'vic-ptv auth login')", Secret: true, Check: checkAPIKey},
+	{Key: "baseUrl", Description: "API endpoint, for a proxy or test server (default the PTV API)", Check: checkBaseURL},
+	{Key: "timezone", Description: "Timezone for displayed times", Default: DefaultTimezone, Check: checkTimezone},
+	{Key: "timeFormat", Description: "Clock style for displayed times: 12h or 24h", Default: DefaultTimeFormat, Check: checkTimeFormat},
+	{Key: "dateFormat", Description: "Date layout for displayed dates, e.g. 2006-01-02 or 02/01/2006", Default: DefaultDateFormat, Check: checkNonEmpty},
+	{Key: "output", Description: "Default output format: table or json", Default: OutputTable, Check: oneOf(OutputTable, OutputJSON)},
+	{Key: "defaults.routeType", Description: "Route type used when --route-type is not given (0=train, 1=tram, 2=bus, 3=vline_train, 4=vline_coach)", Int: true, Check: checkRouteType},
+}
+
+// sections are the top-level keys holding structured settings, edited by
+// their own commands.
+var sections = []string{"favourites", "commutes", "serve", "notify", "profiles"}
+
+// LookupSetting returns the setting called key, ignoring case.
+func LookupSetting(key string) (Setting, error) {
+	for _, s := range Settings {
+		if strings.EqualFold(s.Key, key) {
+			return s, nil
+		}
+	}
+	keys := make([]string, len(Settings))
+	for i, s := range Settings {
+		keys[i] = s.Key
+	}
+	return Setting{}, fmt.Errorf("unknown setting %q (known settings: %s)", key, strings.Join(keys, ", "))
+}
+
+// Get returns the value of the setting called key for the active profile,
+// reporting whether it is set in the config file.
+func Get(key string) (string, bool, error) {
+	s, err := LookupSetting(key)
+	if err != nil {
+		return "", false, err
+	}
+	if read, err := readConfigFile(); !read || err != nil {
+		return s.Default, false, err
+	}
+	if v, ok := lookup(s.Key); ok {
+		return v, true, nil
+	}
+	return s.Default, false, nil
+}
+
+// SettingValue is a setting with its value in the config file, or its
+// default when IsSet is false.
+type SettingValue struct {
+	Setting
+	Value string
+	IsSet bool
+}
+
+// SettingValues returns the value of every setting for the active profile.
+func SettingValues() []SettingValue {
+	read, _ := readConfigFile()
+	values := make([]SettingValue, len(Settings))
+	for i, s := range Settings {
+		values[i] = SettingValue{Setting: s, Value: s.Default}
+		if !read {
+			continue
+		}
+		if v, ok := lookup(s.Key); ok {
+			values[i].Value, values[i].IsSet = v, true
+		}
+	}
+	return values
+}
+
+// Set checks value and writes it to the config file as the setting called
+// key of the active profile.
+func Set(key, value string) error {
+	s, err := LookupSetting(key)
+	if err != nil {
+		return err
+	}
+	if err := s.Check(value); err != nil {
+		return fmt.Errorf("%s: %w", s.Key, err)
+	}
+	var v interface{} = value
+	if s.Int {
+		v, _ = strconv.Atoi(value)
+	}
+	path := writePath(s.Key)
+	return updateFile(func(root *yaml.Node) error {
+		return setPathValue(root, path, v)
+	})
+}
+
+// Unset removes the setting called key of the active profile from the
+// config file, reporting whether it was there.
+func Unset(key string) (bool, error) {
+	s, err := LookupSetting(key)
+	if err != nil {
+		return false, err
+	}
+	path := writePath(s.Key)
+	var removed bool
+	err = updateFile(func(root *yaml.Node) error {
+		removed = deletePathValue(root, path)
+		return nil
+	})
+	return removed, err
+}
+
+// Defaults holds settings that stand in for command-line flags that were
+// not given.
+type Defaults struct {
+	// RouteType is nil when commands should infer or ask for the mode.
+	RouteType *int
+	Output    string
+}
+
+// LoadDefaults loads the defaults of the active profile from the config
+// file.
+func LoadDefaults() (*Defaults, error) {
+	d := &Defaults{Output: OutputTable}
+	if read, err := readConfigFile(); !read || err != nil {
+		return d, err
+	}
+	if o, _ := lookup("output"); o != "" {
+		if err := oneOf(OutputTable, OutputJSON)(o); err != nil {
+			return nil, fmt.Errorf("output: %w", err)
+		}
+		d.Output = o
+	}
+	if v, ok := lookup("defaults.routeType"); ok {
+		if err := checkRouteType(v); err != nil {
+			return nil, fmt.Errorf("defaults.routeType: %w", err)
+		}
+		rt, _ := strconv.Atoi(v)
+		d.RouteType = &rt
+	}
+	return d, nil
+}
+
+// Validate checks the config file against the settings and sections this
+// version understands, returning every problem found. A missing config file
+// is not a problem.
+func Validate() []error {
+	read, err := readConfigFile()
+	if err != nil {
+		return []error{err}
+	}
+	if !read {
+		return nil
+	}
+
+	problems := checkSettings("", sections)
+	for name := range fileConfig.GetStringMap("profiles") {
+		if !favouriteName.MatchString(name) {
+			problems = append(problems, fmt.Errorf("profiles.%s: invalid profile name; use lowercase letters, digits, '-' and '_'", name))
+		}
+	}
+	for _, name := range Profiles() {
+		problems = append(problems, checkSettings("profiles."+name+".", nil)...)
+	}
+
+	if _, err := Favourites(); err != nil {
+		problems = append(problems, err)
+	}
+	if names, err := Commutes(); err != nil {
+		problems = append(problems, err)
+	} else {
+		for _, name := range names {
+			if _, err := LoadCommute(name); err != nil {
+				problems = append(problems, err)
+			}
+		}
+	}
+	if _, err := ServeTokens(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := LoadNotify(); err != nil {
+		problems = append(problems, err)
+	}
+	return problems
+}
+
+// checkSettings checks the settings whose keys start with prefix, and that
+// every key there is a setting or one of sections.
+func checkSettings(prefix string, sections []string) []error {
+	var problems []error
+	known := make(map[string]bool)
+	for _, s := range Settings {
+		known[strings.ToLower(strings.Split(s.Key, ".")[0])] = true
+		if fileConfig.IsSet(prefix + s.Key) {
+			if err := s.Check(fileConfig.GetString(prefix + s.Key)); err != nil {
+				problems = append(problems, fmt.Errorf("%s%s: %w", prefix, s.Key, err))
+			}
+		}
+	}
+	for _, s := range sections {
+		known[s] = true
+	}
+	var unknown []string
+	for _, key := range fileConfig.AllKeys() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		top := strings.Split(strings.TrimPrefix(key, prefix), ".")[0]
+		if !known[top] {
+			unknown = append(unknown, top)
+			known[top] = true
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		problems = append(problems, fmt.Errorf("%s%s: unknown setting", prefix, key))
+	}
+	return problems
+}
+
+func checkBaseURL(v string) error {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", v)
+	}
+	return nil
+}
+
+func checkDevID(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+		return fmt.Errorf("%q is not a developer ID; it is the number PTV sent with the key", v)
+	}
+	return nil
+}
+
+func checkAPIKey(v string) error {
+	if !apiKeyPattern.MatchString(v) {
+		return fmt.Errorf("does not look like a PTV API key, which is a UUID like aaaabbbb-cccc-dddd-eeee-ffffffaaaaaa")
+	}
+	return nil
+}
+
+func checkTimezone(v string) error {
+	if _, err := time.LoadLocation(v); err != nil || v == "" {
+		return fmt.Errorf("unknown timezone %q; use a name like Australia/Melbourne", v)
+	}
+	return nil
+}
+
+func checkTimeFormat(v string) error {
+	switch strings.ToLower(v) {
+	case "12h", "24h", "12", "24":
+		return nil
+	}
+	return fmt.Errorf("%q is not 12h or 24h", v)
+}
+
+func checkNonEmpty(v string) error {
+	if v == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+func checkRouteType(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 0 || n > 4 {
+		return fmt.Errorf("%q is not a route type; use 0=train, 1=tram, 2=bus, 3=vline_train or 4=vline_coach", v)
+	}
+	return nil
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(v string) error {
+		for _, ok := range values {
+			if v == ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", v, strings.Join(values, ", "))
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetGetUnset(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeConfig(t, "# display\ntimezone: UTC\n")
+
+	if err := Set("timeformat", "12h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set("defaults.routeType", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set("timezone", "Mars/Olympus"); err == nil {
+		t.Error("Set() accepted an unknown timezone")
+	}
+	if err := Set("colour", "red"); err == nil {
+		t.Error("Set() accepted an unknown setting")
+	}
+
+	data, err := os.ReadFile(ConfigFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# display\ntimezone: UTC\ntimeFormat: 12h\ndefaults:\n  routeType: 1\n"; string(data) != want {
+		t.Errorf("config file =\n%s\nwant\n%s", data, want)
+	}
+
+	if v, set, err := Get("timeFormat"); err != nil || !set || v != "12h" {
+		t.Errorf("Get(timeFormat) = %q, %v, %v; want 12h", v, set, err)
+	}
+	if v, set, err := Get("dateFormat"); err != nil || set || v != DefaultDateFormat {
+		t.Errorf("Get(dateFormat) = %q, %v, %v; want the default", v, set, err)
+	}
+	d, err := LoadDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.RouteType == nil || *d.RouteType != 1 || d.Output != OutputTable {
+		t.Errorf("LoadDefaults() = %+v, want route type 1 and table output", d)
+	}
+
+	if removed, err := Unset("defaults.routeType"); err != nil || !removed {
+		t.Errorf("Unset() = %v, %v; want removed", removed, err)
+	}
+	if removed, err := Unset("output"); err != nil || removed {
+		t.Errorf("Unset(output) = %v, %v; want nothing removed", removed, err)
+	}
+	if d, _ := LoadDefaults(); d.RouteType != nil {
+		t.Errorf("route type still set after Unset: %d", *d.RouteType)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{name: "valid", config: `devId: "1000001"
+apiKey: aaaabbbb-cccc-dddd-eeee-ffffffaaaaaa
+timezone: Australia/Melbourne
+timeFormat: 24h
+output: json
+defaults:
+  routeType: 0
+favourites:
+  home:
+    stop: 1071
+`},
+		{name: "syntax error", config: "devId: [\n", want: []string{"reading "}},
+		{name: "bad values", config: "devId: me\napiKey: secret\ntimeFormat: 13h\noutput: xml\ndefaults:\n  routeType: 9\n",
+			want: []string{"devId:", "apiKey:", "timeFormat:", "output:", "defaults.routeType:"}},
+		{name: "unknown keys", config: "timezone: UTC\ncolour: red\napikeys: x\n", want: []string{"apikeys: unknown setting", "colour: unknown setting"}},
+		{name: "bad section", config: "notify:\n  rules:\n    - name: x\n      when: sometimes\n", want: []string{`notify rule "x"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			writeConfig(t, tt.config)
+			problems := Validate()
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want %d problems", problems, len(tt.want))
+			}
+			for i, p := range problems {
+				if !strings.Contains(p.Error(), tt.want[i]) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, p, tt.want[i])
+				}
+			}
+		})
+	}
+}
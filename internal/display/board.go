@@ -0,0 +1,178 @@
+package display
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// Board is a full-screen departure board for a single stop, laid out like a
+// station passenger information display.
+type Board struct {
+	StopName   string
+	Departures *api.DeparturesResponse
+	// Messages are disruption messages cycled through at the bottom.
+	Messages []string
+	// Err is the most recent refresh error, if any.
+	Err     error
+	Updated time.Time
+}
+
+// Board column widths, in terminal cells.
+const (
+	boardTimeWidth     = 7
+	boardPlatformWidth = 8
+	boardMinutesWidth  = 7
+	boardRowHeight     = 3
+)
+
+// Render lays the board out to exactly fill width x height cells. page
+// selects which disruption message is shown.
+func (b *Board) Render(now time.Time, width, height, page int) []string {
+	width = max(width, 40)
+	height = max(height, 8)
+
+	lines := make([]string, 0, height)
+	title := strings.ToUpper(b.StopName)
+	clock := FormatTime(now)
+	header := " " + Truncate(title, width-StringWidth(clock)-4)
+	header = padRight(header, width-StringWidth(clock)-1) + clock + " "
+	lines = append(lines, escReverse+escBold+header+escReset, "")
+
+	footer := b.footer(width, page)
+	rows := (height - len(lines) - len(footer)) / boardRowHeight
+	deps := b.upcoming(now)
+	if len(deps) == 0 {
+		lines = append(lines, " No upcoming departures.")
+	}
+	if len(deps) > rows {
+		deps = deps[:rows]
+	}
+	destWidth := width - boardTimeWidth - boardPlatformWidth - boardMinutesWidth - 2
+	for _, d := range deps {
+		t := d.DepartureTime()
+		dest := Truncate(b.destination(d), destWidth-1)
+		platform := "-"
+		if d.PlatformNumber != "" {
+			platform = "Plat " + d.PlatformNumber
+		}
+		mins := minutesUntil(now, t)
+		main := " " + padRight(FormatTime(t), boardTimeWidth) +
+			padRight(dest, destWidth) +
+			padRight(platform, boardPlatformWidth) +
+			fmt.Sprintf("%*s", boardMinutesWidth, mins)
+		lines = append(lines,
+			escBold+main+escReset,
+			" "+strings.Repeat(" ", boardTimeWidth)+Truncate(b.pattern(d), width-boardTimeWidth-2),
+			"")
+	}
+
+	for len(lines) < height-len(footer) {
+		lines = append(lines, "")
+	}
+	return append(lines, footer...)
+}
+
+// footer returns the status and disruption lines at the bottom of the board.
+func (b *Board) footer(width, page int) []string {
+	footer := []string{strings.Repeat("─", width)}
+	switch {
+	case b.Err != nil:
+		footer = append(footer, " "+Truncate("Update failed: "+b.Err.Error(), width-2))
+	case len(b.Messages) == 0:
+		footer = append(footer, " "+Truncate("Good service — no disruptions reported.", width-2))
+	default:
+		i := page % len(b.Messages)
+		counter := ""
+		if len(b.Messages) > 1 {
+			counter = fmt.Sprintf(" (%d/%d)", i+1, len(b.Messages))
+		}
+		msg := Truncate("* "+b.Messages[i], width-2-StringWidth(counter))
+		footer = append(footer, " "+msg+counter)
+	}
+	if !b.Updated.IsZero() {
+		footer = append(footer, fmt.Sprintf(" Updated %s", FormatTime(b.Updated)))
+	}
+	return footer
+}
+
+// upcoming returns departures that have not yet left, in time order.
+func (b *Board) upcoming(now time.Time) []api.Departure {
+	if b.Departures == nil {
+		return nil
+	}
+	var deps []api.Departure
+	for _, d := range b.Departures.Departures {
+		t := d.DepartureTime()
+		if t.IsZero() || t.Before(now.Add(-time.Minute)) {
+			continue
+		}
+		deps = append(deps, d)
+	}
+	sort.SliceStable(deps, func(i, j int) bool {
+		return deps[i].DepartureTime().Before(deps[j].DepartureTime())
+	})
+	return deps
+}
+
+// destination names where a departure is heading, marking it with "*" when
+// it is affected by a disruption.
+func (b *Board) destination(d api.Departure) string {
+	dest := ""
+	if run, ok := b.Departures.Runs[d.RunRef]; ok {
+		dest = run.DestinationName
+	}
+	if dest == "" {
+		if dir, ok := b.Departures.Directions[strconv.Itoa(d.DirectionID)]; ok {
+			dest = dir.DirectionName
+		}
+	}
+	if dest == "" {
+		dest = fmt.Sprintf("Route %d", d.RouteID)
+	}
+	if len(d.DisruptionIDs) > 0 {
+		dest += " *"
+	}
+	return dest
+}
+
+// pattern summarises the stopping pattern and route of a departure.
+func (b *Board) pattern(d api.Departure) string {
+	var parts []string
+	route, hasRoute := b.Departures.Routes[strconv.Itoa(d.RouteID)]
+	if run, ok := b.Departures.Runs[d.RunRef]; ok && (run.RouteType == 0 || run.RouteType == 3) {
+		switch {
+		case run.ExpressStopCount == 1:
+			parts = append(parts, "Express — skips 1 stop")
+		case run.ExpressStopCount > 1:
+			parts = append(parts, fmt.Sprintf("Express — skips %d stops", run.ExpressStopCount))
+		default:
+			parts = append(parts, "Stops all stations")
+		}
+	}
+	if hasRoute {
+		name := route.RouteName
+		if route.RouteNumber != "" {
+			name = route.RouteNumber + " " + name
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// minutesUntil formats the time remaining until t the way station displays do.
+func minutesUntil(now, t time.Time) string {
+	mins := int(t.Sub(now).Minutes())
+	switch {
+	case mins < 1:
+		return "Now"
+	case mins <= 90:
+		return fmt.Sprintf("%d min", mins)
+	default:
+		return ""
+	}
+}
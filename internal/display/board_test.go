@@ -0,0 +1,64 @@
+package display
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func TestBoardRender(t *testing.T) {
+	defer ConfigureTime("Local", "24h", "iso")
+	if err := ConfigureTime("UTC", "24h", "iso"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	at := func(m int) *time.Time {
+		t := now.Add(time.Duration(m) * time.Minute)
+		return &t
+	}
+	b := &Board{
+		StopName: "Richmond Station",
+		Departures: &api.DeparturesResponse{
+			Departures: []api.Departure{
+				{RouteID: 6, RunRef: "2", ScheduledDepartureUTC: at(12), PlatformNumber: "5"},
+				{RouteID: 6, RunRef: "1", ScheduledDepartureUTC: at(3), EstimatedDepartureUTC: at(4), PlatformNumber: "6", DisruptionIDs: []int{99}},
+				{RouteID: 6, RunRef: "0", ScheduledDepartureUTC: at(-5)},
+			},
+			Runs: map[string]api.RunInfo{
+				"1": {RunRef: "1", RouteType: 0, DestinationName: "Frankston", ExpressStopCount: 4},
+				"2": {RunRef: "2", RouteType: 0, DestinationName: "Flinders Street"},
+			},
+			Routes: map[string]api.RouteInfo{
+				"6": {RouteID: 6, RouteName: "Frankston"},
+			},
+		},
+		Messages: []string{"Buses replace trains", "Lift out of service"},
+	}
+
+	lines := b.Render(now, 60, 20, 1)
+	if len(lines) != 20 {
+		t.Fatalf("Render() returned %d lines, want 20", len(lines))
+	}
+	out := strings.Join(lines, "\n")
+
+	for _, want := range []string{"RICHMOND STATION", "08:00", "Frankston *", "Plat 6", "4 min", "Express — skips 4 stops", "Stops all stations", "Lift out of service (2/2)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Render() output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "Frankston *") > strings.Index(out, "Flinders Street") {
+		t.Errorf("departures not in time order:\n%s", out)
+	}
+	if strings.Contains(out, "07:55") {
+		t.Errorf("departed service still shown:\n%s", out)
+	}
+	for _, line := range lines {
+		plain := strings.NewReplacer(escReverse, "", escBold, "", escReset, "").Replace(line)
+		if w := StringWidth(plain); w > 60 {
+			t.Errorf("line %q width %d exceeds 60", plain, w)
+		}
+	}
+}
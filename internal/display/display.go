@@ -3,13 +3,33 @@ package display
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"text/tabwriter"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/commute"
+	"github.com/bls/vic-ptv-cli/internal/disruption"
+	"github.com/bls/vic-ptv-cli/internal/gtfs"
+	"github.com/bls/vic-ptv-cli/internal/planner"
+	"github.com/bls/vic-ptv-cli/internal/punctuality"
 )
 
+// out is where all rendered output is written.
+var out io.Writer = os.Stdout
+
+// SetOutput redirects rendered output to w, for example to capture a frame
+// before drawing it on a full-screen view.
+func SetOutput(w io.Writer) {
+	out = w
+}
+
+// listMarkerPattern matches the bullet or number that HTMLToText puts at the
+// start of list items.
+var listMarkerPattern = regexp.MustCompile(`^ *(• |\d+\. )`)
+
 // RouteTypeName returns a human-readable name for a route type ID.
 func RouteTypeName(routeType int) string {
 	switch routeType {
@@ -30,44 +50,74 @@ func RouteTypeName(routeType int) string {
 
 // JSON outputs any value as indented JSON.
 func JSON(v interface{}) error {
-	enc := json.NewEncoder(os.Stdout)
+	enc := json.NewEncoder(out)
 	enc.SetIndent("", "  ")
 	return enc.Encode(v)
 }
 
+// StopLabel returns a stop name with its suburb, if known. Stops from an
+// offline timetable have no suburb.
+func StopLabel(name, suburb string) string {
+	if suburb == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, suburb)
+}
+
 // SearchResults displays search results as a table.
 func SearchResults(resp *api.SearchResponse) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "TYPE\tNAME\tID\tROUTE TYPE")
+	t := newTable("TYPE", "NAME", "ID", "ROUTE TYPE").flexible(1)
 	for _, s := range resp.Stops {
-		fmt.Fprintf(w, "Stop\t%s (%s)\t%d\t%s\n", s.StopName, s.StopSuburb, s.StopID, RouteTypeName(s.RouteType))
+		t.row("Stop", StopLabel(s.StopName, s.StopSuburb), fmt.Sprintf("%d", s.StopID), RouteTypeName(s.RouteType))
 	}
 	for _, r := range resp.Routes {
 		name := r.RouteName
 		if r.RouteNumber != "" {
 			name = r.RouteNumber + " - " + r.RouteName
 		}
-		fmt.Fprintf(w, "Route\t%s\t%d\t%s\n", name, r.RouteID, RouteTypeName(r.RouteType))
+		t.row("Route", name, fmt.Sprintf("%d", r.RouteID), RouteTypeName(r.RouteType))
 	}
 	for _, o := range resp.Outlets {
-		fmt.Fprintf(w, "Outlet\t%s (%s)\t-\t-\n", o.OutletName, o.OutletSuburb)
+		t.row("Outlet", fmt.Sprintf("%s (%s)", o.OutletName, o.OutletSuburb), "-", "-")
 	}
-	w.Flush()
+	t.render(out, TerminalWidth())
 }
 
-// DeparturesList displays departures as a table.
+// DeparturesList displays departures as a table. When the departures span
+// several modes (at an interchange), a MODE column is added. Departures
+// affected by a disruption are marked with a footnote, and the disruption
+// titles are listed below the table.
 func DeparturesList(resp *api.DeparturesResponse) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "SCHEDULED\tESTIMATED\tROUTE\tDIRECTION\tPLATFORM")
-	loc := time.Now().Location()
+	notes := newFootnotes()
+	modes := make(map[int]bool)
+	for _, d := range resp.Departures {
+		for _, id := range d.DisruptionIDs {
+			notes.add(id)
+		}
+		if r, ok := resp.Routes[fmt.Sprintf("%d", d.RouteID)]; ok {
+			modes[r.RouteType] = true
+		}
+	}
+	showMode := len(modes) > 1
+
+	headers := []string{"SCHEDULED", "ESTIMATED", "ROUTE", "DIRECTION", "PLATFORM"}
+	flex := 2
+	if showMode {
+		headers = append([]string{"MODE"}, headers...)
+		flex++
+	}
+	if len(notes.ids) > 0 {
+		headers = append(headers, "NOTES")
+	}
+	t := newTable(headers...).flexible(flex)
 	for _, d := range resp.Departures {
 		scheduled := "-"
 		if d.ScheduledDepartureUTC != nil {
-			scheduled = d.ScheduledDepartureUTC.In(loc).Format("15:04")
+			scheduled = FormatTime(*d.ScheduledDepartureUTC)
 		}
 		estimated := "-"
 		if d.EstimatedDepartureUTC != nil {
-			estimated = d.EstimatedDepartureUTC.In(loc).Format("15:04")
+			estimated = FormatTime(*d.EstimatedDepartureUTC)
 		}
 
 		routeName := fmt.Sprintf("Route %d", d.RouteID)
@@ -88,42 +138,91 @@ func DeparturesList(resp *api.DeparturesResponse) {
 			platform = "-"
 		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", scheduled, estimated, routeName, dirName, platform)
+		cells := []string{scheduled, estimated, routeName, dirName, platform, notes.markers(d.DisruptionIDs)}
+		if showMode {
+			mode := "-"
+			if r, ok := resp.Routes[fmt.Sprintf("%d", d.RouteID)]; ok {
+				mode = RouteTypeName(r.RouteType)
+			}
+			cells = append([]string{mode}, cells...)
+		}
+		t.row(cells...)
+	}
+	t.render(out, TerminalWidth())
+
+	if len(notes.ids) > 0 {
+		fmt.Fprintln(out)
+		width := TerminalWidth()
+		for i, id := range notes.ids {
+			title := fmt.Sprintf("Disruption %d", id)
+			if dis, ok := resp.Disruptions[fmt.Sprintf("%d", id)]; ok {
+				title = PlainText(dis.Title)
+			}
+			fmt.Fprintln(out, Truncate(fmt.Sprintf("[%d] %s (disruption %d)", i+1, title, id), width))
+		}
 	}
-	w.Flush()
+}
+
+// footnotes numbers disruption IDs in order of first appearance.
+type footnotes struct {
+	ids   []int
+	index map[int]int
+}
+
+func newFootnotes() *footnotes {
+	return &footnotes{index: make(map[int]int)}
+}
+
+func (f *footnotes) add(id int) {
+	if _, ok := f.index[id]; !ok {
+		f.ids = append(f.ids, id)
+		f.index[id] = len(f.ids)
+	}
+}
+
+// markers returns the footnote markers for ids, such as "[1][3]".
+func (f *footnotes) markers(ids []int) string {
+	var b strings.Builder
+	for _, id := range ids {
+		if n, ok := f.index[id]; ok {
+			fmt.Fprintf(&b, "[%d]", n)
+		}
+	}
+	return b.String()
 }
 
 // StopDetail displays stop details.
 func StopDetail(resp *api.StopResponse) {
 	s := resp.Stop
-	fmt.Printf("Stop: %s\n", s.StopName)
-	fmt.Printf("ID: %d\n", s.StopID)
-	fmt.Printf("Route Type: %s\n", RouteTypeName(s.RouteType))
+	fmt.Fprintf(out, "Stop: %s\n", s.StopName)
+	fmt.Fprintf(out, "ID: %d\n", s.StopID)
+	fmt.Fprintf(out, "Route Type: %s\n", RouteTypeName(s.RouteType))
 	if s.StationType != "" {
-		fmt.Printf("Station Type: %s\n", s.StationType)
+		fmt.Fprintf(out, "Station Type: %s\n", s.StationType)
 	}
 	if s.StationDescription != "" {
-		fmt.Printf("Description: %s\n", s.StationDescription)
+		fmt.Fprintln(out, "Description:")
+		printHTML(s.StationDescription, "  ")
 	}
 	if s.StopAmenities != nil {
 		a := s.StopAmenities
-		fmt.Println("\nAmenities:")
-		fmt.Printf("  Toilet: %s\n", boolYesNo(a.Toilet))
-		fmt.Printf("  Taxi Rank: %s\n", boolYesNo(a.TaxiRank))
-		fmt.Printf("  CCTV: %s\n", boolYesNo(a.CCTV))
+		fmt.Fprintln(out, "\nAmenities:")
+		fmt.Fprintf(out, "  Toilet: %s\n", boolYesNo(a.Toilet))
+		fmt.Fprintf(out, "  Taxi Rank: %s\n", boolYesNo(a.TaxiRank))
+		fmt.Fprintf(out, "  CCTV: %s\n", boolYesNo(a.CCTV))
 		if a.CarParking != "" {
-			fmt.Printf("  Car Parking: %s\n", a.CarParking)
+			fmt.Fprintf(out, "  Car Parking: %s\n", a.CarParking)
 		}
 	}
 	if s.StopAccessibility != nil {
 		a := s.StopAccessibility
-		fmt.Println("\nAccessibility:")
-		fmt.Printf("  Wheelchair: %s\n", boolYesNo(a.Wheelchair))
-		fmt.Printf("  Lift Access: %s\n", boolYesNo(a.LiftAccess))
-		fmt.Printf("  Escalator: %s\n", boolYesNo(a.Escalator))
-		fmt.Printf("  Stairs: %s\n", boolYesNo(a.Stairs))
-		fmt.Printf("  Lighting: %s\n", boolYesNo(a.Lighting))
-		fmt.Printf("  Hearing Loop: %s\n", boolYesNo(a.Hearing))
+		fmt.Fprintln(out, "\nAccessibility:")
+		fmt.Fprintf(out, "  Wheelchair: %s\n", boolYesNo(a.Wheelchair))
+		fmt.Fprintf(out, "  Lift Access: %s\n", boolYesNo(a.LiftAccess))
+		fmt.Fprintf(out, "  Escalator: %s\n", boolYesNo(a.Escalator))
+		fmt.Fprintf(out, "  Stairs: %s\n", boolYesNo(a.Stairs))
+		fmt.Fprintf(out, "  Lighting: %s\n", boolYesNo(a.Lighting))
+		fmt.Fprintf(out, "  Hearing Loop: %s\n", boolYesNo(a.Hearing))
 	}
 }
 
@@ -136,92 +235,424 @@ func boolYesNo(b bool) string {
 
 // RoutesList displays routes as a table.
 func RoutesList(resp *api.RoutesResponse) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tNUMBER\tNAME\tTYPE")
+	t := newTable("ID", "NUMBER", "NAME", "TYPE").flexible(2)
 	for _, r := range resp.Routes {
 		num := r.RouteNumber
 		if num == "" {
 			num = "-"
 		}
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", r.RouteID, num, r.RouteName, RouteTypeName(r.RouteType))
+		t.row(fmt.Sprintf("%d", r.RouteID), num, r.RouteName, RouteTypeName(r.RouteType))
 	}
-	w.Flush()
+	t.render(out, TerminalWidth())
 }
 
 // RouteDetail displays route details.
 func RouteDetail(resp *api.RouteResponse) {
 	r := resp.Route
-	fmt.Printf("Route: %s\n", r.RouteName)
-	fmt.Printf("ID: %d\n", r.RouteID)
+	fmt.Fprintf(out, "Route: %s\n", r.RouteName)
+	fmt.Fprintf(out, "ID: %d\n", r.RouteID)
 	if r.RouteNumber != "" {
-		fmt.Printf("Number: %s\n", r.RouteNumber)
+		fmt.Fprintf(out, "Number: %s\n", r.RouteNumber)
 	}
-	fmt.Printf("Type: %s\n", RouteTypeName(r.RouteType))
+	fmt.Fprintf(out, "Type: %s\n", RouteTypeName(r.RouteType))
 	if r.RouteGTFSID != "" {
-		fmt.Printf("GTFS ID: %s\n", r.RouteGTFSID)
+		fmt.Fprintf(out, "GTFS ID: %s\n", r.RouteGTFSID)
 	}
 	if r.RouteServiceStatus != nil {
-		fmt.Printf("Service Status: %s\n", r.RouteServiceStatus.Description)
+		status := r.RouteServiceStatus.Description
+		if ts, err := time.Parse(time.RFC3339, r.RouteServiceStatus.Timestamp); err == nil {
+			status += " (as of " + FormatDateTime(ts) + ")"
+		}
+		fmt.Fprintf(out, "Service Status: %s\n", status)
 	}
 }
 
 // DisruptionsList displays disruptions as a table.
 func DisruptionsList(disruptions []api.Disruption) {
 	if len(disruptions) == 0 {
-		fmt.Println("No current disruptions.")
+		fmt.Fprintln(out, "No current disruptions.")
 		return
 	}
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tSTATUS\tTYPE\tTITLE")
+	t := newTable("ID", "STATUS", "TYPE", "FROM", "TO", "TITLE").flexible(5)
 	for _, d := range disruptions {
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", d.DisruptionID, d.DisruptionStatus, d.DisruptionType, truncate(d.Title, 60))
+		t.row(fmt.Sprintf("%d", d.DisruptionID), d.DisruptionStatus, d.DisruptionType,
+			formatOptionalDate(d.FromDate), formatOptionalDate(d.ToDate), PlainText(d.Title))
+	}
+	t.render(out, TerminalWidth())
+}
+
+// DisruptionChanges displays new, updated and resolved disruptions, each
+// as a table. A non-zero since is when the previous disruptions were seen.
+func DisruptionChanges(c *disruption.Changes, since time.Time) {
+	if c.Empty() {
+		if since.IsZero() {
+			fmt.Fprintln(out, "No changes.")
+		} else {
+			fmt.Fprintf(out, "No changes since %s.\n", FormatDateTime(since))
+		}
+		return
+	}
+	if !since.IsZero() {
+		fmt.Fprintf(out, "Changes since %s:\n\n", FormatDateTime(since))
+	}
+	first := true
+	for _, section := range []struct {
+		title       string
+		disruptions []api.Disruption
+	}{{"New", c.New}, {"Updated", c.Updated}, {"Resolved", c.Resolved}} {
+		if len(section.disruptions) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(out)
+		}
+		first = false
+		fmt.Fprintf(out, "%s (%d):\n", section.title, len(section.disruptions))
+		t := newTable("ID", "TYPE", "UPDATED", "TITLE").flexible(3)
+		for _, d := range section.disruptions {
+			updated := "-"
+			if d.LastUpdated != nil {
+				updated = FormatDateTime(*d.LastUpdated)
+			}
+			t.row(fmt.Sprintf("%d", d.DisruptionID), d.DisruptionType, updated, PlainText(d.Title))
+		}
+		t.render(out, TerminalWidth())
+	}
+}
+
+// DisruptionDetail displays a single disruption, word-wrapping its description.
+func DisruptionDetail(d api.Disruption) {
+	fmt.Fprintf(out, "Disruption: %s\n", PlainText(d.Title))
+	fmt.Fprintf(out, "ID: %d\n", d.DisruptionID)
+	fmt.Fprintf(out, "Status: %s\n", d.DisruptionStatus)
+	fmt.Fprintf(out, "Type: %s\n", d.DisruptionType)
+	if d.FromDate != nil {
+		fmt.Fprintf(out, "From: %s\n", FormatDateTime(*d.FromDate))
+	}
+	if d.ToDate != nil {
+		fmt.Fprintf(out, "To: %s\n", FormatDateTime(*d.ToDate))
+	}
+	if d.LastUpdated != nil {
+		fmt.Fprintf(out, "Last Updated: %s\n", FormatDateTime(*d.LastUpdated))
+	}
+	if d.URL != "" {
+		fmt.Fprintf(out, "URL: %s\n", d.URL)
+	}
+	if len(d.Routes) > 0 {
+		names := make([]string, len(d.Routes))
+		for i, r := range d.Routes {
+			names[i] = r.RouteName
+			if r.RouteNumber != "" {
+				names[i] = r.RouteNumber + " " + r.RouteName
+			}
+		}
+		fmt.Fprintln(out, "\nAffected Routes:")
+		printWrapped(strings.Join(names, ", "), "  ")
+	}
+	if d.Description != "" {
+		fmt.Fprintln(out, "\nDescription:")
+		printHTML(d.Description, "  ")
+	}
+}
+
+// formatOptionalDate formats a possibly-missing timestamp as a date, or "-".
+func formatOptionalDate(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return FormatDate(*t)
+}
+
+// printHTML prints an HTML fragment as wrapped text followed by its link
+// footnotes.
+func printHTML(s, indent string) {
+	text, links := HTMLToText(s)
+	printWrapped(text, indent)
+	if len(links) > 0 {
+		fmt.Fprintln(out)
+		for i, l := range links {
+			fmt.Fprintf(out, "%s[%d] %s\n", indent, i+1, l)
+		}
 	}
-	w.Flush()
 }
 
-func truncate(s string, max int) string {
-	if len(s) <= max {
-		return s
+// printWrapped prints s word-wrapped to the terminal width, prefixing every
+// line with indent. Continuation lines of list items are indented to line up
+// with the item text.
+func printWrapped(s, indent string) {
+	width := TerminalWidth()
+	for _, para := range strings.Split(s, "\n") {
+		hang := listMarkerPattern.FindString(para)
+		w := width
+		if w > 0 {
+			w = max(w-StringWidth(indent)-StringWidth(hang), minFlexWidth)
+		}
+		lines := Wrap(strings.TrimPrefix(para, hang), w)
+		for i, line := range lines {
+			prefix := hang
+			if i > 0 {
+				prefix = strings.Repeat(" ", StringWidth(hang))
+			}
+			fmt.Fprintln(out, strings.TrimRight(indent+prefix+line, " "))
+		}
 	}
-	return s[:max-3] + "..."
 }
 
 // FareEstimate displays fare estimate results.
 func FareEstimate(resp *api.FareEstimateResponse) {
 	if resp.FareEstimate == nil {
-		fmt.Println("No fare estimate available.")
+		fmt.Fprintln(out, "No fare estimate available.")
 		return
 	}
 
 	fe := resp.FareEstimate
 	if fe.IsJourneyInFreeTramZone {
-		fmt.Println("This journey is within the Free Tram Zone - no fare required!")
+		fmt.Fprintln(out, "This journey is within the Free Tram Zone - no fare required!")
 		return
 	}
 	if fe.IsEarlyBird {
-		fmt.Println("Note: Early Bird fare may apply (free travel on selected trains before 7am)")
+		fmt.Fprintln(out, "Note: Early Bird fare may apply (free travel on selected trains before 7am)")
 	}
 
 	if len(fe.PassengerFares) == 0 {
-		fmt.Println("No fare data available.")
+		fmt.Fprintln(out, "No fare data available.")
 		return
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "PASSENGER TYPE\t2 HOUR\tDAILY\tWEEKLY\tWEEKEND CAP")
+	t := newTable("PASSENGER TYPE", "2 HOUR", "DAILY", "WEEKLY", "WEEKEND CAP")
 	for _, f := range fe.PassengerFares {
-		fmt.Fprintf(w, "%s\t$%.2f\t$%.2f\t$%.2f\t$%.2f\n",
-			f.PassengerType, f.Fare2Hour, f.FareDaily, f.FareWeekly, f.FareWeekend)
+		t.row(f.PassengerType,
+			fmt.Sprintf("$%.2f", f.Fare2Hour), fmt.Sprintf("$%.2f", f.FareDaily),
+			fmt.Sprintf("$%.2f", f.FareWeekly), fmt.Sprintf("$%.2f", f.FareWeekend))
+	}
+	t.render(out, TerminalWidth())
+}
+
+// Favourite is a saved favourite as listed by FavouritesList. RouteType is
+// nil, and RouteID and DirectionID 0, when the favourite does not filter on
+// them.
+type Favourite struct {
+	Name        string
+	StopID      int
+	RouteType   *int
+	RouteID     int
+	DirectionID int
+}
+
+// FavouritesList displays saved favourites as a table, in the order given.
+func FavouritesList(favs []Favourite) {
+	if len(favs) == 0 {
+		fmt.Fprintln(out, "No favourites saved. Add one with 'vic-ptv fav add'.")
+		return
+	}
+	t := newTable("NAME", "STOP", "TYPE", "ROUTE", "DIRECTION")
+	for _, f := range favs {
+		routeType, route, direction := "any", "any", "any"
+		if f.RouteType != nil {
+			routeType = RouteTypeName(*f.RouteType)
+		}
+		if f.RouteID != 0 {
+			route = fmt.Sprintf("%d", f.RouteID)
+		}
+		if f.DirectionID != 0 {
+			direction = fmt.Sprintf("%d", f.DirectionID)
+		}
+		t.row("@"+f.Name, fmt.Sprintf("%d", f.StopID), routeType, route, direction)
+	}
+	t.render(out, TerminalWidth())
+}
+
+// Setting is a config setting as listed by SettingsList. Value is the
+// default when IsSet is false.
+type Setting struct {
+	Key         string
+	Value       string
+	Description string
+	IsSet       bool
+	Secret      bool
+}
+
+// SettingsList displays the value of each config setting, marking those
+// that are defaults and masking secrets.
+func SettingsList(values []Setting) {
+	t := newTable("SETTING", "VALUE", "DESCRIPTION").flexible(2)
+	for _, v := range values {
+		value := v.Value
+		switch {
+		case !v.IsSet && value == "":
+			value = "-"
+		case !v.IsSet:
+			value += " (default)"
+		case v.Secret:
+			value = "****" + value[max(0, len(value)-4):]
+		}
+		t.row(v.Key, value, v.Description)
+	}
+	t.render(out, TerminalWidth())
+}
+
+// Profile is a config profile as listed by ProfilesList.
+type Profile struct {
+	Name    string
+	DevID   string
+	BaseURL string
+	Active  bool
+}
+
+// ProfilesList displays the config profiles, marking the active one.
+func ProfilesList(profiles []Profile) {
+	t := newTable("", "PROFILE", "DEV ID", "BASE URL")
+	for _, p := range profiles {
+		active, devID, baseURL := "", p.DevID, p.BaseURL
+		if p.Active {
+			active = "*"
+		}
+		if devID == "" {
+			devID = "-"
+		}
+		if baseURL == "" {
+			baseURL = "-"
+		}
+		t.row(active, p.Name, devID, baseURL)
+	}
+	t.render(out, TerminalWidth())
+}
+
+// CommuteConnections displays connections for a commute, one per line, such
+// as "tram 96 08:02 → arrive Flinders St 08:19 → train Lilydale 08:24".
+func CommuteConnections(name string, conns []commute.Connection) {
+	if len(conns) == 0 {
+		fmt.Fprintf(out, "No connections found for %s.\n", name)
+		return
+	}
+	width := TerminalWidth()
+	for _, c := range conns {
+		var parts []string
+		for _, trip := range c.Trips {
+			parts = append(parts, trip.Label+" "+FormatTime(trip.Depart))
+			if !trip.Arrive.IsZero() {
+				alight := trip.Alight
+				if alight == "" {
+					alight = "stop"
+				}
+				parts = append(parts, "arrive "+alight+" "+FormatTime(trip.Arrive))
+			}
+		}
+		line := strings.Join(parts, " → ")
+		if last := c.Trips[len(c.Trips)-1]; !last.Arrive.IsZero() {
+			line += fmt.Sprintf("  (%d min)", int(c.Arrive().Sub(c.Depart()).Round(time.Minute).Minutes()))
+		}
+		if width > 0 {
+			line = Truncate(line, width)
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// Itineraries displays planned journeys, one block per itinerary with a
+// line for each leg.
+func Itineraries(n *planner.Network, its []planner.Itinerary) {
+	if len(its) == 0 {
+		fmt.Fprintln(out, "No journeys found.")
+		return
+	}
+	width := TerminalWidth()
+	for i, it := range its {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		changes := "direct"
+		switch t := it.Transfers(); t {
+		case 0:
+		case 1:
+			changes = "1 change"
+		default:
+			changes = fmt.Sprintf("%d changes", t)
+		}
+		mins := int(it.Arrive().Sub(it.Depart()).Round(time.Minute).Minutes())
+		fmt.Fprintf(out, "Option %d: depart %s, arrive %s (%d min, %s)\n",
+			i+1, FormatTime(it.Depart()), FormatTime(it.Arrive()), mins, changes)
+
+		for _, l := range it.Legs {
+			var what string
+			if l.Walk {
+				what = fmt.Sprintf("Walk %.0f m to %s", l.Distance, n.StopName(l.To))
+			} else {
+				route := fmt.Sprintf("Route %d", l.RouteID)
+				if r, ok := n.Routes[l.RouteID]; ok {
+					route = RouteTypeName(r.Type) + " " + r.Name
+					if r.Number != "" {
+						route = RouteTypeName(r.Type) + " " + r.Number
+					}
+				}
+				from := n.StopName(l.From)
+				if l.Platform != "" {
+					from += " (platform " + l.Platform + ")"
+				}
+				what = fmt.Sprintf("%s from %s to %s", route, from, n.StopName(l.To))
+			}
+			line := fmt.Sprintf("  %s–%s  %s", FormatTime(l.Depart), FormatTime(l.Arrive), what)
+			if width > 0 {
+				line = Truncate(line, width)
+			}
+			fmt.Fprintln(out, line)
+		}
 	}
-	w.Flush()
 }
 
 // RouteTypesList displays route types as a table.
 func RouteTypesList(resp *api.RouteTypesResponse) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tNAME")
+	t := newTable("ID", "NAME")
 	for _, rt := range resp.RouteTypes {
-		fmt.Fprintf(w, "%d\t%s\n", rt.RouteTypeID, rt.RouteTypeName)
+		t.row(fmt.Sprintf("%d", rt.RouteTypeID), rt.RouteTypeName)
+	}
+	t.render(out, TerminalWidth())
+}
+
+// GTFSInfo displays details of the imported GTFS timetable.
+func GTFSInfo(info *gtfs.Info) {
+	fmt.Fprintf(out, "Source: %s\n", info.Source)
+	fmt.Fprintf(out, "Imported: %s\n", FormatDateTime(info.Imported))
+	if !info.From.IsZero() {
+		fmt.Fprintf(out, "Service: %s to %s\n", FormatDate(info.From), FormatDate(info.To))
+	}
+	fmt.Fprintf(out, "Stops: %d\n", info.Stops)
+	fmt.Fprintf(out, "Routes: %d\n", info.Routes)
+	fmt.Fprintf(out, "Trips: %d\n", info.Trips)
+	fmt.Fprintf(out, "Stop times: %d\n", info.StopTimes)
+}
+
+// PunctualityReport displays recorded punctuality overall, then by route,
+// hour of day and weekday.
+func PunctualityReport(r *punctuality.Report) {
+	if r.Total.Departures == 0 {
+		fmt.Fprintln(out, "No departures recorded yet.")
+		return
+	}
+	fmt.Fprintf(out, "%d departures, %d cancelled, %s on time (%d measured; on time is under %s late)\n",
+		r.Total.Departures, r.Total.Cancelled, percent(r.Total), r.Total.Measured, r.Late)
+	for _, section := range []struct {
+		title  string
+		groups []punctuality.Group
+	}{{"ROUTE", r.ByRoute}, {"HOUR", r.ByHour}, {"WEEKDAY", r.ByWeekday}} {
+		fmt.Fprintln(out)
+		t := newTable(section.title, "DEPARTURES", "ON TIME", "MEAN DELAY", "CANCELLED").flexible(0)
+		for _, g := range section.groups {
+			delay := "-"
+			if g.Measured > 0 {
+				delay = fmt.Sprintf("%+.1f min", g.MeanDelay/60)
+			}
+			t.row(g.Label, fmt.Sprintf("%d", g.Departures), percent(g), delay, fmt.Sprintf("%d", g.Cancelled))
+		}
+		t.render(out, TerminalWidth())
+	}
+}
+
+// percent formats a group's on-time percentage, or "-" if nothing was
+// measured.
+func percent(g punctuality.Group) string {
+	if g.Measured == 0 {
+		return "-"
 	}
-	w.Flush()
+	return fmt.Sprintf("%.1f%%", g.OnTimePct)
 }
@@ -0,0 +1,222 @@
+package display
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	tagPattern        = regexp.MustCompile(`<[a-zA-Z/][^>]*>`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText converts an HTML fragment from the PTV API into readable
+// terminal text. Paragraphs are separated by blank lines, list items become
+// bullets, entities are decoded, and links are replaced by a "[n]" footnote
+// marker. The link targets are returned in footnote order.
+//
+// Input without any markup is treated as plain text: entities are decoded
+// and existing line breaks are kept.
+func HTMLToText(s string) (string, []string) {
+	if !tagPattern.MatchString(s) {
+		text := html.UnescapeString(strings.ReplaceAll(s, "\r\n", "\n"))
+		return strings.TrimSpace(text), nil
+	}
+
+	c := &htmlConverter{}
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF, or malformed input: keep whatever was decoded so far.
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			c.text(tok.Data)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			c.start(tok)
+		case html.EndTagToken:
+			c.end(tok)
+		}
+	}
+
+	out := blankLinesPattern.ReplaceAllString(c.b.String(), "\n\n")
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), c.links
+}
+
+// PlainText converts an HTML fragment to a single line of text, dropping
+// link footnotes. It is used for titles and table cells.
+func PlainText(s string) string {
+	text, _ := HTMLToText(s)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// htmlConverter accumulates text while walking an HTML token stream.
+type htmlConverter struct {
+	b     strings.Builder
+	links []string
+	// lists is a stack of open lists; each entry is the next ordinal for an
+	// <ol>, or 0 for a <ul>.
+	lists []int
+	// href is the target of the currently open link, if any.
+	href string
+	// skip is set inside elements whose content is not shown.
+	skip int
+}
+
+func (c *htmlConverter) text(data string) {
+	if c.skip > 0 {
+		return
+	}
+	words := strings.Fields(data)
+	if len(words) == 0 {
+		if data != "" {
+			c.space()
+		}
+		return
+	}
+	if isSpace(data[0]) {
+		c.space()
+	}
+	c.b.WriteString(strings.Join(words, " "))
+	if isSpace(data[len(data)-1]) {
+		c.space()
+	}
+}
+
+func (c *htmlConverter) start(tok html.Token) {
+	switch tok.Data {
+	case "script", "style", "head", "title":
+		c.skip++
+	case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "table":
+		c.paragraph()
+	case "br":
+		c.newline()
+	case "tr":
+		c.endLine()
+	case "td", "th":
+		c.space()
+	case "ul", "ol":
+		c.listBreak()
+		ordinal := 0
+		if tok.Data == "ol" {
+			ordinal = 1
+		}
+		c.lists = append(c.lists, ordinal)
+	case "li":
+		c.endLine()
+		indent := strings.Repeat("  ", max(len(c.lists)-1, 0))
+		if n := len(c.lists); n > 0 && c.lists[n-1] > 0 {
+			fmt.Fprintf(&c.b, "%s%d. ", indent, c.lists[n-1])
+			c.lists[n-1]++
+		} else {
+			c.b.WriteString(indent + "• ")
+		}
+	case "a":
+		c.href = ""
+		for _, attr := range tok.Attr {
+			if attr.Key == "href" {
+				c.href = strings.TrimSpace(attr.Val)
+			}
+		}
+	}
+}
+
+func (c *htmlConverter) end(tok html.Token) {
+	switch tok.Data {
+	case "script", "style", "head", "title":
+		if c.skip > 0 {
+			c.skip--
+		}
+	case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "table":
+		c.paragraph()
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		c.listBreak()
+	case "a":
+		if c.href != "" && !strings.HasPrefix(c.href, "#") {
+			c.trimSpace()
+			fmt.Fprintf(&c.b, " [%d]", c.footnote(c.href))
+		}
+		c.href = ""
+	}
+}
+
+// footnote returns the 1-based footnote number for url, reusing an existing
+// number if the same link appeared earlier.
+func (c *htmlConverter) footnote(url string) int {
+	for i, l := range c.links {
+		if l == url {
+			return i + 1
+		}
+	}
+	c.links = append(c.links, url)
+	return len(c.links)
+}
+
+// atBoundary reports whether the output is empty or ends in whitespace.
+func (c *htmlConverter) atBoundary() bool {
+	s := c.b.String()
+	return s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, " ")
+}
+
+func (c *htmlConverter) space() {
+	if !c.atBoundary() {
+		c.b.WriteByte(' ')
+	}
+}
+
+func (c *htmlConverter) trimSpace() {
+	s := c.b.String()
+	if trimmed := strings.TrimRight(s, " "); len(trimmed) != len(s) {
+		c.b.Reset()
+		c.b.WriteString(trimmed)
+	}
+}
+
+// endLine starts a new line unless the output is already at one.
+func (c *htmlConverter) endLine() {
+	c.trimSpace()
+	if c.b.Len() > 0 && !strings.HasSuffix(c.b.String(), "\n") {
+		c.b.WriteByte('\n')
+	}
+}
+
+func (c *htmlConverter) newline() {
+	c.trimSpace()
+	if c.b.Len() > 0 {
+		c.b.WriteByte('\n')
+	}
+}
+
+// listBreak starts a new paragraph around top-level lists, and a new line
+// around nested ones so they stay attached to their parent item.
+func (c *htmlConverter) listBreak() {
+	if len(c.lists) > 0 {
+		c.endLine()
+		return
+	}
+	c.paragraph()
+}
+
+func (c *htmlConverter) paragraph() {
+	c.trimSpace()
+	if c.b.Len() > 0 {
+		c.b.WriteString("\n\n")
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\f'
+}
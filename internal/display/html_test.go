@@ -0,0 +1,88 @@
+package display
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      string
+		wantLinks []string
+	}{
+		{
+			name: "plain text keeps line breaks",
+			in:   "Buses replace trains\r\nbetween Caulfield &amp; Dandenong",
+			want: "Buses replace trains\nbetween Caulfield & Dandenong",
+		},
+		{
+			name: "paragraphs",
+			in:   "<p>Buses replace trains.</p><p>Allow an extra  30 minutes.</p>",
+			want: "Buses replace trains.\n\nAllow an extra 30 minutes.",
+		},
+		{
+			name: "line breaks",
+			in:   "Platform 1<br>Platform 2<br/>Platform 3",
+			want: "Platform 1\nPlatform 2\nPlatform 3",
+		},
+		{
+			name: "entities",
+			in:   "<p>Works at Richmond &ndash; &ldquo;expect delays&rdquo; &amp; crowding&nbsp;today</p>",
+			want: "Works at Richmond – “expect delays” & crowding today",
+		},
+		{
+			name: "bullet list",
+			in:   "<p>Affected stations:</p><ul><li>Richmond</li><li>South Yarra</li></ul><p>Sorry.</p>",
+			want: "Affected stations:\n\n• Richmond\n• South Yarra\n\nSorry.",
+		},
+		{
+			name: "ordered list",
+			in:   "<ol><li>Board at Flinders St</li><li>Change at Caulfield</li></ol>",
+			want: "1. Board at Flinders St\n2. Change at Caulfield",
+		},
+		{
+			name: "nested list",
+			in:   "<ul><li>Trains<ul><li>Frankston</li></ul></li><li>Trams</li></ul>",
+			want: "• Trains\n  • Frankston\n• Trams",
+		},
+		{
+			name:      "links as footnotes",
+			in:        `See <a href="https://ptv.vic.gov.au/works">planned works</a> and <a href="https://ptv.vic.gov.au/map">the map</a>.`,
+			want:      "See planned works [1] and the map [2].",
+			wantLinks: []string{"https://ptv.vic.gov.au/works", "https://ptv.vic.gov.au/map"},
+		},
+		{
+			name:      "repeated link reuses footnote",
+			in:        `<a href="https://x.test/a">here</a> or <a href="https://x.test/a">there</a>`,
+			want:      "here [1] or there [1]",
+			wantLinks: []string{"https://x.test/a"},
+		},
+		{
+			name: "inline formatting and scripts dropped",
+			in:   "<p><strong>Note:</strong> <em>limited</em> service<script>alert(1)</script></p>",
+			want: "Note: limited service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, links := HTMLToText(tt.in)
+			if got != tt.want {
+				t.Errorf("HTMLToText() text =\n%q\nwant\n%q", got, tt.want)
+			}
+			if strings.Join(links, " ") != strings.Join(tt.wantLinks, " ") {
+				t.Errorf("HTMLToText() links = %q, want %q", links, tt.wantLinks)
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	got := PlainText("<p>Sandringham line:</p><p>buses &amp; coaches</p>")
+	want := "Sandringham line: buses & coaches"
+	if got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package display
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used for full-screen output.
+const (
+	escAltScreenOn  = "\x1b[?1049h"
+	escAltScreenOff = "\x1b[?1049l"
+	escHideCursor   = "\x1b[?25l"
+	escShowCursor   = "\x1b[?25h"
+	escHome         = "\x1b[H"
+	escClearLine    = "\x1b[K"
+	escClearBelow   = "\x1b[J"
+	escBold         = "\x1b[1m"
+	escDim          = "\x1b[2m"
+	escReverse      = "\x1b[7m"
+	escReset        = "\x1b[0m"
+)
+
+// Reverse returns s in reverse video, for highlighted lines.
+func Reverse(s string) string {
+	return escReverse + s + escReset
+}
+
+// Dim returns s in faint text, for secondary lines such as key help.
+func Dim(s string) string {
+	return escDim + s + escReset
+}
+
+// Screen draws full-screen views on the terminal's alternate screen buffer,
+// so redraws replace the previous frame instead of scrolling.
+type Screen struct {
+	out io.Writer
+}
+
+// NewScreen creates a screen that writes to stdout.
+func NewScreen() *Screen {
+	return &Screen{out: os.Stdout}
+}
+
+// Enter switches to the alternate screen and hides the cursor.
+func (s *Screen) Enter() {
+	io.WriteString(s.out, escAltScreenOn+escHideCursor+escHome+escClearBelow)
+}
+
+// Exit restores the cursor and the original screen contents.
+func (s *Screen) Exit() {
+	io.WriteString(s.out, escShowCursor+escAltScreenOff)
+}
+
+// Draw replaces the screen contents with lines.
+func (s *Screen) Draw(lines []string) {
+	var b strings.Builder
+	b.WriteString(escHome)
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString(escClearLine)
+	}
+	b.WriteString(escClearBelow)
+	io.WriteString(s.out, b.String())
+}
+
+// TerminalSize returns the terminal's width and height, falling back to
+// 80x24 when stdout is not a terminal.
+func TerminalSize() (int, int) {
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		return w, h
+	}
+	return 80, 24
+}
@@ -0,0 +1,87 @@
+package display
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	// columnGap is the number of spaces between table columns.
+	columnGap = 2
+	// minFlexWidth is the narrowest a flexible column is squeezed to.
+	minFlexWidth = 10
+)
+
+// table renders rows of cells as aligned columns, measuring cells by display
+// width rather than bytes. At most one column is flexible: when the table is
+// wider than the terminal, that column is truncated to fit.
+type table struct {
+	headers []string
+	rows    [][]string
+	flex    int
+}
+
+// newTable creates a table with the given column headers and no flexible column.
+func newTable(headers ...string) *table {
+	return &table{headers: headers, flex: -1}
+}
+
+// flexible marks column i as the one to truncate when the table is too wide.
+func (t *table) flexible(i int) *table {
+	t.flex = i
+	return t
+}
+
+// row appends a row of cells.
+func (t *table) row(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// render writes the table to w, fitting it within maxWidth cells when
+// maxWidth is positive.
+func (t *table) render(w io.Writer, maxWidth int) {
+	widths := make([]int, len(t.headers))
+	measure := func(cells []string) {
+		for i, c := range cells {
+			if i < len(widths) {
+				widths[i] = max(widths[i], StringWidth(c))
+			}
+		}
+	}
+	measure(t.headers)
+	for _, r := range t.rows {
+		measure(r)
+	}
+
+	if maxWidth > 0 && t.flex >= 0 && t.flex < len(widths) {
+		total := columnGap * (len(widths) - 1)
+		for _, cw := range widths {
+			total += cw
+		}
+		if over := total - maxWidth; over > 0 {
+			widths[t.flex] = max(minFlexWidth, widths[t.flex]-over)
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		b.Reset()
+		for i := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			cell = Truncate(cell, widths[i])
+			if i == len(widths)-1 {
+				b.WriteString(cell)
+				break
+			}
+			b.WriteString(padRight(cell, widths[i]+columnGap))
+		}
+		io.WriteString(w, strings.TrimRight(b.String(), " ")+"\n")
+	}
+	writeRow(t.headers)
+	for _, r := range t.rows {
+		writeRow(r)
+	}
+}
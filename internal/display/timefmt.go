@@ -0,0 +1,78 @@
+package display
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateFormats maps named date formats to Go time layouts. Any other value is
+// used as a layout directly.
+var dateFormats = map[string]string{
+	"iso":  "2006-01-02",
+	"au":   "02/01/2006",
+	"us":   "01/02/2006",
+	"long": "Mon 2 Jan 2006",
+}
+
+var (
+	location   = time.Local
+	clock12h   bool
+	dateLayout = dateFormats["iso"]
+)
+
+// ConfigureTime sets the timezone, clock style ("12h" or "24h") and date
+// format used for all displayed timestamps. The date format is one of
+// "iso", "au", "us", "long" or a Go time layout.
+func ConfigureTime(timezone, clock, date string) error {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	var is12h bool
+	switch strings.ToLower(clock) {
+	case "24h", "24":
+		is12h = false
+	case "12h", "12":
+		is12h = true
+	default:
+		return fmt.Errorf("invalid time format %q: must be 12h or 24h", clock)
+	}
+
+	layout := date
+	if l, ok := dateFormats[strings.ToLower(date)]; ok {
+		layout = l
+	}
+	if layout == "" {
+		return fmt.Errorf("date format must not be empty")
+	}
+
+	location = loc
+	clock12h = is12h
+	dateLayout = layout
+	return nil
+}
+
+// Location returns the timezone used for displayed timestamps.
+func Location() *time.Location {
+	return location
+}
+
+// FormatTime formats the time of day of t in the configured zone and clock style.
+func FormatTime(t time.Time) string {
+	if clock12h {
+		return t.In(location).Format("3:04pm")
+	}
+	return t.In(location).Format("15:04")
+}
+
+// FormatDate formats the date of t in the configured zone and date format.
+func FormatDate(t time.Time) string {
+	return t.In(location).Format(dateLayout)
+}
+
+// FormatDateTime formats t as a date followed by a time of day.
+func FormatDateTime(t time.Time) string {
+	return FormatDate(t) + " " + FormatTime(t)
+}
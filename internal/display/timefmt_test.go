@@ -0,0 +1,51 @@
+package display
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestConfigureTime(t *testing.T) {
+	defer ConfigureTime("Local", "24h", "iso")
+
+	// 2024-01-15 21:05 UTC is 08:05 the next morning in Melbourne (AEDT, +11).
+	ts := time.Date(2024, 1, 15, 21, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		tz           string
+		clock        string
+		date         string
+		wantTime     string
+		wantDateTime string
+	}{
+		{name: "melbourne 24h iso", tz: "Australia/Melbourne", clock: "24h", date: "iso", wantTime: "08:05", wantDateTime: "2024-01-16 08:05"},
+		{name: "melbourne 12h au", tz: "Australia/Melbourne", clock: "12h", date: "au", wantTime: "8:05am", wantDateTime: "16/01/2024 8:05am"},
+		{name: "utc long", tz: "UTC", clock: "24h", date: "long", wantTime: "21:05", wantDateTime: "Mon 15 Jan 2024 21:05"},
+		{name: "custom layout", tz: "Australia/Perth", clock: "24", date: "2 Jan", wantTime: "05:05", wantDateTime: "16 Jan 05:05"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ConfigureTime(tt.tz, tt.clock, tt.date); err != nil {
+				t.Fatalf("ConfigureTime() error = %v", err)
+			}
+			if got := FormatTime(ts); got != tt.wantTime {
+				t.Errorf("FormatTime() = %q, want %q", got, tt.wantTime)
+			}
+			if got := FormatDateTime(ts); got != tt.wantDateTime {
+				t.Errorf("FormatDateTime() = %q, want %q", got, tt.wantDateTime)
+			}
+		})
+	}
+}
+
+func TestConfigureTimeInvalid(t *testing.T) {
+	if err := ConfigureTime("Mars/Olympus_Mons", "24h", "iso"); err == nil {
+		t.Error("ConfigureTime() with unknown timezone: expected error")
+	}
+	if err := ConfigureTime("UTC", "25h", "iso"); err == nil {
+		t.Error("ConfigureTime() with bad clock: expected error")
+	}
+}
@@ -0,0 +1,155 @@
+package display
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+)
+
+// wide disables all truncation when set.
+var wide bool
+
+// SetWide controls whether tabular output may be truncated to fit the terminal.
+func SetWide(b bool) {
+	wide = b
+}
+
+// TerminalWidth returns the number of columns available for output, or 0 if
+// output should not be limited (wide mode, or stdout is not a terminal and
+// $COLUMNS is unset).
+func TerminalWidth() int {
+	if wide {
+		return 0
+	}
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return 0
+}
+
+// runeWidth returns the number of terminal cells a rune occupies.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || unicode.IsControl(r):
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// StringWidth returns the number of terminal cells s occupies.
+func StringWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// Truncate shortens s to at most max terminal cells, ending with "..." when
+// anything was cut. It never splits a multi-byte character. A max of 0 or
+// less means no limit.
+func Truncate(s string, max int) string {
+	if max <= 0 || StringWidth(s) <= max {
+		return s
+	}
+	const ellipsis = "..."
+	if max <= len(ellipsis) {
+		return ellipsis[:max]
+	}
+	limit := max - len(ellipsis)
+	n := 0
+	for i, r := range s {
+		w := runeWidth(r)
+		if n+w > limit {
+			return strings.TrimRight(s[:i], " ") + ellipsis
+		}
+		n += w
+	}
+	return s
+}
+
+// padRight pads s with spaces to exactly w terminal cells.
+func padRight(s string, w int) string {
+	if n := StringWidth(s); n < w {
+		return s + strings.Repeat(" ", w-n)
+	}
+	return s
+}
+
+// Wrap word-wraps s so that no line exceeds max terminal cells. Existing
+// line breaks are preserved, and words longer than max are broken. A max of
+// 0 or less returns s unchanged.
+func Wrap(s string, max int) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		if max <= 0 {
+			lines = append(lines, para)
+			continue
+		}
+		words := strings.Fields(para)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		var line strings.Builder
+		lineWidth := 0
+		for _, word := range words {
+			for StringWidth(word) > max {
+				if lineWidth > 0 {
+					lines = append(lines, line.String())
+					line.Reset()
+					lineWidth = 0
+				}
+				head, tail := splitAtWidth(word, max)
+				lines = append(lines, head)
+				word = tail
+			}
+			if word == "" {
+				continue
+			}
+			ww := StringWidth(word)
+			if lineWidth > 0 && lineWidth+1+ww > max {
+				lines = append(lines, line.String())
+				line.Reset()
+				lineWidth = 0
+			}
+			if lineWidth > 0 {
+				line.WriteByte(' ')
+				lineWidth++
+			}
+			line.WriteString(word)
+			lineWidth += ww
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// splitAtWidth splits s into a prefix of at most w cells and the remainder.
+// The prefix always contains at least one rune.
+func splitAtWidth(s string, w int) (string, string) {
+	n := 0
+	for i, r := range s {
+		rw := runeWidth(r)
+		if n+rw > w && i > 0 {
+			return s[:i], s[i:]
+		}
+		n += rw
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size], s[size:]
+}
@@ -0,0 +1,148 @@
+package display
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStringWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{name: "ascii", s: "Flinders Street", want: 15},
+		{name: "en dash", s: "Lilydale – Belgrave", want: 19},
+		{name: "curly quotes", s: "“Buses replace trains”", want: 22},
+		{name: "wide characters", s: "墨尔本", want: 6},
+		{name: "combining mark", s: "Café", want: 4},
+		{name: "empty", s: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StringWidth(tt.s); got != tt.want {
+				t.Errorf("StringWidth(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{name: "fits", s: "Route 96", max: 10, want: "Route 96"},
+		{name: "ascii cut", s: "Buses replace trains", max: 10, want: "Buses r..."},
+		{name: "en dash at cut", s: "Sandringham – Buses replace", max: 15, want: "Sandringham..."},
+		{name: "en dash kept", s: "Line – Buses replace trains", max: 12, want: "Line – Bu..."},
+		{name: "curly quotes", s: "“Works” on the Hurstbridge line", max: 12, want: "“Works” o..."},
+		{name: "wide characters", s: "墨尔本中央车站", max: 8, want: "墨尔..."},
+		{name: "no limit", s: "Buses replace trains", max: 0, want: "Buses replace trains"},
+		{name: "tiny limit", s: "Buses", max: 2, want: ".."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Truncate(%q, %d) produced invalid UTF-8: %q", tt.s, tt.max, got)
+			}
+			if tt.max > 0 && StringWidth(got) > tt.max {
+				t.Errorf("Truncate(%q, %d) width = %d, exceeds max", tt.s, tt.max, StringWidth(got))
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want []string
+	}{
+		{
+			name: "simple",
+			s:    "Buses replace trains between Flinders Street and Frankston",
+			max:  20,
+			want: []string{"Buses replace trains", "between Flinders", "Street and Frankston"},
+		},
+		{
+			name: "non-ascii",
+			s:    "Works – “expect delays” on the line",
+			max:  16,
+			want: []string{"Works – “expect", "delays” on the", "line"},
+		},
+		{
+			name: "preserves paragraphs",
+			s:    "First line\n\nSecond line",
+			max:  40,
+			want: []string{"First line", "", "Second line"},
+		},
+		{
+			name: "long word broken",
+			s:    "see https://ptv.vic.gov.au/disruptions",
+			max:  12,
+			want: []string{"see", "https://ptv.", "vic.gov.au/d", "isruptions"},
+		},
+		{
+			name: "no limit",
+			s:    "Buses replace trains",
+			max:  0,
+			want: []string{"Buses replace trains"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Wrap(tt.s, tt.max)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Wrap(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			for _, line := range got {
+				if tt.max > 0 && StringWidth(line) > tt.max {
+					t.Errorf("line %q width %d exceeds %d", line, StringWidth(line), tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestTableRender(t *testing.T) {
+	tab := newTable("ID", "STATUS", "TITLE").flexible(2)
+	tab.row("1", "Current", "Sandringham line – buses replace trains")
+	tab.row("22", "Planned", "“Works” at Richmond")
+
+	var buf bytes.Buffer
+	tab.render(&buf, 30)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if w := StringWidth(line); w > 30 {
+			t.Errorf("line %q width %d exceeds 30", line, w)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %q is not valid UTF-8", line)
+		}
+	}
+	if !strings.HasPrefix(lines[1], "1   Current  Sandringham") {
+		t.Errorf("misaligned row: %q", lines[1])
+	}
+
+	buf.Reset()
+	tab.render(&buf, 0)
+	if !strings.Contains(buf.String(), "Sandringham line – buses replace trains") {
+		t.Errorf("unlimited render truncated output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,118 @@
+// Package disruption tracks how the set of current disruptions changes:
+// which are new, which have been updated and which have been resolved.
+package disruption
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// Changes are the differences between two sets of disruptions.
+type Changes struct {
+	New      []api.Disruption `json:"new"`
+	Updated  []api.Disruption `json:"updated"`
+	Resolved []api.Disruption `json:"resolved"`
+}
+
+// Empty reports whether nothing changed.
+func (c *Changes) Empty() bool {
+	return len(c.New) == 0 && len(c.Updated) == 0 && len(c.Resolved) == 0
+}
+
+// Compare returns how after differs from before. A disruption is updated
+// if its last-updated time has changed, and resolved if it is no longer
+// listed. Each list is ordered by disruption ID.
+func Compare(before, after []api.Disruption) *Changes {
+	old := make(map[int]api.Disruption, len(before))
+	for _, d := range before {
+		old[d.DisruptionID] = d
+	}
+	current := make(map[int]bool, len(after))
+
+	c := &Changes{New: []api.Disruption{}, Updated: []api.Disruption{}, Resolved: []api.Disruption{}}
+	for _, d := range after {
+		if current[d.DisruptionID] {
+			// Listed under several modes.
+			continue
+		}
+		current[d.DisruptionID] = true
+		prev, ok := old[d.DisruptionID]
+		switch {
+		case !ok:
+			c.New = append(c.New, d)
+		case !sameTime(prev.LastUpdated, d.LastUpdated):
+			c.Updated = append(c.Updated, d)
+		}
+	}
+	for _, d := range old {
+		if !current[d.DisruptionID] {
+			c.Resolved = append(c.Resolved, d)
+		}
+	}
+	for _, list := range [][]api.Disruption{c.New, c.Updated, c.Resolved} {
+		sort.Slice(list, func(i, j int) bool { return list[i].DisruptionID < list[j].DisruptionID })
+	}
+	return c
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Seen is what was known about the disruptions at a point in time, saved
+// between runs to report changes since then. Only what identifies a
+// disruption and its latest version is kept.
+type Seen struct {
+	Checked     time.Time        `json:"checked"`
+	Disruptions []api.Disruption `json:"disruptions"`
+}
+
+// NewSeen records disruptions as seen at checked.
+func NewSeen(disruptions []api.Disruption, checked time.Time) *Seen {
+	s := &Seen{Checked: checked, Disruptions: make([]api.Disruption, 0, len(disruptions))}
+	for _, d := range disruptions {
+		s.Disruptions = append(s.Disruptions, api.Disruption{
+			DisruptionID:   d.DisruptionID,
+			Title:          d.Title,
+			DisruptionType: d.DisruptionType,
+			LastUpdated:    d.LastUpdated,
+		})
+	}
+	return s
+}
+
+// LoadSnapshot reads disruptions saved as JSON: the output of
+// 'disruptions --json', with disruptions grouped by mode; an object with a
+// flat "disruptions" list, as served by 'serve'; or a bare list.
+func LoadSnapshot(path string) ([]api.Disruption, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []api.Disruption
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var doc struct {
+		Disruptions json.RawMessage `json:"disruptions"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || len(doc.Disruptions) == 0 {
+		return nil, fmt.Errorf("%s is not a disruptions snapshot", path)
+	}
+	if err := json.Unmarshal(doc.Disruptions, &list); err == nil {
+		return list, nil
+	}
+	var grouped api.DisruptionCategories
+	if err := json.Unmarshal(doc.Disruptions, &grouped); err != nil {
+		return nil, fmt.Errorf("%s is not a disruptions snapshot: %w", path, err)
+	}
+	return grouped.AllDisruptions(), nil
+}
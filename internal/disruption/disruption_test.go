@@ -0,0 +1,96 @@
+package disruption
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func at(hour int) *time.Time {
+	t := time.Date(2024, 1, 15, hour, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func ids(ds []api.Disruption) []int {
+	out := []int{}
+	for _, d := range ds {
+		out = append(out, d.DisruptionID)
+	}
+	return out
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompare(t *testing.T) {
+	before := []api.Disruption{
+		{DisruptionID: 1, LastUpdated: at(8)},
+		{DisruptionID: 2, LastUpdated: at(8)},
+		{DisruptionID: 3, LastUpdated: at(8)},
+		{DisruptionID: 4},
+	}
+	after := []api.Disruption{
+		{DisruptionID: 5, LastUpdated: at(9)},
+		{DisruptionID: 2, LastUpdated: at(9)},
+		{DisruptionID: 1, LastUpdated: at(8)},
+		{DisruptionID: 4},
+		// Listed again under another mode.
+		{DisruptionID: 5, LastUpdated: at(9)},
+	}
+
+	c := Compare(before, after)
+	if !equal(ids(c.New), []int{5}) || !equal(ids(c.Updated), []int{2}) || !equal(ids(c.Resolved), []int{3}) {
+		t.Errorf("Compare() = new %v, updated %v, resolved %v; want [5], [2], [3]", ids(c.New), ids(c.Updated), ids(c.Resolved))
+	}
+	if !Compare(after, after).Empty() {
+		t.Error("comparing a set with itself found changes")
+	}
+	if c := Compare(nil, after); !equal(ids(c.New), []int{1, 2, 4, 5}) {
+		t.Errorf("first run: new = %v, want everything", ids(c.New))
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want []int
+	}{
+		{"grouped by mode", `{"disruptions":{"metro_train":[{"disruption_id":1}],"metro_tram":[{"disruption_id":2}]},"status":{}}`, []int{1, 2}},
+		{"flat list", `{"disruptions":[{"disruption_id":3}]}`, []int{3}},
+		{"bare list", `[{"disruption_id":4},{"disruption_id":5}]`, []int{4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snap.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadSnapshot(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equal(ids(got), tt.want) {
+				t.Errorf("LoadSnapshot() = %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "other.json")
+	os.WriteFile(path, []byte(`{"departures":[]}`), 0o644)
+	if _, err := LoadSnapshot(path); err == nil {
+		t.Error("LoadSnapshot() of a departures response succeeded, want an error")
+	}
+}
@@ -0,0 +1,268 @@
+// Package exporter polls the PTV API and exposes service health as
+// Prometheus metrics: departure delays, active disruptions, the API's
+// reported health, and the latency and status of API requests.
+package exporter
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+)
+
+// delayBuckets are the departure delay histogram buckets, in seconds.
+var delayBuckets = []float64{-60, 0, 60, 120, 180, 300, 600, 900, 1800}
+
+// latencyBuckets are the API request duration histogram buckets, in seconds.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// forgetAfter is how long a tracked departure is kept after it was last
+// seen, in case it never reaches its departure time in a poll.
+const forgetAfter = 2 * time.Hour
+
+// Stop is a stop to watch and the route types serving it.
+type Stop struct {
+	ID         int
+	RouteTypes []int
+}
+
+// Options configure an Exporter.
+type Options struct {
+	Stops []Stop
+	// Routes limits departures to these route IDs, if non-empty.
+	Routes []int
+	// Limit is how many departures to fetch per stop and route type.
+	Limit int
+}
+
+// Exporter polls the API and serves the metrics collected.
+type Exporter struct {
+	client *api.Client
+	opts   Options
+	routes map[int]bool
+
+	reg             registry
+	delay           *family
+	departed        *family
+	disruptions     *family
+	health          *family
+	requestDuration *family
+	requests        *family
+	pollErrors      *family
+	lastPoll        *family
+
+	mu      sync.Mutex
+	pending map[string]*pendingDeparture
+}
+
+// pendingDeparture is an upcoming departure, tracked until it leaves so
+// that each run's delay at a stop is observed once.
+type pendingDeparture struct {
+	labels    []string
+	scheduled time.Time
+	estimated *time.Time
+	lastSeen  time.Time
+}
+
+// New returns an Exporter polling with client. Client's HTTP transport is
+// wrapped to measure API requests.
+func New(client *api.Client, opts Options) *Exporter {
+	e := &Exporter{client: client, opts: opts, routes: make(map[int]bool), pending: make(map[string]*pendingDeparture)}
+	for _, id := range opts.Routes {
+		e.routes[id] = true
+	}
+
+	depLabels := []string{"stop_id", "stop", "route_id", "route", "mode"}
+	e.delay = e.reg.histogram("ptv_departure_delay_seconds",
+		"Delay of departures at their last realtime estimate before leaving, by stop and route.", delayBuckets, depLabels...)
+	e.departed = e.reg.counter("ptv_departures_total",
+		"Departures seen leaving, by stop and route, including those without a realtime estimate.", depLabels...)
+	e.disruptions = e.reg.gauge("ptv_disruptions_active",
+		"Current disruptions by mode and disruption type.", "mode", "type")
+	e.health = e.reg.gauge("ptv_api_health",
+		"Health reported in the status of the last API response (1 is healthy).")
+	e.requestDuration = e.reg.histogram("ptv_api_request_duration_seconds",
+		"Duration of PTV API requests by endpoint.", latencyBuckets, "endpoint")
+	e.requests = e.reg.counter("ptv_api_requests_total",
+		"PTV API requests by endpoint and HTTP status code (\"error\" if no response).", "endpoint", "code")
+	e.pollErrors = e.reg.counter("ptv_exporter_poll_errors_total",
+		"Failed fetches while polling.")
+	e.lastPoll = e.reg.gauge("ptv_exporter_last_success_timestamp_seconds",
+		"Time of the last poll that fetched everything successfully.")
+
+	hc := http.Client{Timeout: api.DefaultTimeout}
+	if client.HTTPClient != nil {
+		hc = *client.HTTPClient
+	}
+	next := hc.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	hc.Transport = &instrumentedTransport{next: next, e: e}
+	client.HTTPClient = &hc
+	return e
+}
+
+// Poll fetches departures and disruptions once and updates the metrics.
+// Metrics are updated from whatever was fetched even if some requests fail.
+func (e *Exporter) Poll(now time.Time) error {
+	var errs []error
+	for _, stop := range e.opts.Stops {
+		for _, rt := range stop.RouteTypes {
+			resp, err := e.client.Departures(rt, stop.ID, e.opts.Limit)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			e.health.set(float64(resp.Status.Health))
+			e.track(stop.ID, resp, now)
+		}
+	}
+	e.flush(now)
+
+	resp, err := e.client.Disruptions()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		e.health.set(float64(resp.Status.Health))
+		e.countDisruptions(resp.Disruptions)
+	}
+
+	if len(errs) > 0 {
+		e.pollErrors.inc(float64(len(errs)))
+		return errors.Join(errs...)
+	}
+	e.lastPoll.set(float64(now.Unix()))
+	return nil
+}
+
+// track records the latest estimates for the departures in resp.
+func (e *Exporter) track(stopID int, resp *api.DeparturesResponse, now time.Time) {
+	stopName := strconv.Itoa(stopID)
+	if s, ok := resp.Stops[stopName]; ok {
+		stopName = s.StopName
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, d := range resp.Departures {
+		if d.ScheduledDepartureUTC == nil || (len(e.routes) > 0 && !e.routes[d.RouteID]) {
+			continue
+		}
+		key := d.RunRef + "/" + strconv.Itoa(stopID)
+		p, ok := e.pending[key]
+		if !ok {
+			route, mode := strconv.Itoa(d.RouteID), ""
+			if r, ok := resp.Routes[strconv.Itoa(d.RouteID)]; ok {
+				route = r.RouteName
+				if r.RouteNumber != "" {
+					route = r.RouteNumber
+				}
+				mode = display.RouteTypeName(r.RouteType)
+			}
+			p = &pendingDeparture{labels: []string{strconv.Itoa(stopID), stopName, strconv.Itoa(d.RouteID), route, mode}}
+			e.pending[key] = p
+		}
+		p.scheduled = *d.ScheduledDepartureUTC
+		if d.EstimatedDepartureUTC != nil {
+			p.estimated = d.EstimatedDepartureUTC
+		}
+		p.lastSeen = now
+	}
+}
+
+// flush observes the departures that have left by now.
+func (e *Exporter) flush(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, p := range e.pending {
+		departs := p.scheduled
+		if p.estimated != nil {
+			departs = *p.estimated
+		}
+		switch {
+		case !departs.After(now):
+			e.departed.inc(1, p.labels...)
+			if p.estimated != nil {
+				e.delay.observe(p.estimated.Sub(p.scheduled).Seconds(), p.labels...)
+			}
+			delete(e.pending, key)
+		case now.Sub(p.lastSeen) > forgetAfter:
+			delete(e.pending, key)
+		}
+	}
+}
+
+// countDisruptions sets the active disruption gauges from the current
+// disruptions in each mode's category.
+func (e *Exporter) countDisruptions(dc api.DisruptionCategories) {
+	var samples []sample
+	for _, c := range []struct {
+		mode        string
+		disruptions []api.Disruption
+	}{
+		{"metro_train", dc.MetroTrain},
+		{"metro_tram", dc.MetroTram},
+		{"metro_bus", dc.MetroBus},
+		{"regional_train", dc.VLineTrain},
+		{"regional_coach", dc.VLineCoach},
+		{"regional_bus", dc.VLineBus},
+		{"school_bus", dc.SchoolBus},
+		{"telebus", dc.Telebus},
+		{"night_bus", dc.NightBus},
+		{"ferry", dc.Ferry},
+		{"interstate", dc.Interstate},
+		{"skybus", dc.SkyBus},
+		{"taxi", dc.TaxiAndRideshare},
+		{"general", dc.General},
+	} {
+		for _, d := range c.disruptions {
+			if strings.EqualFold(d.DisruptionStatus, "Current") {
+				samples = append(samples, sample{labelValues: []string{c.mode, d.DisruptionType}, value: 1})
+			}
+		}
+	}
+	e.disruptions.replace(samples)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.reg.writeText(w)
+}
+
+// instrumentedTransport measures the requests made by the API client.
+type instrumentedTransport struct {
+	next http.RoundTripper
+	e    *Exporter
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	endpoint := endpointOf(req.URL.Path)
+	t.e.requestDuration.observe(time.Since(start).Seconds(), endpoint)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	t.e.requests.inc(1, endpoint, code)
+	return resp, err
+}
+
+// endpointOf names the API endpoint of a request path by its first
+// segment, such as "departures" for /v3/departures/route_type/0/stop/1071,
+// keeping IDs out of the metric labels.
+func endpointOf(path string) string {
+	rest := strings.TrimPrefix(path, "/v3/")
+	name, _, _ := strings.Cut(rest, "/")
+	if name == "" {
+		return "other"
+	}
+	return name
+}
@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func TestWriteText(t *testing.T) {
+	var r registry
+	c := r.counter("requests_total", "Requests.", "code")
+	h := r.histogram("delay_seconds", "Delay.", []float64{0, 60}, "route")
+	r.gauge("unset", "Never set.")
+	c.inc(2, "200")
+	c.inc(1, `say "hi"`)
+	h.observe(30, "96")
+	h.observe(90, "96")
+
+	var b strings.Builder
+	if err := r.writeText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{code="200"} 2
+requests_total{code="say \"hi\""} 1
+# HELP delay_seconds Delay.
+# TYPE delay_seconds histogram
+delay_seconds_bucket{route="96",le="0"} 0
+delay_seconds_bucket{route="96",le="60"} 1
+delay_seconds_bucket{route="96",le="+Inf"} 2
+delay_seconds_sum{route="96"} 120
+delay_seconds_count{route="96"} 2
+# HELP unset Never set.
+# TYPE unset gauge
+`
+	if b.String() != want {
+		t.Errorf("writeText() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// departures serves stop 1071 with two runs on route 6: "a" leaves at
+// 21:02 UTC, two minutes late, and "b" is scheduled for 21:10.
+const departures = `{"departures":[
+ {"stop_id":1071,"route_id":6,"run_ref":"a","scheduled_departure_utc":"2024-01-15T21:00:00Z","estimated_departure_utc":"2024-01-15T21:02:00Z"},
+ {"stop_id":1071,"route_id":6,"run_ref":"b","scheduled_departure_utc":"2024-01-15T21:10:00Z"},
+ {"stop_id":1071,"route_id":7,"run_ref":"c","scheduled_departure_utc":"2024-01-15T21:01:00Z"}],
+ "stops":{"1071":{"stop_name":"Flinders Street"}},
+ "routes":{"6":{"route_name":"Lilydale","route_type":0}},
+ "status":{"health":1}}`
+
+const disruptions = `{"disruptions":{
+ "metro_train":[{"disruption_status":"Current","disruption_type":"Minor Delays"},{"disruption_status":"Planned","disruption_type":"Planned Works"}],
+ "metro_tram":[{"disruption_status":"Current","disruption_type":"Minor Delays"},{"disruption_status":"Current","disruption_type":"Minor Delays"}]},
+ "status":{"health":1}}`
+
+func TestPoll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/departures/route_type/0/stop/1071":
+			w.Write([]byte(departures))
+		case "/v3/disruptions":
+			w.Write([]byte(disruptions))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := api.NewClient("1000001", "test-key")
+	c.BaseURL = srv.URL
+
+	e := New(c, Options{Stops: []Stop{{ID: 1071, RouteTypes: []int{0, 1}}}, Routes: []int{6}, Limit: 5})
+	start := time.Date(2024, 1, 15, 20, 58, 0, 0, time.UTC)
+	if err := e.Poll(start); err == nil {
+		t.Error("Poll() succeeded, want the tram departures' 404")
+	}
+	// Run a has now left; run b has not.
+	e.Poll(start.Add(5 * time.Minute))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	labels := `stop_id="1071",stop="Flinders Street",route_id="6",route="Lilydale",mode="Train"`
+	for _, want := range []string{
+		`ptv_departure_delay_seconds_bucket{` + labels + `,le="120"} 1`,
+		`ptv_departure_delay_seconds_bucket{` + labels + `,le="60"} 0`,
+		`ptv_departure_delay_seconds_sum{` + labels + `} 120`,
+		`ptv_departures_total{` + labels + `} 1`,
+		`ptv_disruptions_active{mode="metro_train",type="Minor Delays"} 1`,
+		`ptv_disruptions_active{mode="metro_tram",type="Minor Delays"} 2`,
+		`ptv_api_health 1`,
+		`ptv_api_requests_total{endpoint="departures",code="200"} 2`,
+		`ptv_api_requests_total{endpoint="departures",code="404"} 2`,
+		`ptv_api_requests_total{endpoint="disruptions",code="200"} 2`,
+		`ptv_api_request_duration_seconds_count{endpoint="disruptions"} 2`,
+		`ptv_exporter_poll_errors_total 2`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+	for _, unwanted := range []string{`route_id="7"`, `Planned Works`} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("metrics contain %s", unwanted)
+		}
+	}
+}
+
+func TestEndpointOf(t *testing.T) {
+	tests := map[string]string{
+		"/v3/departures/route_type/0/stop/1071": "departures",
+		"/v3/disruptions":                       "disruptions",
+		"/v3/search/flinders":                   "search",
+		"/":                                     "other",
+	}
+	for path, want := range tests {
+		if got := endpointOf(path); got != want {
+			t.Errorf("endpointOf(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
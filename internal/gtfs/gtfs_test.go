@@ -0,0 +1,303 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeZip writes files to a new zip at path.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFeed is a tram route with two trips from stop 2504 to 1071: one on
+// weekdays at 08:00, and one late on Mondays that runs past midnight.
+var testFeed = map[string]string{
+	"stops.txt": "\ufeffstop_id,stop_name,stop_lat,stop_lon\n" +
+		"2504,Home St,-37.80,144.96\n" +
+		"1071,Flinders Street,-37.818,144.967\n",
+	"routes.txt": "route_id,route_short_name,route_long_name,route_type\n" +
+		"3-96,96,East Brunswick - St Kilda Beach,0\n",
+	"trips.txt": "route_id,service_id,trip_id,trip_headsign,direction_id\n" +
+		"3-96,WD,T1,St Kilda,0\n" +
+		"3-96,MON,T2,St Kilda,0\n",
+	"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"T1,08:00:00,08:00:00,2504,1\n" +
+		"T1,08:19:00,08:19:00,1071,2\n" +
+		"T2,24:30:00,24:30:00,2504,1\n" +
+		"T2,24:49:00,24:49:00,1071,2\n",
+	"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+		"WD,1,1,1,1,1,0,0,20240101,20241231\n" +
+		"MON,1,0,0,0,0,0,0,20240101,20241231\n",
+	"calendar_dates.txt": "service_id,date,exception_type\n" +
+		"WD,20240116,2\n",
+}
+
+func importTestFeed(t *testing.T) *Store {
+	t.Helper()
+	s, stats := importFiles(t, testFeed)
+	if stats.Stops != 2 || stats.Routes != 1 || stats.Trips != 2 || stats.StopTimes != 4 {
+		t.Errorf("stats = %+v, want 2 stops, 1 route, 2 trips, 4 stop times", stats)
+	}
+	return s
+}
+
+// importFiles imports a feed made of files and opens it.
+func importFiles(t *testing.T, files map[string]string) (*Store, Stats) {
+	t.Helper()
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "feed.zip")
+	writeZip(t, zipPath, files)
+
+	dbPath := filepath.Join(dir, "gtfs.db")
+	stats, err := Import(zipPath, dbPath, nil)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	s, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, stats
+}
+
+func TestDeparturesAt(t *testing.T) {
+	s := importTestFeed(t)
+	loc := s.loc
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []time.Time
+	}{
+		{
+			name: "monday morning",
+			at:   time.Date(2024, 1, 15, 7, 0, 0, 0, loc),
+			want: []time.Time{
+				time.Date(2024, 1, 15, 8, 0, 0, 0, loc),
+				time.Date(2024, 1, 16, 0, 30, 0, 0, loc),
+			},
+		},
+		{
+			name: "after midnight is the previous service day",
+			at:   time.Date(2024, 1, 16, 0, 10, 0, 0, loc),
+			want: []time.Time{
+				time.Date(2024, 1, 16, 0, 30, 0, 0, loc),
+			},
+		},
+		{
+			name: "cancelled by calendar_dates",
+			at:   time.Date(2024, 1, 16, 1, 0, 0, 0, loc),
+			want: []time.Time{
+				time.Date(2024, 1, 17, 8, 0, 0, 0, loc),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.DeparturesAt(1, 2504, tt.at, len(tt.want))
+			if err != nil {
+				t.Fatalf("DeparturesAt() error = %v", err)
+			}
+			if len(resp.Departures) != len(tt.want) {
+				t.Fatalf("got %d departures, want %d", len(resp.Departures), len(tt.want))
+			}
+			for i, d := range resp.Departures {
+				if !d.ScheduledDepartureUTC.Equal(tt.want[i]) {
+					t.Errorf("departure %d at %s, want %s", i, d.ScheduledDepartureUTC.In(loc), tt.want[i])
+				}
+				if dir := resp.Directions[strconv.Itoa(d.DirectionID)]; dir.DirectionName != "St Kilda" {
+					t.Errorf("departure %d direction = %q, want St Kilda", i, dir.DirectionName)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenTimezone(t *testing.T) {
+	if s := importTestFeed(t); s.loc.String() != defaultTimezone {
+		t.Errorf("timezone without agency.txt = %s, want %s", s.loc, defaultTimezone)
+	}
+
+	files := map[string]string{"agency.txt": "agency_id,agency_name,agency_timezone\nPTV,Public Transport Victoria,Australia/Perth\n"}
+	for name, content := range testFeed {
+		files[name] = content
+	}
+	if s, _ := importFiles(t, files); s.loc.String() != "Australia/Perth" {
+		t.Errorf("timezone = %s, want the feed's Australia/Perth", s.loc)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	s := importTestFeed(t)
+	resp, err := s.DeparturesAt(1, 2504, time.Date(2024, 1, 15, 7, 0, 0, 0, s.loc), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := resp.Departures[0].RunRef
+
+	pattern, err := s.Pattern(ref, 1)
+	if err != nil {
+		t.Fatalf("Pattern(%q) error = %v", ref, err)
+	}
+	if len(pattern.Departures) != 2 {
+		t.Fatalf("got %d pattern stops, want 2", len(pattern.Departures))
+	}
+	last := pattern.Departures[1]
+	if last.StopID != 1071 || !last.ScheduledDepartureUTC.Equal(time.Date(2024, 1, 15, 8, 19, 0, 0, s.loc)) {
+		t.Errorf("last stop = %d at %s, want 1071 at 08:19", last.StopID, last.ScheduledDepartureUTC.In(s.loc))
+	}
+	if pattern.Stops["1071"].StopName != "Flinders Street" {
+		t.Errorf("stop 1071 name = %q, want Flinders Street", pattern.Stops["1071"].StopName)
+	}
+}
+
+func TestSearchAndRoutes(t *testing.T) {
+	s := importTestFeed(t)
+
+	resp, err := s.Search("flinders", nil)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(resp.Stops) != 1 || resp.Stops[0].StopID != 1071 || resp.Stops[0].RouteType != 1 {
+		t.Errorf("stops = %+v, want Flinders Street as a tram stop", resp.Stops)
+	}
+
+	resp, err = s.Search("96", []int{1})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(resp.Routes) != 1 || resp.Routes[0].RouteGTFSID != "3-96" {
+		t.Fatalf("routes = %+v, want route 96", resp.Routes)
+	}
+
+	id := resp.Routes[0].RouteID
+	if r, err := s.Route(id); err != nil || r.Route.RouteNumber != "96" {
+		t.Errorf("Route(%d) = %+v, %v; want route 96", id, r, err)
+	}
+	if _, err := s.Route(722); err == nil || !strings.Contains(err.Error(), "API route ID") {
+		t.Errorf("Route(722) error = %v, want an API route ID refused", err)
+	}
+	if _, err := s.RouteDepartures(1, 2504, 722, 0, 1); err == nil {
+		t.Error("RouteDepartures with API route 722 succeeded, want refused")
+	}
+
+	types, err := s.StopRouteTypes(2504)
+	if err != nil || len(types) != 1 || types[0] != 1 {
+		t.Errorf("StopRouteTypes(2504) = %v, %v; want [1]", types, err)
+	}
+	if _, err := s.Stop(2504, 0); err == nil {
+		t.Error("Stop(2504, train) succeeded, want not found")
+	}
+}
+
+func TestSearchRouteTypeBeforeLimit(t *testing.T) {
+	// 100 bus stops sort ahead of the one tram stop matching "main st".
+	stops := "stop_id,stop_name,stop_lat,stop_lon\n"
+	stopTimes := "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n"
+	for i := 1; i <= 101; i++ {
+		stops += fmt.Sprintf("%d,Main St %03d,-37.8,144.9\n", 5000+i, i)
+		trip := "TB"
+		if i == 101 {
+			trip = "TT"
+		}
+		stopTimes += fmt.Sprintf("%s,08:00:00,08:00:00,%d,%d\n", trip, 5000+i, i)
+	}
+	s, _ := importFiles(t, map[string]string{
+		"stops.txt":      stops,
+		"routes.txt":     "route_id,route_short_name,route_long_name,route_type\nB,1,Bus,3\nT,2,Tram,0\n",
+		"trips.txt":      "route_id,service_id,trip_id,trip_headsign,direction_id\nB,WD,TB,City,0\nT,WD,TT,City,0\n",
+		"stop_times.txt": stopTimes,
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"WD,1,1,1,1,1,0,0,20240101,20241231\n",
+	})
+
+	resp, err := s.Search("main st", []int{1})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(resp.Stops) != 1 || resp.Stops[0].StopID != 5101 {
+		t.Errorf("tram stops = %+v, want Main St 101", resp.Stops)
+	}
+}
+
+func TestParseGTFSTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "08:00:00", want: 8 * 3600},
+		{in: "24:30:15", want: 24*3600 + 30*60 + 15},
+		{in: " 7:05:00", want: 7*3600 + 5*60},
+		{in: "", want: -1},
+		{in: "8:00", wantErr: true},
+		{in: "aa:00:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseGTFSTime(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGTFSTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseGTFSTime(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTrip(t *testing.T) {
+	s := importTestFeed(t)
+
+	tests := []struct {
+		name      string
+		stopID    int
+		at        time.Time
+		route     string
+		wantTrip  string
+		wantStart string
+	}{
+		{name: "morning trip", stopID: 2504, at: time.Date(2024, 1, 15, 8, 0, 0, 0, s.loc), route: "3-96", wantTrip: "T1", wantStart: "20240115"},
+		{name: "after midnight", stopID: 1071, at: time.Date(2024, 1, 16, 0, 49, 0, 0, s.loc), wantTrip: "T2", wantStart: "20240115"},
+		{name: "cancelled day", stopID: 2504, at: time.Date(2024, 1, 16, 8, 0, 0, 0, s.loc)},
+		{name: "no departure then", stopID: 2504, at: time.Date(2024, 1, 15, 8, 1, 0, 0, s.loc)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip, start, err := s.MatchTrip(tt.stopID, tt.at, tt.route)
+			if err != nil {
+				t.Fatalf("MatchTrip() error = %v", err)
+			}
+			if trip != tt.wantTrip || start != tt.wantStart {
+				t.Errorf("MatchTrip() = %q, %q; want %q, %q", trip, start, tt.wantTrip, tt.wantStart)
+			}
+		})
+	}
+}
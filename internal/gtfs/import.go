@@ -0,0 +1,553 @@
+// Package gtfs imports a GTFS static timetable feed into a local SQLite
+// database and answers stop, route, search and scheduled departure queries
+// from it, so they can be served without the PTV API.
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// ptvFeedRouteTypes maps the numbered folders of PTV's combined GTFS zip
+// to the API's route types.
+var ptvFeedRouteTypes = map[string]int{
+	"1":  3, // Regional train
+	"2":  0, // Metropolitan train
+	"3":  1, // Metropolitan tram
+	"4":  2, // Metropolitan bus
+	"5":  4, // Regional coach
+	"6":  2, // Regional bus
+	"7":  2, // TeleBus
+	"8":  2, // Night bus
+	"10": 3, // Interstate train
+	"11": 2, // SkyBus
+}
+
+// Stats counts what an import loaded.
+type Stats struct {
+	Feeds     int `json:"feeds"`
+	Stops     int `json:"stops"`
+	Routes    int `json:"routes"`
+	Trips     int `json:"trips"`
+	StopTimes int `json:"stop_times"`
+}
+
+// feed is one GTFS feed within the imported zip.
+type feed struct {
+	name string
+	// routeType is the API route type for every route in the feed, or -1
+	// to map each route's GTFS route_type.
+	routeType int
+	files     map[string]*zip.File
+}
+
+// Import loads the GTFS zip at zipPath into a new database at dbPath,
+// replacing any existing one only once the import has succeeded. The zip
+// may be a single feed or PTV's bundle of numbered per-mode feeds. progress,
+// if not nil, is called with a description of each step.
+func Import(zipPath, dbPath string, progress func(string)) (Stats, error) {
+	if progress == nil {
+		progress = func(string) {}
+	}
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer zr.Close()
+
+	feeds, err := findFeeds(&zr.Reader)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return Stats{}, err
+	}
+	tmpPath := dbPath + ".importing"
+	os.Remove(tmpPath)
+	db, err := sql.Open("sqlite", tmpPath)
+	if err != nil {
+		return Stats{}, err
+	}
+	ok := false
+	defer func() {
+		db.Close()
+		if !ok {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := db.Exec(schema); err != nil {
+		return Stats{}, fmt.Errorf("creating database: %w", err)
+	}
+	im := &importer{db: db, stopIDs: make(map[string]int64)}
+	for _, f := range feeds {
+		label := "feed"
+		if f.name != "" {
+			label = "feed " + f.name
+		}
+		progress("Importing " + label)
+		if err := im.importFeed(f); err != nil {
+			if f.name != "" {
+				return Stats{}, fmt.Errorf("%s: %w", label, err)
+			}
+			return Stats{}, err
+		}
+		im.stats.Feeds++
+	}
+
+	progress("Indexing")
+	if _, err := db.Exec(indexes); err != nil {
+		return Stats{}, fmt.Errorf("indexing: %w", err)
+	}
+	timezone := im.timezone
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+	if _, err := db.Exec(`INSERT INTO meta (key, value) VALUES ('imported', ?), ('source', ?), ('timezone', ?)`,
+		time.Now().UTC().Format(time.RFC3339), filepath.Base(zipPath), timezone); err != nil {
+		return Stats{}, err
+	}
+	if err := db.Close(); err != nil {
+		return Stats{}, err
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return Stats{}, err
+	}
+	ok = true
+	return im.stats, nil
+}
+
+// findFeeds locates the feeds in a zip: the zip itself if it has
+// stops.txt, otherwise any nested google_transit.zip files.
+func findFeeds(zr *zip.Reader) ([]feed, error) {
+	root := feed{routeType: -1, files: make(map[string]*zip.File)}
+	var nested []*zip.File
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		switch {
+		case strings.HasSuffix(name, ".txt") && path.Dir(f.Name) == ".":
+			root.files[name] = f
+		case strings.HasSuffix(name, ".zip"):
+			nested = append(nested, f)
+		}
+	}
+	if root.files["stops.txt"] != nil {
+		return []feed{root}, nil
+	}
+
+	var feeds []feed
+	for _, f := range nested {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		inner, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		name := path.Dir(f.Name)
+		fd := feed{name: name, routeType: -1, files: make(map[string]*zip.File)}
+		if rt, ok := ptvFeedRouteTypes[name]; ok {
+			fd.routeType = rt
+		}
+		for _, g := range inner.File {
+			fd.files[path.Base(g.Name)] = g
+		}
+		if fd.files["stops.txt"] != nil {
+			feeds = append(feeds, fd)
+		}
+	}
+	if len(feeds) == 0 {
+		return nil, errors.New("no GTFS feed found: expected stops.txt or nested google_transit.zip files")
+	}
+	return feeds, nil
+}
+
+// importer loads feeds into the database, keeping the state needed to link
+// rows across files.
+type importer struct {
+	db    *sql.DB
+	stats Stats
+	// stopIDs maps GTFS stop IDs to database stop IDs.
+	stopIDs map[string]int64
+	// nextStopID numbers stops whose GTFS IDs are not numeric.
+	nextStopID int64
+	// nextRouteID numbers routes.
+	nextRouteID int64
+	// timezone is the first agency_timezone seen, which the feed's times
+	// are in.
+	timezone string
+}
+
+// localStopBase is where stop IDs for non-numeric GTFS stop IDs start, well
+// clear of PTV's numeric stop IDs.
+const localStopBase = 1_000_000_000
+
+// localRouteBase is where route IDs start. GTFS route IDs do not carry the
+// API's route IDs, so routes are numbered well clear of them, and an API
+// route ID given offline can be recognised and refused.
+const localRouteBase = 1_000_000
+
+func (im *importer) importFeed(f feed) error {
+	for _, name := range []string{"stops.txt", "routes.txt", "trips.txt", "stop_times.txt"} {
+		if f.files[name] == nil {
+			return fmt.Errorf("missing %s", name)
+		}
+	}
+
+	if err := im.importAgency(f); err != nil {
+		return err
+	}
+
+	tx, err := im.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := im.importStops(tx, f); err != nil {
+		return err
+	}
+	routeIDs, err := im.importRoutes(tx, f)
+	if err != nil {
+		return err
+	}
+	tripIDs, err := im.importTrips(tx, f, routeIDs)
+	if err != nil {
+		return err
+	}
+	if err := im.importStopTimes(tx, f, tripIDs); err != nil {
+		return err
+	}
+	if err := im.importCalendars(tx, f); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// importAgency notes the feed's timezone from agency.txt, if it has one.
+func (im *importer) importAgency(f feed) error {
+	if f.files["agency.txt"] == nil || im.timezone != "" {
+		return nil
+	}
+	return eachRow(f.files["agency.txt"], func(r row) error {
+		tz := r.get("agency_timezone")
+		if tz == "" || im.timezone != "" {
+			return nil
+		}
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("agency.txt: unknown agency_timezone %q", tz)
+		}
+		im.timezone = tz
+		return nil
+	})
+}
+
+func (im *importer) importStops(tx *sql.Tx, f feed) error {
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO stops (id, gtfs_id, name, lat, lon) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	return eachRow(f.files["stops.txt"], func(r row) error {
+		gtfsID := r.get("stop_id")
+		id, ok := im.stopIDs[gtfsID]
+		if !ok {
+			if n, err := strconv.ParseInt(gtfsID, 10, 64); err == nil && n < localStopBase {
+				id = n
+			} else {
+				im.nextStopID++
+				id = localStopBase + im.nextStopID
+			}
+			im.stopIDs[gtfsID] = id
+		}
+		lat, _ := strconv.ParseFloat(r.get("stop_lat"), 64)
+		lon, _ := strconv.ParseFloat(r.get("stop_lon"), 64)
+		res, err := stmt.Exec(id, gtfsID, r.get("stop_name"), lat, lon)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			im.stats.Stops++
+		}
+		return nil
+	})
+}
+
+func (im *importer) importRoutes(tx *sql.Tx, f feed) (map[string]int64, error) {
+	stmt, err := tx.Prepare(`INSERT INTO routes (id, feed, gtfs_id, number, name, route_type) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	ids := make(map[string]int64)
+	err = eachRow(f.files["routes.txt"], func(r row) error {
+		routeType := f.routeType
+		if routeType < 0 {
+			gt, _ := strconv.Atoi(r.get("route_type"))
+			routeType = apiRouteType(gt)
+		}
+		im.nextRouteID++
+		id := localRouteBase + im.nextRouteID
+		if _, err := stmt.Exec(id, f.name, r.get("route_id"), r.get("route_short_name"), r.get("route_long_name"), routeType); err != nil {
+			return err
+		}
+		ids[r.get("route_id")] = id
+		im.stats.Routes++
+		return nil
+	})
+	return ids, err
+}
+
+// apiRouteType maps a GTFS route_type to the closest API route type.
+func apiRouteType(gtfsType int) int {
+	switch gtfsType {
+	case 0, 900:
+		return 1 // Tram
+	case 1, 2, 100:
+		return 0 // Train
+	default:
+		return 2 // Bus
+	}
+}
+
+func (im *importer) importTrips(tx *sql.Tx, f feed, routeIDs map[string]int64) (map[string]int64, error) {
+	tripStmt, err := tx.Prepare(`INSERT INTO trips (gtfs_id, route_id, service, direction_id, headsign) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer tripStmt.Close()
+	dirStmt, err := tx.Prepare(`INSERT INTO directions (route_id, name) VALUES (?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer dirStmt.Close()
+
+	// Directions are numbered per route and headsign, since GTFS's 0/1
+	// direction_id does not say where a trip is going.
+	type dirKey struct {
+		route int64
+		name  string
+	}
+	dirIDs := make(map[dirKey]int64)
+	ids := make(map[string]int64)
+	err = eachRow(f.files["trips.txt"], func(r row) error {
+		routeID, ok := routeIDs[r.get("route_id")]
+		if !ok {
+			return nil
+		}
+		key := dirKey{routeID, r.get("trip_headsign")}
+		dirID, ok := dirIDs[key]
+		if !ok {
+			res, err := dirStmt.Exec(key.route, key.name)
+			if err != nil {
+				return err
+			}
+			if dirID, err = res.LastInsertId(); err != nil {
+				return err
+			}
+			dirIDs[key] = dirID
+		}
+		res, err := tripStmt.Exec(r.get("trip_id"), routeID, serviceKey(f, r.get("service_id")), dirID, key.name)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		ids[r.get("trip_id")] = id
+		im.stats.Trips++
+		return nil
+	})
+	return ids, err
+}
+
+// serviceKey qualifies a service ID with its feed, since feeds in PTV's
+// bundle number their services independently.
+func serviceKey(f feed, serviceID string) string {
+	if f.name == "" {
+		return serviceID
+	}
+	return f.name + "/" + serviceID
+}
+
+func (im *importer) importStopTimes(tx *sql.Tx, f feed, tripIDs map[string]int64) error {
+	stmt, err := tx.Prepare(`INSERT INTO stop_times (trip_id, stop_id, seq, arrival, departure) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	return eachRow(f.files["stop_times.txt"], func(r row) error {
+		tripID, ok := tripIDs[r.get("trip_id")]
+		if !ok {
+			return nil
+		}
+		stopID, ok := im.stopIDs[r.get("stop_id")]
+		if !ok {
+			return nil
+		}
+		seq, _ := strconv.Atoi(r.get("stop_sequence"))
+		dep, err := parseGTFSTime(r.get("departure_time"))
+		if err != nil {
+			return err
+		}
+		arr, err := parseGTFSTime(r.get("arrival_time"))
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(tripID, stopID, seq, arr, dep); err != nil {
+			return err
+		}
+		im.stats.StopTimes++
+		return nil
+	})
+}
+
+func (im *importer) importCalendars(tx *sql.Tx, f feed) error {
+	if cal := f.files["calendar.txt"]; cal != nil {
+		stmt, err := tx.Prepare(`INSERT OR REPLACE INTO calendar (service, days, start_date, end_date) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		err = eachRow(cal, func(r row) error {
+			// days holds a bit per weekday, Sunday first, matching
+			// time.Weekday.
+			days := 0
+			for i, d := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+				if r.get(d) == "1" {
+					days |= 1 << i
+				}
+			}
+			_, err := stmt.Exec(serviceKey(f, r.get("service_id")), days, r.get("start_date"), r.get("end_date"))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if dates := f.files["calendar_dates.txt"]; dates != nil {
+		stmt, err := tx.Prepare(`INSERT INTO calendar_dates (service, date, exception) VALUES (?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		return eachRow(dates, func(r row) error {
+			exception, _ := strconv.Atoi(r.get("exception_type"))
+			_, err := stmt.Exec(serviceKey(f, r.get("service_id")), r.get("date"), exception)
+			return err
+		})
+	}
+	return nil
+}
+
+// parseGTFSTime parses an HH:MM:SS time, which may be past 24:00 for
+// trips running after midnight, into seconds since the start of the
+// service day. An empty time is -1.
+func parseGTFSTime(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return -1, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var secs int
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		secs = secs*60 + n
+	}
+	return secs, nil
+}
+
+// row is a CSV record with access by column name.
+type row struct {
+	cols   map[string]int
+	fields []string
+}
+
+func (r row) get(name string) string {
+	if i, ok := r.cols[name]; ok && i < len(r.fields) {
+		return strings.TrimSpace(r.fields[i])
+	}
+	return ""
+}
+
+// eachRow calls fn for every record of a GTFS CSV file.
+func eachRow(f *zip.File, fn func(row) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	cr := csv.NewReader(rc)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if err := fn(row{cols: cols, fields: rec}); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+}
+
+const schema = `
+CREATE TABLE meta (key TEXT PRIMARY KEY, value TEXT);
+CREATE TABLE stops (id INTEGER PRIMARY KEY, gtfs_id TEXT, name TEXT, lat REAL, lon REAL);
+CREATE TABLE routes (id INTEGER PRIMARY KEY, feed TEXT, gtfs_id TEXT, number TEXT, name TEXT, route_type INTEGER);
+CREATE TABLE directions (id INTEGER PRIMARY KEY, route_id INTEGER, name TEXT);
+CREATE TABLE trips (id INTEGER PRIMARY KEY, gtfs_id TEXT, route_id INTEGER, service TEXT, direction_id INTEGER, headsign TEXT);
+CREATE TABLE stop_times (trip_id INTEGER, stop_id INTEGER, seq INTEGER, arrival INTEGER, departure INTEGER);
+CREATE TABLE calendar (service TEXT PRIMARY KEY, days INTEGER, start_date TEXT, end_date TEXT);
+CREATE TABLE calendar_dates (service TEXT, date TEXT, exception INTEGER);
+`
+
+const indexes = `
+CREATE INDEX stop_times_stop ON stop_times (stop_id, departure);
+CREATE INDEX stop_times_trip ON stop_times (trip_id, seq);
+CREATE INDEX trips_route ON trips (route_id);
+CREATE INDEX calendar_dates_date ON calendar_dates (date);
+CREATE TABLE stop_route_types AS
+	SELECT DISTINCT st.stop_id, r.route_type
+	FROM stop_times st JOIN trips t ON t.id = st.trip_id JOIN routes r ON r.id = t.route_id;
+CREATE INDEX stop_route_types_stop ON stop_route_types (stop_id);
+`
@@ -0,0 +1,599 @@
+package gtfs
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/cache"
+)
+
+// DefaultPath returns where the imported timetable is stored, or "" if the
+// cache directory cannot be determined.
+func DefaultPath() string {
+	dir := cache.Dir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "gtfs.db")
+}
+
+// defaultTimezone is the timezone of timetables whose feed has no
+// agency.txt, or that were imported before it was recorded. PTV's feeds are
+// all in Melbourne time.
+const defaultTimezone = "Australia/Melbourne"
+
+// Store answers queries from an imported timetable. Its methods mirror
+// those of api.Client and return the same response types, with IDs from the
+// feed: stop IDs are PTV's, while route and direction IDs are numbered by
+// the import.
+type Store struct {
+	db  *sql.DB
+	loc *time.Location
+}
+
+// Open opens the timetable database at path. Service days are interpreted
+// in the feed's timezone, whatever timezone times are displayed in.
+func Open(path string) (*Store, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no GTFS timetable imported; run 'vic-ptv gtfs import <zip>' first")
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	tz := defaultTimezone
+	var name string
+	if err := db.QueryRow(`SELECT value FROM meta WHERE key = 'timezone'`).Scan(&name); err == nil && name != "" {
+		tz = name
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("timetable timezone: %w", err)
+	}
+	// Older imports numbered routes from 1, where they collide with the
+	// API's route IDs.
+	var old int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM routes WHERE id < ?`, localRouteBase).Scan(&old); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if old > 0 {
+		db.Close()
+		return nil, fmt.Errorf("the GTFS timetable was imported by an older version; run 'vic-ptv gtfs import <zip>' again")
+	}
+	return &Store{db: db, loc: loc}, nil
+}
+
+// checkRouteID refuses a route ID from the API, which means a different
+// route or none at all in the imported timetable.
+func checkRouteID(routeID int) error {
+	if routeID < localRouteBase {
+		return fmt.Errorf("route %d is an API route ID; offline routes are numbered by the import, so give the route by number or name, such as \"tram 96\"", routeID)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// notFound is returned for unknown stops and routes, shaped like the API's
+// own error so callers can treat both sources alike.
+func notFound(format string, args ...interface{}) error {
+	return &api.APIError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// Info describes the imported timetable.
+type Info struct {
+	Imported  time.Time `json:"imported"`
+	Source    string    `json:"source"`
+	Stops     int       `json:"stops"`
+	Routes    int       `json:"routes"`
+	Trips     int       `json:"trips"`
+	StopTimes int       `json:"stop_times"`
+	// From and To are the first and last dates with service.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Info returns details of the imported timetable.
+func (s *Store) Info() (*Info, error) {
+	var info Info
+	var imported string
+	if err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'imported'`).Scan(&imported); err != nil {
+		return nil, err
+	}
+	info.Imported, _ = time.Parse(time.RFC3339, imported)
+	s.db.QueryRow(`SELECT value FROM meta WHERE key = 'source'`).Scan(&info.Source)
+	for _, c := range []struct {
+		table string
+		n     *int
+	}{{"stops", &info.Stops}, {"routes", &info.Routes}, {"trips", &info.Trips}, {"stop_times", &info.StopTimes}} {
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM ` + c.table).Scan(c.n); err != nil {
+			return nil, err
+		}
+	}
+	var from, to sql.NullString
+	s.db.QueryRow(`SELECT MIN(start_date), MAX(end_date) FROM calendar`).Scan(&from, &to)
+	info.From, _ = time.ParseInLocation("20060102", from.String, s.loc)
+	info.To, _ = time.ParseInLocation("20060102", to.String, s.loc)
+	return &info, nil
+}
+
+// Search finds stops and routes whose names contain term.
+func (s *Store) Search(term string, routeTypes []int) (*api.SearchResponse, error) {
+	like := "%" + strings.ToLower(term) + "%"
+	q := `
+		SELECT s.id, s.name, s.lat, s.lon, srt.route_type
+		FROM stops s JOIN stop_route_types srt ON srt.stop_id = s.id
+		WHERE lower(s.name) LIKE ?`
+	args := []interface{}{like}
+	// Filter by route type before the limit, so matches of other modes
+	// cannot crowd out the ones asked for.
+	if len(routeTypes) > 0 {
+		q += ` AND srt.route_type IN (?` + strings.Repeat(", ?", len(routeTypes)-1) + `)`
+		for _, rt := range routeTypes {
+			args = append(args, rt)
+		}
+	}
+	q += ` ORDER BY s.name LIMIT 100`
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	resp := &api.SearchResponse{}
+	for rows.Next() {
+		var st api.ResultStop
+		if err := rows.Scan(&st.StopID, &st.StopName, &st.StopLatitude, &st.StopLongitude, &st.RouteType); err != nil {
+			return nil, err
+		}
+		resp.Stops = append(resp.Stops, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	routes, err := s.queryRoutes(`WHERE lower(name) LIKE ? OR lower(number) = ?`, like, strings.ToLower(term))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range routes {
+		if matchesRouteType(r.RouteType, routeTypes) {
+			resp.Routes = append(resp.Routes, api.ResultRoute{RouteID: r.RouteID, RouteName: r.RouteName,
+				RouteNumber: r.RouteNumber, RouteType: r.RouteType, RouteGTFSID: r.RouteGTFSID})
+		}
+	}
+	return resp, nil
+}
+
+func matchesRouteType(rt int, routeTypes []int) bool {
+	if len(routeTypes) == 0 {
+		return true
+	}
+	for _, t := range routeTypes {
+		if t == rt {
+			return true
+		}
+	}
+	return false
+}
+
+// Routes lists routes, optionally filtered by route types.
+func (s *Store) Routes(routeTypes []int) (*api.RoutesResponse, error) {
+	routes, err := s.queryRoutes(`ORDER BY route_type, number, name`)
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.RoutesResponse{}
+	for _, r := range routes {
+		if matchesRouteType(r.RouteType, routeTypes) {
+			resp.Routes = append(resp.Routes, r)
+		}
+	}
+	return resp, nil
+}
+
+// Route gets a route by its ID.
+func (s *Store) Route(routeID int) (*api.RouteResponse, error) {
+	if err := checkRouteID(routeID); err != nil {
+		return nil, err
+	}
+	routes, err := s.queryRoutes(`WHERE id = ?`, routeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, notFound("route %d is not in the imported timetable", routeID)
+	}
+	return &api.RouteResponse{Route: routes[0]}, nil
+}
+
+func (s *Store) queryRoutes(where string, args ...interface{}) ([]api.RouteWithStatus, error) {
+	rows, err := s.db.Query(`SELECT id, gtfs_id, number, name, route_type FROM routes `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var routes []api.RouteWithStatus
+	for rows.Next() {
+		var r api.RouteWithStatus
+		if err := rows.Scan(&r.RouteID, &r.RouteGTFSID, &r.RouteNumber, &r.RouteName, &r.RouteType); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+// Stop gets a stop's details. Only the name and location are known from
+// a timetable.
+func (s *Store) Stop(stopID, routeType int) (*api.StopResponse, error) {
+	var d api.StopDetails
+	var loc api.StopLocation
+	err := s.db.QueryRow(`
+		SELECT s.id, s.name, s.lat, s.lon FROM stops s
+		JOIN stop_route_types srt ON srt.stop_id = s.id
+		WHERE s.id = ? AND srt.route_type = ?`, stopID, routeType).
+		Scan(&d.StopID, &d.StopName, &loc.Latitude, &loc.Longitude)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound("stop %d is not served by route type %d in the imported timetable", stopID, routeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.RouteType = routeType
+	d.StopLocation = &loc
+	return &api.StopResponse{Stop: d}, nil
+}
+
+// StopRouteTypes returns the route types serving a stop.
+func (s *Store) StopRouteTypes(stopID int) ([]int, error) {
+	rows, err := s.db.Query(`SELECT route_type FROM stop_route_types WHERE stop_id = ? ORDER BY route_type`, stopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var types []int
+	for rows.Next() {
+		var rt int
+		if err := rows.Scan(&rt); err != nil {
+			return nil, err
+		}
+		types = append(types, rt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, notFound("stop %d is not in the imported timetable", stopID)
+	}
+	return types, nil
+}
+
+// Departures gets the next scheduled departures from a stop.
+func (s *Store) Departures(routeType, stopID, maxResults int) (*api.DeparturesResponse, error) {
+	return s.RouteDepartures(routeType, stopID, 0, 0, maxResults)
+}
+
+// RouteDepartures gets the next scheduled departures from a stop for one
+// route and direction. A routeID or directionID of 0 matches any.
+func (s *Store) RouteDepartures(routeType, stopID, routeID, directionID, maxResults int) (*api.DeparturesResponse, error) {
+	if routeID > 0 {
+		if err := checkRouteID(routeID); err != nil {
+			return nil, err
+		}
+	}
+	return s.departuresAt(routeType, stopID, routeID, directionID, time.Now(), maxResults)
+}
+
+// DeparturesAt gets scheduled departures from a stop starting at a given
+// time.
+func (s *Store) DeparturesAt(routeType, stopID int, at time.Time, maxResults int) (*api.DeparturesResponse, error) {
+	return s.departuresAt(routeType, stopID, 0, 0, at, maxResults)
+}
+
+// scheduled is a departure found in the timetable.
+type scheduled struct {
+	at        time.Time
+	day       time.Time
+	tripID    int
+	routeID   int
+	direction int
+	headsign  string
+}
+
+func (s *Store) departuresAt(routeType, stopID, routeID, directionID int, at time.Time, maxResults int) (*api.DeparturesResponse, error) {
+	at = at.In(s.loc)
+	var found []scheduled
+	// Trips after midnight belong to the previous service day, with times
+	// past 24:00.
+	for _, offset := range []int{-1, 0, 1} {
+		day := time.Date(at.Year(), at.Month(), at.Day()+offset, 0, 0, 0, 0, s.loc)
+		services, err := s.activeServices(day)
+		if err != nil {
+			return nil, err
+		}
+		if len(services) == 0 {
+			continue
+		}
+		deps, err := s.dayDepartures(day, services, routeType, stopID, routeID, directionID, at, maxResults)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, deps...)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].at.Before(found[j].at) })
+	if len(found) > maxResults {
+		found = found[:maxResults]
+	}
+
+	resp := &api.DeparturesResponse{
+		Stops:      make(map[string]api.StopInfo),
+		Routes:     make(map[string]api.RouteInfo),
+		Runs:       make(map[string]api.RunInfo),
+		Directions: make(map[string]api.Direction),
+	}
+	if st, err := s.Stop(stopID, routeType); err == nil {
+		resp.Stops[strconv.Itoa(stopID)] = api.StopInfo{StopID: stopID, StopName: st.Stop.StopName, RouteType: routeType,
+			StopLatitude: st.Stop.StopLocation.Latitude, StopLongitude: st.Stop.StopLocation.Longitude}
+	}
+	for _, d := range found {
+		t := d.at.UTC()
+		ref := runRef(d.tripID, d.day)
+		resp.Departures = append(resp.Departures, api.Departure{
+			StopID:                stopID,
+			RouteID:               d.routeID,
+			RunID:                 d.tripID,
+			RunRef:                ref,
+			DirectionID:           d.direction,
+			ScheduledDepartureUTC: &t,
+		})
+		resp.Runs[ref] = api.RunInfo{RunID: d.tripID, RunRef: ref, RouteID: d.routeID, RouteType: routeType,
+			DirectionID: d.direction, DestinationName: d.headsign, Status: "scheduled"}
+		resp.Directions[strconv.Itoa(d.direction)] = api.Direction{DirectionID: d.direction, DirectionName: d.headsign}
+		key := strconv.Itoa(d.routeID)
+		if _, ok := resp.Routes[key]; !ok {
+			if r, err := s.Route(d.routeID); err == nil {
+				resp.Routes[key] = api.RouteInfo{RouteID: r.Route.RouteID, RouteName: r.Route.RouteName,
+					RouteNumber: r.Route.RouteNumber, RouteType: r.Route.RouteType, RouteGTFSID: r.Route.RouteGTFSID}
+			}
+		}
+	}
+	return resp, nil
+}
+
+// dayDepartures finds departures from a stop on one service day, at or
+// after at.
+func (s *Store) dayDepartures(day time.Time, services map[string]bool, routeType, stopID, routeID, directionID int, at time.Time, limit int) ([]scheduled, error) {
+	from := int(at.Sub(day) / time.Second)
+	q := `
+		SELECT st.departure, t.id, t.route_id, t.direction_id, t.headsign, t.service
+		FROM stop_times st
+		JOIN trips t ON t.id = st.trip_id
+		JOIN routes r ON r.id = t.route_id
+		WHERE st.stop_id = ? AND st.departure >= ? AND r.route_type = ?`
+	args := []interface{}{stopID, from, routeType}
+	if routeID > 0 {
+		q += ` AND t.route_id = ?`
+		args = append(args, routeID)
+	}
+	if directionID > 0 {
+		q += ` AND t.direction_id = ?`
+		args = append(args, directionID)
+	}
+	q += ` ORDER BY st.departure`
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deps []scheduled
+	for rows.Next() && len(deps) < limit {
+		var secs int
+		var d scheduled
+		var service string
+		if err := rows.Scan(&secs, &d.tripID, &d.routeID, &d.direction, &d.headsign, &service); err != nil {
+			return nil, err
+		}
+		if !services[service] {
+			continue
+		}
+		d.at = serviceTime(day, secs)
+		d.day = day
+		deps = append(deps, d)
+	}
+	return deps, rows.Err()
+}
+
+// runRef identifies a trip on a service day, since the same trip runs on
+// many days.
+func runRef(tripID int, day time.Time) string {
+	return fmt.Sprintf("%d-%s", tripID, day.Format("20060102"))
+}
+
+// parseRunRef splits a run reference made by runRef.
+func (s *Store) parseRunRef(ref string) (int, time.Time, error) {
+	trip, date, ok := strings.Cut(ref, "-")
+	tripID, err := strconv.Atoi(trip)
+	if !ok || err != nil {
+		return 0, time.Time{}, notFound("run %q is not in the imported timetable", ref)
+	}
+	day, err := time.ParseInLocation("20060102", date, s.loc)
+	if err != nil {
+		return 0, time.Time{}, notFound("run %q is not in the imported timetable", ref)
+	}
+	return tripID, day, nil
+}
+
+// Pattern gets the stopping pattern of a run, with the scheduled departure
+// time at each stop.
+func (s *Store) Pattern(ref string, routeType int) (*api.PatternResponse, error) {
+	tripID, day, err := s.parseRunRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	var routeID int
+	if err := s.db.QueryRow(`SELECT route_id FROM trips WHERE id = ?`, tripID).Scan(&routeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, notFound("run %q is not in the imported timetable", ref)
+		}
+		return nil, err
+	}
+	rows, err := s.db.Query(`
+		SELECT st.stop_id, st.arrival, st.departure, st.seq, s.name, s.lat, s.lon
+		FROM stop_times st JOIN stops s ON s.id = st.stop_id
+		WHERE st.trip_id = ? ORDER BY st.seq`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := &api.PatternResponse{Stops: make(map[string]api.StopInfo)}
+	for rows.Next() {
+		var stop api.StopInfo
+		var arr, dep, seq int
+		if err := rows.Scan(&stop.StopID, &arr, &dep, &seq, &stop.StopName, &stop.StopLatitude, &stop.StopLongitude); err != nil {
+			return nil, err
+		}
+		if dep < 0 {
+			dep = arr
+		}
+		t := serviceTime(day, dep).UTC()
+		stop.RouteType = routeType
+		resp.Stops[strconv.Itoa(stop.StopID)] = stop
+		resp.Departures = append(resp.Departures, api.Departure{StopID: stop.StopID, RouteID: routeID, RunID: tripID,
+			RunRef: ref, ScheduledDepartureUTC: &t, DepartureSequence: seq})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if r, err := s.Route(routeID); err == nil {
+		resp.Routes = map[string]api.RouteInfo{strconv.Itoa(routeID): {RouteID: routeID, RouteName: r.Route.RouteName,
+			RouteNumber: r.Route.RouteNumber, RouteType: r.Route.RouteType, RouteGTFSID: r.Route.RouteGTFSID}}
+	}
+	return resp, nil
+}
+
+// serviceTime converts a GTFS time on a service day to a time. GTFS times
+// are measured from noon minus 12 hours, which differs from midnight on
+// daylight saving changeover days.
+func serviceTime(day time.Time, secs int) time.Time {
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location())
+	return noon.Add(-12 * time.Hour).Add(time.Duration(secs) * time.Second)
+}
+
+// activeServices returns the services running on day.
+func (s *Store) activeServices(day time.Time) (map[string]bool, error) {
+	date := day.Format("20060102")
+	services := make(map[string]bool)
+	rows, err := s.db.Query(`SELECT service, days FROM calendar WHERE start_date <= ? AND end_date >= ?`, date, date)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var service string
+		var days int
+		if err := rows.Scan(&service, &days); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if days&(1<<int(day.Weekday())) != 0 {
+			services[service] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT service, exception FROM calendar_dates WHERE date = ?`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var service string
+		var exception int
+		if err := rows.Scan(&service, &exception); err != nil {
+			return nil, err
+		}
+		switch exception {
+		case 1:
+			services[service] = true
+		case 2:
+			delete(services, service)
+		}
+	}
+	return services, rows.Err()
+}
+
+// MatchTrip finds the GTFS trip departing a stop at a scheduled time, for
+// mapping API runs to the timetable. When several trips depart together,
+// the one on routeGTFSID is chosen: the API's route GTFS IDs, like "3-96",
+// are prefixes of the feed's. It returns an empty trip ID if there is no
+// unambiguous match.
+func (s *Store) MatchTrip(stopID int, scheduled time.Time, routeGTFSID string) (tripID, startDate string, err error) {
+	at := scheduled.In(s.loc)
+	type candidate struct{ trip, route, date string }
+	var found []candidate
+	for _, offset := range []int{-1, 0} {
+		day := time.Date(at.Year(), at.Month(), at.Day()+offset, 0, 0, 0, 0, s.loc)
+		services, err := s.activeServices(day)
+		if err != nil {
+			return "", "", err
+		}
+		rows, err := s.db.Query(`
+			SELECT t.gtfs_id, r.gtfs_id, t.service
+			FROM stop_times st
+			JOIN trips t ON t.id = st.trip_id
+			JOIN routes r ON r.id = t.route_id
+			WHERE st.stop_id = ? AND st.departure = ?`, stopID, int(at.Sub(serviceTime(day, 0))/time.Second))
+		if err != nil {
+			return "", "", err
+		}
+		for rows.Next() {
+			var c candidate
+			var service string
+			if err := rows.Scan(&c.trip, &c.route, &service); err != nil {
+				rows.Close()
+				return "", "", err
+			}
+			if services[service] {
+				c.date = day.Format("20060102")
+				found = append(found, c)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", "", err
+		}
+	}
+
+	if len(found) > 1 && routeGTFSID != "" {
+		var onRoute []candidate
+		for _, c := range found {
+			if c.route == routeGTFSID || strings.HasPrefix(c.route, routeGTFSID+"-") {
+				onRoute = append(onRoute, c)
+			}
+		}
+		found = onRoute
+	}
+	if len(found) != 1 {
+		return "", "", nil
+	}
+	return found[0].trip, found[0].date, nil
+}
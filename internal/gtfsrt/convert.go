@@ -0,0 +1,211 @@
+package gtfsrt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// TripMatcher finds the static GTFS trip that departs a stop at a scheduled
+// time, so feeds can use the timetable's trip IDs. It returns an empty trip
+// ID when there is no match. *gtfs.Store implements it.
+type TripMatcher interface {
+	MatchTrip(stopID int, scheduled time.Time, routeGTFSID string) (tripID, startDate string, err error)
+}
+
+// Converter turns API departures and disruptions into feed entities.
+type Converter struct {
+	// Matcher maps runs to GTFS trips. Without one, or when a run is not
+	// matched, the trip ID is PTV's run ref.
+	Matcher TripMatcher
+	// Location is the timezone of start dates.
+	Location *time.Location
+}
+
+// runDepartures groups departures by run, ordered by scheduled time.
+func runDepartures(resp *api.DeparturesResponse) map[string][]api.Departure {
+	runs := make(map[string][]api.Departure)
+	for _, d := range resp.Departures {
+		if d.RunRef != "" && d.ScheduledDepartureUTC != nil {
+			runs[d.RunRef] = append(runs[d.RunRef], d)
+		}
+	}
+	for _, deps := range runs {
+		sort.SliceStable(deps, func(i, j int) bool {
+			return deps[i].ScheduledDepartureUTC.Before(*deps[j].ScheduledDepartureUTC)
+		})
+	}
+	return runs
+}
+
+// routeID returns the GTFS route ID of a PTV route, falling back to PTV's
+// route ID when the API gives none.
+func routeID(resp *api.DeparturesResponse, id int) string {
+	if r, ok := resp.Routes[strconv.Itoa(id)]; ok && r.RouteGTFSID != "" {
+		return r.RouteGTFSID
+	}
+	return strconv.Itoa(id)
+}
+
+// trip describes the run of deps, the run's departures in scheduled order.
+func (c *Converter) trip(resp *api.DeparturesResponse, ref string, deps []api.Departure) TripDescriptor {
+	first := deps[0]
+	t := TripDescriptor{
+		TripID:    ref,
+		RouteID:   routeID(resp, first.RouteID),
+		StartDate: first.ScheduledDepartureUTC.In(c.Location).Format("20060102"),
+	}
+	if c.Matcher != nil {
+		// A failed lookup only costs the GTFS trip ID, so it is not fatal.
+		if id, date, err := c.Matcher.MatchTrip(first.StopID, *first.ScheduledDepartureUTC, t.RouteID); err == nil && id != "" {
+			t.TripID, t.StartDate = id, date
+		}
+	}
+	if run, ok := resp.Runs[ref]; ok && run.Cancelled() {
+		t.ScheduleRelationship = Canceled
+	}
+	return t
+}
+
+func vehicle(run api.RunInfo) *VehicleDescriptor {
+	if run.VehicleDescriptor == nil || run.VehicleDescriptor.ID == "" {
+		return nil
+	}
+	return &VehicleDescriptor{ID: run.VehicleDescriptor.ID, Label: run.VehicleDescriptor.Description}
+}
+
+// TripUpdates returns a trip update for each run with a realtime estimate
+// or cancellation, giving the predicted departure from each stop in resp.
+func (c *Converter) TripUpdates(resp *api.DeparturesResponse) []FeedEntity {
+	var entities []FeedEntity
+	for ref, deps := range runDepartures(resp) {
+		u := &TripUpdate{Trip: c.trip(resp, ref, deps), Vehicle: vehicle(resp.Runs[ref])}
+		for _, d := range deps {
+			if d.EstimatedDepartureUTC == nil {
+				continue
+			}
+			delay := int32(d.EstimatedDepartureUTC.Sub(*d.ScheduledDepartureUTC) / time.Second)
+			u.StopTimeUpdates = append(u.StopTimeUpdates, StopTimeUpdate{
+				StopID:    strconv.Itoa(d.StopID),
+				Departure: &StopTimeEvent{Delay: &delay, Time: d.EstimatedDepartureUTC.Unix()},
+			})
+		}
+		if len(u.StopTimeUpdates) == 0 && u.Trip.ScheduleRelationship != Canceled {
+			continue
+		}
+		if vp := resp.Runs[ref].VehiclePosition; vp != nil && vp.DatetimeUTC != nil {
+			u.Timestamp = uint64(vp.DatetimeUTC.Unix())
+		}
+		entities = append(entities, FeedEntity{ID: "trip-" + ref, TripUpdate: u})
+	}
+	sortEntities(entities)
+	return entities
+}
+
+// VehiclePositions returns the position of each vehicle running a service
+// in resp whose position has not expired by now.
+func (c *Converter) VehiclePositions(resp *api.DeparturesResponse, now time.Time) []FeedEntity {
+	runs := runDepartures(resp)
+	var entities []FeedEntity
+	for ref, run := range resp.Runs {
+		vp := run.VehiclePosition
+		if vp == nil || (vp.Latitude == 0 && vp.Longitude == 0) {
+			continue
+		}
+		if vp.ExpiryTime != nil && vp.ExpiryTime.Before(now) {
+			continue
+		}
+		v := &VehiclePosition{
+			Vehicle:  vehicle(run),
+			Position: Position{Latitude: float32(vp.Latitude), Longitude: float32(vp.Longitude)},
+		}
+		if vp.Bearing != 0 {
+			b := float32(vp.Bearing)
+			v.Position.Bearing = &b
+		}
+		if vp.DatetimeUTC != nil {
+			v.Timestamp = uint64(vp.DatetimeUTC.Unix())
+		}
+		if deps := runs[ref]; len(deps) > 0 {
+			t := c.trip(resp, ref, deps)
+			v.Trip = &t
+		}
+		entities = append(entities, FeedEntity{ID: "vehicle-" + ref, Vehicle: v})
+	}
+	sortEntities(entities)
+	return entities
+}
+
+// Alerts returns an alert for each disruption. Disruptions that name no
+// routes or stops, such as general notices, are left out, since an alert
+// must say what it applies to.
+func Alerts(disruptions []api.Disruption) []FeedEntity {
+	var entities []FeedEntity
+	for _, d := range disruptions {
+		a := &Alert{
+			URL:             d.URL,
+			HeaderText:      d.Title,
+			DescriptionText: d.Description,
+		}
+		a.Cause, a.Effect = causeEffect(d.DisruptionType)
+		if d.FromDate != nil || d.ToDate != nil {
+			var p TimeRange
+			if d.FromDate != nil {
+				p.Start = uint64(d.FromDate.Unix())
+			}
+			if d.ToDate != nil {
+				p.End = uint64(d.ToDate.Unix())
+			}
+			a.ActivePeriods = []TimeRange{p}
+		}
+		for _, r := range d.Routes {
+			id := r.RouteGTFSID
+			if id == "" {
+				id = strconv.Itoa(r.RouteID)
+			}
+			a.InformedEntities = append(a.InformedEntities, EntitySelector{RouteID: id})
+		}
+		for _, s := range d.Stops {
+			a.InformedEntities = append(a.InformedEntities, EntitySelector{StopID: strconv.Itoa(s.StopID)})
+		}
+		if len(a.InformedEntities) == 0 {
+			continue
+		}
+		entities = append(entities, FeedEntity{ID: "alert-" + strconv.Itoa(d.DisruptionID), Alert: a})
+	}
+	sortEntities(entities)
+	return entities
+}
+
+// causeEffect maps a PTV disruption type, such as "Planned Works" or "Part
+// Suspended", to an alert cause and effect. The cause is left unset unless
+// the type names one.
+func causeEffect(disruptionType string) (Cause, Effect) {
+	t := strings.ToLower(disruptionType)
+	var cause Cause
+	if strings.Contains(t, "works") {
+		cause = Maintenance
+	}
+	switch {
+	case strings.Contains(t, "part suspended"):
+		return cause, ReducedService
+	case strings.Contains(t, "suspended"), strings.Contains(t, "closure"):
+		return cause, NoService
+	case strings.Contains(t, "delays"):
+		return cause, SignificantDelays
+	case strings.Contains(t, "detour"), strings.Contains(t, "diversion"):
+		return cause, Detour
+	case strings.Contains(t, "works"), strings.Contains(t, "change"), strings.Contains(t, "replacement"):
+		return cause, ModifiedService
+	case strings.Contains(t, "information"):
+		return cause, OtherEffect
+	}
+	return cause, UnknownEffect
+}
+
+func sortEntities(entities []FeedEntity) {
+	sort.Slice(entities, func(i, j int) bool { return entities[i].ID < entities[j].ID })
+}
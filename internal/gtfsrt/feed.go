@@ -0,0 +1,275 @@
+// Package gtfsrt converts PTV realtime departures, vehicle positions and
+// disruptions into GTFS-Realtime feeds (https://gtfs.org/realtime/).
+//
+// Only the parts of the GTFS-Realtime schema that PTV's data can fill are
+// modelled. Messages are encoded to protocol buffers by Marshal, and to
+// JSON with the field names of the schema for inspection.
+package gtfsrt
+
+import "time"
+
+// Version is the GTFS-Realtime version of the feeds produced.
+const Version = "2.0"
+
+// FeedMessage is a complete feed.
+type FeedMessage struct {
+	Header   FeedHeader   `json:"header"`
+	Entities []FeedEntity `json:"entity"`
+}
+
+// FeedHeader describes a feed. Feeds are always full datasets.
+type FeedHeader struct {
+	GTFSRealtimeVersion string `json:"gtfs_realtime_version"`
+	Timestamp           uint64 `json:"timestamp"`
+}
+
+// FeedEntity is one trip update, vehicle position or alert.
+type FeedEntity struct {
+	ID         string           `json:"id"`
+	TripUpdate *TripUpdate      `json:"trip_update,omitempty"`
+	Vehicle    *VehiclePosition `json:"vehicle,omitempty"`
+	Alert      *Alert           `json:"alert,omitempty"`
+}
+
+// ScheduleRelationship is how a trip relates to the static timetable.
+type ScheduleRelationship int
+
+// Trip schedule relationships.
+const (
+	Scheduled ScheduleRelationship = 0
+	Canceled  ScheduleRelationship = 3
+)
+
+// TripDescriptor identifies a trip. DirectionID is nil when unknown, as
+// PTV's direction IDs do not correspond to GTFS's 0 and 1.
+type TripDescriptor struct {
+	TripID               string               `json:"trip_id,omitempty"`
+	RouteID              string               `json:"route_id,omitempty"`
+	DirectionID          *uint32              `json:"direction_id,omitempty"`
+	StartDate            string               `json:"start_date,omitempty"`
+	ScheduleRelationship ScheduleRelationship `json:"schedule_relationship,omitempty"`
+}
+
+// VehicleDescriptor identifies a vehicle.
+type VehicleDescriptor struct {
+	ID    string `json:"id,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// TripUpdate is the realtime progress of a trip.
+type TripUpdate struct {
+	Trip            TripDescriptor     `json:"trip"`
+	Vehicle         *VehicleDescriptor `json:"vehicle,omitempty"`
+	StopTimeUpdates []StopTimeUpdate   `json:"stop_time_update,omitempty"`
+	Timestamp       uint64             `json:"timestamp,omitempty"`
+}
+
+// StopTimeUpdate is the predicted departure from one stop of a trip.
+type StopTimeUpdate struct {
+	StopID    string         `json:"stop_id"`
+	Departure *StopTimeEvent `json:"departure,omitempty"`
+}
+
+// StopTimeEvent is a predicted time, with its delay against the timetable
+// when known.
+type StopTimeEvent struct {
+	Delay *int32 `json:"delay,omitempty"`
+	Time  int64  `json:"time"`
+}
+
+// VehiclePosition is where a vehicle is.
+type VehiclePosition struct {
+	Trip      *TripDescriptor    `json:"trip,omitempty"`
+	Vehicle   *VehicleDescriptor `json:"vehicle,omitempty"`
+	Position  Position           `json:"position"`
+	Timestamp uint64             `json:"timestamp,omitempty"`
+}
+
+// Position is a WGS84 location, with a bearing in degrees clockwise from
+// north when known.
+type Position struct {
+	Latitude  float32  `json:"latitude"`
+	Longitude float32  `json:"longitude"`
+	Bearing   *float32 `json:"bearing,omitempty"`
+}
+
+// Cause is why an alert was raised.
+type Cause int
+
+// Alert causes.
+const (
+	Maintenance Cause = 9
+)
+
+// Effect is what an alert means for passengers.
+type Effect int
+
+// Alert effects.
+const (
+	NoService         Effect = 1
+	ReducedService    Effect = 2
+	SignificantDelays Effect = 3
+	Detour            Effect = 4
+	ModifiedService   Effect = 6
+	OtherEffect       Effect = 7
+	UnknownEffect     Effect = 8
+)
+
+// Alert is a service alert.
+type Alert struct {
+	ActivePeriods    []TimeRange      `json:"active_period,omitempty"`
+	InformedEntities []EntitySelector `json:"informed_entity"`
+	Cause            Cause            `json:"cause,omitempty"`
+	Effect           Effect           `json:"effect,omitempty"`
+	URL              string           `json:"url,omitempty"`
+	HeaderText       string           `json:"header_text"`
+	DescriptionText  string           `json:"description_text,omitempty"`
+}
+
+// TimeRange is when an alert applies. Zero bounds are open.
+type TimeRange struct {
+	Start uint64 `json:"start,omitempty"`
+	End   uint64 `json:"end,omitempty"`
+}
+
+// EntitySelector is a route or stop an alert applies to.
+type EntitySelector struct {
+	RouteID string `json:"route_id,omitempty"`
+	StopID  string `json:"stop_id,omitempty"`
+}
+
+// NewFeed returns a feed of entities timestamped at t.
+func NewFeed(t time.Time, entities []FeedEntity) *FeedMessage {
+	return &FeedMessage{
+		Header:   FeedHeader{GTFSRealtimeVersion: Version, Timestamp: uint64(t.Unix())},
+		Entities: entities,
+	}
+}
+
+// Marshal encodes the feed as a GTFS-Realtime protocol buffer. Field
+// numbers are those of gtfs-realtime.proto.
+func (f *FeedMessage) Marshal() []byte {
+	var e encoder
+	e.message(1, func(e *encoder) {
+		e.string(1, f.Header.GTFSRealtimeVersion)
+		e.uint(2, 0) // FULL_DATASET
+		e.uint(3, f.Header.Timestamp)
+	})
+	for _, ent := range f.Entities {
+		e.message(2, ent.encode)
+	}
+	return e.buf
+}
+
+func (ent FeedEntity) encode(e *encoder) {
+	e.string(1, ent.ID)
+	if ent.TripUpdate != nil {
+		e.message(3, ent.TripUpdate.encode)
+	}
+	if ent.Vehicle != nil {
+		e.message(4, ent.Vehicle.encode)
+	}
+	if ent.Alert != nil {
+		e.message(5, ent.Alert.encode)
+	}
+}
+
+func (t TripDescriptor) encode(e *encoder) {
+	e.string(1, t.TripID)
+	e.string(3, t.StartDate)
+	if t.ScheduleRelationship != Scheduled {
+		e.uint(4, uint64(t.ScheduleRelationship))
+	}
+	e.string(5, t.RouteID)
+	if t.DirectionID != nil {
+		e.uint(6, uint64(*t.DirectionID))
+	}
+}
+
+func (v VehicleDescriptor) encode(e *encoder) {
+	e.string(1, v.ID)
+	e.string(2, v.Label)
+}
+
+func (u *TripUpdate) encode(e *encoder) {
+	e.message(1, u.Trip.encode)
+	for _, st := range u.StopTimeUpdates {
+		e.message(2, st.encode)
+	}
+	if u.Vehicle != nil {
+		e.message(3, u.Vehicle.encode)
+	}
+	if u.Timestamp != 0 {
+		e.uint(4, u.Timestamp)
+	}
+}
+
+func (st StopTimeUpdate) encode(e *encoder) {
+	if st.Departure != nil {
+		e.message(3, func(e *encoder) {
+			if st.Departure.Delay != nil {
+				e.int(1, int64(*st.Departure.Delay))
+			}
+			e.int(2, st.Departure.Time)
+		})
+	}
+	e.string(4, st.StopID)
+}
+
+func (v *VehiclePosition) encode(e *encoder) {
+	if v.Trip != nil {
+		e.message(1, v.Trip.encode)
+	}
+	e.message(2, func(e *encoder) {
+		e.float(1, v.Position.Latitude)
+		e.float(2, v.Position.Longitude)
+		if v.Position.Bearing != nil {
+			e.float(3, *v.Position.Bearing)
+		}
+	})
+	if v.Timestamp != 0 {
+		e.uint(5, v.Timestamp)
+	}
+	if v.Vehicle != nil {
+		e.message(8, v.Vehicle.encode)
+	}
+}
+
+func (a *Alert) encode(e *encoder) {
+	for _, p := range a.ActivePeriods {
+		e.message(1, func(e *encoder) {
+			if p.Start != 0 {
+				e.uint(1, p.Start)
+			}
+			if p.End != 0 {
+				e.uint(2, p.End)
+			}
+		})
+	}
+	for _, sel := range a.InformedEntities {
+		e.message(5, func(e *encoder) {
+			e.string(2, sel.RouteID)
+			e.string(5, sel.StopID)
+		})
+	}
+	if a.Cause != 0 {
+		e.uint(6, uint64(a.Cause))
+	}
+	if a.Effect != 0 {
+		e.uint(7, uint64(a.Effect))
+	}
+	translated := func(field int, s string) {
+		if s == "" {
+			return
+		}
+		e.message(field, func(e *encoder) {
+			e.message(1, func(e *encoder) {
+				e.string(1, s)
+				e.string(2, "en")
+			})
+		})
+	}
+	translated(8, a.URL)
+	translated(10, a.HeaderText)
+	translated(11, a.DescriptionText)
+}
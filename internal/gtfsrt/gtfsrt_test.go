@@ -0,0 +1,200 @@
+package gtfsrt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// field is a decoded protocol buffer field: a varint value or the bytes of
+// a length-delimited field.
+type field struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+// decode splits a message into its fields, for checking encoder output.
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireFixed32:
+			f.value = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// find returns the first field numbered num.
+func find(t *testing.T, fields []field, num int) field {
+	t.Helper()
+	for _, f := range fields {
+		if f.num == num {
+			return f
+		}
+	}
+	t.Fatalf("no field %d in %+v", num, fields)
+	return field{}
+}
+
+func TestMarshalHeader(t *testing.T) {
+	feed := NewFeed(time.Unix(1700000000, 0), nil)
+	want := []byte{0x0a, 0x0d, 0x0a, 0x03, '2', '.', '0', 0x10, 0x00, 0x18}
+	want = binary.AppendUvarint(want, 1700000000)
+	if got := feed.Marshal(); !bytes.Equal(got, want) {
+		t.Errorf("Marshal() = % x, want % x", got, want)
+	}
+}
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func testDepartures() *api.DeparturesResponse {
+	sched := time.Date(2024, 1, 15, 21, 0, 0, 0, time.UTC) // 08:00 on the 16th in Melbourne
+	return &api.DeparturesResponse{
+		Departures: []api.Departure{
+			{StopID: 2504, RouteID: 722, RunRef: "9-ABC", ScheduledDepartureUTC: ptr(sched), EstimatedDepartureUTC: ptr(sched.Add(90 * time.Second))},
+			{StopID: 2504, RouteID: 722, RunRef: "9-DEF", ScheduledDepartureUTC: ptr(sched.Add(10 * time.Minute))},
+			{StopID: 2504, RouteID: 722, RunRef: "9-GHI", ScheduledDepartureUTC: ptr(sched.Add(20 * time.Minute))},
+		},
+		Routes: map[string]api.RouteInfo{"722": {RouteID: 722, RouteGTFSID: "3-96"}},
+		Runs: map[string]api.RunInfo{
+			"9-ABC": {RunRef: "9-ABC", VehicleDescriptor: &api.VehicleDescriptor{ID: "2031", Description: "E-Class"},
+				VehiclePosition: &api.VehiclePosition{Latitude: -37.8, Longitude: 144.96, Bearing: 180, DatetimeUTC: ptr(sched.Add(-time.Minute))}},
+			"9-DEF": {RunRef: "9-DEF", Status: "Cancelled"},
+			"9-GHI": {RunRef: "9-GHI", VehiclePosition: &api.VehiclePosition{Latitude: -37.7, Longitude: 144.9, ExpiryTime: ptr(sched.Add(-time.Hour))}},
+		},
+	}
+}
+
+type fakeMatcher map[int]string
+
+func (m fakeMatcher) MatchTrip(stopID int, scheduled time.Time, routeGTFSID string) (string, string, error) {
+	if routeGTFSID != "3-96" {
+		return "", "", nil
+	}
+	return m[scheduled.Minute()], "20240116", nil
+}
+
+func TestTripUpdates(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Converter{Matcher: fakeMatcher{0: "T1"}, Location: loc}
+	entities := c.TripUpdates(testDepartures())
+
+	// The run without an estimate or cancellation has nothing to report.
+	if len(entities) != 2 {
+		t.Fatalf("got %d trip updates, want 2", len(entities))
+	}
+	u := entities[0].TripUpdate
+	if entities[0].ID != "trip-9-ABC" || u.Trip.TripID != "T1" || u.Trip.RouteID != "3-96" || u.Trip.StartDate != "20240116" {
+		t.Errorf("first update = %s %+v, want trip T1 on route 3-96 from 20240116", entities[0].ID, u.Trip)
+	}
+	if len(u.StopTimeUpdates) != 1 || *u.StopTimeUpdates[0].Departure.Delay != 90 || u.StopTimeUpdates[0].StopID != "2504" {
+		t.Errorf("stop time updates = %+v, want a 90s delay at 2504", u.StopTimeUpdates)
+	}
+	if u.Vehicle == nil || u.Vehicle.ID != "2031" {
+		t.Errorf("vehicle = %+v, want 2031", u.Vehicle)
+	}
+
+	cancelled := entities[1].TripUpdate.Trip
+	if cancelled.TripID != "9-DEF" || cancelled.ScheduleRelationship != Canceled || cancelled.StartDate != "20240116" {
+		t.Errorf("cancelled trip = %+v, want unmatched run 9-DEF cancelled", cancelled)
+	}
+
+	msg := NewFeed(time.Now(), entities).Marshal()
+	ent := decode(t, find(t, decode(t, msg), 2).data)
+	trip := decode(t, find(t, decode(t, find(t, ent, 3).data), 1).data)
+	if got := string(find(t, trip, 1).data); got != "T1" {
+		t.Errorf("encoded trip_id = %q, want T1", got)
+	}
+	if got := string(find(t, trip, 5).data); got != "3-96" {
+		t.Errorf("encoded route_id = %q, want 3-96", got)
+	}
+}
+
+func TestVehiclePositions(t *testing.T) {
+	c := &Converter{Location: time.UTC}
+	resp := testDepartures()
+	entities := c.VehiclePositions(resp, *resp.Departures[0].ScheduledDepartureUTC)
+
+	// The other vehicle's position has expired.
+	if len(entities) != 1 {
+		t.Fatalf("got %d vehicle positions, want 1", len(entities))
+	}
+	v := entities[0].Vehicle
+	if v.Trip == nil || v.Trip.TripID != "9-ABC" || v.Position.Bearing == nil || *v.Position.Bearing != 180 {
+		t.Errorf("vehicle position = %+v, want run 9-ABC heading 180", v)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	from := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	entities := Alerts([]api.Disruption{
+		{DisruptionID: 1, Title: "Buses replace trains", DisruptionType: "Planned Works", FromDate: &from,
+			Routes: []api.DisruptionRoute{{RouteID: 6, RouteGTFSID: "2-LIL"}}, Stops: []api.DisruptionStop{{StopID: 1071}}},
+		{DisruptionID: 2, Title: "Lifts out of order", DisruptionType: "Service Information"},
+		{DisruptionID: 3, Title: "Delays", DisruptionType: "Major Delays", Routes: []api.DisruptionRoute{{RouteID: 722}}},
+	})
+
+	if len(entities) != 2 {
+		t.Fatalf("got %d alerts, want 2 (the one without routes or stops is skipped)", len(entities))
+	}
+	a := entities[0].Alert
+	if a.Cause != Maintenance || a.Effect != ModifiedService {
+		t.Errorf("planned works = cause %d effect %d, want maintenance and modified service", a.Cause, a.Effect)
+	}
+	if len(a.InformedEntities) != 2 || a.InformedEntities[0].RouteID != "2-LIL" || a.InformedEntities[1].StopID != "1071" {
+		t.Errorf("informed entities = %+v, want route 2-LIL and stop 1071", a.InformedEntities)
+	}
+	if len(a.ActivePeriods) != 1 || a.ActivePeriods[0].Start != uint64(from.Unix()) || a.ActivePeriods[0].End != 0 {
+		t.Errorf("active periods = %+v, want open-ended from %d", a.ActivePeriods, from.Unix())
+	}
+	if b := entities[1].Alert; b.Effect != SignificantDelays || b.InformedEntities[0].RouteID != "722" {
+		t.Errorf("delays alert = %+v, want significant delays on route 722", b)
+	}
+}
+
+func TestCauseEffect(t *testing.T) {
+	tests := []struct {
+		in     string
+		cause  Cause
+		effect Effect
+	}{
+		{"Planned Works", Maintenance, ModifiedService},
+		{"Planned Closure", 0, NoService},
+		{"Part Suspended", 0, ReducedService},
+		{"Suspended", 0, NoService},
+		{"Minor Delays", 0, SignificantDelays},
+		{"Service Information", 0, OtherEffect},
+		{"Something New", 0, UnknownEffect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			cause, effect := causeEffect(tt.in)
+			if cause != tt.cause || effect != tt.effect {
+				t.Errorf("causeEffect(%q) = %d, %d; want %d, %d", tt.in, cause, effect, tt.cause, tt.effect)
+			}
+		})
+	}
+}
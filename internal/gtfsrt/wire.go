@@ -0,0 +1,66 @@
+package gtfsrt
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder appends protocol buffer fields to a buffer. The feed is small
+// and fixed, so fields are written by hand rather than with generated code.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) tag(field, wire int) {
+	e.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint writes an unsigned integer or enum field.
+func (e *encoder) uint(field int, v uint64) {
+	e.tag(field, wireVarint)
+	e.varint(v)
+}
+
+// int writes an int32 or int64 field. Negative values take ten bytes, as
+// protobuf requires for non-zigzag types.
+func (e *encoder) int(field int, v int64) {
+	e.tag(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+func (e *encoder) float(field int, v float32) {
+	e.tag(field, wireFixed32)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(v))
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// string writes a string field, omitting it when empty.
+func (e *encoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.bytes(field, []byte(s))
+}
+
+// message writes a nested message produced by fn.
+func (e *encoder) message(field int, fn func(*encoder)) {
+	var m encoder
+	fn(&m)
+	e.bytes(field, m.buf)
+}
@@ -0,0 +1,239 @@
+// Package ical writes disruptions and departures as iCalendar (RFC 5545)
+// files, for importing into or subscribing from a calendar application.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+)
+
+// ContentType is the media type of iCalendar files.
+const ContentType = "text/calendar; charset=utf-8"
+
+// departureLength is how long a departure's event lasts, so that it shows
+// up in calendar views.
+const departureLength = 5 * time.Minute
+
+// Event is a calendar event. Times are written in UTC.
+type Event struct {
+	UID   string
+	Start time.Time
+	// End is the end of the event, or zero if it has no known end.
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	// Modified is when the event last changed, or zero if unknown.
+	Modified  time.Time
+	Cancelled bool
+}
+
+// Write writes events as a calendar named name, stamped with now.
+func Write(w io.Writer, name string, events []Event, now time.Time) error {
+	b := bufio.NewWriter(w)
+	line := func(s string) {
+		b.WriteString(fold(s))
+		b.WriteString("\r\n")
+	}
+	prop := func(name, value string) {
+		if value != "" {
+			line(name + ":" + escape(value))
+		}
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//vic-ptv-cli//vic-ptv//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	prop("X-WR-CALNAME", name)
+	// Ask subscribed clients to refresh reasonably often.
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	line("X-PUBLISHED-TTL:PT1H")
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escape(e.UID))
+		line("DTSTAMP:" + stamp(now))
+		line("DTSTART:" + stamp(e.Start))
+		if !e.End.IsZero() && e.End.After(e.Start) {
+			line("DTEND:" + stamp(e.End))
+		}
+		if !e.Modified.IsZero() {
+			line("LAST-MODIFIED:" + stamp(e.Modified))
+		}
+		prop("SUMMARY", e.Summary)
+		prop("DESCRIPTION", e.Description)
+		prop("LOCATION", e.Location)
+		if e.URL != "" {
+			// URL is a URI value, which is not escaped like text.
+			line("URL:" + e.URL)
+		}
+		if e.Cancelled {
+			line("STATUS:CANCELLED")
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Flush()
+}
+
+func stamp(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape escapes a text value.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold splits a content line into lines of at most 75 octets, continued
+// with a leading space, without splitting UTF-8 sequences.
+func fold(s string) string {
+	const maxLine = 75
+	if len(s) <= maxLine {
+		return s
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > maxLine {
+			b.WriteString("\r\n ")
+			// The leading space counts towards the next line.
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
+
+// DisruptionEvents returns an event for each disruption, spanning its
+// from and to dates. Disruptions listed under several modes appear once;
+// ones with no start date are left out.
+func DisruptionEvents(disruptions []api.Disruption) []Event {
+	var events []Event
+	seen := make(map[int]bool)
+	for _, d := range disruptions {
+		start := d.FromDate
+		if start == nil {
+			start = d.PublishedOn
+		}
+		if start == nil || seen[d.DisruptionID] {
+			continue
+		}
+		seen[d.DisruptionID] = true
+
+		desc := display.PlainText(d.Description)
+		if d.DisruptionType != "" {
+			desc = d.DisruptionType + ". " + desc
+		}
+		var routes []string
+		for _, r := range d.Routes {
+			name := r.RouteName
+			if r.RouteNumber != "" {
+				name = r.RouteNumber + " " + name
+			}
+			routes = append(routes, name)
+		}
+		if len(routes) > 0 {
+			desc += "\n\nRoutes: " + strings.Join(routes, ", ")
+		}
+		e := Event{
+			UID:         fmt.Sprintf("disruption-%d@vic-ptv", d.DisruptionID),
+			Start:       *start,
+			Summary:     display.PlainText(d.Title),
+			Description: strings.TrimSpace(desc),
+			URL:         d.URL,
+		}
+		if d.ToDate != nil {
+			e.End = *d.ToDate
+		} else {
+			e.Description += "\n\nUntil further notice."
+		}
+		if d.LastUpdated != nil {
+			e.Modified = *d.LastUpdated
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// DepartureEvents returns a short event for each departure in resp at its
+// estimated time, or scheduled time if there is no estimate, with the stop
+// and platform as its location.
+func DepartureEvents(resp *api.DeparturesResponse) []Event {
+	var events []Event
+	for _, d := range resp.Departures {
+		at := d.DepartureTime()
+		if at.IsZero() {
+			continue
+		}
+		summary := fmt.Sprintf("Route %d", d.RouteID)
+		mode := ""
+		if r, ok := resp.Routes[strconv.Itoa(d.RouteID)]; ok {
+			summary = r.RouteName
+			if r.RouteNumber != "" {
+				summary = r.RouteNumber + " " + r.RouteName
+			}
+			mode = display.RouteTypeName(r.RouteType)
+		}
+		run := resp.Runs[d.RunRef]
+		if run.DestinationName != "" {
+			summary += " to " + run.DestinationName
+		} else if dir, ok := resp.Directions[strconv.Itoa(d.DirectionID)]; ok {
+			summary += " to " + dir.DirectionName
+		}
+		if mode != "" {
+			summary = mode + ": " + summary
+		}
+
+		location := fmt.Sprintf("Stop %d", d.StopID)
+		if s, ok := resp.Stops[strconv.Itoa(d.StopID)]; ok && s.StopName != "" {
+			location = s.StopName
+		}
+		if d.PlatformNumber != "" {
+			location += ", platform " + d.PlatformNumber
+		}
+
+		var desc []string
+		if d.ScheduledDepartureUTC != nil {
+			desc = append(desc, "Scheduled: "+display.FormatTime(*d.ScheduledDepartureUTC))
+		}
+		if d.EstimatedDepartureUTC != nil {
+			desc = append(desc, "Estimated: "+display.FormatTime(*d.EstimatedDepartureUTC))
+		}
+		cancelled := run.Cancelled()
+		if cancelled {
+			desc = append(desc, "Cancelled")
+		}
+
+		key := d.RunRef
+		if key == "" {
+			key = strconv.Itoa(d.RunID)
+		}
+		scheduled := at
+		if d.ScheduledDepartureUTC != nil {
+			scheduled = *d.ScheduledDepartureUTC
+		}
+		events = append(events, Event{
+			UID:         fmt.Sprintf("departure-%s-%d-%d@vic-ptv", key, d.StopID, scheduled.Unix()),
+			Start:       at,
+			End:         at.Add(departureLength),
+			Summary:     summary,
+			Description: strings.Join(desc, "\n"),
+			Location:    location,
+			Cancelled:   cancelled,
+		})
+	}
+	return events
+}
@@ -0,0 +1,118 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func ptr(t time.Time) *time.Time { return &t }
+
+var now = time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+func TestWrite(t *testing.T) {
+	events := []Event{{
+		UID:         "e1@vic-ptv",
+		Start:       time.Date(2024, 1, 20, 9, 0, 0, 0, time.UTC),
+		End:         time.Date(2024, 1, 21, 18, 0, 0, 0, time.UTC),
+		Summary:     "Buses replace trains; Lilydale, Belgrave",
+		Description: "Line 1\nLine 2",
+		URL:         "https://ptv.vic.gov.au/d/1",
+		Cancelled:   true,
+	}}
+	var b strings.Builder
+	if err := Write(&b, "Works", events, now); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Works\r\n",
+		"DTSTAMP:20240115T000000Z\r\n",
+		"DTSTART:20240120T090000Z\r\nDTEND:20240121T180000Z\r\n",
+		`SUMMARY:Buses replace trains\; Lilydale\, Belgrave` + "\r\n",
+		`DESCRIPTION:Line 1\nLine 2` + "\r\n",
+		"URL:https://ptv.vic.gov.au/d/1\r\n",
+		"STATUS:CANCELLED\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("calendar has no %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("é", 50)
+	folded := fold(long)
+	for i, line := range strings.Split(folded, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i, len(line))
+		}
+		if i > 0 && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation line %d does not start with a space", i)
+		}
+	}
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != long {
+		t.Errorf("unfolding gives %q, want %q", unfolded, long)
+	}
+	if fold("SUMMARY:short") != "SUMMARY:short" {
+		t.Error("short line was folded")
+	}
+}
+
+func TestDisruptionEvents(t *testing.T) {
+	from, to := time.Date(2024, 1, 20, 9, 0, 0, 0, time.UTC), time.Date(2024, 1, 21, 18, 0, 0, 0, time.UTC)
+	events := DisruptionEvents([]api.Disruption{
+		{DisruptionID: 1, Title: "Works", DisruptionType: "Planned Works", Description: "<p>Buses replace trains.</p>",
+			FromDate: &from, ToDate: &to, Routes: []api.DisruptionRoute{{RouteName: "Lilydale"}, {RouteNumber: "96", RouteName: "St Kilda"}}},
+		{DisruptionID: 2, Title: "Lift out of service", PublishedOn: &from},
+		{DisruptionID: 3, Title: "No dates"},
+		{DisruptionID: 1, Title: "Works", FromDate: &from},
+	})
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	e := events[0]
+	if e.UID != "disruption-1@vic-ptv" || !e.Start.Equal(from) || !e.End.Equal(to) {
+		t.Errorf("event = %+v, want disruption 1 from %s to %s", e, from, to)
+	}
+	if want := "Planned Works. Buses replace trains.\n\nRoutes: Lilydale, 96 St Kilda"; e.Description != want {
+		t.Errorf("description = %q, want %q", e.Description, want)
+	}
+	if e := events[1]; !e.End.IsZero() || !strings.HasSuffix(e.Description, "Until further notice.") {
+		t.Errorf("open-ended event = %+v", e)
+	}
+}
+
+func TestDepartureEvents(t *testing.T) {
+	scheduled := time.Date(2024, 1, 15, 21, 2, 0, 0, time.UTC)
+	resp := &api.DeparturesResponse{
+		Departures: []api.Departure{
+			{StopID: 1071, RouteID: 6, RunRef: "a", PlatformNumber: "2", ScheduledDepartureUTC: &scheduled, EstimatedDepartureUTC: ptr(scheduled.Add(3 * time.Minute))},
+			{StopID: 1071, RouteID: 6, RunRef: "b", ScheduledDepartureUTC: ptr(scheduled.Add(time.Hour))},
+		},
+		Stops:  map[string]api.StopInfo{"1071": {StopName: "Flinders Street"}},
+		Routes: map[string]api.RouteInfo{"6": {RouteName: "Lilydale", RouteType: 0}},
+		Runs:   map[string]api.RunInfo{"a": {DestinationName: "Lilydale"}, "b": {Status: "Cancelled"}},
+	}
+	events := DepartureEvents(resp)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	a, b := events[0], events[1]
+	if a.Summary != "Train: Lilydale to Lilydale" || a.Location != "Flinders Street, platform 2" {
+		t.Errorf("event a = %+v", a)
+	}
+	if !a.Start.Equal(scheduled.Add(3*time.Minute)) || a.End.Sub(a.Start) != departureLength {
+		t.Errorf("event a runs %s to %s, want from the estimated time", a.Start, a.End)
+	}
+	if a.UID != "departure-a-1071-1705352520@vic-ptv" {
+		t.Errorf("UID = %q", a.UID)
+	}
+	if !b.Cancelled || b.Location != "Flinders Street" {
+		t.Errorf("event b = %+v, want cancelled with no platform", b)
+	}
+}
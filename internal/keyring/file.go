@@ -0,0 +1,179 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// scryptWorkFactor is the log2 scrypt work factor new files are encrypted
+// with; age's default takes about a second to derive.
+var scryptWorkFactor = 18
+
+// File stores keys in a JSON object of developer IDs to keys, encrypted
+// with a passphrase as an ASCII-armored age file, which 'age -d' can also
+// decrypt.
+type File struct {
+	Path       string
+	Passphrase PassphraseFunc
+}
+
+// Name implements Backend.
+func (f *File) Name() string {
+	return "encrypted file " + f.Path
+}
+
+// Get implements Backend. The passphrase is only asked for if the file
+// exists.
+func (f *File) Get(devID string) (string, error) {
+	keys, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	key, ok := keys[devID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return key, nil
+}
+
+// Set implements Backend. A new file is encrypted with a passphrase chosen
+// now; an existing one keeps its passphrase.
+func (f *File) Set(devID, apiKey string) error {
+	keys, err := f.read()
+	if errors.Is(err, ErrNotFound) {
+		keys = make(map[string]string)
+	} else if err != nil {
+		return err
+	}
+	pass, err := f.passphrase(len(keys) == 0)
+	if err != nil {
+		return err
+	}
+	keys[devID] = apiKey
+	return f.write(keys, pass)
+}
+
+// Delete implements Backend, removing the file once it holds no keys.
+func (f *File) Delete(devID string) error {
+	keys, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[devID]; !ok {
+		return ErrNotFound
+	}
+	delete(keys, devID)
+	if len(keys) == 0 {
+		return os.Remove(f.Path)
+	}
+	pass, err := f.passphrase(false)
+	if err != nil {
+		return err
+	}
+	return f.write(keys, pass)
+}
+
+// passphrase asks for the passphrase once and reuses it, so reading and
+// rewriting the file asks only once.
+func (f *File) passphrase(confirm bool) (string, error) {
+	if f.Passphrase == nil {
+		return "", fmt.Errorf("no passphrase available for %s", f.Path)
+	}
+	p, err := f.Passphrase(confirm)
+	if err != nil {
+		return "", err
+	}
+	f.Passphrase = func(bool) (string, error) { return p, nil }
+	return p, nil
+}
+
+// read decrypts the file, returning ErrNotFound if there is none.
+func (f *File) read() (map[string]string, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	pass, err := f.passphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	id, err := age.NewScryptIdentity(pass)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(data)), id)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, fmt.Errorf("wrong passphrase for %s", f.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", f.Path, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", f.Path, err)
+	}
+	keys := make(map[string]string)
+	if err := json.Unmarshal(plain, &keys); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", f.Path, err)
+	}
+	return keys, nil
+}
+
+// write encrypts keys to the file, replacing it atomically.
+func (f *File) write(keys map[string]string, pass string) error {
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	rcpt, err := age.NewScryptRecipient(pass)
+	if err != nil {
+		return err
+	}
+	rcpt.SetWorkFactor(scryptWorkFactor)
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, rcpt)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(plain); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
@@ -0,0 +1,107 @@
+// Package keyring stores API keys outside the config file: in the desktop
+// keyring through the freedesktop Secret Service (GNOME Keyring, KWallet,
+// KeePassXC) over D-Bus, or, where no Secret Service is running, in a file
+// encrypted with a passphrase using age.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ErrNotFound is returned when no key is stored for a developer ID.
+var ErrNotFound = errors.New("no API key stored")
+
+// PassphraseEnv is the environment variable the passphrase of the encrypted
+// file is read from, for use without a terminal.
+const PassphraseEnv = "PTV_KEYRING_PASSPHRASE"
+
+// Backend stores API keys by developer ID.
+type Backend interface {
+	// Name describes where keys are stored, for messages.
+	Name() string
+	Get(devID string) (string, error)
+	Set(devID, apiKey string) error
+	// Delete removes the key for devID, returning ErrNotFound if there
+	// was none.
+	Delete(devID string) error
+}
+
+// PassphraseFunc returns the passphrase of the encrypted file. confirm is
+// set when a new passphrase is being chosen.
+type PassphraseFunc func(confirm bool) (string, error)
+
+// Backends returns the places keys may be stored, in the order they are
+// consulted: the Secret Service if one is running on the session bus, then
+// the encrypted file at path.
+func Backends(path string, passphrase PassphraseFunc) []Backend {
+	var backends []Backend
+	if ss, err := OpenSecretService(); err == nil {
+		backends = append(backends, ss)
+	}
+	return append(backends, &File{Path: path, Passphrase: passphrase})
+}
+
+// Close releases any connections held by backends.
+func Close(backends []Backend) {
+	for _, b := range backends {
+		if c, ok := b.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Lookup returns the key stored for devID in the first backend holding
+// one, and that backend.
+func Lookup(backends []Backend, devID string) (string, Backend, error) {
+	for _, b := range backends {
+		key, err := b.Get(devID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		return key, b, nil
+	}
+	return "", nil, ErrNotFound
+}
+
+// TerminalPassphrase returns the passphrase from $PTV_KEYRING_PASSPHRASE,
+// or else prompts for it on the terminal, twice when confirming.
+func TerminalPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv(PassphraseEnv); p != "" {
+		return p, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("a passphrase is needed for the encrypted credentials file; set %s", PassphraseEnv)
+	}
+	read := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		p, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(p), err
+	}
+	p, err := read("Passphrase for the encrypted credentials file: ")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("no passphrase given")
+	}
+	if confirm {
+		again, err := read("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,299 @@
+package keyring
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func passphrase(p string) PassphraseFunc {
+	return func(bool) (string, error) { return p, nil }
+}
+
+func TestFile(t *testing.T) {
+	scryptWorkFactor = 10
+	path := filepath.Join(t.TempDir(), "credentials.age")
+
+	f := &File{Path: path, Passphrase: passphrase("correct horse")}
+	if _, err := f.Get("1000001"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() before Set = %v, want ErrNotFound", err)
+	}
+	if err := f.Set("1000001", "key-one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set("1000002", "key-two"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "key-one") || !strings.HasPrefix(string(data), "-----BEGIN AGE ENCRYPTED FILE-----") {
+		t.Errorf("file is not an armored age file:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	f = &File{Path: path, Passphrase: passphrase("correct horse")}
+	if key, err := f.Get("1000002"); err != nil || key != "key-two" {
+		t.Errorf("Get() = %q, %v; want key-two", key, err)
+	}
+	wrong := &File{Path: path, Passphrase: passphrase("battery staple")}
+	if _, err := wrong.Get("1000001"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Get() with the wrong passphrase = %v", err)
+	}
+
+	if err := f.Delete("1000001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete("1000001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete() = %v, want ErrNotFound", err)
+	}
+	if err := f.Delete("1000002"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file still exists after deleting every key")
+	}
+}
+
+// memory is a Backend holding keys in a map.
+type memory map[string]string
+
+func (m memory) Name() string { return "memory" }
+func (m memory) Get(devID string) (string, error) {
+	if k, ok := m[devID]; ok {
+		return k, nil
+	}
+	return "", ErrNotFound
+}
+func (m memory) Set(devID, apiKey string) error { m[devID] = apiKey; return nil }
+func (m memory) Delete(devID string) error      { delete(m, devID); return nil }
+
+func TestLookup(t *testing.T) {
+	first, second := memory{"1": "a"}, memory{"1": "b", "2": "c"}
+	backends := []Backend{first, second}
+	if key, b, err := Lookup(backends, "1"); err != nil || key != "a" || b.(memory)["1"] != "a" {
+		t.Errorf("Lookup(1) = %q, %v, %v; want a from the first backend", key, b, err)
+	}
+	if key, _, err := Lookup(backends, "2"); err != nil || key != "c" {
+		t.Errorf("Lookup(2) = %q, %v; want c", key, err)
+	}
+	if _, _, err := Lookup(backends, "3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup(3) = %v, want ErrNotFound", err)
+	}
+}
+
+// fakeSecrets stands in for a Secret Service: a default collection that
+// starts locked and is unlocked by completing a prompt.
+type fakeSecrets struct {
+	conn   *dbus.Conn
+	mu     sync.Mutex
+	locked bool
+	items  map[dbus.ObjectPath]*fakeItem
+	next   int
+}
+
+type fakeItem struct {
+	svc   *fakeSecrets
+	path  dbus.ObjectPath
+	attrs map[string]string
+	value []byte
+}
+
+func (s *fakeSecrets) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %s", algorithm))
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (s *fakeSecrets) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []dbus.ObjectPath
+	for path, item := range s.items {
+		match := true
+		for k, v := range attrs {
+			match = match && item.attrs[k] == v
+		}
+		if match {
+			found = append(found, path)
+		}
+	}
+	if s.locked {
+		return []dbus.ObjectPath{}, found, nil
+	}
+	return found, []dbus.ObjectPath{}, nil
+}
+
+func (s *fakeSecrets) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.locked {
+		return objects, ssNoPrompt, nil
+	}
+	prompt := dbus.ObjectPath("/org/freedesktop/secrets/prompt/1")
+	s.conn.Export(&fakePrompt{s, prompt, objects}, prompt, ssPrompt)
+	return []dbus.ObjectPath{}, prompt, nil
+}
+
+type fakePrompt struct {
+	svc     *fakeSecrets
+	path    dbus.ObjectPath
+	objects []dbus.ObjectPath
+}
+
+func (p *fakePrompt) Prompt(windowID string) *dbus.Error {
+	p.svc.mu.Lock()
+	p.svc.locked = false
+	p.svc.mu.Unlock()
+	p.svc.conn.Emit(p.path, ssPrompt+".Completed", false, dbus.MakeVariant(p.objects))
+	return nil
+}
+
+func (s *fakeSecrets) CreateItem(props map[string]dbus.Variant, sec secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return "", "", dbus.MakeFailedError(errors.New("collection is locked"))
+	}
+	attrs, _ := props[ssItemAttrs].Value().(map[string]string)
+	for _, item := range s.items {
+		if replace && fmt.Sprint(item.attrs) == fmt.Sprint(attrs) {
+			item.value = sec.Value
+			return item.path, ssNoPrompt, nil
+		}
+	}
+	s.next++
+	item := &fakeItem{svc: s, path: dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", s.next)), attrs: attrs, value: sec.Value}
+	s.items[item.path] = item
+	s.conn.Export(item, item.path, ssItem)
+	return item.path, ssNoPrompt, nil
+}
+
+func (i *fakeItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	i.svc.mu.Lock()
+	defer i.svc.mu.Unlock()
+	if i.svc.locked {
+		return secret{}, dbus.MakeFailedError(errors.New("item is locked"))
+	}
+	return secret{Session: session, Parameters: []byte{}, Value: i.value, ContentType: "text/plain"}, nil
+}
+
+func (i *fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.svc.mu.Lock()
+	defer i.svc.mu.Unlock()
+	delete(i.svc.items, i.path)
+	i.svc.conn.Export(nil, i.path, ssItem)
+	return ssNoPrompt, nil
+}
+
+// privateBus starts a dbus-daemon for the test and returns its address.
+func privateBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "bus.conf")
+	os.WriteFile(conf, []byte(`<busconfig>
+  <type>session</type>
+  <listen>unix:dir=`+dir+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`), 0o644)
+	cmd := exec.Command(daemon, "--config-file="+conf, "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading bus address: %v", err)
+	}
+	return strings.TrimSpace(addr)
+}
+
+func TestSecretService(t *testing.T) {
+	addr := privateBus(t)
+
+	svcConn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svcConn.Close()
+	fake := &fakeSecrets{conn: svcConn, locked: true, items: make(map[dbus.ObjectPath]*fakeItem)}
+	svcConn.Export(fake, ssPath, ssService)
+	svcConn.Export(fake, ssDefault, ssCollection)
+	if reply, err := svcConn.RequestName(ssName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName() = %v, %v", reply, err)
+	}
+
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := NewSecretService(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	if _, err := ss.Get("1000001"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() before Set = %v, want ErrNotFound", err)
+	}
+	// Storing goes through the unlock prompt.
+	if err := ss.Set("1000001", "key-one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Set("1000001", "key-two"); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	if len(fake.items) != 1 {
+		t.Errorf("keyring holds %d items, want the key replaced in place", len(fake.items))
+	}
+	for _, item := range fake.items {
+		if item.attrs["application"] != "vic-ptv-cli" || item.attrs["devId"] != "1000001" {
+			t.Errorf("item attributes = %v", item.attrs)
+		}
+	}
+	fake.locked = true
+	fake.mu.Unlock()
+
+	if key, err := ss.Get("1000001"); err != nil || key != "key-two" {
+		t.Errorf("Get() from a locked keyring = %q, %v; want key-two after unlocking", key, err)
+	}
+	if err := ss.Delete("1000001"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Get("1000001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete = %v, want ErrNotFound", err)
+	}
+	if err := ss.Delete("1000001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete() = %v, want ErrNotFound", err)
+	}
+}
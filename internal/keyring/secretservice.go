@@ -0,0 +1,218 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Secret Service D-Bus names.
+const (
+	ssName       = "org.freedesktop.secrets"
+	ssPath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssDefault    = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	ssNoPrompt   = dbus.ObjectPath("/")
+	ssService    = "org.freedesktop.Secret.Service"
+	ssCollection = "org.freedesktop.Secret.Collection"
+	ssItem       = "org.freedesktop.Secret.Item"
+	ssPrompt     = "org.freedesktop.Secret.Prompt"
+	ssItemLabel  = ssItem + ".Label"
+	ssItemAttrs  = ssItem + ".Attributes"
+)
+
+// promptTimeout is how long to wait for the user to answer a keyring
+// prompt, such as to unlock it.
+const promptTimeout = 2 * time.Minute
+
+// application is the value of the "application" attribute on stored items.
+const application = "vic-ptv-cli"
+
+// secret is a Secret Service secret, (oayays) on the wire.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService stores keys in the default collection of the Secret
+// Service, as items with attributes application=vic-ptv-cli and devId.
+type SecretService struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// OpenSecretService connects to the Secret Service on the session bus,
+// failing if there is no session bus or no Secret Service on it. A session
+// bus is never started just for this.
+func OpenSecretService() (*SecretService, error) {
+	conn, err := dbus.SessionBusPrivateNoAutoStartup()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ss, err := NewSecretService(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ss, nil
+}
+
+// NewSecretService uses the Secret Service on conn, opening a session with
+// it. Secrets are exchanged unencrypted, which is safe on the local bus.
+func NewSecretService(conn *dbus.Conn) (*SecretService, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := conn.Object(ssName, ssPath).Call(ssService+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return nil, fmt.Errorf("opening Secret Service session: %w", err)
+	}
+	return &SecretService{conn: conn, session: session}, nil
+}
+
+// Name implements Backend.
+func (s *SecretService) Name() string {
+	return "Secret Service keyring"
+}
+
+// Close closes the D-Bus connection.
+func (s *SecretService) Close() error {
+	return s.conn.Close()
+}
+
+// Get implements Backend, unlocking the item if need be, which may prompt
+// the user.
+func (s *SecretService) Get(devID string) (string, error) {
+	items, err := s.search(devID)
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", ErrNotFound
+	}
+	var sec secret
+	if err := s.conn.Object(ssName, items[0]).Call(ssItem+".GetSecret", 0, s.session).Store(&sec); err != nil {
+		return "", fmt.Errorf("reading secret: %w", err)
+	}
+	return string(sec.Value), nil
+}
+
+// Set implements Backend, replacing any key stored for devID.
+func (s *SecretService) Set(devID, apiKey string) error {
+	if err := s.unlock([]dbus.ObjectPath{ssDefault}); err != nil {
+		return err
+	}
+	props := map[string]dbus.Variant{
+		ssItemLabel: dbus.MakeVariant(fmt.Sprintf("PTV API key for developer ID %s", devID)),
+		ssItemAttrs: dbus.MakeVariant(attributes(devID)),
+	}
+	sec := secret{Session: s.session, Parameters: []byte{}, Value: []byte(apiKey), ContentType: "text/plain"}
+	var item, prompt dbus.ObjectPath
+	if err := s.conn.Object(ssName, ssDefault).Call(ssCollection+".CreateItem", 0, props, sec, true).Store(&item, &prompt); err != nil {
+		return fmt.Errorf("storing secret: %w", err)
+	}
+	_, err := s.prompt(prompt)
+	return err
+}
+
+// Delete implements Backend.
+func (s *SecretService) Delete(devID string) error {
+	items, err := s.search(devID)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return ErrNotFound
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.conn.Object(ssName, item).Call(ssItem+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("deleting secret: %w", err)
+		}
+		if _, err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attributes(devID string) map[string]string {
+	return map[string]string{"application": application, "devId": devID}
+}
+
+// search returns the items holding keys for devID, unlocking locked ones.
+func (s *SecretService) search(devID string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := s.conn.Object(ssName, ssPath).Call(ssService+".SearchItems", 0, attributes(devID)).Store(&unlocked, &locked); err != nil {
+		return nil, fmt.Errorf("searching keyring: %w", err)
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(locked); err != nil {
+			return nil, err
+		}
+	}
+	return append(unlocked, locked...), nil
+}
+
+// unlock unlocks objects, prompting the user if the service asks to.
+func (s *SecretService) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := s.conn.Object(ssName, ssPath).Call(ssService+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("unlocking keyring: %w", err)
+	}
+	if _, err := s.prompt(prompt); err != nil {
+		return fmt.Errorf("unlocking keyring: %w", err)
+	}
+	return nil
+}
+
+// prompt shows the prompt at path, if any, and waits for the user to
+// complete it, returning its result.
+func (s *SecretService) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	if path == ssNoPrompt || path == "" {
+		return dbus.Variant{}, nil
+	}
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(ssPrompt),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return dbus.Variant{}, err
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(ssName, path).Call(ssPrompt+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, err
+	}
+	timeout := time.After(promptTimeout)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || sig.Name != ssPrompt+".Completed" || len(sig.Body) != 2 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return dbus.Variant{}, errors.New("prompt dismissed")
+			}
+			result, _ := sig.Body[1].(dbus.Variant)
+			return result, nil
+		case <-timeout:
+			return dbus.Variant{}, errors.New("timed out waiting for the keyring prompt")
+		}
+	}
+}
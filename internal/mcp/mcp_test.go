@@ -0,0 +1,202 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+type embedded struct {
+	Note string `json:"note,omitempty"`
+}
+
+type schemaArgs struct {
+	embedded
+	Stop    string             `json:"stop" jsonschema:"Stop ID or name"`
+	Limit   int                `json:"limit,omitempty"`
+	When    *time.Time         `json:"when"`
+	Tags    []string           `json:"tags,omitempty"`
+	Extra   map[string]float64 `json:"extra,omitempty"`
+	Skipped string             `json:"-"`
+	private int
+}
+
+func TestSchemaFor(t *testing.T) {
+	got, err := json.Marshal(SchemaFor(reflect.TypeOf(&schemaArgs{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","properties":{` +
+		`"extra":{"type":"object","additionalProperties":{"type":"number"}},` +
+		`"limit":{"type":"integer"},` +
+		`"note":{"type":"string"},` +
+		`"stop":{"type":"string","description":"Stop ID or name"},` +
+		`"tags":{"type":"array","items":{"type":"string"}},` +
+		`"when":{"type":["string","null"],"format":"date-time"}},` +
+		`"required":["stop","when"],"additionalProperties":false}`
+	if string(got) != want {
+		t.Errorf("SchemaFor() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+type echoArgs struct {
+	Text  string `json:"text"`
+	Times int    `json:"times,omitempty"`
+}
+
+type echoResult struct {
+	Text string `json:"text"`
+}
+
+func testServer() *Server {
+	s := NewServer("test", "1.0", "Say things back.")
+	AddTool(s, "echo", "Repeat text.", func(ctx context.Context, args echoArgs) (*echoResult, error) {
+		if args.Times < 0 {
+			return nil, errors.New("times must not be negative")
+		}
+		if args.Text == "unreachable" {
+			return nil, fmt.Errorf("HTTP request failed: %w", &url.Error{Op: "Get",
+				URL: "http://localhost/v3/route_types?devid=3001234&signature=6E8F", Err: errors.New("connection refused")})
+		}
+		return &echoResult{Text: strings.Repeat(args.Text, max(args.Times, 1))}, nil
+	})
+	return s
+}
+
+// exchange sends each request on its own line and returns the decoded
+// responses.
+func exchange(t *testing.T, s *Server, requests ...string) []map[string]json.RawMessage {
+	t.Helper()
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatal(err)
+	}
+	var resps []map[string]json.RawMessage
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r map[string]json.RawMessage
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, r)
+	}
+	return resps
+}
+
+func TestServe(t *testing.T) {
+	resps := exchange(t, testServer(),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"c","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"text":"ab","times":2}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`,
+		`not json`,
+	)
+	if len(resps) != 5 {
+		t.Fatalf("got %d responses, want 5 (none for the notification)", len(resps))
+	}
+
+	var init struct {
+		ProtocolVersion string
+		ServerInfo      struct{ Name string }
+	}
+	json.Unmarshal(resps[0]["result"], &init)
+	if init.ProtocolVersion != "2025-03-26" || init.ServerInfo.Name != "test" {
+		t.Errorf("initialize = %s, want the client's protocol version and the server name", resps[0]["result"])
+	}
+
+	var list struct{ Tools []Tool }
+	json.Unmarshal(resps[1]["result"], &list)
+	if len(list.Tools) != 1 || list.Tools[0].Name != "echo" || list.Tools[0].InputSchema.Required[0] != "text" || list.Tools[0].OutputSchema == nil {
+		t.Errorf("tools/list = %s", resps[1]["result"])
+	}
+
+	var call callResult
+	json.Unmarshal(resps[2]["result"], &call)
+	if call.IsError || len(call.Content) != 1 || call.Content[0].Text != `{"text":"abab"}` {
+		t.Errorf("tools/call = %s, want abab", resps[2]["result"])
+	}
+
+	if !strings.Contains(string(resps[3]["error"]), "-32601") {
+		t.Errorf("unknown method = %s, want method not found", resps[3]["error"])
+	}
+	if string(resps[4]["id"]) != "null" || !strings.Contains(string(resps[4]["error"]), "-32700") {
+		t.Errorf("bad message = %v, want a parse error", resps[4])
+	}
+}
+
+func TestToolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{name: "missing argument", args: `{}`, want: `missing required argument "text"`},
+		{name: "unknown argument", args: `{"text":"a","loud":true}`, want: `unknown field "loud"`},
+		{name: "wrong type", args: `{"text":1}`, want: "invalid arguments"},
+		{name: "tool failure", args: `{"text":"a","times":-1}`, want: "times must not be negative"},
+		{name: "request failure", args: `{"text":"unreachable"}`, want: "request failed: connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resps := exchange(t, testServer(), `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":`+tt.args+`}}`)
+			var call callResult
+			json.Unmarshal(resps[0]["result"], &call)
+			if !call.IsError || !strings.Contains(call.Content[0].Text, tt.want) {
+				t.Errorf("result = %s, want an error containing %q", resps[0]["result"], tt.want)
+			}
+			if strings.Contains(call.Content[0].Text, "devid") {
+				t.Errorf("result = %s leaks the request URL", resps[0]["result"])
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func TestNewDeparturesResult(t *testing.T) {
+	now := time.Date(2024, 1, 15, 21, 0, 0, 0, time.UTC)
+	loc, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &api.DeparturesResponse{
+		Departures: []api.Departure{
+			{StopID: 1162, RouteID: 11, RunRef: "1", DirectionID: 1, PlatformNumber: "2", DisruptionIDs: []int{9},
+				ScheduledDepartureUTC: ptr(now.Add(3 * time.Minute)), EstimatedDepartureUTC: ptr(now.Add(5 * time.Minute))},
+			{StopID: 1162, RouteID: 11, RunRef: "2", DirectionID: 1, ScheduledDepartureUTC: ptr(now.Add(12 * time.Minute))},
+		},
+		Stops:       map[string]api.StopInfo{"1162": {StopName: "Richmond Station", StopSuburb: "Richmond"}},
+		Routes:      map[string]api.RouteInfo{"11": {RouteName: "Pakenham", RouteType: 0}},
+		Directions:  map[string]api.Direction{"1": {DirectionName: "City (Flinders Street)"}},
+		Runs:        map[string]api.RunInfo{"1": {DestinationName: "Flinders Street"}, "2": {DestinationName: "City (Flinders Street)", Status: "Cancelled"}},
+		Disruptions: map[string]api.Disruption{"9": {Title: "<p>Minor delays</p>"}},
+	}
+
+	r := NewDeparturesResult(1162, resp, loc, now)
+	if r.Stop != "Richmond Station (Richmond)" || len(r.Departures) != 2 {
+		t.Fatalf("result = %+v", r)
+	}
+	d := r.Departures[0]
+	if d.Route != "Pakenham" || d.Mode != "Train" || d.Direction != "City (Flinders Street)" || d.Destination != "Flinders Street" || d.Platform != "2" {
+		t.Errorf("first departure = %+v", d)
+	}
+	if d.Minutes != 5 || d.Estimated.Location() != loc || d.Estimated.Hour() != 8 {
+		t.Errorf("first departure in %d minutes at %s, want 5 minutes, 08:05 Melbourne time", d.Minutes, d.Estimated)
+	}
+	if len(d.Disruptions) != 1 || d.Disruptions[0] != "Minor delays" {
+		t.Errorf("disruptions = %q, want the plain title", d.Disruptions)
+	}
+	if d := r.Departures[1]; !d.Cancelled || d.Destination != "" || d.Minutes != 12 {
+		t.Errorf("second departure = %+v, want cancelled in 12 minutes with no separate destination", d)
+	}
+}
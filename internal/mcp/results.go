@@ -0,0 +1,245 @@
+package mcp
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+)
+
+// The tool results below are compact forms of the internal/api responses:
+// expanded routes, directions and runs are folded into each item, times
+// are in local time, and HTML is reduced to plain text.
+
+// Stop is a stop found by search.
+type Stop struct {
+	ID     int    `json:"id" jsonschema:"Stop ID, usable as the stop argument of other tools"`
+	Name   string `json:"name"`
+	Suburb string `json:"suburb,omitempty"`
+	Mode   string `json:"mode" jsonschema:"Transport mode, such as Train or Tram"`
+}
+
+// Route is a route found by search or looked up.
+type Route struct {
+	ID     int    `json:"id" jsonschema:"Route ID, usable as the route argument of other tools"`
+	Number string `json:"number,omitempty" jsonschema:"Public route number, such as 96 for a tram or bus"`
+	Name   string `json:"name"`
+	Mode   string `json:"mode"`
+	GTFSID string `json:"gtfs_id,omitempty"`
+	Status string `json:"status,omitempty" jsonschema:"Current service status, such as Good Service"`
+}
+
+// SearchResult is the result of the search tool.
+type SearchResult struct {
+	Stops  []Stop  `json:"stops"`
+	Routes []Route `json:"routes"`
+}
+
+// Departure is one departure from a stop.
+type Departure struct {
+	Route       string     `json:"route" jsonschema:"Route number and name"`
+	RouteID     int        `json:"route_id"`
+	Mode        string     `json:"mode"`
+	Direction   string     `json:"direction,omitempty" jsonschema:"Direction of travel, usually the end of the line"`
+	Destination string     `json:"destination,omitempty" jsonschema:"Where this service terminates, if not the end of the line"`
+	Platform    string     `json:"platform,omitempty"`
+	Scheduled   *time.Time `json:"scheduled,omitempty"`
+	Estimated   *time.Time `json:"estimated,omitempty" jsonschema:"Realtime estimate, when one is available"`
+	Minutes     int        `json:"minutes" jsonschema:"Minutes until departure, using the estimate if there is one"`
+	AtPlatform  bool       `json:"at_platform,omitempty"`
+	Cancelled   bool       `json:"cancelled,omitempty"`
+	Disruptions []string   `json:"disruptions,omitempty" jsonschema:"Titles of disruptions affecting this departure"`
+}
+
+// DeparturesResult is the result of the departures tool.
+type DeparturesResult struct {
+	StopID     int         `json:"stop_id"`
+	Stop       string      `json:"stop"`
+	Departures []Departure `json:"departures"`
+}
+
+// StopDetails describes a stop as served by one mode.
+type StopDetails struct {
+	ID            int              `json:"id"`
+	Name          string           `json:"name"`
+	Mode          string           `json:"mode"`
+	Type          string           `json:"type,omitempty" jsonschema:"Station type, such as Premium Station"`
+	Description   string           `json:"description,omitempty"`
+	Latitude      float64          `json:"latitude,omitempty"`
+	Longitude     float64          `json:"longitude,omitempty"`
+	Amenities     *api.StopAmenity `json:"amenities,omitempty"`
+	Accessibility *api.StopAccess  `json:"accessibility,omitempty"`
+}
+
+// StopResult is the result of the stop tool.
+type StopResult struct {
+	Stops []StopDetails `json:"stops" jsonschema:"The stop's details for each mode serving it"`
+}
+
+// Disruption is a service disruption.
+type Disruption struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Type        string     `json:"type" jsonschema:"Kind of disruption, such as Planned Works or Major Delays"`
+	Status      string     `json:"status,omitempty" jsonschema:"Current or Planned"`
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+	Routes      []string   `json:"routes,omitempty" jsonschema:"Routes affected"`
+	Stops       []string   `json:"stops,omitempty" jsonschema:"Stops affected"`
+	Description string     `json:"description,omitempty"`
+	URL         string     `json:"url,omitempty" jsonschema:"Page with full details"`
+}
+
+// DisruptionsResult is the result of the disruptions tool.
+type DisruptionsResult struct {
+	Disruptions []Disruption `json:"disruptions"`
+}
+
+// FareResult is the result of the fare tool.
+type FareResult struct {
+	EarlyBird    bool                `json:"early_bird" jsonschema:"Whether the journey qualifies for free early-bird travel"`
+	FreeTramZone bool                `json:"free_tram_zone" jsonschema:"Whether the journey is within the free tram zone"`
+	Fares        []api.PassengerFare `json:"fares" jsonschema:"Fares in dollars for each passenger type"`
+}
+
+// routeLabel names a route by number and name, like the departures table.
+func routeLabel(number, name string) string {
+	if number != "" {
+		return number + " " + name
+	}
+	return name
+}
+
+// NewSearchResult compacts a search response.
+func NewSearchResult(resp *api.SearchResponse) *SearchResult {
+	r := &SearchResult{Stops: []Stop{}, Routes: []Route{}}
+	for _, s := range resp.Stops {
+		r.Stops = append(r.Stops, Stop{ID: s.StopID, Name: s.StopName, Suburb: s.StopSuburb, Mode: display.RouteTypeName(s.RouteType)})
+	}
+	for _, rt := range resp.Routes {
+		r.Routes = append(r.Routes, Route{ID: rt.RouteID, Number: rt.RouteNumber, Name: rt.RouteName, Mode: display.RouteTypeName(rt.RouteType), GTFSID: rt.RouteGTFSID})
+	}
+	return r
+}
+
+// NewRoute compacts a route.
+func NewRoute(r api.RouteWithStatus) *Route {
+	route := &Route{ID: r.RouteID, Number: r.RouteNumber, Name: r.RouteName, Mode: display.RouteTypeName(r.RouteType), GTFSID: r.RouteGTFSID}
+	if r.RouteServiceStatus != nil {
+		route.Status = r.RouteServiceStatus.Description
+	}
+	return route
+}
+
+// NewDeparturesResult compacts departures from stopID, giving times in loc
+// and minutes until each departure from now.
+func NewDeparturesResult(stopID int, resp *api.DeparturesResponse, loc *time.Location, now time.Time) *DeparturesResult {
+	r := &DeparturesResult{StopID: stopID, Departures: []Departure{}}
+	if s, ok := resp.Stops[strconv.Itoa(stopID)]; ok {
+		r.Stop = display.StopLabel(s.StopName, s.StopSuburb)
+	}
+	for _, d := range resp.Departures {
+		dep := Departure{
+			Route:      "Route " + strconv.Itoa(d.RouteID),
+			RouteID:    d.RouteID,
+			Platform:   d.PlatformNumber,
+			Scheduled:  inLocation(d.ScheduledDepartureUTC, loc),
+			Estimated:  inLocation(d.EstimatedDepartureUTC, loc),
+			Minutes:    int(d.DepartureTime().Sub(now).Minutes()),
+			AtPlatform: d.AtPlatform,
+		}
+		if rt, ok := resp.Routes[strconv.Itoa(d.RouteID)]; ok {
+			dep.Route = routeLabel(rt.RouteNumber, rt.RouteName)
+			dep.Mode = display.RouteTypeName(rt.RouteType)
+		}
+		if dir, ok := resp.Directions[strconv.Itoa(d.DirectionID)]; ok {
+			dep.Direction = dir.DirectionName
+		}
+		if run, ok := resp.Runs[d.RunRef]; ok {
+			if run.DestinationName != dep.Direction {
+				dep.Destination = run.DestinationName
+			}
+			dep.Cancelled = run.Cancelled()
+		}
+		for _, id := range d.DisruptionIDs {
+			if dis, ok := resp.Disruptions[strconv.Itoa(id)]; ok {
+				dep.Disruptions = append(dep.Disruptions, display.PlainText(dis.Title))
+			}
+		}
+		r.Departures = append(r.Departures, dep)
+	}
+	return r
+}
+
+// NewStopDetails compacts a stop's details for one mode.
+func NewStopDetails(s api.StopDetails) StopDetails {
+	d := StopDetails{
+		ID:            s.StopID,
+		Name:          s.StopName,
+		Mode:          display.RouteTypeName(s.RouteType),
+		Type:          s.StationType,
+		Description:   display.PlainText(s.StationDescription),
+		Amenities:     s.StopAmenities,
+		Accessibility: s.StopAccessibility,
+	}
+	if s.StopLocation != nil {
+		d.Latitude, d.Longitude = s.StopLocation.Latitude, s.StopLocation.Longitude
+	}
+	return d
+}
+
+// NewDisruptionsResult compacts disruptions, most recently started first,
+// giving times in loc.
+func NewDisruptionsResult(disruptions []api.Disruption, loc *time.Location) *DisruptionsResult {
+	r := &DisruptionsResult{Disruptions: []Disruption{}}
+	for _, d := range disruptions {
+		r.Disruptions = append(r.Disruptions, NewDisruption(d, loc))
+	}
+	sort.SliceStable(r.Disruptions, func(i, j int) bool {
+		a, b := r.Disruptions[i].From, r.Disruptions[j].From
+		return a != nil && (b == nil || a.After(*b))
+	})
+	return r
+}
+
+// NewDisruption compacts a disruption.
+func NewDisruption(d api.Disruption, loc *time.Location) Disruption {
+	dis := Disruption{
+		ID:          d.DisruptionID,
+		Title:       display.PlainText(d.Title),
+		Type:        d.DisruptionType,
+		Status:      d.DisruptionStatus,
+		From:        inLocation(d.FromDate, loc),
+		To:          inLocation(d.ToDate, loc),
+		Description: display.PlainText(d.Description),
+		URL:         d.URL,
+	}
+	for _, rt := range d.Routes {
+		dis.Routes = append(dis.Routes, routeLabel(rt.RouteNumber, rt.RouteName))
+	}
+	for _, s := range d.Stops {
+		dis.Stops = append(dis.Stops, s.StopName)
+	}
+	return dis
+}
+
+// NewFareResult compacts a fare estimate.
+func NewFareResult(resp *api.FareEstimateResponse) *FareResult {
+	r := &FareResult{Fares: []api.PassengerFare{}}
+	if f := resp.FareEstimate; f != nil {
+		r.EarlyBird = f.IsEarlyBird
+		r.FreeTramZone = f.IsJourneyInFreeTramZone
+		r.Fares = append(r.Fares, f.PassengerFares...)
+	}
+	return r
+}
+
+func inLocation(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
@@ -0,0 +1,265 @@
+// Package mcp serves tools to AI assistants over the Model Context Protocol:
+// JSON-RPC 2.0 messages, one per line, on stdin and stdout. Tool input and
+// output schemas are reflected from the Go types of their arguments and
+// results.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// protocolVersions are the MCP revisions the server speaks, newest first.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// maxMessage is the longest message line accepted.
+const maxMessage = 4 << 20
+
+// Tool is a tool offered to clients.
+type Tool struct {
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	InputSchema  *Schema `json:"inputSchema"`
+	OutputSchema *Schema `json:"outputSchema,omitempty"`
+
+	call func(ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+// Server answers MCP requests with its tools.
+type Server struct {
+	name         string
+	version      string
+	instructions string
+	tools        map[string]*Tool
+}
+
+// NewServer returns a Server identifying itself to clients by name and
+// version, with instructions on how to use its tools.
+func NewServer(name, version, instructions string) *Server {
+	return &Server{name: name, version: version, instructions: instructions, tools: make(map[string]*Tool)}
+}
+
+// AddTool offers fn as a tool. Its arguments are decoded from JSON into an
+// In, and it returns an Out, which must encode as a JSON object; both
+// schemas are reflected from the types. An error from fn is reported to the
+// client as a failed tool call, for the assistant to read and act on.
+func AddTool[In, Out any](s *Server, name, description string, fn func(context.Context, In) (Out, error)) {
+	in := SchemaFor(reflect.TypeOf((*In)(nil)).Elem())
+	s.tools[name] = &Tool{
+		Name:         name,
+		Description:  description,
+		InputSchema:  in,
+		OutputSchema: SchemaFor(reflect.TypeOf((*Out)(nil)).Elem()),
+		call: func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var args In
+			if err := decodeArgs(raw, in, &args); err != nil {
+				return nil, err
+			}
+			return fn(ctx, args)
+		},
+	}
+}
+
+// decodeArgs decodes tool arguments into v, checking that the required
+// ones are present and that there are no others.
+func decodeArgs(raw json.RawMessage, schema *Schema, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		raw = json.RawMessage("{}")
+	}
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &present); err != nil {
+		return fmt.Errorf("arguments must be an object: %w", err)
+	}
+	for _, name := range schema.Required {
+		if _, ok := present[name]; !ok {
+			return fmt.Errorf("missing required argument %q", name)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// request is a JSON-RPC request, or a notification if it has no ID.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// content is a block of tool output shown to the assistant.
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// callResult is the result of tools/call. Successful results are returned
+// both as structured content and, for older clients, as JSON text.
+type callResult struct {
+	Content           []content   `json:"content"`
+	StructuredContent interface{} `json:"structuredContent,omitempty"`
+	IsError           bool        `json:"isError,omitempty"`
+}
+
+// Serve reads requests from r and writes responses to w until r is
+// exhausted or ctx is cancelled. Requests are handled one at a time.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	in := bufio.NewScanner(r)
+	in.Buffer(make([]byte, 64*1024), maxMessage)
+	enc := json.NewEncoder(w)
+	for in.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := bytes.TrimSpace(in.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		resp := s.handle(ctx, line)
+		if resp == nil {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return in.Err()
+}
+
+// handle answers one message, returning nil for notifications.
+func (s *Server) handle(ctx context.Context, msg []byte) *response {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}}
+	}
+	if len(req.ID) == 0 {
+		// Notifications, such as notifications/initialized, need no reply.
+		return nil
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{codeInvalidRequest, "invalid JSON-RPC 2.0 request"}
+		return resp
+	}
+
+	result, err := s.dispatch(ctx, req.Method, req.Params)
+	if err != nil {
+		rerr, ok := err.(*rpcError)
+		if !ok {
+			rerr = &rpcError{codeInvalidParams, err.Error()}
+		}
+		resp.Error = rerr
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+		}
+		version := protocolVersions[0]
+		if slices.Contains(protocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]bool{"listChanged": false}},
+			"serverInfo":      map[string]string{"name": s.name, "version": s.version},
+			"instructions":    s.instructions,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		names := make([]string, 0, len(s.tools))
+		for name := range s.tools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tools := make([]*Tool, len(names))
+		for i, name := range names {
+			tools[i] = s.tools[name]
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		tool, ok := s.tools[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", p.Name)
+		}
+		return callTool(ctx, tool, p.Arguments), nil
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + method}
+}
+
+// callTool runs a tool, turning its result or error into a tools/call
+// result.
+func callTool(ctx context.Context, tool *Tool, args json.RawMessage) *callResult {
+	out, err := tool.call(ctx, args)
+	if err != nil {
+		return &callResult{Content: []content{{Type: "text", Text: toolError(err)}}, IsError: true}
+	}
+	text, err := json.Marshal(out)
+	if err != nil {
+		return &callResult{Content: []content{{Type: "text", Text: "encoding result: " + err.Error()}}, IsError: true}
+	}
+	return &callResult{Content: []content{{Type: "text", Text: string(text)}}, StructuredContent: out}
+}
+
+// toolError returns an error's text for the client, without any request URL.
+func toolError(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return "request failed: " + urlErr.Err.Error()
+	}
+	return err.Error()
+}
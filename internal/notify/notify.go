@@ -0,0 +1,290 @@
+// Package notify evaluates notification rules against disruptions and
+// departures and sends alerts for the matches to webhooks, Slack, ntfy or
+// the desktop, remembering what has been sent so each alert goes out once.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/config"
+)
+
+// Rule is a notification rule with its stop and route resolved.
+type Rule struct {
+	Name string
+	// When is config.NotifyDisruption, config.NotifyDelay or
+	// config.NotifyCancelled.
+	When        string
+	StopID      int
+	RouteTypes  []int
+	RouteID     int
+	DirectionID int
+	// Departure is the scheduled time of day to watch, as HH:MM, or "" for
+	// every departure.
+	Departure string
+	Delay     time.Duration
+	// Sinks are the names of the sinks to send alerts to.
+	Sinks []string
+}
+
+// Alert is a notification for something a rule matched.
+type Alert struct {
+	// Key identifies what the alert is about, so that it is only sent once.
+	Key     string    `json:"key"`
+	Rule    string    `json:"rule"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	URL     string    `json:"url,omitempty"`
+	Time    time.Time `json:"time"`
+	Sinks   []string  `json:"-"`
+}
+
+// DisruptionAlerts returns an alert for each disruption affecting the
+// rule's route, or its stop if it has no route.
+func DisruptionAlerts(r Rule, disruptions []api.Disruption, now time.Time) []Alert {
+	var alerts []Alert
+	seen := make(map[int]bool)
+	for _, d := range disruptions {
+		if seen[d.DisruptionID] || !affects(r, d) {
+			continue
+		}
+		seen[d.DisruptionID] = true
+		msg := d.Description
+		if msg == "" {
+			msg = d.DisruptionType
+		}
+		if d.DisruptionStatus != "" && d.DisruptionStatus != "Current" {
+			msg = d.DisruptionStatus + ": " + msg
+		}
+		alerts = append(alerts, Alert{
+			Key:     fmt.Sprintf("%s/disruption/%d", r.Name, d.DisruptionID),
+			Rule:    r.Name,
+			Title:   d.Title,
+			Message: msg,
+			URL:     d.URL,
+			Time:    now,
+			Sinks:   r.Sinks,
+		})
+	}
+	return alerts
+}
+
+func affects(r Rule, d api.Disruption) bool {
+	if r.RouteID > 0 {
+		for _, route := range d.Routes {
+			if route.RouteID == r.RouteID {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range d.Stops {
+		if s.StopID == r.StopID {
+			return true
+		}
+	}
+	return false
+}
+
+// DepartureAlerts returns an alert for each departure in resp that is late
+// by at least the rule's delay, or cancelled, depending on the rule.
+// Times of day are in loc.
+func DepartureAlerts(r Rule, resp *api.DeparturesResponse, loc *time.Location, now time.Time) []Alert {
+	var alerts []Alert
+	for _, d := range resp.Departures {
+		if d.ScheduledDepartureUTC == nil || d.StopID != r.StopID ||
+			(r.RouteID > 0 && d.RouteID != r.RouteID) ||
+			(r.DirectionID > 0 && d.DirectionID != r.DirectionID) {
+			continue
+		}
+		scheduled := d.ScheduledDepartureUTC.In(loc)
+		if r.Departure != "" && scheduled.Format("15:04") != r.Departure {
+			continue
+		}
+		cancelled := resp.Runs[d.RunRef].Cancelled()
+		name := departureName(d, resp, scheduled)
+		stop := resp.Stops[strconv.Itoa(d.StopID)].StopName
+		if stop == "" {
+			stop = fmt.Sprintf("stop %d", d.StopID)
+		}
+		key := fmt.Sprintf("%s/%s/%s/%d/%d", r.Name, r.When, d.RunRef, d.StopID, scheduled.Unix())
+
+		switch r.When {
+		case config.NotifyDelay:
+			if cancelled || d.EstimatedDepartureUTC == nil {
+				continue
+			}
+			delay := d.EstimatedDepartureUTC.Sub(*d.ScheduledDepartureUTC)
+			if delay < r.Delay {
+				continue
+			}
+			msg := fmt.Sprintf("Now leaving %s at %s", stop, d.EstimatedDepartureUTC.In(loc).Format("15:04"))
+			if d.PlatformNumber != "" {
+				msg += " from platform " + d.PlatformNumber
+			}
+			alerts = append(alerts, Alert{
+				Key:     key,
+				Rule:    r.Name,
+				Title:   fmt.Sprintf("%s delayed %d min", name, int(delay.Round(time.Minute)/time.Minute)),
+				Message: msg + ".",
+				Time:    now,
+				Sinks:   r.Sinks,
+			})
+		case config.NotifyCancelled:
+			if !cancelled {
+				continue
+			}
+			alerts = append(alerts, Alert{
+				Key:     key,
+				Rule:    r.Name,
+				Title:   name + " cancelled",
+				Message: fmt.Sprintf("The %s departure from %s has been cancelled.", scheduled.Format("15:04"), stop),
+				Time:    now,
+				Sinks:   r.Sinks,
+			})
+		}
+	}
+	return alerts
+}
+
+// departureName describes a departure as its scheduled time, route and
+// destination, like "08:02 Lilydale to Flinders Street".
+func departureName(d api.Departure, resp *api.DeparturesResponse, scheduled time.Time) string {
+	name := scheduled.Format("15:04")
+	route := resp.Routes[strconv.Itoa(d.RouteID)]
+	switch {
+	case route.RouteNumber != "":
+		name += " " + route.RouteNumber
+	case route.RouteName != "":
+		name += " " + route.RouteName
+	default:
+		name += fmt.Sprintf(" route %d", d.RouteID)
+	}
+	if dest := resp.Runs[d.RunRef].DestinationName; dest != "" {
+		name += " to " + dest
+	}
+	return name
+}
+
+// Notifier evaluates rules against the API and sends new alerts.
+type Notifier struct {
+	client *api.Client
+	rules  []Rule
+	sinks  map[string]Sink
+	sent   Sent
+	limit  int
+}
+
+// New returns a Notifier evaluating rules and sending to sinks. Alerts
+// already in sent are not sent again; sent is updated as alerts go out.
+// limit is how many departures to fetch per stop and route type.
+func New(client *api.Client, rules []Rule, sinks map[string]Sink, sent Sent, limit int) *Notifier {
+	return &Notifier{client: client, rules: rules, sinks: sinks, sent: sent, limit: limit}
+}
+
+// Evaluate fetches disruptions and departures as the rules need them and
+// returns every alert they match, including ones already sent. A failed
+// fetch is reported in the error and the rules depending on it skipped.
+func (n *Notifier) Evaluate(loc *time.Location, now time.Time) ([]Alert, error) {
+	var (
+		alerts      []Alert
+		errs        []error
+		disruptions []api.Disruption
+		fetched     bool
+		fetchErr    error
+		departures  = make(map[[2]int]*api.DeparturesResponse)
+	)
+	for _, r := range n.rules {
+		if r.When == config.NotifyDisruption {
+			if !fetched {
+				fetched = true
+				resp, err := n.client.Disruptions()
+				if err != nil {
+					fetchErr = fmt.Errorf("disruptions: %w", err)
+					errs = append(errs, fetchErr)
+				} else {
+					disruptions = resp.Disruptions.AllDisruptions()
+				}
+			}
+			if fetchErr != nil {
+				continue
+			}
+			alerts = append(alerts, DisruptionAlerts(r, disruptions, now)...)
+			continue
+		}
+		for _, rt := range r.RouteTypes {
+			k := [2]int{r.StopID, rt}
+			resp, ok := departures[k]
+			if !ok {
+				var err error
+				if resp, err = n.client.RealtimeDepartures(rt, r.StopID, n.limit); err != nil {
+					errs = append(errs, fmt.Errorf("rule %s: stop %d: %w", r.Name, r.StopID, err))
+					continue
+				}
+				departures[k] = resp
+			}
+			alerts = append(alerts, DepartureAlerts(r, resp, loc, now)...)
+		}
+	}
+	return alerts, errors.Join(errs...)
+}
+
+// Send sends each alert to those of its sinks it has not been sent to yet,
+// returning how many notifications went out. A sink that fails is tried
+// again with the same alert next time.
+func (n *Notifier) Send(ctx context.Context, alerts []Alert) (int, error) {
+	var errs []error
+	count := 0
+	for _, a := range alerts {
+		for _, name := range a.Sinks {
+			if n.sent.Has(a.Key, name) {
+				// Still matching: keep remembering it.
+				n.sent.Mark(a.Key, name, a.Time)
+				continue
+			}
+			sink, ok := n.sinks[name]
+			if !ok {
+				continue
+			}
+			if err := sink.Send(ctx, a); err != nil {
+				errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+				continue
+			}
+			n.sent.Mark(a.Key, name, a.Time)
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// Sent records which alerts have been sent to which sinks, and when they
+// last matched.
+type Sent map[string]time.Time
+
+func sentKey(key, sink string) string { return key + " > " + sink }
+
+// Has reports whether the alert with key has been sent to sink.
+func (s Sent) Has(key, sink string) bool {
+	_, ok := s[sentKey(key, sink)]
+	return ok
+}
+
+// Mark records the alert with key as sent to sink, and matching at t.
+func (s Sent) Mark(key, sink string, t time.Time) {
+	s[sentKey(key, sink)] = t
+}
+
+// Prune forgets alerts that last matched before t: their departures have
+// left and their disruptions have been resolved.
+func (s Sent) Prune(t time.Time) {
+	for k, at := range s {
+		if at.Before(t) {
+			delete(s, k)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/config"
+)
+
+func ptr(t time.Time) *time.Time { return &t }
+
+// Monday 15 January 2024, 08:00 in Melbourne.
+var base = time.Date(2024, 1, 14, 21, 0, 0, 0, time.UTC)
+
+func melbourne(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func titles(alerts []Alert) []string {
+	out := []string{}
+	for _, a := range alerts {
+		out = append(out, a.Title)
+	}
+	return out
+}
+
+func TestDisruptionAlerts(t *testing.T) {
+	disruptions := []api.Disruption{
+		{DisruptionID: 1, Title: "Tram 96 diverted", DisruptionStatus: "Current", Description: "Trams divert via Collins St.", Routes: []api.DisruptionRoute{{RouteID: 722}}},
+		{DisruptionID: 2, Title: "Works on route 96", DisruptionStatus: "Planned", DisruptionType: "Planned Works", Routes: []api.DisruptionRoute{{RouteID: 11}, {RouteID: 722}}},
+		{DisruptionID: 3, Title: "Lift out of service", Stops: []api.DisruptionStop{{StopID: 1071}}},
+		// Listed again under another mode.
+		{DisruptionID: 1, Title: "Tram 96 diverted", Routes: []api.DisruptionRoute{{RouteID: 722}}},
+	}
+
+	got := DisruptionAlerts(Rule{Name: "tram-96", RouteID: 722}, disruptions, base)
+	if len(got) != 2 || got[0].Key != "tram-96/disruption/1" || got[1].Key != "tram-96/disruption/2" {
+		t.Fatalf("route alerts = %+v, want disruptions 1 and 2 once each", got)
+	}
+	if got[0].Message != "Trams divert via Collins St." || got[1].Message != "Planned: Planned Works" {
+		t.Errorf("messages = %q, %q", got[0].Message, got[1].Message)
+	}
+
+	got = DisruptionAlerts(Rule{Name: "station", StopID: 1071}, disruptions, base)
+	if len(got) != 1 || got[0].Title != "Lift out of service" {
+		t.Errorf("stop alerts = %v, want the lift", titles(got))
+	}
+}
+
+func TestDepartureAlerts(t *testing.T) {
+	dep := func(run string, route, dir int, scheduled, late time.Duration) api.Departure {
+		d := api.Departure{StopID: 1071, RouteID: route, DirectionID: dir, RunRef: run, PlatformNumber: "2",
+			ScheduledDepartureUTC: ptr(base.Add(scheduled))}
+		if late >= 0 {
+			d.EstimatedDepartureUTC = ptr(base.Add(scheduled + late))
+		}
+		return d
+	}
+	resp := &api.DeparturesResponse{
+		Departures: []api.Departure{
+			dep("a", 6, 1, 2*time.Minute, 7*time.Minute),
+			dep("b", 6, 1, 10*time.Minute, time.Minute),
+			dep("c", 6, 1, 20*time.Minute, -1),
+			dep("d", 7, 1, 2*time.Minute, 9*time.Minute),
+			dep("e", 6, 2, 2*time.Minute, 9*time.Minute),
+		},
+		Stops:  map[string]api.StopInfo{"1071": {StopName: "Flinders Street"}},
+		Routes: map[string]api.RouteInfo{"6": {RouteName: "Lilydale"}},
+		Runs:   map[string]api.RunInfo{"a": {DestinationName: "Lilydale"}, "c": {DestinationName: "Lilydale", Status: "Cancelled"}},
+	}
+	loc := melbourne(t)
+
+	tests := []struct {
+		name string
+		rule Rule
+		want []string
+	}{
+		{"delayed", Rule{Name: "r", When: config.NotifyDelay, StopID: 1071, RouteID: 6, DirectionID: 1, Delay: 5 * time.Minute},
+			[]string{"08:02 Lilydale to Lilydale delayed 7 min"}},
+		{"any route or direction", Rule{Name: "r", When: config.NotifyDelay, StopID: 1071, Delay: 5 * time.Minute},
+			[]string{"08:02 Lilydale to Lilydale delayed 7 min", "08:02 route 7 delayed 9 min", "08:02 Lilydale delayed 9 min"}},
+		{"other departure", Rule{Name: "r", When: config.NotifyDelay, StopID: 1071, RouteID: 6, Departure: "08:10", Delay: 5 * time.Minute},
+			[]string{}},
+		{"lower threshold", Rule{Name: "r", When: config.NotifyDelay, StopID: 1071, RouteID: 6, Departure: "08:10", Delay: time.Minute},
+			[]string{"08:10 Lilydale delayed 1 min"}},
+		{"cancelled", Rule{Name: "r", When: config.NotifyCancelled, StopID: 1071},
+			[]string{"08:20 Lilydale to Lilydale cancelled"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := titles(DepartureAlerts(tt.rule, resp, loc, base))
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("DepartureAlerts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	a := DepartureAlerts(Rule{Name: "r", When: config.NotifyDelay, StopID: 1071, RouteID: 6, DirectionID: 1, Delay: 5 * time.Minute}, resp, loc, base)[0]
+	if a.Message != "Now leaving Flinders Street at 08:09 from platform 2." {
+		t.Errorf("message = %q", a.Message)
+	}
+	if want := "r/delay/a/1071/" + strconv.FormatInt(base.Add(2*time.Minute).Unix(), 10); a.Key != want {
+		t.Errorf("key = %q, want %q", a.Key, want)
+	}
+}
+
+// recorder is a sink that remembers what it was sent, failing if asked to.
+type recorder struct {
+	got  []string
+	fail bool
+}
+
+func (r *recorder) Send(ctx context.Context, a Alert) error {
+	if r.fail {
+		return io.ErrUnexpectedEOF
+	}
+	r.got = append(r.got, a.Key)
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	phone, laptop := &recorder{}, &recorder{fail: true}
+	sent := Sent{}
+	n := New(nil, nil, map[string]Sink{"phone": phone, "laptop": laptop}, sent, 10)
+	alerts := []Alert{{Key: "a", Time: base, Sinks: []string{"laptop", "phone"}}}
+
+	count, err := n.Send(context.Background(), alerts)
+	if count != 1 || err == nil {
+		t.Errorf("Send() = %d, %v; want 1 sent and the laptop's error", count, err)
+	}
+	laptop.fail = false
+	later := []Alert{{Key: "a", Time: base.Add(time.Hour), Sinks: []string{"laptop", "phone"}}}
+	if count, err := n.Send(context.Background(), later); count != 1 || err != nil {
+		t.Errorf("second Send() = %d, %v; want just the laptop's retry", count, err)
+	}
+	if len(phone.got) != 1 || len(laptop.got) != 1 {
+		t.Errorf("phone got %v, laptop got %v; want one alert each", phone.got, laptop.got)
+	}
+
+	// Still matching an hour later, so remembered past the first send.
+	sent.Prune(base.Add(time.Minute))
+	if !sent.Has("a", "phone") {
+		t.Error("Prune() forgot an alert that still matches")
+	}
+	sent.Prune(base.Add(2 * time.Hour))
+	if len(sent) != 0 {
+		t.Errorf("Prune() kept %v", sent)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	var req *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		req, body = r, string(b)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "topic not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	a := Alert{Key: "k", Rule: "tram-96", Title: "Tram 96 diverted", Message: "Via Collins St.", URL: "https://ptv.vic.gov.au/d/1", Time: base}
+	tests := []struct {
+		sink  config.NotifySink
+		check func(t *testing.T)
+	}{
+		{config.NotifySink{Type: config.SinkWebhook, URL: srv.URL, Headers: map[string]string{"authorization": "Bearer x"}}, func(t *testing.T) {
+			var got Alert
+			if err := json.Unmarshal([]byte(body), &got); err != nil || got.Title != a.Title || got.Rule != "tram-96" || got.Key != "k" {
+				t.Errorf("webhook body = %s", body)
+			}
+			if req.Header.Get("Authorization") != "Bearer x" || req.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("webhook headers = %v", req.Header)
+			}
+		}},
+		{config.NotifySink{Type: config.SinkSlack, URL: srv.URL}, func(t *testing.T) {
+			var got map[string]string
+			want := "*Tram 96 diverted*\nVia Collins St.\n<https://ptv.vic.gov.au/d/1|More information>"
+			if err := json.Unmarshal([]byte(body), &got); err != nil || got["text"] != want {
+				t.Errorf("slack body = %s, want text %q", body, want)
+			}
+		}},
+		{config.NotifySink{Type: config.SinkNtfy, URL: srv.URL}, func(t *testing.T) {
+			if body != "Via Collins St." || req.Header.Get("Title") != "Tram 96 diverted" || req.Header.Get("Click") != a.URL {
+				t.Errorf("ntfy request = %v %q", req.Header, body)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sink.Type, func(t *testing.T) {
+			s, err := NewSink(tt.sink)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Send(context.Background(), a); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t)
+		})
+	}
+
+	s, _ := NewSink(config.NotifySink{Type: config.SinkNtfy, URL: srv.URL + "/fail"})
+	if err := s.Send(context.Background(), a); err == nil || !strings.Contains(err.Error(), "topic not found") {
+		t.Errorf("Send() to a failing server = %v, want its error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/config"
+)
+
+// sendTimeout bounds each HTTP notification.
+const sendTimeout = 10 * time.Second
+
+// Sink sends alerts somewhere.
+type Sink interface {
+	Send(ctx context.Context, a Alert) error
+}
+
+// NewSink returns the sink configured by s.
+func NewSink(s config.NotifySink) (Sink, error) {
+	switch s.Type {
+	case config.SinkWebhook:
+		return &httpSink{url: s.URL, headers: s.Headers, request: webhookRequest}, nil
+	case config.SinkSlack:
+		return &httpSink{url: s.URL, headers: s.Headers, request: slackRequest}, nil
+	case config.SinkNtfy:
+		return &httpSink{url: s.URL, headers: s.Headers, request: ntfyRequest}, nil
+	case config.SinkDesktop:
+		return desktopSink{}, nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", s.Type)
+}
+
+// httpSink POSTs alerts to a URL in the format made by request.
+type httpSink struct {
+	url     string
+	headers map[string]string
+	request func(ctx context.Context, url string, a Alert) (*http.Request, error)
+}
+
+func (s *httpSink) Send(ctx context.Context, a Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := s.request(ctx, s.url, a)
+	if err != nil {
+		return err
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, url string, v interface{}) (*http.Request, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// webhookRequest posts the alert as JSON.
+func webhookRequest(ctx context.Context, url string, a Alert) (*http.Request, error) {
+	return postJSON(ctx, url, a)
+}
+
+// slackRequest posts the alert as a Slack incoming webhook message, which
+// Mattermost, Discord (with /slack on the URL) and others also accept.
+func slackRequest(ctx context.Context, url string, a Alert) (*http.Request, error) {
+	text := "*" + a.Title + "*\n" + a.Message
+	if a.URL != "" {
+		text += "\n<" + a.URL + "|More information>"
+	}
+	return postJSON(ctx, url, map[string]string{"text": text})
+}
+
+// ntfyRequest posts the alert's message as the body, with its title and
+// link in headers, as ntfy expects.
+func ntfyRequest(ctx context.Context, url string, a Alert) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(a.Message))
+	if err != nil {
+		return nil, err
+	}
+	// Header values must be ASCII; ntfy decodes RFC 2047 encoded words.
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", a.Title))
+	req.Header.Set("Tags", "train")
+	if a.URL != "" {
+		req.Header.Set("Click", a.URL)
+	}
+	return req, nil
+}
+
+// desktopSink shows alerts with notify-send.
+type desktopSink struct{}
+
+func (desktopSink) Send(ctx context.Context, a Alert) error {
+	out, err := exec.CommandContext(ctx, "notify-send", "--app-name=vic-ptv", a.Title, a.Message).CombinedOutput()
+	if err != nil {
+		if len(out) > 0 {
+			return fmt.Errorf("notify-send: %w: %s", err, bytes.TrimSpace(out))
+		}
+		return fmt.Errorf("notify-send: %w", err)
+	}
+	return nil
+}
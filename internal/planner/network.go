@@ -0,0 +1,203 @@
+// Package planner finds journeys over a timetable built from departures and
+// run stopping patterns. PTV's API has no journey planner, so the network
+// is assembled locally and searched with the Connection Scan Algorithm.
+package planner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Stop is a stop in the network.
+type Stop struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Lat       float64 `json:"lat,omitempty"`
+	Lon       float64 `json:"lon,omitempty"`
+	RouteType int     `json:"route_type"`
+}
+
+// Route is a route that connections run on.
+type Route struct {
+	ID     int    `json:"id"`
+	Type   int    `json:"type"`
+	Number string `json:"number,omitempty"`
+	Name   string `json:"name"`
+}
+
+// Connection is a run travelling from one stop to the next without
+// stopping in between.
+type Connection struct {
+	From     int       `json:"from"`
+	To       int       `json:"to"`
+	Depart   time.Time `json:"depart"`
+	Arrive   time.Time `json:"arrive"`
+	Run      string    `json:"run"`
+	RouteID  int       `json:"route_id"`
+	Platform string    `json:"platform,omitempty"`
+}
+
+// Network is a timetable of connections between stops.
+type Network struct {
+	Stops       map[int]Stop  `json:"stops"`
+	Routes      map[int]Route `json:"routes"`
+	Connections []Connection  `json:"connections"`
+
+	// seen indexes Connections by run, stop and time so that a run
+	// fetched twice is only added once. It is rebuilt on demand.
+	seen map[string]bool
+}
+
+// NewNetwork returns an empty network.
+func NewNetwork() *Network {
+	return &Network{Stops: make(map[int]Stop), Routes: make(map[int]Route)}
+}
+
+// AddStop adds a stop, keeping known details of an existing stop that s
+// lacks.
+func (n *Network) AddStop(s Stop) {
+	if old, ok := n.Stops[s.ID]; ok {
+		if s.Name == "" {
+			s.Name = old.Name
+		}
+		if s.Lat == 0 && s.Lon == 0 {
+			s.Lat, s.Lon = old.Lat, old.Lon
+		}
+	}
+	n.Stops[s.ID] = s
+}
+
+// AddRoute adds or replaces a route.
+func (n *Network) AddRoute(r Route) {
+	n.Routes[r.ID] = r
+}
+
+// AddConnection adds a connection unless the same run already has one
+// leaving the same stop at the same time.
+func (n *Network) AddConnection(c Connection) {
+	if n.seen == nil {
+		n.seen = make(map[string]bool, len(n.Connections))
+		for _, old := range n.Connections {
+			n.seen[connectionKey(old)] = true
+		}
+	}
+	key := connectionKey(c)
+	if n.seen[key] {
+		return
+	}
+	n.seen[key] = true
+	n.Connections = append(n.Connections, c)
+}
+
+// connectionKey identifies a connection for de-duplication.
+func connectionKey(c Connection) string {
+	return fmt.Sprintf("%s/%d/%d", c.Run, c.From, c.Depart.Unix())
+}
+
+// Merge adds all of o's stops, routes and connections to n.
+func (n *Network) Merge(o *Network) {
+	for _, s := range o.Stops {
+		n.AddStop(s)
+	}
+	for _, r := range o.Routes {
+		n.AddRoute(r)
+	}
+	for _, c := range o.Connections {
+		n.AddConnection(c)
+	}
+}
+
+// Prune drops connections that arrive before t, so a cached network does
+// not grow without bound.
+func (n *Network) Prune(t time.Time) {
+	kept := n.Connections[:0]
+	for _, c := range n.Connections {
+		if !c.Arrive.Before(t) {
+			kept = append(kept, c)
+		}
+	}
+	n.Connections = kept
+	n.seen = nil
+}
+
+// Span returns the earliest departure and latest arrival in the network,
+// or zero times if it has no connections.
+func (n *Network) Span() (time.Time, time.Time) {
+	var first, last time.Time
+	for _, c := range n.Connections {
+		if first.IsZero() || c.Depart.Before(first) {
+			first = c.Depart
+		}
+		if c.Arrive.After(last) {
+			last = c.Arrive
+		}
+	}
+	return first, last
+}
+
+// StopName returns the name of a stop, or its ID if the name is unknown.
+func (n *Network) StopName(id int) string {
+	if s, ok := n.Stops[id]; ok && s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("Stop %d", id)
+}
+
+// footpath is a walk from one stop to a nearby one.
+type footpath struct {
+	to       int
+	duration int64 // seconds
+	distance float64
+}
+
+// footpaths finds walks of up to maxWalk metres between stops with known
+// locations, at speed metres per second.
+func (n *Network) footpaths(maxWalk, speed float64) map[int][]footpath {
+	paths := make(map[int][]footpath)
+	if maxWalk <= 0 || speed <= 0 {
+		return paths
+	}
+
+	var located []Stop
+	for _, s := range n.Stops {
+		if s.Lat != 0 || s.Lon != 0 {
+			located = append(located, s)
+		}
+	}
+	sort.Slice(located, func(i, j int) bool { return located[i].Lat < located[j].Lat })
+
+	// Sweep in latitude order, only comparing stops close enough north to
+	// south to possibly be in range.
+	maxLat := maxWalk / metresPerDegree
+	for i, a := range located {
+		for _, b := range located[i+1:] {
+			if b.Lat-a.Lat > maxLat {
+				break
+			}
+			d := distance(a.Lat, a.Lon, b.Lat, b.Lon)
+			if d > maxWalk {
+				continue
+			}
+			dur := int64(math.Ceil(d / speed))
+			paths[a.ID] = append(paths[a.ID], footpath{to: b.ID, duration: dur, distance: d})
+			paths[b.ID] = append(paths[b.ID], footpath{to: a.ID, duration: dur, distance: d})
+		}
+	}
+	return paths
+}
+
+// metresPerDegree is the length of a degree of latitude.
+const metresPerDegree = 111_320
+
+// distance returns the great-circle distance in metres between two points.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6_371_000
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
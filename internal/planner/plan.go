@@ -0,0 +1,343 @@
+package planner
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Options tune the journey search.
+type Options struct {
+	// TransferPenalty is the minimum time allowed to change between
+	// services, on top of any walking.
+	TransferPenalty time.Duration
+	// MaxWalk is the furthest walk, in metres, between nearby stops.
+	MaxWalk float64
+	// WalkSpeed is the walking speed in metres per second.
+	WalkSpeed float64
+	// Count is how many itineraries to return.
+	Count int
+}
+
+// DefaultOptions returns the options used when none are given.
+func DefaultOptions() Options {
+	return Options{
+		TransferPenalty: 3 * time.Minute,
+		MaxWalk:         400,
+		WalkSpeed:       1.2,
+		Count:           3,
+	}
+}
+
+// Leg is one part of an itinerary: a ride on a run, or a walk.
+type Leg struct {
+	Walk     bool      `json:"walk,omitempty"`
+	From     int       `json:"from"`
+	To       int       `json:"to"`
+	Depart   time.Time `json:"depart"`
+	Arrive   time.Time `json:"arrive"`
+	Run      string    `json:"run,omitempty"`
+	RouteID  int       `json:"route_id,omitempty"`
+	Platform string    `json:"platform,omitempty"`
+	// Distance is the length of a walk in metres.
+	Distance float64 `json:"distance,omitempty"`
+}
+
+// Itinerary is a journey from origin to destination.
+type Itinerary struct {
+	Legs []Leg `json:"legs"`
+}
+
+// Depart returns when the itinerary leaves the origin.
+func (it Itinerary) Depart() time.Time {
+	return it.Legs[0].Depart
+}
+
+// Arrive returns when the itinerary reaches the destination.
+func (it Itinerary) Arrive() time.Time {
+	return it.Legs[len(it.Legs)-1].Arrive
+}
+
+// Transfers returns the number of changes between services.
+func (it Itinerary) Transfers() int {
+	if r := it.rides(); r > 0 {
+		return r - 1
+	}
+	return 0
+}
+
+// rides returns the number of legs on a service.
+func (it Itinerary) rides() int {
+	rides := 0
+	for _, l := range it.Legs {
+		if !l.Walk {
+			rides++
+		}
+	}
+	return rides
+}
+
+// DepartAt finds itineraries from any of the origin stops to any of the
+// destination stops leaving at or after t, earliest arrival first. Later
+// itineraries are only included if they arrive later too.
+func DepartAt(n *Network, from, to []int, t time.Time, opts Options) []Itinerary {
+	g := newGraph(n, opts, false)
+	var its []Itinerary
+	for len(its) < opts.Count {
+		it, ok := g.search(from, to, t.Unix())
+		if !ok {
+			break
+		}
+		// A later departure arriving at the same time is better.
+		if k := len(its) - 1; k >= 0 && it.Arrive().Equal(its[k].Arrive()) {
+			its[k] = it
+		} else {
+			its = append(its, it)
+		}
+		if it.rides() == 0 {
+			// Walking can start at any time; one answer is enough.
+			break
+		}
+		t = it.Depart().Add(time.Second)
+	}
+	return its
+}
+
+// ArriveBy finds itineraries from the origin stops to the destination stops
+// arriving at or before t, latest departure first, returned in departure
+// order.
+func ArriveBy(n *Network, from, to []int, t time.Time, opts Options) []Itinerary {
+	// Searching the network with time reversed finds latest departures
+	// with the same algorithm.
+	g := newGraph(n, opts, true)
+	var its []Itinerary
+	for len(its) < opts.Count {
+		it, ok := g.search(to, from, -t.Unix())
+		if !ok {
+			break
+		}
+		if k := len(its) - 1; k >= 0 && it.Depart().Equal(its[k].Depart()) {
+			its[k] = it
+		} else {
+			its = append(its, it)
+		}
+		if it.rides() == 0 {
+			break
+		}
+		t = it.Arrive().Add(-time.Second)
+	}
+	sort.Slice(its, func(i, j int) bool { return its[i].Depart().Before(its[j].Depart()) })
+	return its
+}
+
+// conn is a connection in search form, with times as Unix seconds (negated
+// when searching in reverse) and runs numbered.
+type conn struct {
+	from, to int
+	dep, arr int64
+	trip     int
+	src      int // index into Network.Connections
+}
+
+// graph is a network prepared for searching.
+type graph struct {
+	n       *Network
+	reverse bool
+	conns   []conn
+	trips   int
+	foot    map[int][]footpath
+	penalty int64
+}
+
+// newGraph prepares n for searching. A reverse graph has every connection
+// flipped in space and time, so that a forward search over it from the
+// destination finds the latest departures from the origin.
+func newGraph(n *Network, opts Options, reverse bool) *graph {
+	g := &graph{
+		n:       n,
+		reverse: reverse,
+		foot:    n.footpaths(opts.MaxWalk, opts.WalkSpeed),
+		penalty: int64(opts.TransferPenalty / time.Second),
+	}
+	trips := make(map[string]int)
+	for i, c := range n.Connections {
+		id, ok := trips[c.Run]
+		if !ok {
+			id = len(trips)
+			trips[c.Run] = id
+		}
+		sc := conn{from: c.From, to: c.To, dep: c.Depart.Unix(), arr: c.Arrive.Unix(), trip: id, src: i}
+		if reverse {
+			sc = conn{from: c.To, to: c.From, dep: -c.Arrive.Unix(), arr: -c.Depart.Unix(), trip: id, src: i}
+		}
+		g.conns = append(g.conns, sc)
+	}
+	g.trips = len(trips)
+	sort.SliceStable(g.conns, func(i, j int) bool {
+		if g.conns[i].dep != g.conns[j].dep {
+			return g.conns[i].dep < g.conns[j].dep
+		}
+		return g.conns[i].arr < g.conns[j].arr
+	})
+	return g
+}
+
+// hop records how a stop was reached: by riding a trip from connection
+// board to connection alight, or by walking from another stop.
+type hop struct {
+	walk          bool
+	board, alight int
+	walkFrom      int
+	walkPath      footpath
+}
+
+// search runs the Connection Scan Algorithm from the source stops at time
+// t, returning the itinerary that reaches a target stop soonest.
+func (g *graph) search(sources, targets []int, t int64) (Itinerary, bool) {
+	const never = math.MaxInt64
+	arrival := make(map[int]int64)
+	ready := make(map[int]int64)
+	hops := make(map[int]hop)
+	get := func(m map[int]int64, s int) int64 {
+		if v, ok := m[s]; ok {
+			return v
+		}
+		return never
+	}
+
+	isTarget := make(map[int]bool, len(targets))
+	for _, s := range targets {
+		isTarget[s] = true
+	}
+	best, bestStop := int64(never), -1
+	reach := func(s int, at int64, h hop, boarding bool) {
+		if at >= get(arrival, s) {
+			return
+		}
+		arrival[s] = at
+		ready[s] = at
+		if !boarding {
+			ready[s] = at + g.penalty
+		}
+		hops[s] = h
+		if isTarget[s] && at < best {
+			best, bestStop = at, s
+		}
+	}
+
+	// No transfer penalty applies before the first service.
+	isSource := make(map[int]bool, len(sources))
+	for _, s := range sources {
+		isSource[s] = true
+		arrival[s], ready[s] = t, t
+		if isTarget[s] {
+			return Itinerary{}, false
+		}
+	}
+	for _, s := range sources {
+		for _, fp := range g.foot[s] {
+			if !isSource[fp.to] {
+				reach(fp.to, t+fp.duration, hop{walk: true, walkFrom: s, walkPath: fp}, true)
+			}
+		}
+	}
+
+	boarded := make([]int, g.trips)
+	for i := range boarded {
+		boarded[i] = -1
+	}
+	start := sort.Search(len(g.conns), func(i int) bool { return g.conns[i].dep >= t })
+	for i := start; i < len(g.conns); i++ {
+		c := g.conns[i]
+		if c.dep >= best {
+			break
+		}
+		if boarded[c.trip] < 0 {
+			if get(ready, c.from) > c.dep {
+				continue
+			}
+			boarded[c.trip] = i
+		}
+		if c.arr >= get(arrival, c.to) {
+			continue
+		}
+		reach(c.to, c.arr, hop{board: boarded[c.trip], alight: i}, false)
+		for _, fp := range g.foot[c.to] {
+			reach(fp.to, c.arr+fp.duration, hop{walk: true, walkFrom: c.to, walkPath: fp}, false)
+		}
+	}
+	if bestStop < 0 {
+		return Itinerary{}, false
+	}
+	return g.itinerary(bestStop, hops, isSource, t), true
+}
+
+// itinerary follows hops back from stop to a source and builds the
+// itinerary in real time order. t is the search time, used to place an
+// itinerary that is only a walk.
+func (g *graph) itinerary(stop int, hops map[int]hop, isSource map[int]bool, t int64) Itinerary {
+	var legs []Leg
+	// Each hop moves strictly back in time, so this terminates; the bound
+	// guards against a malformed network with zero-length connections.
+	for steps := 0; !isSource[stop] && steps < len(hops); steps++ {
+		h := hops[stop]
+		if h.walk {
+			legs = append(legs, Leg{Walk: true, From: h.walkFrom, To: stop, Distance: h.walkPath.distance,
+				Depart: time.Unix(0, 0), Arrive: time.Unix(h.walkPath.duration, 0)})
+			stop = h.walkFrom
+			continue
+		}
+		first, last := g.n.Connections[g.conns[h.board].src], g.n.Connections[g.conns[h.alight].src]
+		if g.reverse {
+			first, last = last, first
+		}
+		legs = append(legs, Leg{From: first.From, To: last.To, Depart: first.Depart, Arrive: last.Arrive,
+			Run: first.Run, RouteID: first.RouteID, Platform: first.Platform})
+		stop = g.conns[h.board].from
+	}
+
+	if g.reverse {
+		// Legs were found destination first, each running backwards.
+		for i := range legs {
+			if legs[i].Walk {
+				legs[i].From, legs[i].To = legs[i].To, legs[i].From
+			}
+		}
+	} else {
+		for i, j := 0, len(legs)-1; i < j; i, j = i+1, j-1 {
+			legs[i], legs[j] = legs[j], legs[i]
+		}
+	}
+	if len(legs) == 1 && legs[0].Walk {
+		dur := legs[0].Arrive.Sub(legs[0].Depart)
+		if g.reverse {
+			legs[0].Arrive = time.Unix(-t, 0)
+			legs[0].Depart = legs[0].Arrive.Add(-dur)
+		} else {
+			legs[0].Depart = time.Unix(t, 0)
+			legs[0].Arrive = legs[0].Depart.Add(dur)
+		}
+	}
+	placeWalks(legs)
+	return Itinerary{Legs: legs}
+}
+
+// placeWalks sets the times of walking legs, which hold only their
+// duration until now. A walk at the start ends as the first service leaves;
+// any other walk starts when the previous leg arrives.
+func placeWalks(legs []Leg) {
+	for i := range legs {
+		if !legs[i].Walk {
+			continue
+		}
+		dur := legs[i].Arrive.Sub(legs[i].Depart)
+		switch {
+		case i > 0:
+			legs[i].Depart = legs[i-1].Arrive
+			legs[i].Arrive = legs[i].Depart.Add(dur)
+		case len(legs) > 1:
+			legs[i].Arrive = legs[1].Depart
+			legs[i].Depart = legs[i].Arrive.Add(-dur)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package planner
+
+import (
+	"testing"
+	"time"
+)
+
+// testNetwork builds a small network: a tram from stop 1 via 2 to stop 3,
+// whose stop is a short walk from train stop 4, and a train from 4 to 5.
+// A slow bus runs direct from 1 to 5.
+func testNetwork() (*Network, func(int) time.Time) {
+	base := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+
+	n := NewNetwork()
+	n.AddStop(Stop{ID: 1, Name: "Home", Lat: -37.80, Lon: 144.96})
+	n.AddStop(Stop{ID: 2, Name: "Middle", Lat: -37.81, Lon: 144.96})
+	n.AddStop(Stop{ID: 3, Name: "Tram Terminus", Lat: -37.8180, Lon: 144.9670})
+	n.AddStop(Stop{ID: 4, Name: "Station", Lat: -37.8183, Lon: 144.9671})
+	n.AddStop(Stop{ID: 5, Name: "Work", Lat: -37.90, Lon: 145.00})
+
+	tram := func(run string, m int) {
+		n.AddConnection(Connection{From: 1, To: 2, Depart: at(m), Arrive: at(m + 5), Run: run, RouteID: 96})
+		n.AddConnection(Connection{From: 2, To: 3, Depart: at(m + 5), Arrive: at(m + 10), Run: run, RouteID: 96})
+	}
+	train := func(run string, m int) {
+		n.AddConnection(Connection{From: 4, To: 5, Depart: at(m), Arrive: at(m + 10), Run: run, RouteID: 6, Platform: "3"})
+	}
+	tram("tram-a", 0)
+	tram("tram-b", 10)
+	tram("tram-c", 20)
+	train("train-a", 14)
+	train("train-b", 24)
+	train("train-c", 34)
+	n.AddConnection(Connection{From: 1, To: 5, Depart: at(5), Arrive: at(60), Run: "bus", RouteID: 900})
+	return n, at
+}
+
+func TestDepartAt(t *testing.T) {
+	n, at := testNetwork()
+	opts := DefaultOptions()
+
+	its := DepartAt(n, []int{1}, []int{5}, at(0), opts)
+	if len(its) != 3 {
+		t.Fatalf("got %d itineraries, want 3", len(its))
+	}
+	// Tram a reaches stop 3 at 08:10; walking and the 3 minute penalty
+	// make train a at 08:14 the first that can be caught.
+	wantDepart := []int{0, 10, 20}
+	wantArrive := []int{24, 34, 44}
+	for i, it := range its {
+		if !it.Depart().Equal(at(wantDepart[i])) || !it.Arrive().Equal(at(wantArrive[i])) {
+			t.Errorf("itinerary %d: %s-%s, want %s-%s", i,
+				it.Depart().Format("15:04"), it.Arrive().Format("15:04"),
+				at(wantDepart[i]).Format("15:04"), at(wantArrive[i]).Format("15:04"))
+		}
+	}
+
+	legs := its[0].Legs
+	if len(legs) != 3 || legs[0].Walk || !legs[1].Walk || legs[2].Walk {
+		t.Fatalf("legs = %+v, want ride, walk, ride", legs)
+	}
+	if legs[0].From != 1 || legs[0].To != 3 || legs[0].Run != "tram-a" {
+		t.Errorf("first leg = %+v, want tram-a from 1 to 3", legs[0])
+	}
+	if legs[1].From != 3 || legs[1].To != 4 || !legs[1].Depart.Equal(at(10)) {
+		t.Errorf("walk leg = %+v, want 3 to 4 from 08:10", legs[1])
+	}
+	if legs[2].Platform != "3" || legs[2].Run != "train-a" {
+		t.Errorf("last leg = %+v, want train-a from platform 3", legs[2])
+	}
+	if its[0].Transfers() != 1 {
+		t.Errorf("Transfers() = %d, want 1", its[0].Transfers())
+	}
+}
+
+func TestDepartAtTransferPenalty(t *testing.T) {
+	n, at := testNetwork()
+	opts := DefaultOptions()
+	opts.TransferPenalty = 5 * time.Minute
+
+	its := DepartAt(n, []int{1}, []int{5}, at(0), opts)
+	if len(its) == 0 {
+		t.Fatal("no itineraries found")
+	}
+	// Tram a now misses train a and waits for train b; tram b arrives
+	// too late for it.
+	if !its[0].Depart().Equal(at(0)) || !its[0].Arrive().Equal(at(34)) {
+		t.Errorf("first itinerary %s-%s, want 08:00-08:34",
+			its[0].Depart().Format("15:04"), its[0].Arrive().Format("15:04"))
+	}
+	if its[0].Legs[2].Run != "train-b" {
+		t.Errorf("first itinerary takes %s, want train-b", its[0].Legs[2].Run)
+	}
+}
+
+func TestDepartAtNoWalking(t *testing.T) {
+	n, at := testNetwork()
+	opts := DefaultOptions()
+	opts.MaxWalk = 0
+
+	its := DepartAt(n, []int{1}, []int{5}, at(0), opts)
+	if len(its) != 1 || its[0].Legs[0].Run != "bus" {
+		t.Fatalf("got %+v, want only the direct bus", its)
+	}
+}
+
+func TestArriveBy(t *testing.T) {
+	n, at := testNetwork()
+	opts := DefaultOptions()
+	opts.Count = 2
+
+	its := ArriveBy(n, []int{1}, []int{5}, at(40), opts)
+	if len(its) != 2 {
+		t.Fatalf("got %d itineraries, want 2", len(its))
+	}
+	wantDepart := []int{0, 10}
+	for i, it := range its {
+		if !it.Depart().Equal(at(wantDepart[i])) {
+			t.Errorf("itinerary %d departs %s, want %s", i, it.Depart().Format("15:04"), at(wantDepart[i]).Format("15:04"))
+		}
+		if it.Arrive().After(at(40)) {
+			t.Errorf("itinerary %d arrives %s, after 08:40", i, it.Arrive().Format("15:04"))
+		}
+	}
+	legs := its[1].Legs
+	if len(legs) != 3 || legs[0].From != 1 || legs[0].To != 3 || !legs[1].Walk || legs[1].From != 3 || legs[1].To != 4 || legs[2].To != 5 {
+		t.Errorf("legs = %+v, want tram 1-3, walk 3-4, train 4-5", legs)
+	}
+}
+
+func TestNetworkDeduplicatesAndPrunes(t *testing.T) {
+	n, at := testNetwork()
+	count := len(n.Connections)
+
+	other, _ := testNetwork()
+	n.Merge(other)
+	if len(n.Connections) != count {
+		t.Errorf("merging a copy left %d connections, want %d", len(n.Connections), count)
+	}
+
+	n.Prune(at(30))
+	for _, c := range n.Connections {
+		if c.Arrive.Before(at(30)) {
+			t.Errorf("connection arriving %s survived pruning", c.Arrive.Format("15:04"))
+		}
+	}
+}
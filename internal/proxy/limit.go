@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errRateLimited is returned when an upstream call would wait longer than
+// the limiter allows.
+var errRateLimited = errors.New("too many upstream requests; try again shortly")
+
+// ttlCache holds upstream responses until they expire.
+type ttlCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newTTLCache() *ttlCache {
+	return &ttlCache{entries: make(map[string]cacheEntry), now: time.Now}
+}
+
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// set stores value for ttl, dropping expired entries so the cache only
+// holds what is still live.
+func (c *ttlCache) set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+// limiter is a token bucket limiting upstream requests to rate per second,
+// with bursts of up to burst.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	maxWait time.Duration
+	now     func() time.Time
+}
+
+func newLimiter(rate float64, burst int, maxWait time.Duration) *limiter {
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), maxWait: maxWait, now: time.Now}
+}
+
+// reserve takes a token, returning how long to wait before using it. It
+// takes nothing and fails if the wait would exceed maxWait.
+func (l *limiter) reserve() (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	wait := time.Duration(0)
+	if l.tokens < 1 {
+		wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	if wait > l.maxWait {
+		return 0, errRateLimited
+	}
+	l.tokens--
+	return wait, nil
+}
+
+// wait blocks until an upstream request may be made.
+func (l *limiter) wait(ctx context.Context) error {
+	d, err := l.reserve()
+	if err != nil || d == 0 {
+		return err
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
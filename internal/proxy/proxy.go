@@ -0,0 +1,558 @@
+// Package proxy serves PTV data over an unsigned JSON API, so other
+// applications can use it without being given the API credentials. Upstream
+// requests are signed by the api.Client, cached and rate limited.
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/ical"
+)
+
+// How long upstream responses are reused. Realtime data is kept briefly;
+// the network's shape changes rarely.
+const (
+	realtimeTTL = 20 * time.Second
+	alertsTTL   = time.Minute
+	staticTTL   = time.Hour
+	stopTypeTTL = 24 * time.Hour
+)
+
+// maxDepartures caps the limit a client may ask for.
+const maxDepartures = 50
+
+// allRouteTypes are the route types probed when a stop's modes are not given.
+var allRouteTypes = []int{0, 1, 2, 3, 4}
+
+// Options configure a Server.
+type Options struct {
+	// Tokens maps client names to the tokens they authenticate with. With
+	// no tokens, every request is allowed.
+	Tokens map[string]string
+	// AllowOrigins are the origins browsers may call from; "*" allows any.
+	AllowOrigins []string
+	// Rate and Burst limit upstream requests per second.
+	Rate  float64
+	Burst int
+	// MaxWait is the longest a request waits for the rate limiter before
+	// failing with 503.
+	MaxWait time.Duration
+	// Logger receives a line per request, or nothing if nil.
+	Logger *log.Logger
+}
+
+// Server is an http.Handler answering from the PTV API.
+type Server struct {
+	client *api.Client
+	opts   Options
+	cache  *ttlCache
+	limit  *limiter
+	mux    *http.ServeMux
+}
+
+// New returns a Server fetching from client.
+func New(client *api.Client, opts Options) *Server {
+	s := &Server{
+		client: client,
+		opts:   opts,
+		cache:  newTTLCache(),
+		limit:  newLimiter(opts.Rate, opts.Burst, opts.MaxWait),
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	s.mux.HandleFunc("GET /search", s.search)
+	s.mux.HandleFunc("GET /departures/{stop}", s.departures)
+	s.mux.HandleFunc("GET /stops/{stop}", s.stop)
+	s.mux.HandleFunc("GET /routes", s.routes)
+	s.mux.HandleFunc("GET /routes/{route}", s.route)
+	s.mux.HandleFunc("GET /disruptions", s.disruptions)
+	s.mux.HandleFunc("GET /disruptions/{id}", s.disruption)
+	s.mux.HandleFunc("GET /fare", s.fare)
+	s.mux.HandleFunc("GET /route-types", s.routeTypes)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	})
+	return s
+}
+
+// ServeHTTP applies CORS and authentication, then routes the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	client := s.serve(rec, r)
+	if s.opts.Logger != nil {
+		s.opts.Logger.Printf("%s %s %s %d %s", client, r.Method, loggedURI(r.URL), rec.status, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// loggedURI returns the request URI with any ?token= masked, so that the
+// access log does not collect clients' tokens.
+func loggedURI(u *url.URL) string {
+	q := u.Query()
+	if !q.Has("token") {
+		return u.RequestURI()
+	}
+	q.Set("token", "REDACTED")
+	return u.EscapedPath() + "?" + q.Encode()
+}
+
+// serve handles a request, returning the name of the authenticated client
+// for logging.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) string {
+	s.cors(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return "-"
+	}
+	if r.URL.Path == "/healthz" {
+		s.mux.ServeHTTP(w, r)
+		return "-"
+	}
+	client, ok := s.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="vic-ptv"`)
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return "-"
+	}
+	s.mux.ServeHTTP(w, r)
+	return client
+}
+
+// cors sets the CORS headers for an allowed origin.
+func (s *Server) cors(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	switch {
+	case slices.Contains(s.opts.AllowOrigins, "*"):
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case slices.Contains(s.opts.AllowOrigins, origin):
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	default:
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+	w.Header().Set("Access-Control-Max-Age", "3600")
+}
+
+// authenticate returns the name of the client whose token the request
+// carries, as "Authorization: Bearer <token>" or "?token=<token>".
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	if len(s.opts.Tokens) == 0 {
+		return "anonymous", true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return "", false
+	}
+	for name, t := range s.opts.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// fetch returns the cached result for key, or calls fn once the rate
+// limiter allows and caches its result for ttl.
+func fetch[T any](s *Server, ctx context.Context, key string, ttl time.Duration, fn func() (T, error)) (T, error) {
+	if v, ok := s.cache.get(key); ok {
+		return v.(T), nil
+	}
+	var zero T
+	if err := s.limit.wait(ctx); err != nil {
+		return zero, err
+	}
+	v, err := fn()
+	if err != nil {
+		return zero, err
+	}
+	s.cache.set(key, v, ttl)
+	return v, nil
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "missing search term ?q=")
+		return
+	}
+	routeTypes, err := intList(r, "route_types")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key := fmt.Sprintf("search/%s/%v", strings.ToLower(q), routeTypes)
+	resp, err := fetch(s, r.Context(), key, staticTTL, func() (*api.SearchResponse, error) {
+		return s.client.Search(q, routeTypes)
+	})
+	s.respond(w, resp, err)
+}
+
+func (s *Server) departures(w http.ResponseWriter, r *http.Request) {
+	stopID, err := pathID(r, "stop")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	routeID, err1 := intParam(r, "route", 0)
+	directionID, err2 := intParam(r, "direction", 0)
+	limit, err3 := intParam(r, "limit", 5)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if limit < 1 || limit > maxDepartures {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxDepartures))
+		return
+	}
+	routeTypes, err := s.stopRouteTypes(r, stopID)
+	if err != nil {
+		s.respond(w, nil, err)
+		return
+	}
+
+	resps := make([]*api.DeparturesResponse, len(routeTypes))
+	errs := make([]error, len(routeTypes))
+	var wg sync.WaitGroup
+	for i, rt := range routeTypes {
+		wg.Add(1)
+		go func(i, rt int) {
+			defer wg.Done()
+			key := fmt.Sprintf("departures/%d/%d/%d/%d/%d", rt, stopID, routeID, directionID, limit)
+			resps[i], errs[i] = fetch(s, r.Context(), key, realtimeTTL, func() (*api.DeparturesResponse, error) {
+				return s.client.RouteDepartures(rt, stopID, routeID, directionID, limit)
+			})
+		}(i, rt)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		s.respond(w, nil, err)
+		return
+	}
+	merged := api.MergeDepartures(resps...)
+	if len(merged.Departures) > limit {
+		merged.Departures = merged.Departures[:limit]
+	}
+	if wantICS(r) {
+		name := "Departures"
+		if st, ok := merged.Stops[strconv.Itoa(stopID)]; ok && st.StopName != "" {
+			name += " from " + st.StopName
+		}
+		writeICS(w, name, ical.DepartureEvents(merged))
+		return
+	}
+	s.respond(w, merged, nil)
+}
+
+func (s *Server) stop(w http.ResponseWriter, r *http.Request) {
+	stopID, err := pathID(r, "stop")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	routeTypes, err := s.stopRouteTypes(r, stopID)
+	if err != nil {
+		s.respond(w, nil, err)
+		return
+	}
+	var stops []api.StopDetails
+	for _, rt := range routeTypes {
+		resp, err := s.stopDetails(r.Context(), stopID, rt)
+		if err != nil {
+			s.respond(w, nil, err)
+			return
+		}
+		stops = append(stops, resp.Stop)
+	}
+	s.respond(w, map[string]interface{}{"stops": stops}, nil)
+}
+
+func (s *Server) stopDetails(ctx context.Context, stopID, routeType int) (*api.StopResponse, error) {
+	return fetch(s, ctx, fmt.Sprintf("stop/%d/%d", stopID, routeType), staticTTL, func() (*api.StopResponse, error) {
+		return s.client.Stop(stopID, routeType)
+	})
+}
+
+// stopRouteTypes returns the ?route_type= of the request, or the route types
+// serving the stop, found by looking the stop up under each.
+func (s *Server) stopRouteTypes(r *http.Request, stopID int) ([]int, error) {
+	if r.URL.Query().Has("route_type") {
+		rt, err := intParam(r, "route_type", 0)
+		if err != nil {
+			return nil, &api.APIError{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		return []int{rt}, nil
+	}
+	key := fmt.Sprintf("stop-route-types/%d", stopID)
+	if v, ok := s.cache.get(key); ok {
+		return v.([]int), nil
+	}
+
+	served := make([]bool, len(allRouteTypes))
+	errs := make([]error, len(allRouteTypes))
+	var wg sync.WaitGroup
+	for i, rt := range allRouteTypes {
+		wg.Add(1)
+		go func(i, rt int) {
+			defer wg.Done()
+			resp, err := s.stopDetails(r.Context(), stopID, rt)
+			var apiErr *api.APIError
+			switch {
+			case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusNotFound):
+				// Not a stop for this route type.
+			case err != nil:
+				errs[i] = err
+			default:
+				served[i] = resp.Stop.StopID == stopID && resp.Stop.StopName != ""
+			}
+		}(i, rt)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	var routeTypes []int
+	for i, rt := range allRouteTypes {
+		if served[i] {
+			routeTypes = append(routeTypes, rt)
+		}
+	}
+	if len(routeTypes) == 0 {
+		return nil, &api.APIError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("no stop %d", stopID)}
+	}
+	s.cache.set(key, routeTypes, stopTypeTTL)
+	return routeTypes, nil
+}
+
+func (s *Server) routes(w http.ResponseWriter, r *http.Request) {
+	routeTypes, err := intList(r, "route_types")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := fetch(s, r.Context(), fmt.Sprintf("routes/%v", routeTypes), staticTTL, func() (*api.RoutesResponse, error) {
+		return s.client.Routes(routeTypes)
+	})
+	s.respond(w, resp, err)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	routeID, err := pathID(r, "route")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := fetch(s, r.Context(), fmt.Sprintf("route/%d", routeID), staticTTL, func() (*api.RouteResponse, error) {
+		return s.client.Route(routeID)
+	})
+	s.respond(w, resp, err)
+}
+
+// disruptions lists disruptions as one flat list, optionally filtered by
+// ?route= or ?stop=, or with ?format=ics as a calendar.
+func (s *Server) disruptions(w http.ResponseWriter, r *http.Request) {
+	routeID, err1 := intParam(r, "route", 0)
+	stopID, err2 := intParam(r, "stop", 0)
+	if err := errors.Join(err1, err2); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if routeID > 0 && stopID > 0 {
+		writeError(w, http.StatusBadRequest, "use only one of route and stop")
+		return
+	}
+	key := fmt.Sprintf("disruptions/%d/%d", routeID, stopID)
+	resp, err := fetch(s, r.Context(), key, alertsTTL, func() (*api.DisruptionsResponse, error) {
+		switch {
+		case routeID > 0:
+			return s.client.DisruptionsByRoute(routeID)
+		case stopID > 0:
+			return s.client.DisruptionsByStop(stopID)
+		}
+		return s.client.Disruptions()
+	})
+	if err != nil {
+		s.respond(w, nil, err)
+		return
+	}
+	disruptions := resp.Disruptions.AllDisruptions()
+	if wantICS(r) {
+		writeICS(w, "PTV disruptions", ical.DisruptionEvents(disruptions))
+		return
+	}
+	if disruptions == nil {
+		disruptions = []api.Disruption{}
+	}
+	s.respond(w, map[string]interface{}{"disruptions": disruptions}, nil)
+}
+
+func (s *Server) disruption(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Look the disruption up in the network-wide list, sharing its cache.
+	resp, err := fetch(s, r.Context(), "disruptions/0/0", alertsTTL, func() (*api.DisruptionsResponse, error) {
+		return s.client.Disruptions()
+	})
+	if err != nil {
+		s.respond(w, nil, err)
+		return
+	}
+	for _, d := range resp.Disruptions.AllDisruptions() {
+		if d.DisruptionID == id {
+			s.respond(w, map[string]interface{}{"disruption": d}, nil)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("no current or planned disruption %d", id))
+}
+
+func (s *Server) fare(w http.ResponseWriter, r *http.Request) {
+	minZone, err1 := intParam(r, "min_zone", 0)
+	maxZone, err2 := intParam(r, "max_zone", 0)
+	if err := errors.Join(err1, err2); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if minZone < 1 || maxZone < minZone {
+		writeError(w, http.StatusBadRequest, "min_zone and max_zone are required, with min_zone <= max_zone")
+		return
+	}
+	resp, err := fetch(s, r.Context(), fmt.Sprintf("fare/%d/%d", minZone, maxZone), staticTTL, func() (*api.FareEstimateResponse, error) {
+		return s.client.FareEstimate(minZone, maxZone)
+	})
+	s.respond(w, resp, err)
+}
+
+func (s *Server) routeTypes(w http.ResponseWriter, r *http.Request) {
+	resp, err := fetch(s, r.Context(), "route-types", staticTTL, func() (*api.RouteTypesResponse, error) {
+		return s.client.RouteTypes()
+	})
+	s.respond(w, resp, err)
+}
+
+// respond writes v, or the error. API errors keep their client-side
+// statuses; other upstream failures are logged and reported to the client
+// only as a 502, as their text describes the upstream request.
+func (s *Server) respond(w http.ResponseWriter, v interface{}, err error) {
+	var apiErr *api.APIError
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, v)
+	case errors.Is(err, errRateLimited):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, "request cancelled")
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden:
+		// The proxy's own credentials were refused; that is not the
+		// client's fault.
+		writeError(w, http.StatusBadGateway, "upstream refused the proxy's credentials")
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500:
+		writeError(w, apiErr.StatusCode, apiErr.Message)
+	default:
+		if s.opts.Logger != nil {
+			s.opts.Logger.Printf("upstream error: %v", err)
+		}
+		writeError(w, http.StatusBadGateway, "upstream request failed")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// wantICS reports whether the request asks for an iCalendar feed with
+// ?format=ics.
+func wantICS(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "ics"
+}
+
+func writeICS(w http.ResponseWriter, name string, events []ical.Event) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	ical.Write(w, name, events, time.Now())
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{"error": msg, "status": status})
+}
+
+// pathID parses a numeric path value.
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("%s must be a numeric ID (use /search to find one)", name)
+	}
+	return id, nil
+}
+
+// intParam parses an integer query parameter, returning def if absent.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+// intList parses a comma-separated list of integers, which may also be
+// given as repeated parameters.
+func intList(r *http.Request, name string) ([]int, error) {
+	var out []int
+	for _, v := range r.URL.Query()[name] {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", name, s)
+			}
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// statusRecorder captures the status written, for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
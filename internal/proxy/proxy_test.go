@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// upstream fakes the PTV API: stop 1071 is a train and tram stop, and
+// every request is counted by path.
+type upstream struct {
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.hits[r.URL.Path]++
+	u.mu.Unlock()
+
+	if r.URL.Query().Get("devid") == "" || r.URL.Query().Get("signature") == "" {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v3/stops/1071/route_type/0", r.URL.Path == "/v3/stops/1071/route_type/1":
+		w.Write([]byte(`{"stop":{"stop_id":1071,"stop_name":"Flinders Street"}}`))
+	case strings.HasPrefix(r.URL.Path, "/v3/stops/"):
+		http.Error(w, "not found", http.StatusNotFound)
+	case r.URL.Path == "/v3/departures/route_type/0/stop/1071":
+		w.Write([]byte(`{"departures":[{"stop_id":1071,"run_ref":"train","scheduled_departure_utc":"2024-01-15T21:05:00Z"}]}`))
+	case r.URL.Path == "/v3/departures/route_type/1/stop/1071":
+		w.Write([]byte(`{"departures":[{"stop_id":1071,"run_ref":"tram","scheduled_departure_utc":"2024-01-15T21:01:00Z"}]}`))
+	case r.URL.Path == "/v3/disruptions":
+		w.Write([]byte(`{"disruptions":{"metro_train":[{"disruption_id":1,"title":"Buses replace trains","from_date":"2024-01-20T00:00:00Z"}],"metro_tram":[{"disruption_id":2}]}}`))
+	case r.URL.Path == "/v3/routes/99":
+		http.Error(w, "forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func newTestServer(t *testing.T, opts Options) (*Server, *upstream) {
+	t.Helper()
+	up := &upstream{hits: make(map[string]int)}
+	srv := httptest.NewServer(up)
+	t.Cleanup(srv.Close)
+
+	c := api.NewClient("1000001", "test-key")
+	c.BaseURL = srv.URL
+	if opts.Rate == 0 {
+		opts.Rate, opts.Burst = 100, 100
+	}
+	return New(c, opts), up
+}
+
+func get(s *Server, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthentication(t *testing.T) {
+	s, _ := newTestServer(t, Options{Tokens: map[string]string{"dashboard": "s3cret"}})
+
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{name: "no token", path: "/disruptions", want: http.StatusUnauthorized},
+		{name: "wrong token", path: "/disruptions", header: map[string]string{"Authorization": "Bearer nope"}, want: http.StatusUnauthorized},
+		{name: "bearer token", path: "/disruptions", header: map[string]string{"Authorization": "Bearer s3cret"}, want: http.StatusOK},
+		{name: "query token", path: "/disruptions?token=s3cret", want: http.StatusOK},
+		{name: "health check is open", path: "/healthz", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := get(s, tt.path, tt.header); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAccessLogHidesToken(t *testing.T) {
+	var logs bytes.Buffer
+	s, _ := newTestServer(t, Options{Tokens: map[string]string{"dashboard": "s3cret"}, Logger: log.New(&logs, "", 0)})
+
+	get(s, "/disruptions?token=s3cret&route_types=0", nil)
+	if strings.Contains(logs.String(), "s3cret") {
+		t.Errorf("access log leaks the token: %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "/disruptions?route_types=0&token=REDACTED") {
+		t.Errorf("access log = %q, want the masked request URI", logs.String())
+	}
+}
+
+func TestCORS(t *testing.T) {
+	s, _ := newTestServer(t, Options{Tokens: map[string]string{"app": "t"}, AllowOrigins: []string{"https://app.example"}})
+
+	req := httptest.NewRequest(http.MethodOptions, "/departures/1071", nil)
+	req.Header.Set("Origin", "https://app.example")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want 204", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the origin", got)
+	}
+
+	rec = get(s, "/disruptions", map[string]string{"Origin": "https://evil.example", "Authorization": "Bearer t"})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for a foreign origin, want none", got)
+	}
+}
+
+func TestDeparturesMergesModesAndCaches(t *testing.T) {
+	s, up := newTestServer(t, Options{})
+
+	for i := 0; i < 2; i++ {
+		rec := get(s, "/departures/1071?limit=5", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var resp api.DeparturesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Departures) != 2 || resp.Departures[0].RunRef != "tram" || resp.Departures[1].RunRef != "train" {
+			t.Errorf("departures = %+v, want tram then train", resp.Departures)
+		}
+	}
+
+	if n := up.hits["/v3/departures/route_type/1/stop/1071"]; n != 1 {
+		t.Errorf("upstream departures requested %d times, want 1 (cached)", n)
+	}
+	if n := up.hits["/v3/stops/1071/route_type/2"]; n != 1 {
+		t.Errorf("stop probed %d times, want 1 (route types cached)", n)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, _ := newTestServer(t, Options{})
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "stop name", path: "/departures/flinders", want: http.StatusBadRequest},
+		{name: "bad limit", path: "/departures/1071?limit=500", want: http.StatusBadRequest},
+		{name: "unknown stop", path: "/stops/5", want: http.StatusNotFound},
+		{name: "upstream not found", path: "/disruptions/7", want: http.StatusNotFound},
+		{name: "credentials refused", path: "/routes/99", want: http.StatusBadGateway},
+		{name: "no endpoint", path: "/nope", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(s, tt.path, nil)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body)
+			}
+			var body struct{ Error string }
+			if json.Unmarshal(rec.Body.Bytes(), &body); body.Error == "" {
+				t.Errorf("body %s has no error message", rec.Body)
+			}
+		})
+	}
+}
+
+func TestUnreachableUpstream(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	c := api.NewClient("3001234", "test-key")
+	c.BaseURL = srv.URL
+	var logs bytes.Buffer
+	s := New(c, Options{Rate: 100, Burst: 100, Logger: log.New(&logs, "", 0)})
+
+	rec := get(s, "/route-types", nil)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+	for name, text := range map[string]string{"body": rec.Body.String(), "log": logs.String()} {
+		if strings.Contains(text, "devid") || strings.Contains(text, "signature") {
+			t.Errorf("%s leaks the signed URL: %s", name, text)
+		}
+	}
+	if !strings.Contains(logs.String(), "upstream error") {
+		t.Errorf("log = %q, want the upstream error", logs.String())
+	}
+}
+
+func TestDisruptionsFlattened(t *testing.T) {
+	s, _ := newTestServer(t, Options{})
+	rec := get(s, "/disruptions", nil)
+	var body struct{ Disruptions []api.Disruption }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Disruptions) != 2 {
+		t.Errorf("got %d disruptions, want 2", len(body.Disruptions))
+	}
+}
+
+func TestICSFeeds(t *testing.T) {
+	s, _ := newTestServer(t, Options{})
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/disruptions?format=ics", []string{"X-WR-CALNAME:PTV disruptions", "UID:disruption-1@vic-ptv", "SUMMARY:Buses replace trains"}},
+		{"/departures/1071?format=ics", []string{"UID:departure-tram-1071-", "UID:departure-train-1071-", "DTSTART:20240115T210100Z"}},
+	}
+	for _, tt := range tests {
+		rec := get(s, tt.path, nil)
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Errorf("%s: Content-Type = %q, want text/calendar", tt.path, ct)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(rec.Body.String(), w) {
+				t.Errorf("%s: body has no %q:\n%s", tt.path, w, rec.Body)
+			}
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(2, 2, 600*time.Millisecond)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if d, err := l.reserve(); err != nil || d != 0 {
+			t.Fatalf("burst request %d: wait %s, err %v; want immediate", i, d, err)
+		}
+	}
+	if d, err := l.reserve(); err != nil || d != 500*time.Millisecond {
+		t.Errorf("third request: wait %s, err %v; want 500ms", d, err)
+	}
+	if _, err := l.reserve(); err != errRateLimited {
+		t.Errorf("fourth request: err %v, want rate limited", err)
+	}
+
+	now = now.Add(2 * time.Second)
+	if d, err := l.reserve(); err != nil || d != 0 {
+		t.Errorf("after refilling: wait %s, err %v; want immediate", d, err)
+	}
+}
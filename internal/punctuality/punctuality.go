@@ -0,0 +1,251 @@
+// Package punctuality records observed departures in a SQLite database and
+// reports how punctual services were.
+package punctuality
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// EarlyTolerance is how early a departure may leave and still be on time.
+const EarlyTolerance = time.Minute
+
+const schema = `
+CREATE TABLE IF NOT EXISTS departures (
+	run_ref    TEXT NOT NULL,
+	stop_id    INTEGER NOT NULL,
+	scheduled  INTEGER NOT NULL,
+	route_id   INTEGER NOT NULL,
+	route_type INTEGER NOT NULL,
+	route_name TEXT NOT NULL,
+	estimated  INTEGER,
+	final      INTEGER,
+	cancelled  INTEGER NOT NULL DEFAULT 0,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL,
+	PRIMARY KEY (run_ref, stop_id, scheduled)
+);
+CREATE INDEX IF NOT EXISTS departures_route ON departures (route_id, scheduled);
+`
+
+// DB is a database of observed departures. Each run is stored once per
+// stop, with its scheduled time, the first realtime estimate seen, and the
+// last estimate seen before it left, taken as its actual departure. Times
+// are stored as Unix seconds.
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it if needed.
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Record stores the departures from stopID in resp, seen at now, merging
+// them with earlier observations of the same runs. It returns how many
+// departures were stored.
+func (d *DB) Record(stopID int, resp *api.DeparturesResponse, now time.Time) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`
+		INSERT INTO departures (run_ref, stop_id, scheduled, route_id, route_type, route_name, estimated, final, cancelled, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (run_ref, stop_id, scheduled) DO UPDATE SET
+			route_name = excluded.route_name,
+			estimated  = coalesce(departures.estimated, excluded.estimated),
+			final      = coalesce(excluded.final, departures.final),
+			cancelled  = excluded.cancelled,
+			last_seen  = excluded.last_seen`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	for _, dep := range resp.Departures {
+		if dep.RunRef == "" || dep.ScheduledDepartureUTC == nil {
+			continue
+		}
+		route := resp.Routes[strconv.Itoa(dep.RouteID)]
+		name := route.RouteName
+		if route.RouteNumber != "" {
+			name = route.RouteNumber + " " + route.RouteName
+		}
+		if name == "" {
+			name = fmt.Sprintf("Route %d", dep.RouteID)
+		}
+		var estimated sql.NullInt64
+		if dep.EstimatedDepartureUTC != nil {
+			estimated = sql.NullInt64{Int64: dep.EstimatedDepartureUTC.Unix(), Valid: true}
+		}
+		cancelled := resp.Runs[dep.RunRef].Cancelled()
+		if _, err := stmt.Exec(dep.RunRef, stopID, dep.ScheduledDepartureUTC.Unix(), dep.RouteID, route.RouteType, name,
+			estimated, estimated, cancelled, now.Unix(), now.Unix()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// Filter selects the departures to report on. Zero fields select all.
+type Filter struct {
+	StopID  int
+	RouteID int
+	Since   time.Time
+}
+
+// Group summarises the departures sharing a route, hour or weekday.
+type Group struct {
+	Label      string `json:"label"`
+	Departures int    `json:"departures"`
+	// Measured counts the departures that ran and had a realtime estimate.
+	Measured  int     `json:"measured"`
+	OnTime    int     `json:"on_time"`
+	OnTimePct float64 `json:"on_time_pct"`
+	MeanDelay float64 `json:"mean_delay_seconds"`
+	Cancelled int     `json:"cancelled"`
+
+	totalDelay time.Duration
+}
+
+// Report is punctuality overall and grouped by route, by hour of day and by
+// weekday of the scheduled departure.
+type Report struct {
+	// Late is the delay from which a departure counts as late.
+	Late      time.Duration `json:"-"`
+	Total     Group         `json:"total"`
+	ByRoute   []Group       `json:"by_route"`
+	ByHour    []Group       `json:"by_hour"`
+	ByWeekday []Group       `json:"by_weekday"`
+}
+
+// Stats reports on the departures matching f that had left by now. A
+// departure is on time if it left no more than EarlyTolerance early and
+// less than late late. Hours and weekdays are in loc.
+func (d *DB) Stats(f Filter, late time.Duration, loc *time.Location, now time.Time) (*Report, error) {
+	q := `SELECT route_name, scheduled, final, cancelled FROM departures WHERE coalesce(final, scheduled) < ?`
+	args := []interface{}{now.Unix()}
+	if f.StopID > 0 {
+		q += ` AND stop_id = ?`
+		args = append(args, f.StopID)
+	}
+	if f.RouteID > 0 {
+		q += ` AND route_id = ?`
+		args = append(args, f.RouteID)
+	}
+	if !f.Since.IsZero() {
+		q += ` AND scheduled >= ?`
+		args = append(args, f.Since.Unix())
+	}
+	rows, err := d.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := &Report{Late: late, Total: Group{Label: "All"}}
+	routes := make(map[string]*Group)
+	hours := make(map[int]*Group)
+	weekdays := make(map[time.Weekday]*Group)
+	for rows.Next() {
+		var route string
+		var scheduled int64
+		var final sql.NullInt64
+		var cancelled bool
+		if err := rows.Scan(&route, &scheduled, &final, &cancelled); err != nil {
+			return nil, err
+		}
+		sched := time.Unix(scheduled, 0).In(loc)
+		groups := []*Group{
+			&r.Total,
+			group(routes, route, route),
+			group(hours, sched.Hour(), fmt.Sprintf("%02d:00", sched.Hour())),
+			group(weekdays, sched.Weekday(), sched.Weekday().String()),
+		}
+		for _, g := range groups {
+			g.add(cancelled, final, scheduled, late)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.Total.finish()
+	r.ByRoute = sorted(routes, func(a, b string) bool { return a < b })
+	r.ByHour = sorted(hours, func(a, b int) bool { return a < b })
+	r.ByWeekday = sorted(weekdays, func(a, b time.Weekday) bool { return (a+6)%7 < (b+6)%7 })
+	return r, nil
+}
+
+// group returns the group for key, creating it with label.
+func group[K comparable](groups map[K]*Group, key K, label string) *Group {
+	g, ok := groups[key]
+	if !ok {
+		g = &Group{Label: label}
+		groups[key] = g
+	}
+	return g
+}
+
+func (g *Group) add(cancelled bool, final sql.NullInt64, scheduled int64, late time.Duration) {
+	g.Departures++
+	switch {
+	case cancelled:
+		g.Cancelled++
+	case final.Valid:
+		delay := time.Duration(final.Int64-scheduled) * time.Second
+		g.Measured++
+		g.totalDelay += delay
+		if delay >= -EarlyTolerance && delay < late {
+			g.OnTime++
+		}
+	}
+}
+
+// finish computes the percentages and means.
+func (g *Group) finish() {
+	if g.Measured > 0 {
+		g.OnTimePct = 100 * float64(g.OnTime) / float64(g.Measured)
+		g.MeanDelay = g.totalDelay.Seconds() / float64(g.Measured)
+	}
+}
+
+// sorted returns the groups finished and ordered by key.
+func sorted[K comparable](groups map[K]*Group, less func(a, b K) bool) []Group {
+	keys := make([]K, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	out := make([]Group, 0, len(keys))
+	for _, k := range keys {
+		g := groups[k]
+		g.finish()
+		out = append(out, *g)
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package punctuality
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func ptr(t time.Time) *time.Time { return &t }
+
+// Monday 15 January 2024, 08:00 in Melbourne.
+var base = time.Date(2024, 1, 14, 21, 0, 0, 0, time.UTC)
+
+func dep(run string, routeID int, scheduled time.Duration, estimated *time.Duration) api.Departure {
+	d := api.Departure{RunRef: run, RouteID: routeID, ScheduledDepartureUTC: ptr(base.Add(scheduled))}
+	if estimated != nil {
+		d.EstimatedDepartureUTC = ptr(base.Add(*estimated))
+	}
+	return d
+}
+
+func dur(d time.Duration) *time.Duration { return &d }
+
+func TestRecordAndStats(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "p.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	routes := map[string]api.RouteInfo{"6": {RouteName: "Lilydale"}, "96": {RouteNumber: "96", RouteName: "East Brunswick - St Kilda Beach"}}
+	polls := []struct {
+		at   time.Duration
+		resp *api.DeparturesResponse
+	}{
+		{0, &api.DeparturesResponse{Routes: routes, Departures: []api.Departure{
+			dep("a", 6, 2*time.Minute, dur(3*time.Minute)),
+			dep("b", 6, 10*time.Minute, nil),
+			dep("c", 96, 5*time.Minute, nil),
+		}}},
+		// a slips to eight minutes late; b gets an estimate; c is cancelled.
+		{time.Minute, &api.DeparturesResponse{Routes: routes, Departures: []api.Departure{
+			dep("a", 6, 2*time.Minute, dur(10*time.Minute)),
+			dep("b", 6, 10*time.Minute, dur(10*time.Minute+30*time.Second)),
+			dep("c", 96, 5*time.Minute, nil),
+		}, Runs: map[string]api.RunInfo{"c": {Status: "Cancelled"}}}},
+		// d has not left by the time of the report.
+		{9 * time.Minute, &api.DeparturesResponse{Routes: routes, Departures: []api.Departure{
+			dep("b", 6, 10*time.Minute, dur(11*time.Minute)),
+			dep("d", 6, time.Hour, nil),
+		}}},
+	}
+	for _, p := range polls {
+		if _, err := db.Record(1071, p.resp, base.Add(p.at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loc, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.Stats(Filter{}, 5*time.Minute, loc, base.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := r.Total
+	if total.Departures != 3 || total.Cancelled != 1 || total.Measured != 2 || total.OnTime != 1 || total.OnTimePct != 50 {
+		t.Errorf("total = %+v, want 3 departures, 1 cancelled, 1 of 2 on time", total)
+	}
+	// a left 8 minutes late and b 1 minute late.
+	if total.MeanDelay != 270 {
+		t.Errorf("mean delay = %v seconds, want 270", total.MeanDelay)
+	}
+	if len(r.ByRoute) != 2 || r.ByRoute[0].Label != "96 East Brunswick - St Kilda Beach" || r.ByRoute[1].Label != "Lilydale" || r.ByRoute[1].Measured != 2 {
+		t.Errorf("by route = %+v", r.ByRoute)
+	}
+	if len(r.ByHour) != 1 || r.ByHour[0].Label != "08:00" {
+		t.Errorf("by hour = %+v, want 08:00 Melbourne time", r.ByHour)
+	}
+	if len(r.ByWeekday) != 1 || r.ByWeekday[0].Label != "Monday" {
+		t.Errorf("by weekday = %+v, want Monday", r.ByWeekday)
+	}
+
+	r, err = db.Stats(Filter{RouteID: 96}, 5*time.Minute, loc, base.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total.Departures != 1 || r.Total.Cancelled != 1 || r.Total.Measured != 0 {
+		t.Errorf("route 96 total = %+v, want just the cancellation", r.Total)
+	}
+}
+
+func TestGroupOnTime(t *testing.T) {
+	const scheduled = 1705352400
+	tests := []struct {
+		name  string
+		delay time.Duration
+		want  bool
+	}{
+		{name: "on schedule", delay: 0, want: true},
+		{name: "a minute early", delay: -time.Minute, want: true},
+		{name: "too early", delay: -time.Minute - time.Second, want: false},
+		{name: "just under late", delay: 5*time.Minute - time.Second, want: true},
+		{name: "late", delay: 5 * time.Minute, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g Group
+			g.add(false, sql.NullInt64{Int64: scheduled + int64(tt.delay/time.Second), Valid: true}, scheduled, 5*time.Minute)
+			if got := g.OnTime == 1; got != tt.want {
+				t.Errorf("on time = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
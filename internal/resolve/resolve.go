@@ -0,0 +1,116 @@
+// Package resolve matches stop and route names typed by the user against
+// PTV search results.
+package resolve
+
+import (
+	"strings"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// modeWords are words users put in route queries to name a transport mode,
+// mapped to the route types they select.
+var modeWords = map[string][]int{
+	"train": {0, 3},
+	"tram":  {1},
+	"bus":   {2, 4},
+	"coach": {4},
+	"vline": {3, 4},
+	"line":  {0, 3},
+	"route": nil,
+}
+
+// RouteQuery is a parsed route name such as "96", "tram 96" or
+// "Lilydale line".
+type RouteQuery struct {
+	// Term is the search term with mode words removed.
+	Term string
+	// RouteTypes restricts matches to these route types, if non-empty.
+	RouteTypes []int
+}
+
+// ParseRouteQuery splits mode words like "tram" or "line" out of s.
+func ParseRouteQuery(s string) RouteQuery {
+	var q RouteQuery
+	var words []string
+	for _, w := range strings.Fields(s) {
+		if types, ok := modeWords[strings.ToLower(w)]; ok {
+			q.RouteTypes = append(q.RouteTypes, types...)
+			continue
+		}
+		words = append(words, w)
+	}
+	q.Term = strings.Join(words, " ")
+	if q.Term == "" {
+		q.Term = strings.TrimSpace(s)
+	}
+	return q
+}
+
+// Stops returns the stops in results that best match name. Exact name
+// matches (ignoring case and a trailing "Station") win over partial ones.
+func Stops(results []api.ResultStop, name string) []api.ResultStop {
+	want := normalizeStopName(name)
+	var exact []api.ResultStop
+	for _, s := range results {
+		if normalizeStopName(s.StopName) == want {
+			exact = append(exact, s)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return results
+}
+
+// Routes returns the routes in results that match q. A term that equals a
+// route number matches on number alone; otherwise route names containing
+// the term match, with exact names preferred.
+func Routes(results []api.ResultRoute, q RouteQuery) []api.ResultRoute {
+	var candidates []api.ResultRoute
+	for _, r := range results {
+		if len(q.RouteTypes) > 0 && !containsInt(q.RouteTypes, r.RouteType) {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+
+	term := strings.ToLower(q.Term)
+	var byNumber, exact, partial []api.ResultRoute
+	for _, r := range candidates {
+		name := strings.ToLower(r.RouteName)
+		switch {
+		case r.RouteNumber != "" && strings.EqualFold(r.RouteNumber, q.Term):
+			byNumber = append(byNumber, r)
+		case name == term:
+			exact = append(exact, r)
+		case strings.Contains(name, term):
+			partial = append(partial, r)
+		}
+	}
+	switch {
+	case len(byNumber) > 0:
+		return byNumber
+	case len(exact) > 0:
+		return exact
+	}
+	return partial
+}
+
+// normalizeStopName lowercases a stop name and drops a trailing "Station"
+// or "Railway Station" so "Flinders Street" matches "Flinders Street Station".
+func normalizeStopName(s string) string {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	s = strings.TrimSuffix(s, " railway station")
+	s = strings.TrimSuffix(s, " station")
+	return s
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package resolve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+func TestParseRouteQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RouteQuery
+	}{
+		{in: "96", want: RouteQuery{Term: "96"}},
+		{in: "tram 96", want: RouteQuery{Term: "96", RouteTypes: []int{1}}},
+		{in: "route 96", want: RouteQuery{Term: "96"}},
+		{in: "Lilydale line", want: RouteQuery{Term: "Lilydale", RouteTypes: []int{0, 3}}},
+		{in: "route 903", want: RouteQuery{Term: "903"}},
+		{in: "tram", want: RouteQuery{Term: "tram", RouteTypes: []int{1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ParseRouteQuery(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRouteQuery(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStops(t *testing.T) {
+	results := []api.ResultStop{
+		{StopID: 1071, StopName: "Flinders Street Station", RouteType: 0},
+		{StopID: 2001, StopName: "Flinders St/Elizabeth St", RouteType: 1},
+		{StopID: 2002, StopName: "Flinders St/Swanston St", RouteType: 1},
+	}
+
+	got := Stops(results, "flinders street")
+	if len(got) != 1 || got[0].StopID != 1071 {
+		t.Errorf("Stops(exact) = %+v, want only 1071", got)
+	}
+
+	got = Stops(results, "Flinders St")
+	if len(got) != 3 {
+		t.Errorf("Stops(partial) returned %d stops, want all 3", len(got))
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	results := []api.ResultRoute{
+		{RouteID: 722, RouteNumber: "96", RouteName: "East Brunswick - St Kilda Beach", RouteType: 1},
+		{RouteID: 9, RouteName: "Lilydale", RouteType: 0},
+		{RouteID: 1, RouteName: "Alamein", RouteType: 0},
+		{RouteID: 13001, RouteNumber: "960", RouteName: "Lilydale Station - Mooroolbark", RouteType: 2},
+	}
+
+	tests := []struct {
+		name string
+		q    RouteQuery
+		want []int
+	}{
+		{name: "route number", q: ParseRouteQuery("96"), want: []int{722}},
+		{name: "train line name", q: ParseRouteQuery("Lilydale line"), want: []int{9}},
+		{name: "name without mode", q: ParseRouteQuery("Lilydale"), want: []int{9}},
+		{name: "partial name", q: ParseRouteQuery("lilyd"), want: []int{9, 13001}},
+		{name: "mode filters", q: ParseRouteQuery("bus lilydale station"), want: []int{13001}},
+		{name: "no match", q: ParseRouteQuery("Sandringham"), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, r := range Routes(results, tt.q) {
+				got = append(got, r.RouteID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Routes(%+v) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
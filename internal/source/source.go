@@ -0,0 +1,34 @@
+// Package source defines the timetable queries shared by the PTV API
+// client and the offline GTFS store, so commands can answer from either.
+package source
+
+import (
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+)
+
+// Source answers stop, route and scheduled departure queries. Both
+// *api.Client and *gtfs.Store implement it.
+type Source interface {
+	Search(term string, routeTypes []int) (*api.SearchResponse, error)
+	Stop(stopID, routeType int) (*api.StopResponse, error)
+	Routes(routeTypes []int) (*api.RoutesResponse, error)
+	Route(routeID int) (*api.RouteResponse, error)
+	Departures(routeType, stopID, maxResults int) (*api.DeparturesResponse, error)
+	RouteDepartures(routeType, stopID, routeID, directionID, maxResults int) (*api.DeparturesResponse, error)
+	DeparturesAt(routeType, stopID int, at time.Time, maxResults int) (*api.DeparturesResponse, error)
+	Pattern(runRef string, routeType int) (*api.PatternResponse, error)
+}
+
+// StopRouteTyper is implemented by sources that can list the route types
+// serving a stop directly, rather than by probing each one.
+type StopRouteTyper interface {
+	StopRouteTypes(stopID int) ([]int, error)
+}
+
+// DisruptionSource is implemented by sources that know the disruptions
+// affecting a stop. The offline timetable has none.
+type DisruptionSource interface {
+	DisruptionsByStop(stopID int) (*api.DisruptionsResponse, error)
+}
@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// keyCode identifies a key press. Printable characters are keyRune.
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyEsc
+	keyBackspace
+	keyTab
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPgUp
+	keyPgDn
+	keyHome
+	keyEnd
+	keyCtrlC
+	keyCtrlD
+	keyUnknown
+)
+
+// key is a single key press.
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// parseKeys decodes a chunk of raw terminal input into key presses. A lone
+// ESC byte at the end of a chunk is the Escape key; otherwise ESC starts a
+// CSI or SS3 sequence.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			if len(b) == 1 {
+				keys = append(keys, key{code: keyEsc})
+				b = b[1:]
+				continue
+			}
+			k, n := parseEscape(b)
+			keys = append(keys, k)
+			b = b[n:]
+		case c == '\r' || c == '\n':
+			keys = append(keys, key{code: keyEnter})
+			b = b[1:]
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+			b = b[1:]
+		case c == '\t':
+			keys = append(keys, key{code: keyTab})
+			b = b[1:]
+		case c == 0x03:
+			keys = append(keys, key{code: keyCtrlC})
+			b = b[1:]
+		case c == 0x04:
+			keys = append(keys, key{code: keyCtrlD})
+			b = b[1:]
+		case c < 0x20:
+			keys = append(keys, key{code: keyUnknown})
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			keys = append(keys, key{code: keyRune, r: r})
+			b = b[n:]
+		}
+	}
+	return keys
+}
+
+// parseEscape decodes an escape sequence at the start of b, returning the
+// key and the number of bytes consumed.
+func parseEscape(b []byte) (key, int) {
+	if b[1] != '[' && b[1] != 'O' {
+		// Alt+key: treat as Escape followed by the key on the next pass.
+		return key{code: keyEsc}, 1
+	}
+	// Find the final byte of the sequence (0x40–0x7e).
+	end := 2
+	for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+		end++
+	}
+	if end == len(b) {
+		return key{code: keyUnknown}, len(b)
+	}
+	params := string(b[2:end])
+	switch b[end] {
+	case 'A':
+		return key{code: keyUp}, end + 1
+	case 'B':
+		return key{code: keyDown}, end + 1
+	case 'C':
+		return key{code: keyRight}, end + 1
+	case 'D':
+		return key{code: keyLeft}, end + 1
+	case 'H':
+		return key{code: keyHome}, end + 1
+	case 'F':
+		return key{code: keyEnd}, end + 1
+	case '~':
+		switch params {
+		case "1", "7":
+			return key{code: keyHome}, end + 1
+		case "4", "8":
+			return key{code: keyEnd}, end + 1
+		case "5":
+			return key{code: keyPgUp}, end + 1
+		case "6":
+			return key{code: keyPgDn}, end + 1
+		}
+	}
+	return key{code: keyUnknown}, end + 1
+}
+
+// readKeys reads raw input from r and sends decoded key presses on keys
+// until r fails.
+func readKeys(r io.Reader, keys chan<- key) {
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		for _, k := range parseKeys(buf[:n]) {
+			keys <- k
+		}
+		if err != nil {
+			close(keys)
+			return
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []key
+	}{
+		{name: "text", in: "96", want: []key{{code: keyRune, r: '9'}, {code: keyRune, r: '6'}}},
+		{name: "non-ascii", in: "é", want: []key{{code: keyRune, r: 'é'}}},
+		{name: "enter", in: "\r", want: []key{{code: keyEnter}}},
+		{name: "backspace", in: "\x7f", want: []key{{code: keyBackspace}}},
+		{name: "lone escape", in: "\x1b", want: []key{{code: keyEsc}}},
+		{name: "arrows", in: "\x1b[A\x1b[B\x1bOC", want: []key{{code: keyUp}, {code: keyDown}, {code: keyRight}}},
+		{name: "page keys", in: "\x1b[5~\x1b[6~", want: []key{{code: keyPgUp}, {code: keyPgDn}}},
+		{name: "home end", in: "\x1b[H\x1b[4~", want: []key{{code: keyHome}, {code: keyEnd}}},
+		{name: "ctrl keys", in: "\x03\x04", want: []key{{code: keyCtrlC}, {code: keyCtrlD}}},
+		{name: "alt key", in: "\x1bx", want: []key{{code: keyEsc}, {code: keyRune, r: 'x'}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseKeys([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeys(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package tui implements the interactive full-screen interface: a search
+// box with drill-down views for stops, routes and disruptions.
+package tui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+)
+
+// view is one screen in the navigation stack.
+type view interface {
+	// title is shown in the header bar.
+	title() string
+	// help lists the view's key bindings for the footer.
+	help() string
+	// load returns background work that fetches the view's data, or nil if
+	// there is nothing to fetch. The work returns a function that stores the
+	// result in the view; it is run on the UI goroutine.
+	load(c *api.Client) func() (func(), error)
+	// refreshEvery is how often the view reloads itself, or 0 for never.
+	refreshEvery() time.Duration
+	// render draws the view's content area.
+	render(width, height int) []string
+	// handle processes a key press.
+	handle(k key) command
+}
+
+// command is what a view asks the app to do in response to a key press.
+type command struct {
+	push   view
+	pop    bool
+	reload bool
+	quit   bool
+}
+
+// viewState tracks loading for a view.
+type viewState struct {
+	loading  bool
+	err      error
+	loadedAt time.Time
+}
+
+// loadResult is the outcome of a view's background load.
+type loadResult struct {
+	v     view
+	apply func()
+	err   error
+}
+
+// App is the interactive full-screen interface.
+type App struct {
+	client  *api.Client
+	screen  *display.Screen
+	stack   []view
+	state   map[view]*viewState
+	results chan loadResult
+	// done is closed when Run returns, so fetches still in flight can
+	// give up sending their results.
+	done chan struct{}
+}
+
+// New creates an app that queries the API with client.
+func New(client *api.Client) *App {
+	return &App{
+		client:  client,
+		screen:  display.NewScreen(),
+		state:   make(map[view]*viewState),
+		results: make(chan loadResult),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run takes over the terminal until the user quits or ctx is cancelled.
+func (a *App) Run(ctx context.Context) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("the interactive interface requires a terminal")
+	}
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("switching terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, old)
+	defer close(a.done)
+
+	a.screen.Enter()
+	defer a.screen.Exit()
+
+	keys := make(chan key)
+	go readKeys(os.Stdin, keys)
+
+	a.push(newSearchView())
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		a.draw()
+		select {
+		case <-ctx.Done():
+			return nil
+		case k, ok := <-keys:
+			if !ok || k.code == keyCtrlC {
+				return nil
+			}
+			if a.dispatch(k) {
+				return nil
+			}
+		case res := <-a.results:
+			st := a.stateOf(res.v)
+			st.loading = false
+			st.err = res.err
+			if res.err == nil {
+				res.apply()
+				st.loadedAt = time.Now()
+			}
+		case <-ticker.C:
+			top := a.top()
+			st := a.stateOf(top)
+			if every := top.refreshEvery(); every > 0 && !st.loading && !st.loadedAt.IsZero() && time.Since(st.loadedAt) >= every {
+				a.load(top)
+			}
+		}
+	}
+}
+
+// dispatch sends a key to the current view and carries out the resulting
+// command. It reports whether the app should quit.
+func (a *App) dispatch(k key) bool {
+	cmd := a.top().handle(k)
+	switch {
+	case cmd.quit:
+		return true
+	case cmd.push != nil:
+		a.push(cmd.push)
+	case cmd.pop:
+		if len(a.stack) == 1 {
+			return true
+		}
+		delete(a.state, a.top())
+		a.stack = a.stack[:len(a.stack)-1]
+	case cmd.reload:
+		a.load(a.top())
+	}
+	return false
+}
+
+func (a *App) top() view {
+	return a.stack[len(a.stack)-1]
+}
+
+func (a *App) stateOf(v view) *viewState {
+	st, ok := a.state[v]
+	if !ok {
+		st = &viewState{}
+		a.state[v] = st
+	}
+	return st
+}
+
+func (a *App) push(v view) {
+	a.stack = append(a.stack, v)
+	a.load(v)
+}
+
+// load starts v's background fetch, if it has one.
+func (a *App) load(v view) {
+	work := v.load(a.client)
+	if work == nil {
+		return
+	}
+	st := a.stateOf(v)
+	st.loading = true
+	go func() {
+		apply, err := work()
+		select {
+		case a.results <- loadResult{v: v, apply: apply, err: err}:
+		case <-a.done:
+		}
+	}()
+}
+
+// draw renders the header, current view and footer.
+func (a *App) draw() {
+	width, height := display.TerminalSize()
+	v := a.top()
+	st := a.stateOf(v)
+
+	crumbs := make([]string, len(a.stack))
+	for i, s := range a.stack {
+		crumbs[i] = s.title()
+	}
+	clock := display.FormatTime(time.Now())
+	header := display.Truncate(" vic-ptv › "+strings.Join(crumbs, " › "), width-len(clock)-2)
+	header += strings.Repeat(" ", max(width-display.StringWidth(header)-len(clock)-1, 0)) + clock + " "
+
+	status := ""
+	switch {
+	case st.loading:
+		status = "Loading…"
+	case st.err != nil:
+		status = "Error: " + st.err.Error()
+	case !st.loadedAt.IsZero() && v.refreshEvery() > 0:
+		next := max(v.refreshEvery()-time.Since(st.loadedAt), 0).Round(time.Second)
+		status = fmt.Sprintf("Updated %s · refreshing in %s", display.FormatTime(st.loadedAt), next)
+	}
+
+	lines := []string{display.Reverse(header)}
+	body := v.render(width, max(height-4, 1))
+	lines = append(lines, body...)
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines,
+		display.Truncate(" "+status, width),
+		display.Dim(display.Truncate(" "+v.help(), width)))
+	a.screen.Draw(lines)
+}
+
+// capture runs a display renderer and returns its output as lines.
+func capture(render func()) []string {
+	var buf bytes.Buffer
+	display.SetOutput(&buf)
+	defer display.SetOutput(os.Stdout)
+	render()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
@@ -0,0 +1,492 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bls/vic-ptv-cli/internal/api"
+	"github.com/bls/vic-ptv-cli/internal/display"
+)
+
+// Auto-refresh intervals for live views.
+const (
+	departuresRefresh  = 30 * time.Second
+	disruptionsRefresh = 2 * time.Minute
+)
+
+// scroller keeps track of the scroll position of a text view.
+type scroller struct {
+	offset int
+	height int
+	total  int
+}
+
+// window returns the lines visible at the current scroll position.
+func (s *scroller) window(lines []string, height int) []string {
+	s.height, s.total = height, len(lines)
+	s.offset = max(min(s.offset, len(lines)-height), 0)
+	return lines[s.offset:min(s.offset+height, len(lines))]
+}
+
+// scroll moves the view for navigation keys, reporting whether k was one.
+func (s *scroller) scroll(k key) bool {
+	switch k.code {
+	case keyUp:
+		s.offset--
+	case keyDown:
+		s.offset++
+	case keyPgUp:
+		s.offset -= max(s.height-1, 1)
+	case keyPgDn:
+		s.offset += max(s.height-1, 1)
+	case keyHome:
+		s.offset = 0
+	case keyEnd:
+		s.offset = s.total
+	default:
+		return false
+	}
+	s.offset = max(s.offset, 0)
+	return true
+}
+
+// item is an entry in a selectable list.
+type item struct {
+	label string
+	open  func() view
+}
+
+// selector tracks the selected entry of a list and keeps it in view.
+type selector struct {
+	selected int
+	offset   int
+	height   int
+}
+
+// move changes the selection for navigation keys, reporting whether k was one.
+func (s *selector) move(k key, n int) bool {
+	switch k.code {
+	case keyUp:
+		s.selected--
+	case keyDown:
+		s.selected++
+	case keyPgUp:
+		s.selected -= max(s.height-1, 1)
+	case keyPgDn:
+		s.selected += max(s.height-1, 1)
+	case keyHome:
+		s.selected = 0
+	case keyEnd:
+		s.selected = n - 1
+	default:
+		return false
+	}
+	s.selected = max(min(s.selected, n-1), 0)
+	return true
+}
+
+// render draws items, highlighting the selection when focused.
+func (s *selector) render(items []item, width, height int, focused bool) []string {
+	s.height = height
+	if s.selected < s.offset {
+		s.offset = s.selected
+	}
+	if s.selected >= s.offset+height {
+		s.offset = s.selected - height + 1
+	}
+	var lines []string
+	for i := s.offset; i < len(items) && i < s.offset+height; i++ {
+		line := display.Truncate(" "+items[i].label, width-1)
+		if i == s.selected && focused {
+			line = display.Reverse(line + strings.Repeat(" ", max(width-display.StringWidth(line), 0)))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// searchView is the home screen: a search box over a list of matching
+// stops and routes.
+type searchView struct {
+	input     string
+	query     string
+	searched  bool
+	items     []item
+	list      selector
+	listFocus bool
+}
+
+func newSearchView() *searchView {
+	return &searchView{}
+}
+
+func (v *searchView) title() string { return "Search" }
+
+func (v *searchView) help() string {
+	if v.listFocus {
+		return "↑/↓ select · Enter open · type to search · D disruptions · Esc back to search · Ctrl-C quit"
+	}
+	return "Type a stop or route and press Enter · ↓ results · Ctrl-D network disruptions · Esc quit"
+}
+
+func (v *searchView) refreshEvery() time.Duration { return 0 }
+
+func (v *searchView) load(c *api.Client) func() (func(), error) {
+	if v.query == "" {
+		return nil
+	}
+	query := v.query
+	return func() (func(), error) {
+		resp, err := c.Search(query, nil)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			v.items = searchItems(resp)
+			v.searched = true
+			v.list = selector{}
+			v.listFocus = len(v.items) > 0
+		}, nil
+	}
+}
+
+// searchItems converts search results into list entries that open the
+// matching stop or route.
+func searchItems(resp *api.SearchResponse) []item {
+	var items []item
+	for _, s := range resp.Stops {
+		s := s
+		items = append(items, item{
+			label: fmt.Sprintf("%-12s %s (%s)", display.RouteTypeName(s.RouteType)+" stop", s.StopName, s.StopSuburb),
+			open:  func() view { return newStopView(s.StopID, s.RouteType, s.StopName) },
+		})
+	}
+	for _, r := range resp.Routes {
+		r := r
+		name := r.RouteName
+		if r.RouteNumber != "" {
+			name = r.RouteNumber + " - " + r.RouteName
+		}
+		items = append(items, item{
+			label: fmt.Sprintf("%-12s %s", display.RouteTypeName(r.RouteType)+" route", name),
+			open:  func() view { return newRouteView(r.RouteID, name) },
+		})
+	}
+	return items
+}
+
+func (v *searchView) render(width, height int) []string {
+	cursor := display.Reverse(" ")
+	if v.listFocus {
+		cursor = ""
+	}
+	lines := []string{" Search: " + v.input + cursor, ""}
+	switch {
+	case len(v.items) > 0:
+		lines = append(lines, v.list.render(v.items, width, height-len(lines), v.listFocus)...)
+	case v.searched:
+		lines = append(lines, " No stops or routes found.")
+	default:
+		lines = append(lines, " Search for a stop (\"Flinders Street\") or route (\"96\"), then press Enter.")
+	}
+	return lines
+}
+
+func (v *searchView) handle(k key) command {
+	if k.code == keyCtrlD || v.listFocus && k.code == keyRune && k.r == 'D' {
+		return command{push: newDisruptionsView(disruptionScope{})}
+	}
+	if v.listFocus {
+		switch {
+		case k.code == keyEnter:
+			if len(v.items) > 0 {
+				return command{push: v.items[v.list.selected].open()}
+			}
+		case k.code == keyUp && v.list.selected == 0, k.code == keyEsc, k.code == keyTab:
+			v.listFocus = false
+		case v.list.move(k, len(v.items)):
+		case k.code == keyRune, k.code == keyBackspace:
+			v.listFocus = false
+			return v.edit(k)
+		}
+		return command{}
+	}
+	switch k.code {
+	case keyEsc:
+		return command{quit: true}
+	case keyEnter:
+		v.query = strings.TrimSpace(v.input)
+		return command{reload: v.query != ""}
+	case keyDown, keyTab:
+		v.listFocus = len(v.items) > 0
+		return command{}
+	}
+	return v.edit(k)
+}
+
+// edit applies a key press to the search box.
+func (v *searchView) edit(k key) command {
+	switch k.code {
+	case keyBackspace:
+		if r := []rune(v.input); len(r) > 0 {
+			v.input = string(r[:len(r)-1])
+		}
+	case keyRune:
+		if k.r >= ' ' {
+			v.input += string(k.r)
+		}
+	}
+	return command{}
+}
+
+// stopView shows a stop's details with live departures.
+type stopView struct {
+	stopID    int
+	routeType int
+	name      string
+	stop      *api.StopResponse
+	deps      *api.DeparturesResponse
+	scroll    scroller
+}
+
+func newStopView(stopID, routeType int, name string) *stopView {
+	return &stopView{stopID: stopID, routeType: routeType, name: name}
+}
+
+func (v *stopView) title() string { return v.name }
+
+func (v *stopView) help() string {
+	return "↑/↓ scroll · d disruptions · r refresh · Esc back · Ctrl-C quit"
+}
+
+func (v *stopView) refreshEvery() time.Duration { return departuresRefresh }
+
+func (v *stopView) load(c *api.Client) func() (func(), error) {
+	return func() (func(), error) {
+		stop, err := c.Stop(v.stopID, v.routeType)
+		if err != nil {
+			return nil, err
+		}
+		deps, err := c.Departures(v.routeType, v.stopID, 3)
+		if err != nil {
+			return nil, err
+		}
+		return func() { v.stop, v.deps = stop, deps }, nil
+	}
+}
+
+func (v *stopView) render(width, height int) []string {
+	if v.stop == nil {
+		return nil
+	}
+	lines := capture(func() {
+		display.DeparturesList(v.deps)
+	})
+	lines = append([]string{"Departures:", ""}, lines...)
+	lines = append(lines, "")
+	lines = append(lines, capture(func() { display.StopDetail(v.stop) })...)
+	return v.scroll.window(lines, height)
+}
+
+func (v *stopView) handle(k key) command {
+	switch {
+	case v.scroll.scroll(k):
+	case k.code == keyEsc, k.code == keyBackspace, k.code == keyLeft:
+		return command{pop: true}
+	case k.code == keyRune && k.r == 'd':
+		return command{push: newDisruptionsView(disruptionScope{stopID: v.stopID, name: v.name})}
+	case k.code == keyRune && k.r == 'r':
+		return command{reload: true}
+	case k.code == keyRune && k.r == 'q':
+		return command{quit: true}
+	}
+	return command{}
+}
+
+// routeView shows a route's details and its current disruptions.
+type routeView struct {
+	routeID     int
+	name        string
+	route       *api.RouteResponse
+	disruptions []api.Disruption
+	scroll      scroller
+}
+
+func newRouteView(routeID int, name string) *routeView {
+	return &routeView{routeID: routeID, name: name}
+}
+
+func (v *routeView) title() string { return v.name }
+
+func (v *routeView) help() string {
+	return "↑/↓ scroll · d disruption list · r refresh · Esc back · Ctrl-C quit"
+}
+
+func (v *routeView) refreshEvery() time.Duration { return disruptionsRefresh }
+
+func (v *routeView) load(c *api.Client) func() (func(), error) {
+	return func() (func(), error) {
+		route, err := c.Route(v.routeID)
+		if err != nil {
+			return nil, err
+		}
+		dis, err := c.DisruptionsByRoute(v.routeID)
+		if err != nil {
+			return nil, err
+		}
+		return func() { v.route, v.disruptions = route, dis.Disruptions.AllDisruptions() }, nil
+	}
+}
+
+func (v *routeView) render(width, height int) []string {
+	if v.route == nil {
+		return nil
+	}
+	lines := capture(func() { display.RouteDetail(v.route) })
+	lines = append(lines, "", "Disruptions:", "")
+	lines = append(lines, capture(func() { display.DisruptionsList(v.disruptions) })...)
+	return v.scroll.window(lines, height)
+}
+
+func (v *routeView) handle(k key) command {
+	switch {
+	case v.scroll.scroll(k):
+	case k.code == keyEsc, k.code == keyBackspace, k.code == keyLeft:
+		return command{pop: true}
+	case k.code == keyRune && k.r == 'd':
+		return command{push: newDisruptionsView(disruptionScope{routeID: v.routeID, name: v.name})}
+	case k.code == keyRune && k.r == 'r':
+		return command{reload: true}
+	case k.code == keyRune && k.r == 'q':
+		return command{quit: true}
+	}
+	return command{}
+}
+
+// disruptionScope selects which disruptions a disruptionsView lists. The
+// zero value means the whole network.
+type disruptionScope struct {
+	routeID int
+	stopID  int
+	name    string
+}
+
+// disruptionsView is a selectable list of disruptions.
+type disruptionsView struct {
+	scope disruptionScope
+	items []item
+	list  selector
+	empty bool
+}
+
+func newDisruptionsView(scope disruptionScope) *disruptionsView {
+	return &disruptionsView{scope: scope}
+}
+
+func (v *disruptionsView) title() string {
+	if v.scope.name != "" {
+		return "Disruptions: " + v.scope.name
+	}
+	return "Disruptions"
+}
+
+func (v *disruptionsView) help() string {
+	return "↑/↓ select · Enter details · r refresh · Esc back · Ctrl-C quit"
+}
+
+func (v *disruptionsView) refreshEvery() time.Duration { return disruptionsRefresh }
+
+func (v *disruptionsView) load(c *api.Client) func() (func(), error) {
+	scope := v.scope
+	return func() (func(), error) {
+		var (
+			resp *api.DisruptionsResponse
+			err  error
+		)
+		switch {
+		case scope.routeID != 0:
+			resp, err = c.DisruptionsByRoute(scope.routeID)
+		case scope.stopID != 0:
+			resp, err = c.DisruptionsByStop(scope.stopID)
+		default:
+			resp, err = c.Disruptions()
+		}
+		if err != nil {
+			return nil, err
+		}
+		var items []item
+		for _, d := range resp.Disruptions.AllDisruptions() {
+			d := d
+			items = append(items, item{
+				label: fmt.Sprintf("%-9s %s", d.DisruptionStatus, display.PlainText(d.Title)),
+				open:  func() view { return newDisruptionView(d) },
+			})
+		}
+		return func() {
+			v.items = items
+			v.empty = len(items) == 0
+			v.list.selected = min(v.list.selected, max(len(items)-1, 0))
+		}, nil
+	}
+}
+
+func (v *disruptionsView) render(width, height int) []string {
+	if v.empty {
+		return []string{" No current disruptions."}
+	}
+	return v.list.render(v.items, width, height, true)
+}
+
+func (v *disruptionsView) handle(k key) command {
+	switch {
+	case v.list.move(k, len(v.items)):
+	case k.code == keyEnter:
+		if len(v.items) > 0 {
+			return command{push: v.items[v.list.selected].open()}
+		}
+	case k.code == keyEsc, k.code == keyBackspace, k.code == keyLeft:
+		return command{pop: true}
+	case k.code == keyRune && k.r == 'r':
+		return command{reload: true}
+	case k.code == keyRune && k.r == 'q':
+		return command{quit: true}
+	}
+	return command{}
+}
+
+// disruptionView shows the full text of one disruption.
+type disruptionView struct {
+	d      api.Disruption
+	scroll scroller
+}
+
+func newDisruptionView(d api.Disruption) *disruptionView {
+	return &disruptionView{d: d}
+}
+
+func (v *disruptionView) title() string { return fmt.Sprintf("Disruption %d", v.d.DisruptionID) }
+
+func (v *disruptionView) help() string { return "↑/↓ scroll · Esc back · Ctrl-C quit" }
+
+func (v *disruptionView) refreshEvery() time.Duration { return 0 }
+
+func (v *disruptionView) load(c *api.Client) func() (func(), error) { return nil }
+
+func (v *disruptionView) render(width, height int) []string {
+	lines := capture(func() {
+		display.DisruptionDetail(v.d)
+	})
+	return v.scroll.window(lines, height)
+}
+
+func (v *disruptionView) handle(k key) command {
+	switch {
+	case v.scroll.scroll(k):
+	case k.code == keyEsc, k.code == keyBackspace, k.code == keyLeft:
+		return command{pop: true}
+	case k.code == keyRune && k.r == 'q':
+		return command{quit: true}
+	}
+	return command{}
+}
@@ -1,6 +1,12 @@
 package main
 
-import "github.com/bls/vic-ptv-cli/cmd"
+import (
+	// Embed the timezone database so Melbourne times display correctly in
+	// minimal containers without /usr/share/zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/bls/vic-ptv-cli/cmd"
+)
 
 var (
 	version = "dev"